@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 画像を使わないアクセシブルな出題 ---
+
+// 目の不自由なプレイヤーやスクリーンリーダーの利用者向けに、
+// 画像を見なくても文章だけで答えられるヒント（種族値・タイプ・図鑑の説明文）と代替テキストを問題に加えます。
+
+// 図鑑の説明文に含まれるポケモン名を伏せるときの文字列
+const hiddenNameMask = "？？？"
+
+// addAccessibleHints は、問題に文章だけで答えられるヒントと代替テキストを追加します。
+func addAccessibleHints(question gin.H, pokemon *Pokemon) {
+	flavorText := strings.ReplaceAll(pokemon.FlavorText, pokemon.Name, hiddenNameMask)
+
+	question["accessible"] = true
+	question["stats"] = pokemon.Stats
+	question["types"] = pokemon.Types
+	question["flavorText"] = flavorText
+	question["altText"] = describeForScreenReader(pokemon, flavorText)
+}
+
+// describeForScreenReader は、画像の代わりに読み上げる問題の説明文を組み立てます。
+func describeForScreenReader(pokemon *Pokemon, flavorText string) string {
+	s := pokemon.Stats
+	var b strings.Builder
+	fmt.Fprintf(&b, "タイプは%s。", strings.Join(pokemon.Types, "・"))
+	fmt.Fprintf(&b, "種族値はHP %d、こうげき %d、ぼうぎょ %d、とくこう %d、とくぼう %d、すばやさ %d、合計 %d。",
+		s.HP, s.Attack, s.Defense, s.SpAttack, s.SpDefense, s.Speed, s.Total())
+	fmt.Fprintf(&b, "高さ %.1fメートル、重さ %.1fキログラム。", pokemon.Height, pokemon.Weight)
+	if flavorText != "" {
+		fmt.Fprintf(&b, "図鑑の説明：%s", flavorText)
+	}
+	return b.String()
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- クイズの行動記録（イベントソーシング） ---
+
+// 出題・回答・ヒントの利用・スキップを、書き換えない行動記録として追記していきます。
+// 成績のランキングはこの記録を先頭から順に集計（プロジェクション）して作るので、
+// 得点のルールを変えても、過去の記録から集計し直せます。
+// 記録の書き込みはバッファに積んでまとめて行い、いっぱいのときは記録を捨てずにその場で書き込みます。
+// 終了するときは、バッファに残っている記録を書き出してから止めます（shutdown.go）。
+
+const (
+	activityTypeQuestionServed  = "question_served"
+	activityTypeAnswerSubmitted = "answer_submitted"
+	activityTypeHintUsed        = "hint_used"
+	activityTypeQuestionSkipped = "question_skipped"
+)
+
+const (
+	activityBufferSize    = 1024
+	activityBatchSize     = 100
+	activityFlushInterval = time.Second
+	activityLeaderboard   = 50   // ランキングの最大件数
+	activityReplayBatch   = 1000 // 集計し直すときに一度に読み込む件数
+	// 抜けているIDの記録を待つ時間。ID の順と書き込みが確定する順は前後することがあるので、
+	// 抜けているIDはこの時間だけ読み込み直し、それでも現れなければ（書き込みが取り消されたなど）あきらめる
+	activityGapTimeout = time.Minute
+	activityMaxGap     = 10000 // これより多くIDが飛んだときは抜けとして追わない
+)
+
+// --- データベースモデル ---
+
+// 1件の行動記録。追記のみで、更新・削除はしない
+type ActivityEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	Type      string    `gorm:"index;not null"`
+	UserID    uint      `gorm:"index"` // ログインしていなければ 0
+	PokemonID int
+	Mode      string
+	Pack      string // コンテンツパックの問題なら名前（ポケモンなら空）
+	Source    string // quiz / daily / session など、どこでの出題・回答か
+	Correct   bool   // answer_submitted のみ
+	// 公式でないクライアントからの回答（answer_submitted のみ。attestation.go を参照）
+	Unofficial bool
+}
+
+// バッファに積んでまとめて書き込む行動記録
+type activityLog struct {
+	events chan ActivityEvent
+	done   chan struct{}
+	mu     sync.RWMutex // closed と events への送信を守る
+	closed bool
+}
+
+// main で書き込みを開始するまでは nil（その間は同期的に書き込む）
+var activity *activityLog
+
+// startActivityLog は、行動記録を書き込むワーカーを起動します。
+func startActivityLog() *activityLog {
+	l := &activityLog{events: make(chan ActivityEvent, activityBufferSize), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+func (l *activityLog) run() {
+	ticker := time.NewTicker(activityFlushInterval)
+	defer ticker.Stop()
+	batch := make([]ActivityEvent, 0, activityBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		restoreGate.RLock()
+		defer restoreGate.RUnlock()
+		if err := db.CreateInBatches(batch, activityBatchSize).Error; err != nil {
+			log.Printf("Failed to write %d activity events: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-l.events:
+			if !ok {
+				flush()
+				close(l.done)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= activityBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// close は、新しい記録の受け付けをやめ、バッファに残っている記録を書き出すまで待ちます。
+// close の後の記録は、その場で書き込まれます。
+func (l *activityLog) close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		<-l.done
+		return
+	}
+	l.closed = true
+	close(l.events)
+	l.mu.Unlock()
+	<-l.done
+}
+
+// enqueue は、記録をバッファに積みます。バッファがいっぱいか、止めた後なら false を返します。
+func (l *activityLog) enqueue(e ActivityEvent) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return false
+	}
+	select {
+	case l.events <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordActivity は、行動記録を追記します。
+// バッファに積めないとき（書き込みの開始前・バッファがいっぱい・終了処理の後）は、その場で書き込みます。
+func recordActivity(e ActivityEvent) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if activity != nil && activity.enqueue(e) {
+		return
+	}
+	restoreGate.RLock()
+	defer restoreGate.RUnlock()
+	if err := db.Create(&e).Error; err != nil {
+		log.Printf("Failed to write activity event: %v", err)
+	}
+}
+
+// recordQuestionServed は、出題したことを記録します。hinted ならヒントの利用も記録します。
+func recordQuestionServed(userID uint, pokemonID int, mode, pack, source string, hinted bool) {
+	recordActivity(ActivityEvent{Type: activityTypeQuestionServed, UserID: userID, PokemonID: pokemonID, Mode: mode, Pack: pack, Source: source})
+	if hinted {
+		recordActivity(ActivityEvent{Type: activityTypeHintUsed, UserID: userID, PokemonID: pokemonID, Mode: mode, Pack: pack, Source: source})
+	}
+}
+
+// recordAnswerSubmitted は、回答したことを記録します。
+// 公式のクライアントからの回答でなければ、その印を付けて記録します。
+// 応答に含めるため、この回答でランキングに加わるXPを返します（集計の対象外の回答なら ok が false）。
+func recordAnswerSubmitted(c *gin.Context, userID uint, pokemonID int, mode, pack, source string, isCorrect bool) (xpAward, bool) {
+	e := ActivityEvent{CreatedAt: time.Now(), Type: activityTypeAnswerSubmitted, UserID: userID, PokemonID: pokemonID, Mode: mode, Pack: pack, Source: source, Correct: isCorrect, Unofficial: unofficialClient(c)}
+	recordActivity(e)
+	if userID == 0 || pack != "" {
+		return xpAward{}, false
+	}
+	return answerXP(currentScoringRules, e), true
+}
+
+// recordQuestionSkipped は、問題のスキップを記録します。
+func recordQuestionSkipped(userID uint, pokemonID int, mode, pack, source string) {
+	recordActivity(ActivityEvent{Type: activityTypeQuestionSkipped, UserID: userID, PokemonID: pokemonID, Mode: mode, Pack: pack, Source: source})
+}
+
+// --- プロジェクション ---
+
+// 得点のルール
+type scoringRules struct {
+	PerAnswer  int `json:"xpPerAnswer"`
+	PerCorrect int `json:"xpPerCorrect"`
+}
+
+// 現在の得点のルール（userXP と同じ）
+var currentScoringRules = scoringRules{PerAnswer: xpPerAnswer, PerCorrect: xpPerCorrect}
+
+// 行動記録から集計したユーザーごとの成績
+type activityTotals struct {
+	UserID        uint `json:"userId"`
+	Questions     int  `json:"questions"`
+	Correct       int  `json:"correct"`
+	HintsUsed     int  `json:"hintsUsed"`
+	Skipped       int  `json:"skipped"`
+	CurrentStreak int  `json:"currentStreak"`
+	BestStreak    int  `json:"bestStreak"`
+	XP            int  `json:"xp"`
+	// 公式でないクライアントからの回答の数
+	UnofficialAnswers int `json:"unofficialAnswers"`
+	// 最後に回答・スキップした時刻（活動量で重み付けしたランキングに使う）
+	LastActiveAt time.Time `json:"lastActiveAt"`
+}
+
+// 行動記録を順に適用して作るユーザーごとの成績
+type activityProjection struct {
+	rules  scoringRules
+	lastID uint
+	// lastID より前で、まだ読み込めていないID（見つけた時刻）。後から書き込みが確定した記録を拾うために使う
+	gaps   map[uint]time.Time
+	totals map[uint]*activityTotals
+}
+
+func newActivityProjection(rules scoringRules) *activityProjection {
+	return &activityProjection{rules: rules, gaps: make(map[uint]time.Time), totals: make(map[uint]*activityTotals)}
+}
+
+// track は、読み込んだ記録のIDから、抜けているIDと集計済みの最後のIDを更新します。
+func (p *activityProjection) track(id uint, now time.Time) {
+	if _, ok := p.gaps[id]; ok {
+		delete(p.gaps, id)
+		return
+	}
+	if id <= p.lastID {
+		return
+	}
+	if id-p.lastID <= activityMaxGap {
+		for missing := p.lastID + 1; missing < id; missing++ {
+			p.gaps[missing] = now
+		}
+	}
+	p.lastID = id
+}
+
+// apply は、1件の行動記録を集計に反映します。成績と同じく、ログインユーザーのポケモンの問題だけを数えます。
+// オフライン用の問題パックの回答は公式の記録ではないので数えません（以前に記録されたものを集計し直す場合のため）。
+func (p *activityProjection) apply(e ActivityEvent) {
+	if e.UserID == 0 || e.Pack != "" || (e.Type == activityTypeAnswerSubmitted && e.Source == "offline") {
+		return
+	}
+	t, ok := p.totals[e.UserID]
+	if !ok {
+		t = &activityTotals{UserID: e.UserID}
+		p.totals[e.UserID] = t
+	}
+	switch e.Type {
+	case activityTypeHintUsed:
+		t.HintsUsed++
+	case activityTypeQuestionSkipped:
+		// スキップは正答率には含めず、連続正解だけを途切れさせる
+		t.LastActiveAt = e.CreatedAt
+		t.Skipped++
+		t.CurrentStreak = 0
+	case activityTypeAnswerSubmitted:
+		t.LastActiveAt = e.CreatedAt
+		t.Questions++
+		if e.Unofficial {
+			t.UnofficialAnswers++
+		}
+		// XP2倍の期間中の回答は倍率を掛ける（modifiers.go）
+		t.XP += answerXP(p.rules, e).Gained
+		if e.Correct {
+			t.Correct++
+			t.CurrentStreak++
+			t.BestStreak = max(t.BestStreak, t.CurrentStreak)
+		} else {
+			t.CurrentStreak = 0
+		}
+	}
+}
+
+// catchUp は、まだ集計していない行動記録を読み込んで反映します。
+// 前回は抜けていたIDの記録が書き込まれていれば、それも反映します。
+func (p *activityProjection) catchUp() error {
+	now := time.Now()
+	if err := p.fillGaps(now); err != nil {
+		return err
+	}
+	for {
+		var events []ActivityEvent
+		if err := db.Where("id > ?", p.lastID).Order("id").Limit(activityReplayBatch).Find(&events).Error; err != nil {
+			return err
+		}
+		for _, e := range events {
+			p.track(e.ID, now)
+			p.apply(e)
+		}
+		if len(events) < activityReplayBatch {
+			return nil
+		}
+	}
+}
+
+// fillGaps は、抜けていたIDの記録を読み込み直して反映し、長く現れないIDはあきらめます。
+func (p *activityProjection) fillGaps(now time.Time) error {
+	ids := make([]uint, 0, len(p.gaps))
+	for id, seen := range p.gaps {
+		if now.Sub(seen) > activityGapTimeout {
+			delete(p.gaps, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for chunk := range slices.Chunk(ids, activityReplayBatch) {
+		var events []ActivityEvent
+		if err := db.Where("id IN ?", chunk).Order("id").Find(&events).Error; err != nil {
+			return err
+		}
+		for _, e := range events {
+			p.track(e.ID, now)
+			p.apply(e)
+		}
+	}
+	return nil
+}
+
+// top は、XPの高い順に最大 limit 人の成績を返します。
+func (p *activityProjection) top(limit int) []activityTotals {
+	return p.topBy(limit, func(t activityTotals) float64 { return float64(t.XP) }, nil)
+}
+
+// topBy は、score の高い順に最大 limit 人の成績を返します。keep が nil でなければ、keep が true を返した成績だけを返します。
+func (p *activityProjection) topBy(limit int, score func(activityTotals) float64, keep func(activityTotals) bool) []activityTotals {
+	list := make([]activityTotals, 0, len(p.totals))
+	for _, t := range p.totals {
+		if t.Questions > 0 && (keep == nil || keep(*t)) {
+			list = append(list, *t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if si, sj := score(list[i]), score(list[j]); si != sj {
+			return si > sj
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// 現在のルールで集計し続けるランキング（リクエストのたびに新しい記録だけを反映する）
+var (
+	leaderboardMu         sync.Mutex
+	leaderboardProjection = newActivityProjection(currentScoringRules)
+)
+
+// leaderboardResponse は、集計結果にユーザー名を付けて返します。
+func leaderboardResponse(list []activityTotals, rules scoringRules) gin.H {
+	entries := make([]gin.H, 0, len(list))
+	for i, t := range list {
+		name := ""
+		if user, err := users.UserByID(t.UserID); err == nil {
+			name = user.Username
+		}
+		entries = append(entries, gin.H{"rank": i + 1, "username": name, "totals": t})
+	}
+	return gin.H{"rules": rules, "leaderboard": entries}
+}
+
+// handleGetLeaderboard は、行動記録から集計したXPのランキングを返します。
+// prizeEligible=true なら、重複の疑いがあるアカウントを除いた、賞品の対象となるランキングを返します。
+// view=weighted なら、しばらく遊んでいないユーザーのXPを減らした順位で返します（省略時は view=raw）。
+// officialOnly=true なら、公式でないクライアントから回答したことのあるユーザーを除いたランキングを返します。
+func handleGetLeaderboard(c *gin.Context) {
+	view := c.DefaultQuery("view", leaderboardViewRaw)
+	if view != leaderboardViewRaw && view != leaderboardViewWeighted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view must be raw or weighted"})
+		return
+	}
+	ineligible, err := prizeIneligibleUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+	prizeOnly := c.Query("prizeEligible") == "true"
+	limit := activityLeaderboard
+	if prizeOnly {
+		limit += len(ineligible) // 除いた分だけ多めに取る
+	}
+	now := time.Now()
+	score := func(t activityTotals) float64 { return float64(t.XP) }
+	if view == leaderboardViewWeighted {
+		score = func(t activityTotals) float64 { return decayedXP(t, now, leaderboardHalfLife) }
+	}
+	var keep func(activityTotals) bool
+	if c.Query("officialOnly") == "true" {
+		keep = func(t activityTotals) bool { return t.UnofficialAnswers == 0 }
+	}
+	leaderboardMu.Lock()
+	err = leaderboardProjection.catchUp()
+	list := leaderboardProjection.topBy(limit, score, keep)
+	leaderboardMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+	if prizeOnly {
+		list = slices.DeleteFunc(list, func(t activityTotals) bool { return ineligible[t.UserID] })
+		if len(list) > activityLeaderboard {
+			list = list[:activityLeaderboard]
+		}
+	}
+	response := leaderboardResponse(list, currentScoringRules)
+	for i, entry := range response["leaderboard"].([]gin.H) {
+		entry["prizeEligible"] = !ineligible[list[i].UserID]
+		entry["weightedXp"] = math.Round(decayedXP(list[i], now, leaderboardHalfLife))
+		entry["officialClient"] = list[i].UnofficialAnswers == 0
+	}
+	response["view"] = view
+	response["halfLifeHours"] = leaderboardHalfLife.Hours()
+	c.JSON(http.StatusOK, response)
+}
+
+// handleRecomputeLeaderboard は、指定した得点のルールで全ての行動記録を集計し直したランキングを返します（管理者用）。
+// 省略したルールは現在の値を使います。集計し直した結果は保存しません。
+func handleRecomputeLeaderboard(c *gin.Context) {
+	rules := currentScoringRules
+	for name, field := range map[string]*int{"xpPerAnswer": &rules.PerAnswer, "xpPerCorrect": &rules.PerCorrect} {
+		if q := c.Query(name); q != "" {
+			n, err := strconv.Atoi(q)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a non-negative integer"})
+				return
+			}
+			*field = n
+		}
+	}
+	projection := newActivityProjection(rules)
+	if err := projection.catchUp(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay activity events"})
+		return
+	}
+	c.JSON(http.StatusOK, leaderboardResponse(projection.top(activityLeaderboard), rules))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"gorm.io/gorm"
+)
+
+// --- 苦手なポケモンを優先する出題 ---
+
+// ログイン中のユーザーが通常モードで出題を受けるとき、一様な乱数ではなく、
+// よく間違えるポケモンや、まだ出題されたことのないポケモンが選ばれやすいよう重み付けして選びます。
+// adaptive=false を指定すれば、これまでどおり一様に選びます。
+
+// 重み（整数で扱う）。正答率が低いほど重くなり、全問不正解なら adaptiveWeightSeen+adaptiveWeightMiss になる
+const (
+	adaptiveWeightUnseen = 30 // まだ出題されたことがない
+	adaptiveWeightSeen   = 10 // 全問正解している
+	adaptiveWeightMiss   = 40 // 間違えた割合に応じて加える
+)
+
+// --- データベースモデル ---
+
+// ユーザーごと・ポケモンごとの回答数と正解数
+type PokemonAttempt struct {
+	gorm.Model
+	UserID    uint `gorm:"uniqueIndex:idx_pokemon_attempt;not null"`
+	PokemonID int  `gorm:"uniqueIndex:idx_pokemon_attempt;not null"`
+	Attempts  int  `gorm:"default:0"`
+	Correct   int  `gorm:"default:0"`
+}
+
+// recordPokemonAttempt は、1問分の回答結果をポケモンごとの記録に加算します。
+// applyAnswerToStats のトランザクション内から呼び出されます。
+func recordPokemonAttempt(tx *gorm.DB, userID uint, pokemonID int, isCorrect bool) error {
+	var attempt PokemonAttempt
+	if err := tx.FirstOrCreate(&attempt, PokemonAttempt{UserID: userID, PokemonID: pokemonID}).Error; err != nil {
+		return err
+	}
+	attempt.Attempts++
+	if isCorrect {
+		attempt.Correct++
+	}
+	return tx.Save(&attempt).Error
+}
+
+// adaptiveWeight は、ポケモンの回答記録から出題の重みを返します。
+func adaptiveWeight(attempt PokemonAttempt, seen bool) int {
+	if !seen || attempt.Attempts == 0 {
+		return adaptiveWeightUnseen
+	}
+	missed := attempt.Attempts - attempt.Correct
+	return adaptiveWeightSeen + adaptiveWeightMiss*missed/attempt.Attempts
+}
+
+// pickAdaptivePokemon は、ユーザーの回答記録に基づいて重み付きでポケモンを1匹選びます。
+func pickAdaptivePokemon(userID uint, list []*Pokemon) (*Pokemon, error) {
+	attempts, err := users.PokemonAttempts(userID)
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]int, len(list))
+	total := 0
+	for i, p := range list {
+		attempt, seen := attempts[p.ID]
+		weights[i] = adaptiveWeight(attempt, seen)
+		total += weights[i]
+	}
+	r, err := randomIndex(total)
+	if err != nil {
+		return nil, err
+	}
+	for i, w := range weights {
+		if r < w {
+			return list[i], nil
+		}
+		r -= w
+	}
+	return list[len(list)-1], nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// --- 1回だけ使える答え合わせ ---
+
+// 同じ問題に正解するまで何度も答え直して正答率を水増しできないよう、出題した問題ごとの nonce を覚えておき、
+// 同じ nonce で2回目の答え合わせが来たら断ります（409）。
+//   - /quiz の問題: questionToken に入っている questionId（スキップした問題も同じ nonce を使うので、後から答えられない）
+//   - デイリーチャレンジ: 日付・何問目か・ユーザー（ログインユーザーだけ。匿名の回答は成績に反映しない）
+//
+// nonce は問題の有効期限まで覚えておけばよいので、データベースには保存せずメモリに持ち、期限が過ぎたら消します。
+
+var (
+	answerNonces     = make(map[string]time.Time) // nonce と、覚えておく期限
+	answerNoncesMu   sync.Mutex
+	lastNonceSweep   time.Time
+	nonceSweepPeriod = time.Minute
+)
+
+// consumeAnswerNonce は、nonce を使用済みにします。既に使われていれば false を返します。
+// expiresAt を過ぎた nonce は忘れるので、それまでに問題自体も答えられなくなっている必要があります。
+func consumeAnswerNonce(nonce string, expiresAt time.Time) bool {
+	now := time.Now()
+	answerNoncesMu.Lock()
+	defer answerNoncesMu.Unlock()
+	// 回答のたびに全体を見ると重いので、一定の間隔で期限切れのものを消す
+	if now.Sub(lastNonceSweep) > nonceSweepPeriod {
+		for n, exp := range answerNonces {
+			if now.After(exp) {
+				delete(answerNonces, n)
+			}
+		}
+		lastNonceSweep = now
+	}
+	if exp, ok := answerNonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	answerNonces[nonce] = expiresAt
+	return true
+}
+
+// answerNonceUsed は、nonce が既に使われているかを返します（使用済みにはしない）。
+func answerNonceUsed(nonce string) bool {
+	answerNoncesMu.Lock()
+	defer answerNoncesMu.Unlock()
+	exp, ok := answerNonces[nonce]
+	return ok && time.Now().Before(exp)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 公式クライアントの証明 ---
+
+// 競うランキングを公平に保つため、公式のフロントエンドやアプリ以外（自動で答えるスクリプトなど）からの回答を見分けられるようにします。
+// CLIENT_ATTESTATION_KEYS に "クライアント名:鍵" をカンマ区切りで設定すると有効になり、
+// 回答のリクエストの X-Client-Attestation ヘッダーを確かめます。ヘッダーの形式は次のとおりです。
+//
+//	<クライアント名>:<UNIX時刻(秒)>:<HMAC-SHA256(鍵, "<クライアント名>:<UNIX時刻>:<メソッド> <パス>") の16進数>
+//
+// ヘッダーがない・署名が違う・時刻が5分以上ずれている回答は、断らずに「公式でないクライアントからの回答」として記録します。
+// そうした回答をしたユーザーは、GET /leaderboard?officialOnly=true のランキングから外れます（通常のランキングには officialClient: false で載る）。
+// Webのフロントエンドは、ビルド時の REACT_APP_ATTESTATION_CLIENT と REACT_APP_ATTESTATION_KEY からこのヘッダーを付けます（src/App.js）。
+// Webのフロントエンドに埋め込んだ鍵は取り出せるので、これは手間を増やすためのもので、完全に防ぐものではありません。
+// 未設定なら確かめず、全ての回答を公式のクライアントからのものとして扱います。
+
+const (
+	attestationHeader  = "X-Client-Attestation"
+	attestationMaxSkew = 5 * time.Minute
+)
+
+// クライアント名ごとの鍵（空なら確かめない）
+var attestationKeys map[string][]byte
+
+// loadAttestationKeys は、CLIENT_ATTESTATION_KEYS からクライアントごとの鍵を読み込みます。
+func loadAttestationKeys() {
+	attestationKeys = make(map[string][]byte)
+	for _, entry := range strings.Split(os.Getenv("CLIENT_ATTESTATION_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		client, key, ok := strings.Cut(entry, ":")
+		if !ok || client == "" || key == "" {
+			log.Printf("Ignoring invalid CLIENT_ATTESTATION_KEYS entry %q", entry)
+			continue
+		}
+		attestationKeys[client] = []byte(key)
+	}
+	if len(attestationKeys) > 0 {
+		log.Printf("Client attestation is enabled for %d clients.", len(attestationKeys))
+	}
+}
+
+// attestationSignature は、クライアント名・時刻・リクエストに対する署名を返します。
+func attestationSignature(key []byte, client, timestamp, method, path string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(client + ":" + timestamp + ":" + method + " " + path))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// unofficialClient は、証明が有効で、リクエストに正しい X-Client-Attestation ヘッダーがなければ true を返します。
+func unofficialClient(c *gin.Context) bool {
+	if len(attestationKeys) == 0 {
+		return false
+	}
+	parts := strings.Split(c.GetHeader(attestationHeader), ":")
+	if len(parts) != 3 {
+		return true
+	}
+	client, timestamp, signature := parts[0], parts[1], parts[2]
+	key, ok := attestationKeys[client]
+	if !ok {
+		return true
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return true
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > attestationMaxSkew || skew < -attestationMaxSkew {
+		return true
+	}
+	expected := attestationSignature(key, client, timestamp, c.Request.Method, c.Request.URL.Path)
+	return !hmac.Equal([]byte(signature), []byte(expected))
+}
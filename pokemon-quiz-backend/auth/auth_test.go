@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokensIssueAndParse(t *testing.T) {
+	tokens := NewTokens([]byte("test-key"), 15*time.Minute)
+	now := time.Now()
+	loggedInAt := now.Add(-time.Hour)
+
+	token, expiresAt, err := tokens.Issue(42, 3, loggedInAt, now)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if want := now.Add(15 * time.Minute); !expiresAt.Equal(want) {
+		t.Errorf("expiresAt = %v, want %v", expiresAt, want)
+	}
+	userID, claims, err := tokens.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if userID != 42 || claims.Version != 3 {
+		t.Errorf("userID, version = %d, %d, want 42, 3", userID, claims.Version)
+	}
+	// IssuedAt は最初にログインした時刻になる
+	if got := claims.IssuedAt.Time; got.Unix() != loggedInAt.Unix() {
+		t.Errorf("IssuedAt = %v, want %v", got, loggedInAt)
+	}
+}
+
+func TestTokensParseErrors(t *testing.T) {
+	tokens := NewTokens([]byte("test-key"), time.Minute)
+	now := time.Now()
+
+	expired, _, err := tokens.Issue(1, 0, now.Add(-time.Hour), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Parse(expired); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired token: err = %v, want ErrTokenExpired", err)
+	}
+
+	other, _, err := NewTokens([]byte("other-key"), time.Minute).Issue(1, 0, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Parse(other); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token signed with another key: err = %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := tokens.Parse("not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("malformed token: err = %v, want ErrInvalidToken", err)
+	}
+
+	noSubject, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Subject:   "admin",
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}).SignedString([]byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Parse(noSubject); !errors.Is(err, ErrInvalidSubject) {
+		t.Errorf("token without a user ID: err = %v, want ErrInvalidSubject", err)
+	}
+}
+
+func TestRevoked(t *testing.T) {
+	tokens := NewTokens([]byte("test-key"), time.Minute)
+	now := time.Now()
+
+	// 版を入れる前のトークンは版 0 として扱う
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Subject:   "1",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}).SignedString([]byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, claims, err := tokens.Parse(legacy)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if Revoked(claims, 0) {
+		t.Error("token is revoked although the password was never changed")
+	}
+	if !Revoked(claims, 1) {
+		t.Error("token issued before the password change is not revoked")
+	}
+
+	// パスワードを変えたのと同じ瞬間に発行したトークンでも、版が違えば使えない
+	token, _, err := tokens.Issue(1, 1, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, claims, err = tokens.Parse(token); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if Revoked(claims, 1) {
+		t.Error("token issued with the current version is revoked")
+	}
+	if !Revoked(claims, 2) {
+		t.Error("token issued in the same second as the password change is not revoked")
+	}
+}
+
+func TestValidCredentials(t *testing.T) {
+	tests := []struct {
+		cred string
+		want bool
+	}{
+		{"abcd1234", true},
+		{"abc123", false},    // 短い
+		{"abcdefgh", false},  // 数字がない
+		{"12345678", false},  // 英字がない
+		{"abcd 1234", false}, // 英数字以外
+		{"ａｂｃｄ1234", false},  // 全角
+	}
+	for _, tt := range tests {
+		if got := ValidCredentials(tt.cred); got != tt.want {
+			t.Errorf("ValidCredentials(%q) = %v, want %v", tt.cred, got, tt.want)
+		}
+	}
+}
+
+func TestHashAndCheckPassword(t *testing.T) {
+	hash, err := HashPassword("Passw0rd1long")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if hash == "Passw0rd1long" {
+		t.Error("HashPassword returned the password as is")
+	}
+	if !CheckPassword(hash, "Passw0rd1long") {
+		t.Error("CheckPassword rejected the right password")
+	}
+	if CheckPassword(hash, "Passw0rd2long") {
+		t.Error("CheckPassword accepted a wrong password")
+	}
+}
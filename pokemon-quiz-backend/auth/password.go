@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"regexp"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- パスワード ---
+
+var (
+	hasLetter      = regexp.MustCompile(`[a-zA-Z]`)
+	hasNumber      = regexp.MustCompile(`[0-9]`)
+	isAlphanumeric = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+)
+
+// ValidCredentials は、ユーザー名やパスワードが要件（8文字以上の英数字で、英字と数字の両方を含む）を満たしているか検証します。
+func ValidCredentials(cred string) bool {
+	return len(cred) >= 8 && hasLetter.MatchString(cred) && hasNumber.MatchString(cred) && isAlphanumeric.MatchString(cred)
+}
+
+// HashPassword は、パスワードを bcrypt でハッシュ化します。
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword は、パスワードがハッシュと一致すれば true を返します。
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
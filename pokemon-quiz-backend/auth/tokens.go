@@ -0,0 +1,98 @@
+// Package auth は、ログイントークン（JWT）の発行と検証、パスワードの要件の確認とハッシュ化をまとめたものです。
+//
+// 鍵や有効期限は NewTokens で渡すので、HTTPのハンドラ以外（コマンドラインのツールなど）からも同じ手順でトークンを扱えます。
+//
+//	tokens := auth.NewTokens([]byte(os.Getenv("JWT_SECRET_KEY")), 15*time.Minute)
+//	token, expiresAt, err := tokens.Issue(userID, tokenVersion, time.Now(), time.Now())
+//	userID, claims, err := tokens.Parse(token)
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- ログイントークン ---
+
+var (
+	// 有効期限が切れたトークン
+	ErrTokenExpired = errors.New("token has expired")
+	// 署名が違う・形式が違うトークン
+	ErrInvalidToken = errors.New("invalid token")
+	// ユーザーIDが読み取れないトークン
+	ErrInvalidSubject = errors.New("invalid user ID in token")
+)
+
+// Claims は、ログイントークンの中身です。
+type Claims struct {
+	// 発行したときのユーザーのトークンの版。パスワードを変えるたびに上がり、古い版のトークンは使えなくなる
+	// （版を入れる前に発行したトークンは 0）
+	Version int `json:"ver,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Tokens は、ログイントークンを発行・検証します。複数の goroutine から同時に使えます。
+type Tokens struct {
+	key      []byte
+	duration time.Duration
+}
+
+// NewTokens は、key で署名し、duration の間有効なログイントークンを扱う Tokens を作ります。
+func NewTokens(key []byte, duration time.Duration) *Tokens {
+	return &Tokens{key: key, duration: duration}
+}
+
+// Duration は、ログイントークンの有効期限を返します。
+func (t *Tokens) Duration() time.Duration {
+	return t.duration
+}
+
+// Issue は、ログイントークンとその有効期限を返します。version にはユーザーの今のトークンの版を、
+// loggedInAt には最初にログインした時刻を渡します（IssuedAt になる）。
+func (t *Tokens) Issue(userID uint, version int, loggedInAt, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(t.duration)
+	claims := &Claims{
+		Version: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(int(userID)),
+			IssuedAt:  jwt.NewNumericDate(loggedInAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.key)
+	return tokenString, expiresAt, err
+}
+
+// Parse は、ログイントークンを検証し、ユーザーIDとクレームを返します。
+// 期限切れなら ErrTokenExpired、ユーザーIDが読み取れなければ ErrInvalidSubject、それ以外は ErrInvalidToken を返します。
+func (t *Tokens) Parse(tokenString string) (uint, *Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// 署名方式が期待通りか検証
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return t.key, nil
+	})
+	if err != nil || !token.Valid {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return 0, nil, ErrTokenExpired
+		}
+		return 0, nil, ErrInvalidToken
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return 0, nil, ErrInvalidSubject
+	}
+	return uint(userID), claims, nil
+}
+
+// Revoked は、ユーザーの今のトークンの版（version）より前に発行したトークン（パスワードを変える前のトークン）なら true を返します。
+// 発行した時刻ではなく版で比べるので、パスワードを変えたのと同じ秒に発行したトークンも使えなくなります。
+func Revoked(claims *Claims, version int) bool {
+	return claims.Version != version
+}
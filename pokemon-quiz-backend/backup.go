@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- バックアップと復元（セルフホスト用） ---
+
+// 管理者がデータベースのバックアップを取り、名前を指定して復元できるようにします。
+//   - SQLite: VACUUM INTO で実行中でも整合性の取れたファイルを作り、復元ではテーブルの中身を入れ替える
+//   - PostgreSQL: pg_dump（カスタム形式）で保存し、pg_restore --clean で復元する（コマンドが必要）
+//
+// バックアップは BACKUP_DIR（既定は backups）に保存します。BACKUP_UPLOAD_COMMAND を設定すると、
+// 作成したファイルのパスを $1 に渡してシェルで実行するので、オブジェクトストレージへのアップロードに使えます
+// （例: aws s3 cp "$1" s3://bucket/pokequiz/）。復元はローカルにあるバックアップからのみ行います。
+// バックアップ・復元の操作は、誰がいつ行ったかを監査ログ（AdminAuditLog）に残します。
+// 復元しても監査ログは上書きしません。
+// 復元している間は、成績と行動記録の書き込みを止めます（restoreGate）。復元した後は、データベースから読み込んで
+// メモリに持っている設定（出題から外すポケモン・名前のルール・XPの倍率）を読み込み直し、作り置きを捨てます。
+
+const defaultBackupDir = "backups"
+
+// バックアップの名前（パスの区切りなどを含めさせない）。同じ秒に作っても重ならないよう、
+// ミリ秒とランダムな文字列を付ける（付けていない以前のバックアップも受け付ける）
+var backupNamePattern = regexp.MustCompile(`^pokequiz-\d{8}-\d{6}(\.\d{3}-[0-9a-f]{12})?\.(db|dump)$`)
+
+var errBackupNotFound = errors.New("backup not found")
+
+// バックアップと復元を同時に行わないためのロック
+var backupMu sync.Mutex
+
+// 復元の間、成績と行動記録の書き込みを止めるためのロック。書き込む側は RLock を取り、復元する側は Lock を取る
+var restoreGate sync.RWMutex
+
+// --- データベースモデル ---
+
+// 管理者の操作の監査ログ
+type AdminAuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"index"`
+	Action    string    `gorm:"not null"` // backup / restore など
+	Target    string    // 操作の対象（バックアップの名前など）
+	Success   bool
+	Detail    string
+}
+
+// recordAudit は、管理者の操作を監査ログに記録します。
+func recordAudit(userID uint, action, target string, opErr error) {
+	entry := AdminAuditLog{UserID: userID, Action: action, Target: target, Success: opErr == nil}
+	if opErr != nil {
+		entry.Detail = opErr.Error()
+	}
+	log.Printf("Audit: user %d %s %s (success=%t) %s", userID, action, target, entry.Success, entry.Detail)
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// backupDir は、バックアップを保存するディレクトリを返します。
+func backupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return defaultBackupDir
+}
+
+// createBackup は、データベースのバックアップを作成し、その名前を返します。
+func createBackup(now time.Time) (string, error) {
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	suffix, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	stamp := now.In(jst).Format("20060102-150405.000") + "-" + suffix
+	switch db.Dialector.Name() {
+	case "sqlite":
+		name := "pokequiz-" + stamp + ".db"
+		if err := db.Exec("VACUUM INTO ?", filepath.Join(dir, name)).Error; err != nil {
+			return "", err
+		}
+		return name, nil
+	case "postgres":
+		name := "pokequiz-" + stamp + ".dump"
+		out, err := exec.Command("pg_dump", "--format=custom", "--file", filepath.Join(dir, name), os.Getenv("DATABASE_URL")).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("pg_dump failed: %v: %s", err, out)
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("backups are not supported for %s", db.Dialector.Name())
+}
+
+// uploadBackup は、BACKUP_UPLOAD_COMMAND が設定されていれば、バックアップのファイルを渡して実行します。
+func uploadBackup(name string) (bool, error) {
+	command := os.Getenv("BACKUP_UPLOAD_COMMAND")
+	if command == "" {
+		return false, nil
+	}
+	out, err := exec.Command("sh", "-c", command, "backup", filepath.Join(backupDir(), name)).CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("upload command failed: %v: %s", err, out)
+	}
+	return true, nil
+}
+
+// restoreBackup は、指定したバックアップからデータベースを復元します。
+func restoreBackup(name string) error {
+	path := filepath.Join(backupDir(), name)
+	if _, err := os.Stat(path); err != nil {
+		return errBackupNotFound
+	}
+	switch db.Dialector.Name() {
+	case "sqlite":
+		if filepath.Ext(name) != ".db" {
+			return errors.New("this backup was not taken from SQLite")
+		}
+		return restoreSQLite(path)
+	case "postgres":
+		if filepath.Ext(name) != ".dump" {
+			return errors.New("this backup was not taken from PostgreSQL")
+		}
+		// 監査ログは上書きしない
+		out, err := exec.Command("pg_restore", "--clean", "--if-exists", "--no-owner",
+			"--exclude-table=admin_audit_logs", "--dbname", os.Getenv("DATABASE_URL"), path).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("pg_restore failed: %v: %s", err, out)
+		}
+		return nil
+	}
+	return fmt.Errorf("restore is not supported for %s", db.Dialector.Name())
+}
+
+// restoreSQLite は、バックアップのファイルを ATTACH し、1つのトランザクションで各テーブルの中身を入れ替えます。
+// 両方にある列だけをコピーするので、バックアップの後に列が追加されていても復元できます。
+func restoreSQLite(path string) error {
+	// ATTACH は接続ごとなので、1つの接続で行う
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("ATTACH DATABASE ? AS backup", path).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("DETACH DATABASE backup")
+
+		var tables []string
+		if err := conn.Raw("SELECT name FROM backup.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&tables).Error; err != nil {
+			return err
+		}
+		return conn.Transaction(func(tx *gorm.DB) error {
+			for _, table := range tables {
+				if table == "admin_audit_logs" || !tx.Migrator().HasTable(table) {
+					continue
+				}
+				var current, saved []string
+				if err := tx.Raw("SELECT name FROM pragma_table_info(?)", table).Scan(&current).Error; err != nil {
+					return err
+				}
+				if err := tx.Raw("SELECT name FROM pragma_table_info(?, 'backup')", table).Scan(&saved).Error; err != nil {
+					return err
+				}
+				columns := ""
+				for _, col := range current {
+					for _, s := range saved {
+						if col == s {
+							if columns != "" {
+								columns += ", "
+							}
+							columns += `"` + col + `"`
+						}
+					}
+				}
+				if err := tx.Exec(fmt.Sprintf(`DELETE FROM main."%s"`, table)).Error; err != nil {
+					return err
+				}
+				if columns == "" {
+					continue
+				}
+				if err := tx.Exec(fmt.Sprintf(`INSERT INTO main."%s" (%s) SELECT %s FROM backup."%s"`, table, columns, columns, table)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// handleListBackups は、保存されているバックアップの一覧を新しい順に返します。
+func handleListBackups(c *gin.Context) {
+	entries, err := os.ReadDir(backupDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list backups"})
+		return
+	}
+	backups := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !backupNamePattern.MatchString(e.Name()) {
+			continue
+		}
+		backups = append(backups, gin.H{"name": e.Name(), "size": info.Size(), "createdAt": info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i]["name"].(string) > backups[j]["name"].(string) })
+	c.JSON(http.StatusOK, gin.H{"backups": backups})
+}
+
+// handleCreateBackup は、バックアップを作成します。
+func handleCreateBackup(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	if _, ok := users.(gormUserStore); !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Backups are not available with in-memory storage"})
+		return
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	name, err := createBackup(time.Now())
+	if err != nil {
+		recordAudit(userID, "backup", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+	uploaded, err := uploadBackup(name)
+	recordAudit(userID, "backup", name, err)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Backup was created but the upload failed", "name": name})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"name": name, "uploaded": uploaded})
+}
+
+// handleRestoreBackup は、指定したバックアップからデータベースを復元します。
+func handleRestoreBackup(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	name := c.Param("name")
+	if !backupNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backup name"})
+		return
+	}
+	if _, ok := users.(gormUserStore); !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Restore is not available with in-memory storage"})
+		return
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	restoreGate.Lock()
+	err := restoreBackup(name)
+	restoreGate.Unlock()
+	recordAudit(userID, "restore", name, err)
+	if errors.Is(err, errBackupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore backup"})
+		return
+	}
+
+	reloadAfterRestore()
+	c.JSON(http.StatusOK, gin.H{"message": "Backup restored", "name": name})
+}
+
+// reloadAfterRestore は、データベースから読み込んでメモリに持っている設定を読み込み直し、作り置きを捨てます。
+// 読み込めなかった設定はログに出し、以前の設定のまま続けます。
+func reloadAfterRestore() {
+	for name, load := range map[string]func() error{
+		"quiz exclusions": loadExclusions,
+		"name rules":      loadNameRules,
+		"XP modifiers":    loadXPModifiers,
+	} {
+		if err := load(); err != nil {
+			log.Printf("Failed to reload %s after restore: %v", name, err)
+		}
+	}
+
+	// 出題の候補とデイリーチャレンジは、読み込み直した設定で作り直す
+	quizPoolCacheMu.Lock()
+	clear(quizPoolCache)
+	quizPoolCacheMu.Unlock()
+	dailyChallengesMu.Lock()
+	clear(dailyChallenges)
+	dailyChallengesMu.Unlock()
+
+	// 行動記録から作ったランキングは作り直す
+	leaderboardMu.Lock()
+	leaderboardProjection = newActivityProjection(currentScoringRules)
+	leaderboardMu.Unlock()
+}
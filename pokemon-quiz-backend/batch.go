@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"pokemon-quiz-backend/quiz"
+)
+
+// --- まとめて出題するセッション ---
+
+// セッション作成時にN問をまとめて出題し、最後に全問の回答をまとめて送ってもらいます。
+// 1問ごとの通信が不要になり、成績の更新も1回のプレイ単位で1つのトランザクションにまとまります。
+// 正解はサーバーだけが保持し、回答の送信には作成時に発行した署名付きのセッショントークンが必要です。
+
+const (
+	sessionTypeBatch      = "batch"
+	sessionTokenIssuer    = "pokequiz-session"
+	defaultBatchQuestions = 10
+)
+
+// セッショントークンの中身（正解は含めない）
+type sessionTokenClaims struct {
+	SessionID string `json:"sid"`
+	UserID    uint   `json:"uid,omitempty"`
+	Questions int    `json:"questions"`
+	jwt.RegisteredClaims
+}
+
+// issueSessionToken は、まとめて出題したセッションの回答送信に使うトークンを発行します。
+func issueSessionToken(s *quizSession) (string, error) {
+	expiresAt := s.CreatedAt.Add(quizSessionTTL)
+	if deadline, ok := s.deadline(); ok {
+		expiresAt = deadline
+	}
+	claims := sessionTokenClaims{
+		SessionID: s.ID,
+		UserID:    s.UserID,
+		Questions: len(s.batch),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    sessionTokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(s.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(derivedSigningKey(sessionTokenIssuer))
+}
+
+// parseSessionToken は、セッショントークンの署名と有効期限を検証して中身を返します。
+func parseSessionToken(tokenString string) (*sessionTokenClaims, error) {
+	claims := &sessionTokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return derivedSigningKey(sessionTokenIssuer), nil
+	}, jwt.WithIssuer(sessionTokenIssuer))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// prepareBatchQuestions は、セッションの問題をまとめて作成します。
+// 地方のポケモンが足りる限り、同じポケモンは2回出題しません。
+func prepareBatchQuestions(s *quizSession, count int) error {
+	pool := s.regionPool()
+	remaining := make([]*Pokemon, len(pool))
+	copy(remaining, pool)
+
+	s.batch = make([]*sessionQuestion, 0, count)
+	for i := 0; i < count; i++ {
+		if len(remaining) == 0 {
+			remaining = append(remaining, pool...)
+		}
+		qr := s.nextQuestionRand()
+		idx, err := qr.index(len(remaining))
+		if err != nil {
+			return err
+		}
+		pokemon := remaining[idx]
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+
+		question, err := newQuizQuestion(qr, pokemon, pool, s.Mode, defaultOptionCount)
+		if err != nil {
+			return err
+		}
+		if s.Accessible {
+			addAccessibleHints(question, pokemon)
+		}
+		recordQuestionServed(s.UserID, pokemon.ID, s.Mode, "", "batch", s.Accessible)
+		delete(question, "id") // 正解が分からないようにIDは返さない
+		question["questionNumber"] = i + 1
+		s.batch = append(s.batch, &sessionQuestion{pokemon: pokemon, question: question, issuedAt: s.CreatedAt})
+	}
+	return nil
+}
+
+// batchQuestions は、クライアントに返す問題の一覧を組み立てます。
+func (s *quizSession) batchQuestions() []gin.H {
+	questions := make([]gin.H, len(s.batch))
+	for i, q := range s.batch {
+		questions[i] = q.question
+	}
+	return questions
+}
+
+// --- まとめて出題するセッションのハンドラ ---
+
+// handleSubmitQuizSession は、まとめて出題した問題への回答を全問まとめて採点します。
+// ログインしている場合は、全問の結果を1つのトランザクションで成績に反映します。
+func handleSubmitQuizSession(c *gin.Context) {
+	var req struct {
+		SessionToken string   `json:"sessionToken"`
+		PackToken    string   `json:"packToken"` // オフライン用の問題パックの回答を送る場合（offline_pack.go）
+		Answers      []string `json:"answers"`   // 問題の順番どおりの回答（未回答は空文字）
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.SessionToken == "" && req.PackToken == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.PackToken != "" {
+		submitOfflinePack(c, req.PackToken, req.Answers)
+		return
+	}
+
+	session, ok := findQuizSession(c)
+	if !ok {
+		return
+	}
+	claims, err := parseSessionToken(req.SessionToken)
+	if err != nil || claims.SessionID != session.ID || claims.UserID != session.UserID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session token"})
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Type != sessionTypeBatch {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only batch sessions can be submitted"})
+		return
+	}
+	if now := time.Now(); session.isFinished(now) {
+		session.finalize(now)
+		c.JSON(http.StatusGone, sessionOverError(session))
+		return
+	}
+	if len(req.Answers) != len(session.batch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("answers must contain exactly %d entries", len(session.batch))})
+		return
+	}
+
+	// 未回答（空文字）以外は、出題した選択肢の中から答えていなければならない
+	for i, q := range session.batch {
+		if req.Answers[i] != "" && !isOfferedOption(q.question, req.Answers[i]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("answer %d must be one of the options from the question", i+1)})
+			return
+		}
+	}
+
+	submittedAt := time.Now()
+	results := make([]gin.H, len(session.batch))
+	correct := 0
+	for i, q := range session.batch {
+		isCorrect := quiz.IsSameAnswer(req.Answers[i], answerName(q.pokemon, session.Mode))
+		if isCorrect {
+			correct++
+		}
+		results[i] = gin.H{
+			"questionNumber": i + 1,
+			"answer":         req.Answers[i],
+			"isCorrect":      isCorrect,
+			"correctPokemon": q.pokemon,
+			"explanation":    buildExplanation(q.pokemon),
+		}
+	}
+
+	// 成績は全問まとめて反映し、途中で失敗した場合は1問も反映しない
+	var streak answerStreak
+	var stats statsAggregates
+	statsPending := false
+	if session.UserID != 0 {
+		// 途中で自己ベストを更新していれば、最後に不正解でも更新したことを返す
+		answers := make([]statsAnswer, len(session.batch))
+		for i, q := range session.batch {
+			answers[i] = statsAnswer{PokemonID: q.pokemon.ID, Mode: session.Mode, IsCorrect: results[i]["isCorrect"].(bool), AnsweredAt: submittedAt}
+		}
+		for i, a := range answers {
+			if xp, ok := recordAnswerSubmitted(c, session.UserID, a.PokemonID, session.Mode, "", "batch", a.IsCorrect); ok {
+				results[i]["xp"] = xp
+			}
+		}
+		res, pending, err := writeUserStats(session.UserID, answers, batchStatsWait)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save results, please submit again"})
+			return
+		}
+		streak = res.Streak
+		stats = res.Stats
+		statsPending = pending
+	}
+
+	// まとめて答えるので、1問ごとの回答時間は分からない
+	for i, q := range session.batch {
+		session.answerLog = append(session.answerLog, statsAnswer{PokemonID: q.pokemon.ID, IsCorrect: results[i]["isCorrect"].(bool), AnsweredAt: submittedAt})
+	}
+	now := time.Now()
+	session.Answered = len(session.batch)
+	session.Correct = correct
+	session.Balance = correct * sessionBasePoint
+	session.ended = true
+	session.updatedAt = now
+	session.finalize(now)
+
+	response := session.state()
+	response["results"] = results
+	if statsPending {
+		response["statsPending"] = true
+	} else if session.UserID != 0 {
+		response["streak"] = streak
+		response["stats"] = stats
+	}
+	c.JSON(http.StatusOK, response)
+}
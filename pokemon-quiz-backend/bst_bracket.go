@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// --- 種族値の合計を比べる形式 ---
+
+// 「この中で種族値の合計が一番高いポケモンは？」と出題します。
+// 選択肢は同じ地方（出題プール）から、種族値の合計が互いに異なるポケモンを選びます。
+// 正解は選択肢の組み合わせで決まるため、答え合わせでは選んだポケモンのIDと選択肢のIDの一覧を送ってもらい、IDで判定します。
+
+const quizModeBSTBracket = "bst_bracket"
+
+// bstBracketOptions は、pokemon と、種族値の合計が互いに異なるポケモンをあわせて最大 count 匹選び、シャッフルして返します。
+func bstBracketOptions(qr *quizRand, pokemon *Pokemon, pool []*Pokemon, count int) []*Pokemon {
+	candidates := make([]*Pokemon, len(pool))
+	copy(candidates, pool)
+
+	options := []*Pokemon{pokemon}
+	seenTotals := map[int]bool{pokemon.Stats.Total(): true}
+	// 必要な数が集まるまで、候補を先頭から順にランダムに並べながら選ぶ
+	for i := 0; i < len(candidates) && len(options) < count; i++ {
+		k, _ := qr.index(len(candidates) - i)
+		j := i + k
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+		if total := candidates[i].Stats.Total(); !seenTotals[total] {
+			seenTotals[total] = true
+			options = append(options, candidates[i])
+		}
+	}
+
+	for i := len(options) - 1; i > 0; i-- {
+		j, _ := qr.index(i + 1)
+		options[i], options[j] = options[j], options[i]
+	}
+	return options
+}
+
+// buildBSTBracketQuestion は、種族値の合計を比べる形式の問題を組み立てます。
+// 正解が分からないよう、問題には正解のIDを含めません。
+func buildBSTBracketQuestion(qr *quizRand, pokemon *Pokemon, pool []*Pokemon, optionCount int) gin.H {
+	options := bstBracketOptions(qr, pokemon, pool, optionCount)
+	choices := make([]gin.H, len(options))
+	ids := make([]int, len(options))
+	for i, p := range options {
+		choices[i] = gin.H{
+			"id":          p.ID,
+			"name":        p.Name,
+			"nameReading": p.NameReading,
+			"imageUrl":    p.ImageURL,
+			"types":       p.Types,
+		}
+		ids[i] = p.ID
+	}
+	return gin.H{
+		"mode":      quizModeBSTBracket,
+		"options":   choices,
+		"optionIds": ids, // 答え合わせでそのまま送り返してもらう
+	}
+}
+
+// bstBracketWinner は、選択肢のIDの一覧から種族値の合計が一番高いポケモンを返します。
+// 存在しないIDや重複、合計が同じポケモンが含まれる場合は false を返します。
+func bstBracketWinner(byID map[int]*Pokemon, optionIDs []int) (*Pokemon, bool) {
+	if len(optionIDs) < minOptionCount || len(optionIDs) > maxOptionCount {
+		return nil, false
+	}
+	var winner *Pokemon
+	seenIDs := make(map[int]bool, len(optionIDs))
+	seenTotals := make(map[int]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		p, ok := byID[id]
+		if !ok || seenIDs[id] || seenTotals[p.Stats.Total()] {
+			return nil, false
+		}
+		seenIDs[id] = true
+		seenTotals[p.Stats.Total()] = true
+		if winner == nil || p.Stats.Total() > winner.Stats.Total() {
+			winner = p
+		}
+	}
+	return winner, true
+}
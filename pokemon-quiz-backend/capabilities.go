@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- デプロイごとの機能一覧 ---
+
+// セルフホストの環境ごとに有効な機能が違っても、同じフロントエンドのビルドで対応できるよう、
+// このデプロイで使える任意の機能を GET /capabilities で返します。
+// 未実装の機能（OAuthログイン・プッシュ通知・Redis）は、実装されるまで常に無効として返します。
+
+// capabilities は、このデプロイで有効な機能の一覧を組み立てます。
+func capabilities() gin.H {
+	modes := make([]string, 0, len(quizModes)+len(quizOnlyModes))
+	for m := range quizModes {
+		modes = append(modes, m)
+	}
+	for m := range quizOnlyModes {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+
+	return gin.H{
+		"multiplayer": gin.H{
+			"matches":     true,
+			"tournaments": true,
+			"events":      true,
+		},
+		"oauthProviders": []string{},
+		"push":           false,
+		"redis":          false,
+		"publicApi":      true,
+		"attestation":    len(attestationKeys) > 0,
+		"quizModes":      modes,
+		"options": gin.H{
+			"min":     minOptionCount,
+			"max":     maxOptionCount,
+			"default": defaultOptionCount,
+			"orders":  optionOrders,
+		},
+	}
+}
+
+// handleCapabilities は、このデプロイで有効な機能の一覧を返します。
+func handleCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, capabilities())
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- コンテンツカレンダー ---
+
+// テーマ週間・トーナメント・XP2倍の期間などの予定を、管理者が /admin/calendar で前もって登録できるようにします。
+// クライアントは GET /calendar で開催中と近日開催の予定を取得し、「近日開催」のバナーなどに使います。
+// 予定はスケジューラーが1分ごとに確かめ、開始時刻になったら自動で始めます。
+//   - themed_week: 地方などのテーマを決めた週間（開催中として返すだけで、出題は変えない）
+//   - tournament:  開始時にトーナメントを作成し、終了時に順位を確定する（主催者は予定を登録した管理者）
+//   - double_xp:   期間中の回答で得たランキングのXPを multiplier 倍にする（region を指定するとその地方のポケモンの問題だけ。modifiers.go）
+// 始まった予定は種類と開始時刻を変えられません。XPの倍率や期間を変えても、集計済みのランキングには反映し直さず、
+// 管理者がランキングを集計し直したとき（/admin/leaderboard/recompute）に反映されます。
+
+const (
+	calendarKindThemedWeek = "themed_week"
+	calendarKindTournament = "tournament"
+	calendarKindDoubleXP   = "double_xp"
+
+	calendarSchedulerInterval = time.Minute
+	calendarUpcomingLimit     = 20
+	defaultXPMultiplier       = 2
+	maxXPMultiplier           = 5
+	maxCalendarTitleLength    = 100
+)
+
+var calendarKinds = map[string]bool{calendarKindThemedWeek: true, calendarKindTournament: true, calendarKindDoubleXP: true}
+
+// --- データベースモデル ---
+
+// コンテンツカレンダーの予定
+type CalendarEntry struct {
+	gorm.Model
+	Kind         string    `gorm:"not null"`
+	Title        string    `gorm:"not null"`
+	Description  string    `gorm:"type:text"`
+	StartsAt     time.Time `gorm:"index;not null"`
+	EndsAt       time.Time `gorm:"index;not null"`
+	Region       string    // themed_week と tournament の地方（double_xp では倍率を掛ける地方、空なら全て）
+	Mode         string    // tournament の対戦の種類
+	Rounds       int       // tournament の1試合の問題数
+	Multiplier   int       // double_xp のXPの倍率
+	CreatedBy    uint
+	ActivatedAt  *time.Time // スケジューラーが始めた時刻
+	FinishedAt   *time.Time // スケジューラーが終えた時刻
+	TournamentID uint       // 開始時に作成したトーナメント
+}
+
+// --- スケジューラー ---
+
+// startCalendarScheduler は、予定を始めたり終えたりするジョブを開始します。
+func startCalendarScheduler() {
+	if err := loadXPModifiers(); err != nil {
+		log.Printf("Failed to load XP modifiers: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(calendarSchedulerInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runCalendarScheduler(now)
+		}
+	}()
+}
+
+// runCalendarScheduler は、開始時刻を過ぎた予定を始め、終了時刻を過ぎた予定を終えます。
+func runCalendarScheduler(now time.Time) {
+	var due []CalendarEntry
+	if err := db.Where("activated_at IS NULL AND starts_at <= ? AND ends_at > ?", now, now).Find(&due).Error; err != nil {
+		log.Printf("Failed to load calendar entries to start: %v", err)
+		return
+	}
+	for i := range due {
+		if err := activateCalendarEntry(&due[i], now); err != nil {
+			log.Printf("Failed to start calendar entry %d: %v", due[i].ID, err)
+		}
+	}
+
+	var ended []CalendarEntry
+	if err := db.Where("finished_at IS NULL AND ends_at <= ?", now).Find(&ended).Error; err != nil {
+		log.Printf("Failed to load calendar entries to finish: %v", err)
+		return
+	}
+	for i := range ended {
+		if err := finishCalendarEntry(&ended[i], now); err != nil {
+			log.Printf("Failed to finish calendar entry %d: %v", ended[i].ID, err)
+		}
+	}
+}
+
+// activateCalendarEntry は、予定を始めます。複数のサーバーで同時に動いても、始めるのは1回だけにします。
+func activateCalendarEntry(e *CalendarEntry, now time.Time) error {
+	if e.Kind == calendarKindTournament && !dataReady.Load() {
+		return nil // ポケモンデータの準備ができてから始める
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&CalendarEntry{}).Where("id = ? AND activated_at IS NULL", e.ID).Update("activated_at", now)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if e.Kind == calendarKindTournament {
+			tournament := Tournament{
+				Name:       e.Title,
+				HostUserID: e.CreatedBy,
+				Mode:       e.Mode,
+				Region:     e.Region,
+				Rounds:     e.Rounds,
+				Status:     tournamentStatusOpen,
+			}
+			if err := tx.Create(&tournament).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&CalendarEntry{}).Where("id = ?", e.ID).Update("tournament_id", tournament.ID).Error; err != nil {
+				return err
+			}
+			e.TournamentID = tournament.ID
+		}
+		log.Printf("Started calendar entry %d (%s): %s", e.ID, e.Kind, e.Title)
+		return nil
+	})
+}
+
+// finishCalendarEntry は、予定を終えます。トーナメントはまだ終わっていなければ順位を確定します。
+func finishCalendarEntry(e *CalendarEntry, now time.Time) error {
+	res := db.Model(&CalendarEntry{}).Where("id = ? AND finished_at IS NULL", e.ID).Update("finished_at", now)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	if e.TournamentID != 0 {
+		err := db.Model(&Tournament{}).Where("id = ? AND status = ?", e.TournamentID, tournamentStatusOpen).
+			Update("status", tournamentStatusFinished).Error
+		if err != nil {
+			return err
+		}
+		publishTournamentStandings(e.TournamentID)
+	}
+	return nil
+}
+
+// --- コンテンツカレンダーのハンドラ ---
+
+// handleGetCalendar は、開催中の予定と、これから始まる予定（開始の早い順に最大20件）を返します。
+func handleGetCalendar(c *gin.Context) {
+	now := time.Now()
+	var active, upcoming []CalendarEntry
+	if err := db.Where("starts_at <= ? AND ends_at > ?", now, now).Order("starts_at asc").Find(&active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+	if err := db.Where("starts_at > ?", now).Order("starts_at asc").Limit(calendarUpcomingLimit).Find(&upcoming).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"active": calendarViews(active), "upcoming": calendarViews(upcoming)})
+}
+
+// handleListCalendarEntries は、終わったものを含めて全ての予定を開始の遅い順に返します（管理者用）。
+func handleListCalendarEntries(c *gin.Context) {
+	var entries []CalendarEntry
+	if err := db.Order("starts_at desc").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": calendarViews(entries)})
+}
+
+// 予定の作成・更新のリクエスト
+type calendarEntryRequest struct {
+	Kind        string    `json:"kind"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartsAt    time.Time `json:"startsAt"`
+	EndsAt      time.Time `json:"endsAt"`
+	Region      string    `json:"region"`
+	Mode        string    `json:"mode"`
+	Rounds      int       `json:"rounds"`
+	Multiplier  int       `json:"multiplier"`
+}
+
+// validate は、リクエストを確かめて省略した値を埋めます。問題があればエラーメッセージを返します。
+func (r *calendarEntryRequest) validate() string {
+	if !calendarKinds[r.Kind] {
+		return "kind must be themed_week, tournament or double_xp"
+	}
+	if r.Title == "" || len([]rune(r.Title)) > maxCalendarTitleLength {
+		return "title is required and must be at most 100 characters"
+	}
+	if r.StartsAt.IsZero() || !r.EndsAt.After(r.StartsAt) {
+		return "startsAt and endsAt are required and endsAt must be after startsAt"
+	}
+	switch r.Kind {
+	case calendarKindThemedWeek:
+		if r.Region != "" && len(pokemonListByRegion[r.Region]) == 0 {
+			return "Invalid region specified"
+		}
+	case calendarKindTournament:
+		if r.Mode == "" {
+			r.Mode = matchModeQuiz
+		}
+		if r.Mode != matchModeTopTrumps && r.Mode != matchModeQuiz {
+			return "Invalid match mode specified"
+		}
+		if r.Region == "" {
+			r.Region = "all"
+		}
+		if len(regionRotation(r.Region)) < 4 {
+			return "Invalid or empty region specified"
+		}
+		if r.Rounds == 0 {
+			r.Rounds = defaultMatchRounds
+		}
+		if r.Rounds < 1 || r.Rounds > maxMatchRounds {
+			return "Rounds must be between 1 and 20"
+		}
+	case calendarKindDoubleXP:
+		if r.Region == "all" {
+			r.Region = ""
+		}
+		if r.Region != "" && len(pokemonListByRegion[r.Region]) == 0 {
+			return "Invalid region specified"
+		}
+		if r.Multiplier == 0 {
+			r.Multiplier = defaultXPMultiplier
+		}
+		if r.Multiplier < 2 || r.Multiplier > maxXPMultiplier {
+			return "multiplier must be between 2 and 5"
+		}
+	}
+	return ""
+}
+
+// apply は、リクエストの内容を予定に反映します。
+func (r *calendarEntryRequest) apply(e *CalendarEntry) {
+	e.Kind, e.Title, e.Description = r.Kind, r.Title, r.Description
+	e.StartsAt, e.EndsAt = r.StartsAt, r.EndsAt
+	e.Region, e.Mode, e.Rounds, e.Multiplier = r.Region, r.Mode, r.Rounds, r.Multiplier
+}
+
+// handleCreateCalendarEntry は、予定を登録します（管理者用）。
+func handleCreateCalendarEntry(c *gin.Context) {
+	var req calendarEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if rejectBlockedName(c, "title", req.Title) {
+		return
+	}
+	adminID := c.MustGet("userID").(uint)
+	entry := CalendarEntry{CreatedBy: adminID}
+	req.apply(&entry)
+	err := db.Create(&entry).Error
+	recordAudit(adminID, "calendar_create", "calendar:"+strconv.Itoa(int(entry.ID)), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save calendar entry"})
+		return
+	}
+	reloadXPModifiers(entry.Kind)
+	c.JSON(http.StatusCreated, calendarView(entry))
+}
+
+// handleUpdateCalendarEntry は、予定を書き換えます（管理者用）。始まった予定は種類と開始時刻を変えられません。
+func handleUpdateCalendarEntry(c *gin.Context) {
+	entry, ok := findCalendarEntry(c)
+	if !ok {
+		return
+	}
+	var req calendarEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if entry.ActivatedAt != nil && (req.Kind != entry.Kind || !req.StartsAt.Equal(entry.StartsAt)) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot change the kind or start of an entry that has already started"})
+		return
+	}
+	if rejectBlockedName(c, "title", req.Title) {
+		return
+	}
+	kind := entry.Kind
+	req.apply(entry)
+	err := db.Save(entry).Error
+	recordAudit(c.MustGet("userID").(uint), "calendar_update", "calendar:"+strconv.Itoa(int(entry.ID)), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save calendar entry"})
+		return
+	}
+	reloadXPModifiers(kind)
+	reloadXPModifiers(entry.Kind)
+	c.JSON(http.StatusOK, calendarView(*entry))
+}
+
+// handleDeleteCalendarEntry は、予定を取り消します（管理者用）。作成済みのトーナメントはそのまま残ります。
+func handleDeleteCalendarEntry(c *gin.Context) {
+	entry, ok := findCalendarEntry(c)
+	if !ok {
+		return
+	}
+	err := db.Delete(entry).Error
+	recordAudit(c.MustGet("userID").(uint), "calendar_delete", "calendar:"+strconv.Itoa(int(entry.ID)), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete calendar entry"})
+		return
+	}
+	reloadXPModifiers(entry.Kind)
+	c.Status(http.StatusNoContent)
+}
+
+// findCalendarEntry は、URLの :id の予定を探します。見つからなければエラーを返して false を返します。
+func findCalendarEntry(c *gin.Context) (*CalendarEntry, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar entry ID"})
+		return nil, false
+	}
+	var entry CalendarEntry
+	if err := db.First(&entry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar entry not found"})
+		return nil, false
+	}
+	return &entry, true
+}
+
+// reloadXPModifiers は、XP2倍の予定が変わったときに、XPの倍率（modifiers.go）を読み込み直します。
+func reloadXPModifiers(kind string) {
+	if kind != calendarKindDoubleXP {
+		return
+	}
+	if err := loadXPModifiers(); err != nil {
+		log.Printf("Failed to reload XP modifiers: %v", err)
+	}
+}
+
+// calendarView は、予定をJSONで返す形にします。
+func calendarView(e CalendarEntry) gin.H {
+	view := gin.H{
+		"id":          e.ID,
+		"kind":        e.Kind,
+		"title":       e.Title,
+		"description": e.Description,
+		"startsAt":    e.StartsAt,
+		"endsAt":      e.EndsAt,
+	}
+	switch e.Kind {
+	case calendarKindThemedWeek:
+		view["region"] = e.Region
+	case calendarKindTournament:
+		view["region"] = e.Region
+		view["mode"] = e.Mode
+		view["rounds"] = e.Rounds
+		if e.TournamentID != 0 {
+			view["tournamentId"] = e.TournamentID
+		}
+	case calendarKindDoubleXP:
+		view["multiplier"] = e.Multiplier
+		if e.Region != "" {
+			view["region"] = e.Region
+		}
+	}
+	return view
+}
+
+func calendarViews(entries []CalendarEntry) []gin.H {
+	views := make([]gin.H, len(entries))
+	for i, e := range entries {
+		views[i] = calendarView(e)
+	}
+	return views
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// --- 公式イラストの一部から当てる形式 ---
+
+// 公式イラストの一部を切り抜いた画像を見せて、どのポケモンかを当ててもらいます。
+// イラストのURLには図鑑番号が含まれるので、問題には切り抜いた画像のURL（/quiz/crop/:token）だけを含めます。
+// token はポケモンのIDとシードを暗号化したもので、切り抜く範囲はシードから決まります。
+// デイリーチャレンジでは日付から決めたシードを使うので、その日に遊ぶ全員が同じ範囲を見ることになります。
+
+const (
+	quizModeCrop = "crop"
+
+	cropMinSize   = 0.25 // 切り抜く範囲の一辺の最小値（イラストの一辺に対する割合）
+	cropMaxSize   = 0.40 // 切り抜く範囲の一辺の最大値
+	cropMargin    = 0.15 // イラストの端の余白（何も描かれていないことが多いので避ける）
+	cropCacheSize = 256  // メモリに保持する切り抜いた画像（シルエットを含む）の数
+)
+
+// 切り抜く範囲（イラストの幅・高さに対する割合）
+type cropRect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// cropRectFor は、ポケモンとシードから切り抜く範囲を決めます。同じポケモン・シードからは必ず同じ範囲になります。
+func cropRectFor(pokemon *Pokemon, seed uint64) cropRect {
+	rng := rand.New(rand.NewPCG(seed, uint64(pokemon.ID)))
+	size := cropMinSize + rng.Float64()*(cropMaxSize-cropMinSize)
+	span := 1 - 2*cropMargin - size
+	return cropRect{
+		X:      cropMargin + rng.Float64()*span,
+		Y:      cropMargin + rng.Float64()*span,
+		Width:  size,
+		Height: size,
+	}
+}
+
+// newCropSeed は、問題ごとに切り抜く範囲を決めるシードを作ります。
+func newCropSeed() uint64 {
+	return rand.Uint64()
+}
+
+// cropCipher は、token の暗号化に使うAES-GCMを返します。
+func cropCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(derivedSigningKey("pokequiz-crop"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cropToken は、ポケモンのIDとシードを暗号化した token を作ります。
+// nonce も中身から決めるので、同じポケモン・シードからは同じ token になり、画像をキャッシュできます。
+func cropToken(pokemon *Pokemon, seed uint64) (string, error) {
+	aead, err := cropCipher()
+	if err != nil {
+		return "", err
+	}
+	plain := binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint32(nil, uint32(pokemon.ID)), seed)
+	mac := hmac.New(sha256.New, derivedSigningKey("pokequiz-crop-nonce"))
+	mac.Write(plain)
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// parseCropToken は、token を復号してポケモンとシードを返します。
+func parseCropToken(token string) (*Pokemon, uint64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := cropCipher()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, 0, errors.New("token is too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil || len(plain) != 12 {
+		return nil, 0, errors.New("invalid token")
+	}
+	pokemon, ok := pokemonMapByID[int(binary.BigEndian.Uint32(plain))]
+	if !ok {
+		return nil, 0, errors.New("pokemon not found")
+	}
+	return pokemon, binary.BigEndian.Uint64(plain[4:]), nil
+}
+
+// addCropQuestion は、シードから決めた切り抜く範囲と、切り抜いた画像のURLを問題に加えます。
+func addCropQuestion(question gin.H, pokemon *Pokemon, seed uint64) error {
+	token, err := cropToken(pokemon, seed)
+	if err != nil {
+		return err
+	}
+	question["crop"] = cropRectFor(pokemon, seed)
+	question["imageUrl"] = "/quiz/crop/" + token
+	return nil
+}
+
+// --- 切り抜いた画像 ---
+
+var (
+	cropCache   = make(map[string][]byte)
+	cropCacheMu sync.Mutex
+	cropClient  = &http.Client{Timeout: 10 * time.Second}
+	// 同じ画像を同時に作らないようにする（quiz_pool_cache.go）
+	imageRenderGroup singleflight.Group
+)
+
+// fetchArtwork は、ポケモンの公式イラストを取得します。
+func fetchArtwork(pokemon *Pokemon) (image.Image, error) {
+	resp, err := cropClient.Get(pokemon.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("artwork request failed with status %d", resp.StatusCode)
+	}
+	src, _, err := image.Decode(io.LimitReader(resp.Body, 10<<20))
+	return src, err
+}
+
+// encodePNG は、画像をPNGに変換します。
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cachedImage は、key の画像がキャッシュにあればそれを返し、なければ render で作ってキャッシュします。
+// 同じ key の画像を同時に求められたら、render は1回だけ呼びます。
+func cachedImage(key string, render func() ([]byte, error)) ([]byte, error) {
+	cropCacheMu.Lock()
+	body, ok := cropCache[key]
+	cropCacheMu.Unlock()
+	if ok {
+		return body, nil
+	}
+	v, err, _ := imageRenderGroup.Do(key, func() (any, error) {
+		body, err := render()
+		if err != nil {
+			return nil, err
+		}
+		cropCacheMu.Lock()
+		if len(cropCache) >= cropCacheSize {
+			clear(cropCache) // 古いものから消すほどではないので、いっぱいになったらまとめて消す
+		}
+		cropCache[key] = body
+		cropCacheMu.Unlock()
+		return body, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// renderCrop は、公式イラストを取得して、指定した範囲を切り抜いたPNG画像を作ります。
+func renderCrop(pokemon *Pokemon, rect cropRect) ([]byte, error) {
+	src, err := fetchArtwork(pokemon)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	area := image.Rect(
+		b.Min.X+int(rect.X*float64(b.Dx())),
+		b.Min.Y+int(rect.Y*float64(b.Dy())),
+		b.Min.X+int((rect.X+rect.Width)*float64(b.Dx())),
+		b.Min.Y+int((rect.Y+rect.Height)*float64(b.Dy())),
+	)
+	cropped := image.NewNRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), src, area.Min, draw.Src)
+	return encodePNG(cropped)
+}
+
+// handleGetCropImage は、問題の imageUrl の切り抜いた画像を返します。
+func handleGetCropImage(c *gin.Context) {
+	token := c.Param("token")
+	pokemon, seed, err := parseCropToken(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	if pokemon.ImageURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artwork is not available for this question"})
+		return
+	}
+
+	body, err := cachedImage(token, func() ([]byte, error) { return renderCrop(pokemon, cropRectFor(pokemon, seed)) })
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to load artwork"})
+		return
+	}
+	// token が同じなら画像も変わらない
+	c.Header("Cache-Control", "public, max-age=86400, immutable")
+	c.Data(http.StatusOK, "image/png", body)
+}
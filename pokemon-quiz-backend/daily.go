@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"pokemon-quiz-backend/quiz"
+)
+
+// --- デイリーチャレンジ ---
+
+// 毎日全員に同じ問題を出題します。出題するポケモンと選択肢は日付から決まるシード値で選ぶため、
+// どのサーバーで何度取得しても、再起動しても同じ並びになります。
+// 管理者は記念日などに合わせて、特定の日の1問目（オープニング）を好きなポケモン・出題形式に差し替えられます。
+
+const (
+	dailyChallengeSize   = 5     // 1日に出題する問題数
+	dailyChallengeRegion = "all" // 出題する地方
+)
+
+// --- データベースモデル ---
+
+// 管理者が指定したデイリーチャレンジの1問目
+type DailyOverride struct {
+	gorm.Model
+	Date        string `gorm:"unique;not null"` // YYYY-MM-DD（日本時間）
+	PokemonID   int    `gorm:"not null"`
+	Mode        string `gorm:"not null"`
+	Note        string // 差し替えの理由（「○周年」など）
+	AdminUserID uint   `gorm:"not null"`
+}
+
+// デイリーチャレンジの1問分
+type dailySlot struct {
+	pokemon  *Pokemon
+	question gin.H // クライアントに見せる問題（IDを除く）
+}
+
+// 生成したデイリーチャレンジを日付ごとに保持する（同じ日は全員に同じ選択肢を見せるため）
+var (
+	dailyChallenges   = make(map[string][]dailySlot)
+	dailyChallengesMu sync.Mutex
+)
+
+// dailySeed は、日付から出題に使うシード値を計算します。
+func dailySeed(date string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte("daily:" + date))
+	return h.Sum64()
+}
+
+// getDailyChallenge は、指定した日付のデイリーチャレンジを返します。まだ生成していなければ生成します。
+func getDailyChallenge(date string) ([]dailySlot, error) {
+	dailyChallengesMu.Lock()
+	defer dailyChallengesMu.Unlock()
+
+	if slots, ok := dailyChallenges[date]; ok {
+		return slots, nil
+	}
+
+	pool := regionRotation(dailyChallengeRegion)
+	if len(pool) < 4 {
+		return nil, errors.New("not enough pokemon for daily challenge")
+	}
+	// マップから作ったリストは順番が不定なので、ID順に並べてからシード値で選ぶ
+	sorted := make([]*Pokemon, len(pool))
+	copy(sorted, pool)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	rng := rand.New(rand.NewPCG(dailySeed(date), 0))
+	picks := rng.Perm(len(sorted))
+
+	var override DailyOverride
+	hasOverride := db.Where("date = ?", date).Limit(1).Find(&override).RowsAffected > 0
+
+	slots := make([]dailySlot, 0, dailyChallengeSize)
+	for i := 0; i < dailyChallengeSize && i < len(sorted); i++ {
+		pokemon, mode := sorted[picks[i]], quizModeStats
+		if i == 0 && hasOverride {
+			if p, ok := pokemonMapByID[override.PokemonID]; ok {
+				pokemon, mode = p, override.Mode
+			}
+		}
+		// 選択肢も日付から決まるよう、何問目かごとにシード値から作った乱数で選ぶ（ID順のリストから選ぶ）
+		qr := &quizRand{rng: rand.New(rand.NewPCG(dailySeed(date), uint64(i)+1))}
+		question, err := newQuizQuestion(qr, pokemon, sorted, mode, defaultOptionCount)
+		if err != nil {
+			return nil, err
+		}
+		if question["mode"] == quizModeCrop {
+			// 全員が同じ範囲を見るよう、切り抜く範囲も日付から決める
+			if err := addCropQuestion(question, pokemon, dailySeed(date)+uint64(i)); err != nil {
+				return nil, err
+			}
+		}
+		delete(question, "id") // 正解が分からないようにIDは返さない
+		question["slot"] = i
+		slots = append(slots, dailySlot{pokemon: pokemon, question: question})
+	}
+
+	// 前日以前のチャレンジは不要なので破棄する
+	yesterday := dateKey(time.Now().AddDate(0, 0, -1))
+	for d := range dailyChallenges {
+		if d < yesterday {
+			delete(dailyChallenges, d)
+		}
+	}
+	dailyChallenges[date] = slots
+	return slots, nil
+}
+
+// forgetDailyChallenge は、生成済みのデイリーチャレンジを破棄します（1問目が差し替えられたとき）。
+func forgetDailyChallenge(date string) {
+	dailyChallengesMu.Lock()
+	delete(dailyChallenges, date)
+	dailyChallengesMu.Unlock()
+}
+
+// --- 管理者 ---
+
+// promoteAdmins は、環境変数 ADMIN_USERNAMES（カンマ区切り）に書かれたユーザーを管理者にします。
+func promoteAdmins() {
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := users.PromoteAdmin(name); err != nil {
+			log.Printf("Failed to promote %s to admin: %v", name, err)
+		}
+	}
+}
+
+// adminMiddleware は、管理者以外のリクエストを拒否します。authMiddleware の後に使います。
+func adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.UserByID(c.MustGet("userID").(uint))
+		if err != nil || !user.IsAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin privileges are required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// --- デイリーチャレンジのハンドラ ---
+
+// handleGetDailyChallenge は、今日のデイリーチャレンジの問題を返します。
+func handleGetDailyChallenge(c *gin.Context) {
+	date := dateKey(time.Now())
+	slots, err := getDailyChallenge(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate daily challenge"})
+		return
+	}
+	questions := make([]gin.H, len(slots))
+	for i, slot := range slots {
+		questions[i] = slot.question
+	}
+	c.JSON(http.StatusOK, gin.H{"date": date, "questions": questions})
+}
+
+// dailyAnswerNonce は、ユーザーがその日の何問目かに答えたことを表す nonce を返します。
+func dailyAnswerNonce(date string, slot int, userID uint) string {
+	return fmt.Sprintf("daily:%s:%d:%d", date, slot, userID)
+}
+
+// nextDailyReset は、デイリーチャレンジが次に切り替わる時刻（日本時間の翌日0時）を返します。
+func nextDailyReset(now time.Time) time.Time {
+	y, m, d := now.In(jst).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, jst)
+}
+
+// handleDailyChallengeAnswer は、今日のデイリーチャレンジの問題への回答を採点します。
+func handleDailyChallengeAnswer(c *gin.Context) {
+	var req struct {
+		Slot int    `json:"slot"`
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	slots, err := getDailyChallenge(dateKey(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate daily challenge"})
+		return
+	}
+	if req.Slot < 0 || req.Slot >= len(slots) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slot"})
+		return
+	}
+
+	slot := slots[req.Slot]
+	if !isOfferedOption(slot.question, req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be one of the options from the question"})
+		return
+	}
+	userID, exists := optionalUserID(c)
+	// ログインユーザーは、その日の同じ問題に1回しか答えられない（日付が変わるまで覚えておく）
+	if exists && !consumeAnswerNonce(dailyAnswerNonce(dateKey(time.Now()), req.Slot, userID), nextDailyReset(time.Now())) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already answered this question today"})
+		return
+	}
+	isCorrect := quiz.IsSameAnswer(req.Name, answerName(slot.pokemon, slot.question["mode"].(string)))
+	response := gin.H{
+		"isCorrect":      isCorrect,
+		"correctPokemon": slot.pokemon,
+		"explanation":    buildExplanation(slot.pokemon),
+	}
+	if xp, ok := recordAnswerSubmitted(c, userID, slot.pokemon.ID, slot.question["mode"].(string), "", "daily", isCorrect); ok {
+		response["xp"] = xp
+	}
+	if exists {
+		res, ok, pending := updateUserStats(userID, statsAnswer{PokemonID: slot.pokemon.ID, Mode: slot.question["mode"].(string), IsCorrect: isCorrect, AnsweredAt: time.Now()})
+		if ok {
+			response["streak"] = res.Streak
+			response["stats"] = res.Stats
+			response["score"] = res.Score
+		}
+		if pending {
+			response["statsPending"] = true
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleListDailyOverrides は、今日以降に予定されている1問目の差し替えを返します。
+func handleListDailyOverrides(c *gin.Context) {
+	var overrides []DailyOverride
+	if err := db.Where("date >= ?", dateKey(time.Now())).Order("date asc").Find(&overrides).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load overrides"})
+		return
+	}
+	result := make([]gin.H, len(overrides))
+	for i, o := range overrides {
+		result[i] = gin.H{"date": o.Date, "pokemonId": o.PokemonID, "mode": o.Mode, "note": o.Note}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleSetDailyOverride は、指定した日（省略時は明日）のデイリーチャレンジの1問目を差し替えます。
+// 同じ日に既に差し替えがあれば上書きします。
+func handleSetDailyOverride(c *gin.Context) {
+	var req struct {
+		Date      string `json:"date"`
+		PokemonID int    `json:"pokemonId" binding:"required"`
+		Mode      string `json:"mode"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pokemonId is required"})
+		return
+	}
+	now := time.Now()
+	if req.Date == "" {
+		req.Date = dateKey(now.AddDate(0, 0, 1))
+	}
+	if _, err := time.ParseInLocation("2006-01-02", req.Date, jst); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+		return
+	}
+	if req.Date < dateKey(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot override a past daily challenge"})
+		return
+	}
+	if _, ok := pokemonMapByID[req.PokemonID]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pokemon not found"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = quizModeStats
+	}
+	if !quizModes[req.Mode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz mode specified"})
+		return
+	}
+
+	override := DailyOverride{Date: req.Date}
+	if err := db.FirstOrInit(&override, DailyOverride{Date: req.Date}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save override"})
+		return
+	}
+	override.PokemonID = req.PokemonID
+	override.Mode = req.Mode
+	override.Note = req.Note
+	override.AdminUserID = c.MustGet("userID").(uint)
+	if err := db.Save(&override).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save override"})
+		return
+	}
+	forgetDailyChallenge(req.Date)
+
+	c.JSON(http.StatusOK, gin.H{"date": override.Date, "pokemonId": override.PokemonID, "mode": override.Mode, "note": override.Note})
+}
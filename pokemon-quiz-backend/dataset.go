@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 問題の難しさの公開データセット ---
+
+// 研究者やコミュニティのツール制作者が使えるよう、ポケモンごとの回答数と正答率を集計したデータセットを
+// 決まったURL（/datasets/difficulty.json と /datasets/difficulty.csv）で公開します。
+// 集計は DATASET_INTERVAL_HOURS（既定は24時間）ごとに作り直し、その間は同じ内容を返します。
+// 個人を特定できないよう、ユーザーの情報は含めず、回答したユーザーが datasetMinPlayers 人未満のポケモンは載せません。
+
+const (
+	defaultDatasetIntervalHours = 24
+	datasetMinPlayers           = 5
+)
+
+// 全ユーザー分を合計した、ポケモンごとの回答記録
+type pokemonAttemptTotal struct {
+	PokemonID int
+	Players   int
+	Attempts  int
+	Correct   int
+}
+
+// データセットの1行
+type difficultyRow struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	EnglishName string  `json:"englishName"`
+	Attempts    int     `json:"attempts"`
+	Correct     int     `json:"correct"`
+	Accuracy    float64 `json:"accuracy"`
+}
+
+// 公開中のデータセット
+type difficultyDataset struct {
+	GeneratedAt time.Time       `json:"generatedAt"`
+	MinPlayers  int             `json:"minPlayers"`
+	Pokemon     []difficultyRow `json:"pokemon"`
+	csv         []byte
+}
+
+var (
+	datasetMu sync.Mutex
+	dataset   *difficultyDataset
+)
+
+// buildDifficultyDataset は、回答記録を集計してデータセットを作ります。
+func buildDifficultyDataset(now time.Time) (*difficultyDataset, error) {
+	totals, err := users.PokemonAttemptTotals()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]difficultyRow, 0, len(totals))
+	for _, t := range totals {
+		if t.Players < datasetMinPlayers || t.Attempts == 0 {
+			continue
+		}
+		row := difficultyRow{ID: t.PokemonID, Attempts: t.Attempts, Correct: t.Correct, Accuracy: float64(t.Correct) / float64(t.Attempts)}
+		if p, ok := pokemonMapByID[t.PokemonID]; ok {
+			row.Name, row.EnglishName = p.Name, p.EnglishName
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "name", "english_name", "attempts", "correct", "accuracy"})
+	for _, r := range rows {
+		w.Write([]string{strconv.Itoa(r.ID), r.Name, r.EnglishName, strconv.Itoa(r.Attempts), strconv.Itoa(r.Correct), strconv.FormatFloat(r.Accuracy, 'f', 4, 64)})
+	}
+	w.Flush()
+
+	return &difficultyDataset{GeneratedAt: now, MinPlayers: datasetMinPlayers, Pokemon: rows, csv: buf.Bytes()}, nil
+}
+
+// publishDifficultyDataset は、データセットを作り直して公開します。
+func publishDifficultyDataset() {
+	d, err := buildDifficultyDataset(time.Now())
+	if err != nil {
+		log.Printf("Failed to build difficulty dataset: %v", err)
+		return
+	}
+	datasetMu.Lock()
+	dataset = d
+	datasetMu.Unlock()
+	log.Printf("Published difficulty dataset with %d Pokemon.", len(d.Pokemon))
+}
+
+// startDatasetPublisher は、データセットを定期的に作り直すジョブを開始します。
+func startDatasetPublisher(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultDatasetIntervalHours * time.Hour
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			publishDifficultyDataset()
+		}
+	}()
+}
+
+// currentDifficultyDataset は、公開中のデータセットを返します。まだなければここで作ります。
+func currentDifficultyDataset() *difficultyDataset {
+	datasetMu.Lock()
+	d := dataset
+	datasetMu.Unlock()
+	if d == nil {
+		publishDifficultyDataset()
+		datasetMu.Lock()
+		d = dataset
+		datasetMu.Unlock()
+	}
+	return d
+}
+
+// handleGetDifficultyDataset は、公開中のデータセットをJSONで返します。
+func handleGetDifficultyDataset(c *gin.Context) {
+	d := currentDifficultyDataset()
+	if d == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Dataset is not available yet"})
+		return
+	}
+	body, err := json.Marshal(d)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode dataset"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("Last-Modified", d.GeneratedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// handleGetDifficultyDatasetCSV は、公開中のデータセットをCSVで返します。
+func handleGetDifficultyDatasetCSV(c *gin.Context) {
+	d := currentDifficultyDataset()
+	if d == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Dataset is not available yet"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("Last-Modified", d.GeneratedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", d.csv)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- ポケモンデータの更新の差分 ---
+
+// 起動時にPokeAPIからポケモンデータを取り直したり、足りないポケモンを取得したりしたときに、
+// 取得の前後で追加・削除・変更されたポケモンと項目を記録します。
+// 管理者は GET /admin/data/diffs で、PokeAPIの更新で何が変わったのかを出題に影響する前に確認できます。
+// 何も変わらなかった場合は記録しません。
+
+const (
+	defaultDatasetDiffLimit = 10
+	maxDatasetDiffLimit     = 50
+
+	datasetSyncInitial = "initial_fetch" // pokemon.json がなく、全て取得した
+	datasetSyncRefetch = "refetch"       // pokemon.json の項目が足りず、全て取り直した
+	datasetSyncTopUp   = "top_up"        // pokemon.json にないポケモンだけを取得した
+)
+
+// --- データベースモデル ---
+
+// ポケモンデータの更新の差分
+type DatasetDiff struct {
+	gorm.Model
+	Source  string `gorm:"not null"`
+	Added   int
+	Removed int
+	Changed int
+	Details string `gorm:"type:text"` // datasetDiffDetails をJSONで保存
+}
+
+// 追加・削除されたポケモン
+type datasetDiffEntry struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// 変更された項目
+type datasetFieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// 変更されたポケモン
+type datasetPokemonChange struct {
+	ID     int                  `json:"id"`
+	Name   string               `json:"name"`
+	Fields []datasetFieldChange `json:"fields"`
+}
+
+// 差分の中身
+type datasetDiffDetails struct {
+	Added   []datasetDiffEntry     `json:"added"`
+	Removed []datasetDiffEntry     `json:"removed"`
+	Changed []datasetPokemonChange `json:"changed"`
+}
+
+// ポケモンデータの、項目名と値の組（JSONにしたときの名前で比べる）
+type pokemonDataSnapshot map[int]map[string]any
+
+// snapshotPokemonData は、今のポケモンデータを比べられる形で写し取ります。
+// 取り直すとポケモンのデータが上書きされることがあるので、ポインタではなく値を写す。
+func snapshotPokemonData() pokemonDataSnapshot {
+	snapshot := make(pokemonDataSnapshot, len(pokemonMapByID))
+	for id, p := range pokemonMapByID {
+		data, err := json.Marshal(p)
+		if err != nil {
+			continue
+		}
+		var fields map[string]any
+		if json.Unmarshal(data, &fields) == nil {
+			snapshot[id] = fields
+		}
+	}
+	return snapshot
+}
+
+// diffPokemonData は、2つのポケモンデータの差分を、IDの順に並べて返します。
+func diffPokemonData(before, after pokemonDataSnapshot) datasetDiffDetails {
+	var details datasetDiffDetails
+	for id, b := range before {
+		if _, ok := after[id]; !ok {
+			details.Removed = append(details.Removed, datasetDiffEntry{ID: id, Name: snapshotName(b)})
+		}
+	}
+	for id, a := range after {
+		b, ok := before[id]
+		if !ok {
+			details.Added = append(details.Added, datasetDiffEntry{ID: id, Name: snapshotName(a)})
+			continue
+		}
+		var fields []datasetFieldChange
+		for _, field := range unionKeys(b, a) {
+			if !reflect.DeepEqual(b[field], a[field]) {
+				fields = append(fields, datasetFieldChange{Field: field, Before: b[field], After: a[field]})
+			}
+		}
+		if len(fields) > 0 {
+			details.Changed = append(details.Changed, datasetPokemonChange{ID: id, Name: snapshotName(a), Fields: fields})
+		}
+	}
+	sort.Slice(details.Added, func(i, j int) bool { return details.Added[i].ID < details.Added[j].ID })
+	sort.Slice(details.Removed, func(i, j int) bool { return details.Removed[i].ID < details.Removed[j].ID })
+	sort.Slice(details.Changed, func(i, j int) bool { return details.Changed[i].ID < details.Changed[j].ID })
+	return details
+}
+
+// unionKeys は、2つの項目の一覧に含まれる項目名を並べて返します。
+func unionKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func snapshotName(fields map[string]any) string {
+	name, _ := fields["name"].(string)
+	return name
+}
+
+// recordDatasetDiff は、before からの今のポケモンデータの差分を記録します。何も変わっていなければ記録しません。
+func recordDatasetDiff(source string, before pokemonDataSnapshot) {
+	details := diffPokemonData(before, snapshotPokemonData())
+	if len(details.Added) == 0 && len(details.Removed) == 0 && len(details.Changed) == 0 {
+		log.Printf("Pokemon data %s made no changes.", source)
+		return
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		log.Printf("Failed to encode the Pokemon data diff: %v", err)
+		return
+	}
+	diff := DatasetDiff{Source: source, Added: len(details.Added), Removed: len(details.Removed), Changed: len(details.Changed), Details: string(data)}
+	if err := db.Create(&diff).Error; err != nil {
+		log.Printf("Failed to save the Pokemon data diff: %v", err)
+		return
+	}
+	log.Printf("Pokemon data %s: %d added, %d removed, %d changed.", source, diff.Added, diff.Removed, diff.Changed)
+}
+
+// --- ポケモンデータの更新の差分のハンドラ（管理者用） ---
+
+// handleListDatasetDiffs は、ポケモンデータの更新の差分を新しい順に返します。
+func handleListDatasetDiffs(c *gin.Context) {
+	limit := defaultDatasetDiffLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDatasetDiffLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50"})
+			return
+		}
+		limit = n
+	}
+	var diffs []DatasetDiff
+	if err := db.Order("id desc").Limit(limit).Find(&diffs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load data diffs"})
+		return
+	}
+	result := make([]gin.H, len(diffs))
+	for i, d := range diffs {
+		var details datasetDiffDetails
+		json.Unmarshal([]byte(d.Details), &details)
+		result[i] = gin.H{
+			"id":           d.ID,
+			"source":       d.Source,
+			"syncedAt":     d.CreatedAt,
+			"addedCount":   d.Added,
+			"removedCount": d.Removed,
+			"changedCount": d.Changed,
+			"added":        details.Added,
+			"removed":      details.Removed,
+			"changed":      details.Changed,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"diffs": result})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 図鑑番号の範囲で出題 ---
+
+// from・to クエリパラメータで図鑑番号の範囲（例: 1〜151、252〜386）を指定すると、
+// 地方の区切りとは関係なく、その範囲のポケモンから出題します。
+// 不正解の選択肢も同じ範囲から選ぶので、地方で出題する場合と同じく、同じタイプのポケモンが混ざるようにします。
+// フォルム違い（図鑑番号が10000番台）は範囲に含めません。
+
+// dexRangeParam は、from・to クエリパラメータを読み取ります。
+// どちらも指定されていなければ set は false、値が不正なら ok は false を返します。
+func dexRangeParam(c *gin.Context) (from, to int, set, ok bool) {
+	qFrom, qTo := c.Query("from"), c.Query("to")
+	if qFrom == "" && qTo == "" {
+		return 0, 0, false, true
+	}
+	from, errFrom := strconv.Atoi(qFrom)
+	to, errTo := strconv.Atoi(qTo)
+	if errFrom != nil || errTo != nil || from < 1 || to < from || to >= formIDOffset {
+		return 0, 0, true, false
+	}
+	return from, to, true, true
+}
+
+// dexRangePool は、図鑑番号が from 以上 to 以下のポケモンを図鑑番号の順に返します。
+func dexRangePool(from, to int) []*Pokemon {
+	pool := make([]*Pokemon, 0, to-from+1)
+	for id := from; id <= to; id++ {
+		if p, ok := pokemonMapByID[id]; ok {
+			pool = append(pool, p)
+		}
+	}
+	return pool
+}
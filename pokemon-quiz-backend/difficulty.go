@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// --- 難易度 ---
+
+// 難易度「hard」では、種族値が正解に近いポケモンを不正解の選択肢にします。
+// 種族値の近さは6つの種族値を座標としたユークリッド距離で測り、地方ごとの近傍を起動時に計算しておきます。
+
+const (
+	difficultyEasy   = "easy"
+	difficultyNormal = "normal"
+	difficultyHard   = "hard"
+
+	// hard で選択肢の候補にする近傍の数。最も近い3匹に固定すると毎回同じ選択肢になるため少しだけ幅を持たせる
+	statNeighborCount = 5
+)
+
+// 有効な難易度の一覧
+var difficulties = map[string]bool{
+	difficultyEasy:   true,
+	difficultyNormal: true,
+	difficultyHard:   true,
+}
+
+// 地方ごと・ポケモンごとの、種族値が近い順の近傍（データの読み込み後にバックグラウンドで構築する）
+var (
+	statNeighborIndex   = make(map[string]map[int][]*Pokemon)
+	statNeighborIndexMu sync.RWMutex
+)
+
+// statDistance は、2匹のポケモンの種族値のユークリッド距離の2乗を返します（大小の比較にしか使わないので平方根は取らない）。
+func statDistance(a, b *Pokemon) int {
+	d := func(x, y int) int { return (x - y) * (x - y) }
+	return d(a.Stats.HP, b.Stats.HP) +
+		d(a.Stats.Attack, b.Stats.Attack) +
+		d(a.Stats.Defense, b.Stats.Defense) +
+		d(a.Stats.SpAttack, b.Stats.SpAttack) +
+		d(a.Stats.SpDefense, b.Stats.SpDefense) +
+		d(a.Stats.Speed, b.Stats.Speed)
+}
+
+// nearestByStats は、プールの中から種族値が近い順に最大k匹を返します。
+// 正解と同じ名前のポケモン（フォルム違い）は選択肢として紛らわしいため除きます。
+func nearestByStats(pokemon *Pokemon, pool []*Pokemon, k int) []*Pokemon {
+	candidates := make([]*Pokemon, 0, len(pool))
+	for _, p := range pool {
+		if p.ID != pokemon.ID && p.Name != pokemon.Name {
+			candidates = append(candidates, p)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		di, dj := statDistance(pokemon, candidates[i]), statDistance(pokemon, candidates[j])
+		if di != dj {
+			return di < dj
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// buildStatNeighborIndex は、地方ごとに各ポケモンの種族値の近傍を計算します。
+func buildStatNeighborIndex() {
+	index := make(map[string]map[int][]*Pokemon, len(pokemonListByRegion))
+	for region, list := range pokemonListByRegion {
+		neighbors := make(map[int][]*Pokemon, len(list))
+		for _, p := range list {
+			neighbors[p.ID] = nearestByStats(p, list, statNeighborCount)
+		}
+		index[region] = neighbors
+	}
+	statNeighborIndexMu.Lock()
+	statNeighborIndex = index
+	statNeighborIndexMu.Unlock()
+}
+
+// optionsPoolForDifficulty は、難易度に応じて不正解の選択肢の候補を絞り込みます。
+// region には optionsPool がどの地方の一覧かを渡します（地方の一覧でなければ空文字）。
+func optionsPoolForDifficulty(pokemon *Pokemon, optionsPool []*Pokemon, difficulty, region string, optionCount int) []*Pokemon {
+	if difficulty != difficultyHard {
+		return optionsPool
+	}
+	// 4択と同じく、必要な不正解の数より2匹多い近傍から選ぶ
+	k := optionCount + 1
+	if k < statNeighborCount {
+		k = statNeighborCount
+	}
+	statNeighborIndexMu.RLock()
+	neighbors, ok := statNeighborIndex[region][pokemon.ID]
+	statNeighborIndexMu.RUnlock()
+	if ok && k == statNeighborCount {
+		return neighbors
+	}
+	// 索引にないプール（プリセットやコンテンツパック）や索引の構築前、索引より多くの近傍が必要な場合はその場で計算する
+	return nearestByStats(pokemon, optionsPool, k)
+}
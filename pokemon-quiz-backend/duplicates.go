@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- 重複アカウントの検出 ---
+
+// 複数のアカウントで答えを教え合って順位を稼ぐのを防ぐため、同じ端末やIPアドレスから使われているアカウントをグループにまとめ、
+// 賞品の対象となるランキング（GET /leaderboard?prizeEligible=true）から外します。
+// 登録・ログインのたびに、端末ID（クライアントが送る X-Device-ID ヘッダー）とIPアドレスを記録します。
+// IPアドレスや端末IDはそのまま保存せず、サーバーの鍵で HMAC を取った値だけを保存します。
+// 同じ端末IDを使ったアカウント、または2つ以上の同じIPアドレスを使ったアカウントを同じグループとみなします
+// （学校や携帯回線ではIPアドレスを共有することがあるので、1つだけでは判定しない）。
+// 誤判定のこともあるので、グループに入ったアカウントは管理者が申し立てを認めて対象に戻せます。
+// 検出はログインのたびにそのアカウントについて行い、管理者は POST /admin/duplicates/scan で全体を検出し直せます。
+
+const (
+	accountSignalIP     = "ip"
+	accountSignalDevice = "device"
+
+	deviceIDHeader       = "X-Device-ID"
+	maxDeviceIDLength    = 128
+	duplicateMinSharedIP = 2 // 同じグループとみなすのに必要な、共有しているIPアドレスの数
+)
+
+// --- データベースモデル ---
+
+// アカウントが使われた端末・IPアドレス（値は HMAC を取ったもの）
+type AccountSignal struct {
+	ID         uint      `gorm:"primarykey"`
+	UserID     uint      `gorm:"uniqueIndex:idx_account_signal;not null"`
+	Kind       string    `gorm:"uniqueIndex:idx_account_signal;index:idx_account_signal_value;not null"` // ip / device
+	ValueHash  string    `gorm:"uniqueIndex:idx_account_signal;index:idx_account_signal_value;not null"`
+	LastSeenAt time.Time `gorm:"index"`
+}
+
+// 重複の疑いでグループにまとめたアカウント
+type DuplicateFlag struct {
+	gorm.Model
+	UserID     uint   `gorm:"uniqueIndex;not null"`
+	GroupID    string `gorm:"index;not null"` // グループの中で最も小さいユーザーIDから作る
+	Reason     string // device / ip
+	Cleared    bool   // 管理者が申し立てを認めて、ランキングの対象に戻した
+	ReviewedBy uint
+	Note       string
+}
+
+// signalHash は、端末IDやIPアドレスを保存用の値にします。
+func signalHash(kind, value string) string {
+	mac := hmac.New(sha256.New, derivedSigningKey("pokequiz-account-signal"))
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordAccountSignals は、リクエストの端末IDとIPアドレスを記録し、他のアカウントと重複していればグループにまとめます。
+// 記録に失敗してもログインは続けるので、エラーはログに残すだけにします。
+func recordAccountSignals(c *gin.Context, userID uint) {
+	now := time.Now()
+	var signals []AccountSignal
+	if ip := c.ClientIP(); ip != "" {
+		signals = append(signals, AccountSignal{UserID: userID, Kind: accountSignalIP, ValueHash: signalHash(accountSignalIP, ip), LastSeenAt: now})
+	}
+	if device := c.GetHeader(deviceIDHeader); device != "" && len(device) <= maxDeviceIDLength {
+		signals = append(signals, AccountSignal{UserID: userID, Kind: accountSignalDevice, ValueHash: signalHash(accountSignalDevice, device), LastSeenAt: now})
+	}
+	if len(signals) == 0 {
+		return
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "kind"}, {Name: "value_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen_at"}),
+	}).Create(&signals).Error
+	if err != nil {
+		log.Printf("Failed to record account signals for user %d: %v", userID, err)
+		return
+	}
+	if err := flagLinkedAccounts(userID); err != nil {
+		log.Printf("Failed to check duplicate accounts for user %d: %v", userID, err)
+	}
+}
+
+// linkedAccounts は、userID と端末またはIPアドレスを共有しているアカウントと、その理由を返します。
+func linkedAccounts(userID uint) (map[uint]string, error) {
+	var mine []AccountSignal
+	if err := db.Where("user_id = ?", userID).Find(&mine).Error; err != nil {
+		return nil, err
+	}
+	linked := make(map[uint]string)
+	sharedIPs := make(map[uint]int)
+	for _, s := range mine {
+		var others []uint
+		err := db.Model(&AccountSignal{}).Where("kind = ? AND value_hash = ? AND user_id <> ?", s.Kind, s.ValueHash, userID).
+			Distinct().Pluck("user_id", &others).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range others {
+			if s.Kind == accountSignalDevice {
+				linked[other] = accountSignalDevice
+			} else if sharedIPs[other]++; sharedIPs[other] >= duplicateMinSharedIP && linked[other] == "" {
+				linked[other] = accountSignalIP
+			}
+		}
+	}
+	return linked, nil
+}
+
+// flagLinkedAccounts は、userID と重複しているアカウントがあれば、まとめて同じグループにします。
+func flagLinkedAccounts(userID uint) error {
+	linked, err := linkedAccounts(userID)
+	if err != nil || len(linked) == 0 {
+		return err
+	}
+	reason := accountSignalIP
+	group := []uint{userID}
+	for id, r := range linked {
+		group = append(group, id)
+		if r == accountSignalDevice {
+			reason = accountSignalDevice
+		}
+	}
+	return flagDuplicateGroup(group, reason)
+}
+
+// flagDuplicateGroup は、アカウントを同じグループにまとめます。既にグループに入っているアカウントは、
+// 管理者の判断（Cleared）を残したまま、小さい方のグループIDにそろえます。
+func flagDuplicateGroup(group []uint, reason string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var existing []DuplicateFlag
+		if err := tx.Where("user_id IN ?", group).Find(&existing).Error; err != nil {
+			return err
+		}
+		// 既存のグループとつながった場合は、そのグループのアカウントもまとめる
+		groupIDs := make([]string, 0, len(existing))
+		for _, f := range existing {
+			groupIDs = append(groupIDs, f.GroupID)
+		}
+		if len(groupIDs) > 0 {
+			var members []uint
+			if err := tx.Model(&DuplicateFlag{}).Where("group_id IN ?", groupIDs).Pluck("user_id", &members).Error; err != nil {
+				return err
+			}
+			group = append(group, members...)
+		}
+		slices.Sort(group)
+		group = slices.Compact(group)
+		groupID := "g" + strconv.FormatUint(uint64(group[0]), 10)
+
+		if err := tx.Model(&DuplicateFlag{}).Where("user_id IN ?", group).Update("group_id", groupID).Error; err != nil {
+			return err
+		}
+		for _, id := range group {
+			flag := DuplicateFlag{UserID: id, GroupID: groupID, Reason: reason}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&flag).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// prizeIneligibleUsers は、重複の疑いでグループにまとめられ、申し立てが認められていないアカウントを返します。
+func prizeIneligibleUsers() (map[uint]bool, error) {
+	var ids []uint
+	if err := db.Model(&DuplicateFlag{}).Where("cleared = ?", false).Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	ineligible := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		ineligible[id] = true
+	}
+	return ineligible, nil
+}
+
+// --- 重複アカウントのハンドラ（管理者用） ---
+
+// handleListDuplicateGroups は、重複の疑いでまとめたアカウントをグループごとに返します。
+func handleListDuplicateGroups(c *gin.Context) {
+	var flags []DuplicateFlag
+	if err := db.Order("group_id, user_id").Find(&flags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duplicate accounts"})
+		return
+	}
+	groups := make([]gin.H, 0)
+	index := make(map[string]int)
+	for _, f := range flags {
+		i, ok := index[f.GroupID]
+		if !ok {
+			i = len(groups)
+			index[f.GroupID] = i
+			groups = append(groups, gin.H{"groupId": f.GroupID, "accounts": []gin.H{}})
+		}
+		name := ""
+		if user, err := users.UserByID(f.UserID); err == nil {
+			name = user.Username
+		}
+		groups[i]["accounts"] = append(groups[i]["accounts"].([]gin.H), gin.H{
+			"userId":     f.UserID,
+			"username":   name,
+			"reason":     f.Reason,
+			"cleared":    f.Cleared,
+			"reviewedBy": f.ReviewedBy,
+			"note":       f.Note,
+			"flaggedAt":  f.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// handleReviewDuplicateAccount は、申し立てを受けたアカウントをランキングの対象に戻す（または戻したのを取り消す）。
+func handleReviewDuplicateAccount(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var req struct {
+		Cleared *bool  `json:"cleared" binding:"required"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cleared is required"})
+		return
+	}
+	var flag DuplicateFlag
+	if err := db.Where("user_id = ?", userID).First(&flag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "This account has not been flagged"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duplicate account"})
+		return
+	}
+	adminID := c.MustGet("userID").(uint)
+	flag.Cleared, flag.ReviewedBy, flag.Note = *req.Cleared, adminID, req.Note
+	err = db.Save(&flag).Error
+	action := "duplicate_clear"
+	if !flag.Cleared {
+		action = "duplicate_reflag"
+	}
+	recordAudit(adminID, action, strconv.Itoa(userID), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update duplicate account"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"userId": flag.UserID, "groupId": flag.GroupID, "cleared": flag.Cleared, "note": flag.Note})
+}
+
+// handleScanDuplicateAccounts は、記録済みの全アカウントについて重複を検出し直します。
+func handleScanDuplicateAccounts(c *gin.Context) {
+	var ids []uint
+	if err := db.Model(&AccountSignal{}).Distinct().Pluck("user_id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account signals"})
+		return
+	}
+	for _, id := range ids {
+		if err := flagLinkedAccounts(id); err != nil {
+			recordAudit(c.MustGet("userID").(uint), "duplicate_scan", "", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan duplicate accounts"})
+			return
+		}
+	}
+	recordAudit(c.MustGet("userID").(uint), "duplicate_scan", "", nil)
+	var flagged int64
+	db.Model(&DuplicateFlag{}).Count(&flagged)
+	c.JSON(http.StatusOK, gin.H{"scannedAccounts": len(ids), "flaggedAccounts": flagged})
+}
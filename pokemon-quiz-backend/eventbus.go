@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- イベントバス ---
+
+// サーバー内で発生したイベントをトピックごとに購読者へ配信する仕組みです。
+// 配信はメモリ上だけで行うため、購読していなかった間のイベントは届きません。
+
+// 購読者に届けるイベント
+type busEvent struct {
+	Type string
+	Data any
+}
+
+const (
+	eventBufferSize   = 16               // 購読者ごとの未送信イベントの上限
+	eventStreamPingIn = 15 * time.Second // 接続維持のためのpingの間隔
+)
+
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan busEvent]struct{}
+}
+
+var events = &eventBus{subscribers: make(map[string]map[chan busEvent]struct{})}
+
+// Subscribe は、トピックを購読します。戻り値の関数を呼ぶと購読を解除します。
+func (b *eventBus) Subscribe(topic string) (<-chan busEvent, func()) {
+	ch := make(chan busEvent, eventBufferSize)
+	b.mu.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan busEvent]struct{})
+	}
+	b.subscribers[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers[topic], ch)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Publish は、トピックの購読者全員にイベントを配信します。
+// 受信が追いつかない購読者にはイベントを捨てて、発行側を待たせないようにします。
+func (b *eventBus) Publish(topic, eventType string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[topic] {
+		select {
+		case ch <- busEvent{Type: eventType, Data: data}:
+		default:
+		}
+	}
+}
+
+// streamEvents は、トピックのイベントをServer-Sent Eventsとしてクライアントに送り続けます。
+// initial が nil でなければ、接続直後に現在の状態として送ります。
+func streamEvents(c *gin.Context, topic string, initial *busEvent) {
+	ch, unsubscribe := events.Subscribe(topic)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("X-Accel-Buffering", "no") // リバースプロキシによるバッファリングを無効化
+	if initial != nil {
+		c.SSEvent(initial.Type, initial.Data)
+		c.Writer.Flush()
+	}
+
+	ticker := time.NewTicker(eventStreamPingIn)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev := <-ch:
+			c.SSEvent(ev.Type, ev.Data)
+			return true
+		case <-ticker.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
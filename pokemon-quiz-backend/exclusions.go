@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 出題から外すポケモン ---
+
+// 画像が壊れている・フォルムの扱いに異論があるなど、問題のあるポケモンを、データを作り直さずにすぐ出題から外せるようにします。
+// 管理者は /admin/exclusions でポケモンのID（pokemonId）またはカテゴリ（"mega"・"gmax" や地方名など）を登録し、
+// 登録したものは /quiz・セッション・まとめて出題・デイリー・オフライン用の問題パック・対戦・イベントの出題と、
+// 不正解の選択肢から外れます。
+// 既に作ったデイリーチャレンジや、出題中の問題・パックはそのまま答え合わせできます。
+// 地方（kanto など）と "all" の出題の候補が minRegionPoolSize 匹より少なくなる登録は断ります（409）。
+// それでも候補がなくなった地方で進行中のセッションや対戦は、次の出題のときに 409 を返して終了します。
+
+const (
+	maxExclusionReasonLength = 200
+	minRegionPoolSize        = 4 // 地方の出題に最低限必要なポケモンの数（選択肢の数）
+)
+
+var (
+	errExclusionTarget = errors.New("exactly one of pokemonId or category is required")
+	// 出題から外したため、地方に出題できるポケモンがいない
+	errRegionUnavailable = errors.New("no pokemon are available in the region")
+)
+
+// --- データベースモデル ---
+
+// 出題から外すポケモン（PokemonID と Category のどちらか一方を指定する）
+type QuizExclusion struct {
+	gorm.Model
+	PokemonID int    `gorm:"index"`
+	Category  string `gorm:"index"`
+	Reason    string
+	CreatedBy uint
+}
+
+// 判定に使う一覧
+type exclusionSet struct {
+	ids        map[int]bool
+	categories map[string]bool
+	version    string // 読み込み直すたびに変わる（出題の候補の作り置きのキーに使う）
+}
+
+var (
+	exclusionsMu      sync.RWMutex
+	exclusions        = &exclusionSet{}
+	exclusionsVersion int
+)
+
+// loadExclusions は、出題から外すポケモンの一覧を読み込み直します。
+func loadExclusions() error {
+	var rows []QuizExclusion
+	if err := db.Find(&rows).Error; err != nil {
+		return err
+	}
+	set := &exclusionSet{ids: make(map[int]bool), categories: make(map[string]bool)}
+	for _, r := range rows {
+		if r.PokemonID != 0 {
+			set.ids[r.PokemonID] = true
+		}
+		if r.Category != "" {
+			set.categories[r.Category] = true
+		}
+	}
+
+	exclusionsMu.Lock()
+	exclusionsVersion++
+	set.version = strconv.Itoa(exclusionsVersion)
+	exclusions = set
+	exclusionsMu.Unlock()
+	return nil
+}
+
+// currentExclusions は、今の一覧を返します。一覧は読み込み直すたびに作り直すので、返したものは変更されません。
+func currentExclusions() *exclusionSet {
+	exclusionsMu.RLock()
+	defer exclusionsMu.RUnlock()
+	return exclusions
+}
+
+func (s *exclusionSet) empty() bool {
+	return len(s.ids) == 0 && len(s.categories) == 0
+}
+
+func (s *exclusionSet) has(p *Pokemon) bool {
+	return s.ids[p.ID] || s.categories[p.Category]
+}
+
+// with は、ポケモンのIDまたはカテゴリを加えた一覧を返します（元の一覧は変更しない）。
+func (s *exclusionSet) with(pokemonID int, category string) *exclusionSet {
+	set := &exclusionSet{ids: make(map[int]bool), categories: make(map[string]bool)}
+	for id := range s.ids {
+		set.ids[id] = true
+	}
+	for c := range s.categories {
+		set.categories[c] = true
+	}
+	if pokemonID != 0 {
+		set.ids[pokemonID] = true
+	}
+	if category != "" {
+		set.categories[category] = true
+	}
+	return set
+}
+
+// tooSmallRegion は、この一覧で外すと出題の候補が minRegionPoolSize 匹より少なくなる地方を返します。
+// 元から少ない地方は対象にしません。
+func (s *exclusionSet) tooSmallRegion() (string, bool) {
+	for region, genID := range regionGenerationMap {
+		if genID <= 0 {
+			continue
+		}
+		if regionTooSmall(s, region) {
+			return region, true
+		}
+	}
+	if regionTooSmall(s, "all") {
+		return "all", true
+	}
+	return "", false
+}
+
+func regionTooSmall(s *exclusionSet, region string) bool {
+	list := pokemonListByRegion[region]
+	if len(list) < minRegionPoolSize {
+		return false
+	}
+	remaining := 0
+	for _, p := range list {
+		if !s.has(p) {
+			remaining++
+		}
+	}
+	return remaining < minRegionPoolSize
+}
+
+// isExcluded は、ポケモンが出題から外されていれば true を返します。
+func isExcluded(p *Pokemon) bool {
+	return currentExclusions().has(p)
+}
+
+// withoutExcluded は、一覧から出題から外したポケモンを除いた一覧を返します。
+// 何も外していなければ、コピーせずにそのまま返します。
+func withoutExcluded(list []*Pokemon) []*Pokemon {
+	set := currentExclusions()
+	if set.empty() {
+		return list
+	}
+	filtered := make([]*Pokemon, 0, len(list))
+	for _, p := range list {
+		if !set.has(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// regionRotation は、地方の出題の候補（出題から外したポケモンを除いたもの）を返します。
+func regionRotation(region string) []*Pokemon {
+	return withoutExcluded(pokemonListByRegion[region])
+}
+
+// --- 出題から外すポケモンのハンドラ（管理者用） ---
+
+// handleListExclusions は、出題から外しているポケモンの一覧を返します。
+func handleListExclusions(c *gin.Context) {
+	var rows []QuizExclusion
+	if err := db.Order("id asc").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exclusions"})
+		return
+	}
+	result := make([]gin.H, len(rows))
+	for i, r := range rows {
+		result[i] = exclusionView(r)
+	}
+	c.JSON(http.StatusOK, gin.H{"exclusions": result})
+}
+
+// handleCreateExclusion は、ポケモンのIDまたはカテゴリを出題から外します。すぐに出題に反映します。
+func handleCreateExclusion(c *gin.Context) {
+	var req struct {
+		PokemonID int    `json:"pokemonId"`
+		Category  string `json:"category"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errExclusionTarget.Error()})
+		return
+	}
+	req.Category = strings.ToLower(strings.TrimSpace(req.Category))
+	if (req.PokemonID == 0) == (req.Category == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errExclusionTarget.Error()})
+		return
+	}
+	if len([]rune(req.Reason)) > maxExclusionReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be at most 200 characters"})
+		return
+	}
+	target := "category:" + req.Category
+	if req.PokemonID != 0 {
+		if _, ok := pokemonMapByID[req.PokemonID]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pokemon not found"})
+			return
+		}
+		target = "pokemon:" + strconv.Itoa(req.PokemonID)
+	} else if !knownCategory(req.Category) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	if region, ok := currentExclusions().with(req.PokemonID, req.Category).tooSmallRegion(); ok {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("This exclusion would leave fewer than %d Pokemon in %s", minRegionPoolSize, region)})
+		return
+	}
+
+	adminID := c.MustGet("userID").(uint)
+	row := QuizExclusion{PokemonID: req.PokemonID, Category: req.Category}
+	err := db.Where(QuizExclusion{PokemonID: req.PokemonID, Category: req.Category}).
+		Assign(QuizExclusion{Reason: req.Reason, CreatedBy: adminID}).FirstOrCreate(&row).Error
+	recordAudit(adminID, "quiz_exclusion_create", target, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exclusion"})
+		return
+	}
+	if err := loadExclusions(); err != nil {
+		log.Printf("Failed to reload exclusions: %v", err)
+	}
+	c.JSON(http.StatusCreated, exclusionView(row))
+}
+
+// handleDeleteExclusion は、出題から外したポケモンを出題に戻します。
+func handleDeleteExclusion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exclusion ID"})
+		return
+	}
+	var row QuizExclusion
+	if err := db.First(&row, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exclusion not found"})
+		return
+	}
+	target := "category:" + row.Category
+	if row.PokemonID != 0 {
+		target = "pokemon:" + strconv.Itoa(row.PokemonID)
+	}
+	err = db.Unscoped().Delete(&row).Error
+	recordAudit(c.MustGet("userID").(uint), "quiz_exclusion_delete", target, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exclusion"})
+		return
+	}
+	if err := loadExclusions(); err != nil {
+		log.Printf("Failed to reload exclusions: %v", err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// knownCategory は、読み込んだデータにそのカテゴリのポケモンがいれば true を返します。
+func knownCategory(category string) bool {
+	for _, p := range pokemonMapByID {
+		if p.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusionView は、出題から外したポケモンをJSONで返す形にします。
+func exclusionView(r QuizExclusion) gin.H {
+	view := gin.H{"id": r.ID, "reason": r.Reason, "createdBy": r.CreatedBy, "createdAt": r.CreatedAt}
+	if r.PokemonID != 0 {
+		view["pokemonId"] = r.PokemonID
+		if p, ok := pokemonMapByID[r.PokemonID]; ok {
+			view["name"] = p.Name
+		}
+	} else {
+		view["category"] = r.Category
+	}
+	return view
+}
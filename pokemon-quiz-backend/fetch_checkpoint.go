@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// --- 取得の途中経過の保存 ---
+
+// PokeAPIからの一括取得は1000件以上のリクエストになるため、途中経過をファイルに保存しておきます。
+// 取得中にプロセスが落ちたりデプロイされたりしても、次の起動時は取得済みのIDを飛ばして続きから取得します。
+
+const fetchCheckpointInterval = 50 // このID数を取得するごとに途中経過を保存する
+
+// fetchCheckpointFile は、途中経過を保存するファイルのパスを返します。
+func fetchCheckpointFile() string {
+	return pokemonDataFile + ".checkpoint"
+}
+
+// 保存する途中経過
+type fetchCheckpoint struct {
+	CompletedIDs []int            `json:"completedIds"` // フォルム違いも含めて取得し終えた図鑑番号（存在しなかったIDも含む）
+	Pokemon      map[int]*Pokemon `json:"pokemon"`
+}
+
+// 取得中の途中経過
+type fetchProgress struct {
+	mu        *sync.Mutex // pokemonMapByID を守るロック（fetchAllPokemonData と共有）
+	completed map[int]bool
+	unsaved   int
+}
+
+// loadFetchCheckpoint は、保存された途中経過を読み込み、取得済みのポケモンを pokemonMapByID に戻します。
+// 途中経過がない、または今のデータ形式と合わない場合は最初から取得します。
+func loadFetchCheckpoint(mu *sync.Mutex) *fetchProgress {
+	progress := &fetchProgress{mu: mu, completed: make(map[int]bool)}
+	data, err := os.ReadFile(fetchCheckpointFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return progress
+	}
+	if err != nil {
+		log.Printf("Failed to read fetch checkpoint, starting from scratch: %v", err)
+		return progress
+	}
+	var checkpoint fetchCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		log.Printf("Fetch checkpoint is corrupted, starting from scratch: %v", err)
+		return progress
+	}
+	for _, p := range checkpoint.Pokemon {
+		if isPokemonDataIncomplete(p) {
+			log.Println("Fetch checkpoint was saved by an older version, starting from scratch.")
+			return progress
+		}
+	}
+
+	for id, p := range checkpoint.Pokemon {
+		pokemonMapByID[id] = p
+	}
+	for _, id := range checkpoint.CompletedIDs {
+		progress.completed[id] = true
+	}
+	log.Printf("Resuming PokeAPI fetch from checkpoint: %d IDs already fetched.", len(progress.completed))
+	return progress
+}
+
+// isCompleted は、図鑑番号が取得済みかどうかを返します。
+func (fp *fetchProgress) isCompleted(id int) bool {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return fp.completed[id]
+}
+
+// markCompleted は、図鑑番号を取得済みにし、一定数ごとに途中経過を保存します。
+func (fp *fetchProgress) markCompleted(id int) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.completed[id] = true
+	fp.unsaved++
+	if fp.unsaved >= fetchCheckpointInterval {
+		fp.saveLocked()
+	}
+}
+
+// save は、途中経過を保存します。
+func (fp *fetchProgress) save() {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.saveLocked()
+}
+
+// saveLocked は、途中経過を一時ファイルに書いてから置き換えます（書き込み中に落ちても壊れないように）。
+// 呼び出し側で fp.mu をロックしておく必要があります。
+func (fp *fetchProgress) saveLocked() {
+	checkpoint := fetchCheckpoint{
+		CompletedIDs: make([]int, 0, len(fp.completed)),
+		Pokemon:      pokemonMapByID,
+	}
+	for id := range fp.completed {
+		checkpoint.CompletedIDs = append(checkpoint.CompletedIDs, id)
+	}
+	if err := writeFileAtomic(fetchCheckpointFile(), checkpoint); err != nil {
+		log.Printf("Failed to save fetch checkpoint: %v", err)
+		return
+	}
+	fp.unsaved = 0
+}
+
+// writeFileAtomic は、値をJSONにして一時ファイルに書き、書き終えてからファイルを置き換えます。
+func writeFileAtomic(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// clearFetchCheckpoint は、取得したデータを pokemon.json に保存し終えた後に途中経過を削除します。
+func clearFetchCheckpoint() {
+	if err := os.Remove(fetchCheckpointFile()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove fetch checkpoint: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "strings"
+
+// --- フォルム違いの表示名 ---
+
+// リージョンフォーム・メガシンカ・キョダイマックスなどのフォルム違いは、PokeAPI の日本語名が元のポケモンと同じなので、
+// そのままだと選択肢に同じ名前が並んだり、不正解の選択肢が正解と同じ名前になったりします。
+// そこでデータを読み込んだ後に、フォルム違いの名前をフォルムが分かる表示名（「サンドパン（アローラ）」「メガリザードンX」など）にします。
+// フォルムは PokeAPI の名前（EnglishName、"sandslash-alola" など）の接尾辞から判定し、
+// 表示名は元のポケモンの名前から作り直すので、何度適用しても同じ名前になります。
+
+// 名前の後ろに括弧書きで付けるフォルム（PokeAPI の名前の接尾辞と日本語の表記）
+var formNameSuffixes = []struct {
+	suffix string
+	label  string
+}{
+	{"-alola", "アローラ"},
+	{"-galar", "ガラル"},
+	{"-hisui", "ヒスイ"},
+	{"-paldea", "パルデア"},
+	{"-gmax", "キョダイマックス"},
+}
+
+// formDisplayName は、フォルム違いの表示名と読みを返します。フォルムが分からなければ元の名前と読みを返します。
+func formDisplayName(apiName, name, reading string) (string, string) {
+	// メガシンカは「メガ」を前に付け、X・Y があれば後ろに付ける
+	if i := strings.Index(apiName, "-mega"); i >= 0 {
+		variant := strings.ToUpper(strings.TrimPrefix(apiName[i+len("-mega"):], "-"))
+		return "メガ" + name + variant, "メガ" + reading + variant
+	}
+	for _, f := range formNameSuffixes {
+		if strings.Contains(apiName, f.suffix) {
+			return name + "（" + f.label + "）", reading + "（" + f.label + "）"
+		}
+	}
+	return name, reading
+}
+
+// applyFormDisplayNames は、読み込んだフォルム違いのポケモンの名前を、元のポケモンの名前から作った表示名にします。
+func applyFormDisplayNames() {
+	for _, p := range pokemonMapByID {
+		if p.ID < formIDOffset {
+			continue
+		}
+		base, ok := pokemonMapByID[p.SpeciesID]
+		if !ok {
+			continue
+		}
+		p.Name, p.NameReading = formDisplayName(p.EnglishName, base.Name, base.NameReading)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- フロントエンドの配信（セルフホスト用） ---
+
+// フロントエンドのビルド結果をこのサーバーから / で配信し、1つのプロセスだけでクイズ全体を動かせるようにします。
+// ビルド結果は -tags embedui でバイナリに埋め込むか（frontend/ に置いてからビルドする）、FRONTEND_DIR でディレクトリを指定します。
+// どちらもなければ、これまでどおりAPIだけを提供します。
+//
+// APIとフロントエンドのパス（/quiz など）が重なるため、次の順に振り分けます。
+//  1. ビルド結果に存在するファイルへの GET・HEAD はそのファイルを返す
+//  2. どのAPIのルートにも当てはまらないパスへのブラウザの画面遷移（Accept に text/html を含む GET・HEAD）は
+//     index.html を返す（SPAのルーティング）
+//  3. それ以外はAPIとして処理する（/stats などAPIのパスは、ブラウザから開いてもAPIの応答を返す）
+
+// frontendFS は、配信するフロントエンドのビルド結果を返します。なければ nil を返します。
+func frontendFS() fs.FS {
+	fsys := embeddedFrontend()
+	source := "embedded assets"
+	if dir := os.Getenv("FRONTEND_DIR"); dir != "" {
+		fsys = os.DirFS(dir)
+		source = dir
+	}
+	if fsys == nil {
+		return nil
+	}
+	if _, err := fs.Stat(fsys, "index.html"); err != nil {
+		log.Printf("Frontend index.html not found in %s, serving the API only.", source)
+		return nil
+	}
+	log.Printf("Serving frontend from %s.", source)
+	return fsys
+}
+
+// apiRoutePatterns は、APIのルートのパスを "/" で区切ったものです（メソッドは区別しない）。
+type apiRoutePatterns [][]string
+
+// newAPIRoutePatterns は、gin に登録したルートからAPIのパスの一覧を作ります。
+func newAPIRoutePatterns(routes gin.RoutesInfo) apiRoutePatterns {
+	patterns := make(apiRoutePatterns, 0, len(routes))
+	for _, r := range routes {
+		patterns = append(patterns, strings.Split(strings.Trim(r.Path, "/"), "/"))
+	}
+	return patterns
+}
+
+// match は、パスがいずれかのAPIのルートに当てはまるかを返します。
+// :name は1つの区切りに、*name は残りすべてに当てはまります。
+func (p apiRoutePatterns) match(urlPath string) bool {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	for _, pattern := range p {
+		if matchRouteSegments(pattern, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRouteSegments(pattern, segments []string) bool {
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(part, ":") && part != segments[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+// withFrontend は、フロントエンドのファイルと画面遷移のリクエストを処理し、それ以外をAPIのハンドラに渡します。
+func withFrontend(api http.Handler, fsys fs.FS, routes apiRoutePatterns) http.Handler {
+	files := http.FileServerFS(fsys)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			api.ServeHTTP(w, r)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if info, err := fs.Stat(fsys, name); err == nil && !info.IsDir() && name != "index.html" {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			files.ServeHTTP(w, r)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "text/html") && !routes.match(path.Clean(r.URL.Path)) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "DENY")
+			w.Header().Set("Cache-Control", "no-cache") // 新しいビルドをすぐに反映する
+			http.ServeFileFS(w, r, fsys, "index.html")
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+}
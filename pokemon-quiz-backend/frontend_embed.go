@@ -0,0 +1,22 @@
+//go:build embedui
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// frontend/ に置いたフロントエンドのビルド結果（npm run build の出力）
+//
+//go:embed all:frontend
+var embeddedFrontendFiles embed.FS
+
+// embeddedFrontend は、バイナリに埋め込んだフロントエンドのビルド結果を返します。
+func embeddedFrontend() fs.FS {
+	sub, err := fs.Sub(embeddedFrontendFiles, "frontend")
+	if err != nil {
+		return nil
+	}
+	return sub
+}
@@ -0,0 +1,10 @@
+//go:build !embedui
+
+package main
+
+import "io/fs"
+
+// embeddedFrontend は、-tags embedui を付けずにビルドした場合は nil を返します（FRONTEND_DIR は使える）。
+func embeddedFrontend() fs.FS {
+	return nil
+}
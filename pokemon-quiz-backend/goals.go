@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- デイリー目標 ---
+
+// 日付の区切りは日本時間で判定する（実行環境にタイムゾーンデータがなくても動くよう固定オフセットを使う）
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+const (
+	defaultDailyQuestions = 10
+	maxDailyQuestions     = 500
+)
+
+// --- データベースモデル ---
+
+// ユーザーが設定したデイリー目標と、目標達成の連続日数
+type UserGoal struct {
+	gorm.Model
+	UserID            uint   `gorm:"unique;not null"`
+	DailyQuestions    int    `gorm:"default:10"` // 1日に解く問題数の目標
+	DailyAccuracy     int    `gorm:"default:0"`  // 1日の正答率の目標（%）。0なら問わない
+	GoalStreak        int    `gorm:"default:0"`  // 目標を連続で達成した日数
+	BestGoalStreak    int    `gorm:"default:0"`
+	LastCompletedDate string // 最後に目標を達成した日付 (YYYY-MM-DD)
+}
+
+// ユーザーの1日ごとの進捗
+type DailyProgress struct {
+	gorm.Model
+	UserID    uint   `gorm:"uniqueIndex:idx_daily_progress;not null"`
+	Date      string `gorm:"uniqueIndex:idx_daily_progress;not null"` // YYYY-MM-DD
+	Questions int    `gorm:"default:0"`
+	Correct   int    `gorm:"default:0"`
+	Completed bool   `gorm:"default:false"`
+}
+
+// dateKey は、日本時間での日付を YYYY-MM-DD 形式で返します。
+func dateKey(t time.Time) string {
+	return t.In(jst).Format("2006-01-02")
+}
+
+// isGoalMet は、その日の進捗が目標を満たしているか判定します。
+func isGoalMet(goal *UserGoal, progress *DailyProgress) bool {
+	if progress.Questions < goal.DailyQuestions {
+		return false
+	}
+	return progress.Correct*100 >= goal.DailyAccuracy*progress.Questions
+}
+
+// updateDailyProgress は、回答結果を今日の進捗に加算し、目標を達成したら連続日数を更新します。
+// updateUserStats のトランザクション内から呼び出されます。
+func updateDailyProgress(tx *gorm.DB, userID uint, isCorrect bool, now time.Time) error {
+	var progress DailyProgress
+	if err := tx.FirstOrCreate(&progress, DailyProgress{UserID: userID, Date: dateKey(now)}).Error; err != nil {
+		return err
+	}
+	var goal UserGoal
+	err := tx.First(&goal, "user_id = ?", userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	// 目標を設定していないユーザーは進捗の記録のみ行う
+	hasGoal := err == nil
+	if addDailyProgress(&goal, hasGoal, &progress, isCorrect, now) {
+		if err := tx.Save(&goal).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Save(&progress).Error
+}
+
+// addDailyProgress は、回答結果をその日の進捗に加算します（保存はしない）。
+// 目標を設定していて（hasGoal）、この回答で目標を達成したら連続日数を更新して true を返します。
+func addDailyProgress(goal *UserGoal, hasGoal bool, progress *DailyProgress, isCorrect bool, now time.Time) bool {
+	progress.Questions++
+	if isCorrect {
+		progress.Correct++
+	}
+	if !hasGoal || progress.Completed || !isGoalMet(goal, progress) {
+		return false
+	}
+	progress.Completed = true
+	today := dateKey(now)
+	yesterday := dateKey(now.AddDate(0, 0, -1))
+	if goal.LastCompletedDate == yesterday {
+		goal.GoalStreak++
+	} else if goal.LastCompletedDate != today {
+		goal.GoalStreak = 1
+	}
+	if goal.GoalStreak > goal.BestGoalStreak {
+		goal.BestGoalStreak = goal.GoalStreak
+	}
+	goal.LastCompletedDate = today
+	return true
+}
+
+// setDailyGoal は、指定された項目だけ目標を変更します（保存はしない）。
+func setDailyGoal(goal *UserGoal, dailyQuestions, dailyAccuracy *int) {
+	if dailyQuestions != nil {
+		goal.DailyQuestions = *dailyQuestions
+	}
+	if dailyAccuracy != nil {
+		goal.DailyAccuracy = *dailyAccuracy
+	}
+}
+
+// goalState は、目標と今日の進捗をクライアントに返す形に組み立てます。
+func goalState(goal *UserGoal, progress *DailyProgress, now time.Time) gin.H {
+	// 昨日も今日も達成していなければ連続記録は途切れている
+	streak := goal.GoalStreak
+	if goal.LastCompletedDate != dateKey(now) && goal.LastCompletedDate != dateKey(now.AddDate(0, 0, -1)) {
+		streak = 0
+	}
+	accuracy := 0
+	if progress.Questions > 0 {
+		accuracy = progress.Correct * 100 / progress.Questions
+	}
+	return gin.H{
+		"dailyQuestions": goal.DailyQuestions,
+		"dailyAccuracy":  goal.DailyAccuracy,
+		"today": gin.H{
+			"date":      progress.Date,
+			"questions": progress.Questions,
+			"correct":   progress.Correct,
+			"accuracy":  accuracy,
+			"completed": progress.Completed,
+		},
+		"goalStreak":     streak,
+		"bestGoalStreak": goal.BestGoalStreak,
+	}
+}
+
+// loadGoalState は、ユーザーの目標と今日の進捗を読み込みます。目標が未設定ならデフォルト値で返します。
+func loadGoalState(userID uint) (gin.H, error) {
+	now := time.Now()
+	goal, progress, err := users.DailyGoal(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	return goalState(&goal, &progress, now), nil
+}
+
+// --- デイリー目標のハンドラ ---
+
+// handleGetGoals は、ログインユーザーのデイリー目標と今日の進捗を返します。
+func handleGetGoals(c *gin.Context) {
+	state, err := loadGoalState(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load goals"})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// handleUpdateGoals は、ログインユーザーのデイリー目標を変更します。指定されなかった項目は変更しません。
+func handleUpdateGoals(c *gin.Context) {
+	var req struct {
+		DailyQuestions *int `json:"dailyQuestions"`
+		DailyAccuracy  *int `json:"dailyAccuracy"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.DailyQuestions != nil && (*req.DailyQuestions < 1 || *req.DailyQuestions > maxDailyQuestions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dailyQuestions must be between 1 and 500"})
+		return
+	}
+	if req.DailyAccuracy != nil && (*req.DailyAccuracy < 0 || *req.DailyAccuracy > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dailyAccuracy must be between 0 and 100"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if err := users.UpdateDailyGoal(userID, req.DailyQuestions, req.DailyAccuracy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update goals"})
+		return
+	}
+
+	state, err := loadGoalState(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load goals"})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
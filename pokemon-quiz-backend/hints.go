@@ -0,0 +1,193 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 段階的なヒント ---
+
+// /quiz の問題には questionId を付け、どのポケモンを出題したかをサーバー側で覚えておきます。
+// GET /quiz/:questionID/hint を呼ぶたびに、タイプ → 名前の最初の1文字 → シルエット の順にヒントを1つずつ明かします。
+// 使ったヒントの数は問題ごとに記録し、答え合わせ（/answer）やスキップの応答で返すので、
+// 得点の計算でヒントを使った分を減らせます。ヒントを使うたびに行動記録（hint_used）にも残します。
+// シルエットの画像のURLにも図鑑番号を含めないよう、/quiz/:questionID/silhouette から返します。
+
+const (
+	hintStageType           = 1
+	hintStageFirstCharacter = 2
+	hintStageSilhouette     = 3
+	maxHintStage            = hintStageSilhouette
+
+	servedQuestionTTL        = time.Hour
+	servedQuestionSweepEvery = time.Minute
+)
+
+// 出題した問題
+type servedQuestion struct {
+	ID             string
+	UserID         uint // ログインせずに出題した場合は0
+	Mode           string
+	Pack           string
+	Options        []string // 出題した選択肢（50/50で取り除く選択肢を選ぶのに使う）
+	HintsUsed      int
+	FiftyFiftyUsed bool
+	pokemon        *Pokemon
+	servedAt       time.Time
+}
+
+var (
+	servedQuestions   = make(map[string]*servedQuestion)
+	servedQuestionsMu sync.Mutex
+	lastQuestionSweep time.Time
+)
+
+// registerServedQuestion は、出題した問題を覚えておき、問題に questionId を付けます。
+func registerServedQuestion(question gin.H, pokemon *Pokemon, mode, pack string, userID uint) error {
+	id, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	servedQuestionsMu.Lock()
+	defer servedQuestionsMu.Unlock()
+	// 問題は1問ごとに増えるので、毎回ではなく一定の間隔で期限切れのものを消す
+	if now.Sub(lastQuestionSweep) > servedQuestionSweepEvery {
+		for qid, q := range servedQuestions {
+			if now.Sub(q.servedAt) > servedQuestionTTL {
+				delete(servedQuestions, qid)
+			}
+		}
+		lastQuestionSweep = now
+	}
+	served := &servedQuestion{ID: id, UserID: userID, Mode: mode, Pack: pack, pokemon: pokemon, servedAt: now}
+	if options, ok := question["options"].([]string); ok {
+		served.Options = options
+	}
+	servedQuestions[id] = served
+	question["questionId"] = id
+	return nil
+}
+
+// lookupServedQuestion は、questionId の問題を返します。他のユーザーに出題した問題や期限切れの問題は見つからない扱いにします。
+// 呼び出し側で servedQuestionsMu をロックしておく必要があります。
+func lookupServedQuestion(id string, userID uint) (*servedQuestion, bool) {
+	q, ok := servedQuestions[id]
+	if !ok || time.Since(q.servedAt) > servedQuestionTTL || (q.UserID != 0 && q.UserID != userID) {
+		return nil, false
+	}
+	return q, true
+}
+
+// takeServedQuestion は、答え合わせやスキップが済んだ問題を取り出して忘れます。
+func takeServedQuestion(id string, userID uint) (*servedQuestion, bool) {
+	servedQuestionsMu.Lock()
+	defer servedQuestionsMu.Unlock()
+	q, ok := lookupServedQuestion(id, userID)
+	if ok {
+		delete(servedQuestions, id)
+	}
+	return q, ok
+}
+
+// revealedHints は、指定した段階までに明かしたヒントをまとめて返します。
+func revealedHints(q *servedQuestion, stage int) gin.H {
+	hints := gin.H{}
+	if stage >= hintStageType {
+		hints["types"] = q.pokemon.Types
+	}
+	if stage >= hintStageFirstCharacter {
+		name := []rune(answerName(q.pokemon, q.Mode))
+		if len(name) > 0 {
+			hints["firstCharacter"] = string(name[0])
+		}
+	}
+	if stage >= hintStageSilhouette {
+		hints["silhouetteUrl"] = "/quiz/" + q.ID + "/silhouette"
+	}
+	return hints
+}
+
+// handleGetHint は、問題のヒントを次の段階まで明かします。
+func handleGetHint(c *gin.Context) {
+	userID, _ := optionalUserID(c)
+	servedQuestionsMu.Lock()
+	defer servedQuestionsMu.Unlock()
+	q, ok := lookupServedQuestion(c.Param("questionID"), userID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	if quizOnlyModes[q.Mode] {
+		c.JSON(http.StatusConflict, gin.H{"error": "Hints are not available in this quiz mode"})
+		return
+	}
+	last := maxHintStage
+	if q.pokemon.ImageURL == "" {
+		last = hintStageFirstCharacter
+	}
+	if q.HintsUsed >= last {
+		c.JSON(http.StatusConflict, gin.H{"error": "No more hints are available", "hintsUsed": q.HintsUsed, "hints": revealedHints(q, q.HintsUsed)})
+		return
+	}
+	q.HintsUsed++
+	recordActivity(ActivityEvent{Type: activityTypeHintUsed, UserID: userID, PokemonID: q.pokemon.ID, Mode: q.Mode, Pack: q.Pack, Source: "quiz"})
+
+	c.JSON(http.StatusOK, gin.H{
+		"questionId": q.ID,
+		"hintsUsed":  q.HintsUsed,
+		"remaining":  last - q.HintsUsed,
+		"hints":      revealedHints(q, q.HintsUsed),
+	})
+}
+
+// renderSilhouette は、公式イラストを黒く塗りつぶしたシルエットのPNG画像を作ります。
+func renderSilhouette(pokemon *Pokemon) ([]byte, error) {
+	src, err := fetchArtwork(pokemon)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	silhouette := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			_, _, _, a := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			silhouette.SetNRGBA(x, y, color.NRGBA{A: uint8(a >> 8)})
+		}
+	}
+	return encodePNG(silhouette)
+}
+
+// handleGetSilhouette は、シルエットのヒントを明かした問題のシルエット画像を返します。
+func handleGetSilhouette(c *gin.Context) {
+	userID, _ := optionalUserID(c)
+	servedQuestionsMu.Lock()
+	q, ok := lookupServedQuestion(c.Param("questionID"), userID)
+	var pokemon *Pokemon
+	revealed := false
+	if ok {
+		pokemon, revealed = q.pokemon, q.HintsUsed >= hintStageSilhouette
+	}
+	servedQuestionsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	if !revealed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The silhouette hint has not been revealed yet"})
+		return
+	}
+	body, err := cachedImage("silhouette:"+strconv.Itoa(pokemon.ID), func() ([]byte, error) { return renderSilhouette(pokemon) })
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to load artwork"})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, "image/png", body)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- HTTPメソッドの扱い ---
+
+// GETのエンドポイントは全てHEADでも呼び出せるようにし、登録されていないメソッドには Allow ヘッダー付きの 405 を返します。
+// OPTIONS はCORSのプリフライト以外でも、そのパスで使えるメソッドを Allow ヘッダーで返します。
+
+// corsAllowMethods は、CORSで許可するメソッドです。
+var corsAllowMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// withHeadSupport は、HEADのリクエストを同じパスのGETとしてルーターに渡します。
+// レスポンスのボディは net/http がHEADのリクエストに対して書き込まないので、ヘッダーだけが返ります。
+func withHeadSupport(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+		get := r.Clone(r.Context())
+		get.Method = http.MethodGet
+		h.ServeHTTP(w, get)
+	})
+}
+
+// handleMethodNotAllowed は、パスはあるがメソッドが登録されていないリクエストに応答します。
+// gin が設定した Allow ヘッダーに HEAD と OPTIONS を加え、OPTIONS なら 204、それ以外は 405 を返します。
+func handleMethodNotAllowed(c *gin.Context) {
+	allowed := strings.Split(c.Writer.Header().Get("Allow"), ", ")
+	for _, m := range allowed {
+		if m == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+			break
+		}
+	}
+	allowed = append(allowed, http.MethodOptions)
+	c.Header("Allow", strings.Join(allowed, ", "))
+
+	if c.Request.Method == http.MethodOptions {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Idempotency-Key ---
+
+// 通信が不安定なスマートフォンでは、/answer の応答が届かずにクライアントが同じ回答を送り直すことがあります。
+// 送り直しで成績（TotalQuestions や地方ごとの成績）が2回数えられないよう、Idempotency-Key ヘッダーを受け付け、
+// 同じユーザー（ログインしていなければIPアドレス）から同じキーで来たリクエストには、1回目の応答をそのまま返します。
+//   - 1回目の処理中に同じキーで来たリクエストは 409 で断る
+//   - 同じキーで中身の違うリクエストが来たら 422 で断る（キーの使い回しの間違い）
+//   - 1回目がサーバーのエラー（5xx）だったら覚えず、送り直しを処理する
+//
+// キーと応答はメモリに IDEMPOTENCY_KEY_TTL（既定は10分）だけ覚えておきます。
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotencyReplayHeader  = "Idempotent-Replayed"
+	defaultIdempotencyKeyTTL = 10 * time.Minute
+	maxIdempotencyKeyLength  = 255
+)
+
+// 処理したリクエストと、その応答
+type idempotentResponse struct {
+	requestHash [sha256.Size]byte
+	done        bool // false なら処理中
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// 処理したキーを覚えておく場所
+type idempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*idempotentResponse
+	lastSweep time.Time
+}
+
+// /answer のキー（main で IDEMPOTENCY_KEY_TTL から作る）
+var answerIdempotency = newIdempotencyStore(defaultIdempotencyKeyTTL)
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: make(map[string]*idempotentResponse)}
+}
+
+// begin は、キーの処理を始めます。既に覚えているキーなら、その記録と false を返します。
+func (s *idempotencyStore) begin(key string, hash [sha256.Size]byte, now time.Time) (idempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// リクエストのたびに全体を見ると重いので、一定の間隔で期限切れのものを消す
+	if now.Sub(s.lastSweep) > nonceSweepPeriod {
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expiresAt) {
+		return *e, false
+	}
+	s.entries[key] = &idempotentResponse{requestHash: hash, expiresAt: now.Add(s.ttl)}
+	return idempotentResponse{}, true
+}
+
+// finish は、処理したキーの応答を覚えます。
+func (s *idempotencyStore) finish(key string, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.done, e.status, e.contentType, e.body = true, status, contentType, body
+	}
+}
+
+// forget は、キーを忘れて、同じキーでもう一度処理できるようにします。
+func (s *idempotencyStore) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// 応答の本文を書き出しながら控えておく ResponseWriter
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware は、Idempotency-Key ヘッダーが付いたリクエストを1回だけ処理し、送り直しには同じ応答を返します。
+func idempotencyMiddleware(s *idempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// キーはユーザーごとに別にする（他のユーザーと同じキーを使っても、他のユーザーの応答は返さない）
+		scoped := rateLimitKey(c) + ":" + c.FullPath() + ":" + key
+		hash := sha256.Sum256(body)
+		prev, first := s.begin(scoped, hash, time.Now())
+		switch {
+		case first:
+		case prev.requestHash != hash:
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			return
+		case !prev.done:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			return
+		default:
+			c.Header(idempotencyReplayHeader, "true")
+			c.Data(prev.status, prev.contentType, prev.body)
+			c.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		finished := false
+		defer func() {
+			// パニックした場合も含め、応答を覚えられなかったキーは忘れる
+			if !finished {
+				s.forget(scoped)
+			}
+		}()
+		c.Next()
+		if status := w.Status(); status < http.StatusInternalServerError {
+			s.finish(scoped, status, w.Header().Get("Content-Type"), w.body.Bytes())
+			finished = true
+		}
+	}
+}
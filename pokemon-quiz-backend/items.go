@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- アイテム ---
+
+// 回答の成績に応じてアイテムを獲得し、持ち物（GET /me/items）から使えるようにします。
+// 今あるのは「連続正解シールド」（streak_shield）だけで、連続正解が10問続くたびに1つ獲得します（最大3つまで）。
+// POST /me/items/streak_shield/use で使うとシールドを構え、次に間違えたときに1回だけ連続正解が途切れなくなります。
+// アイテムの獲得・消費はすべてサーバーが成績の更新と一緒に（userStore の ApplyAnswers の中で）行い、
+// クライアントからは「使う」ことしかできないので、持っていないアイテムを使ったり数を書き換えたりはできません。
+
+const (
+	itemStreakShield       = "streak_shield"
+	streakShieldEvery      = 10 // この数の連続正解ごとにシールドを獲得する
+	maxStreakShieldsInHand = 3
+)
+
+var (
+	errItemNotOwned      = errors.New("item not owned")
+	errItemAlreadyActive = errors.New("item already active")
+)
+
+// アイテムの種類
+type itemInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MaxQuantity int    `json:"maxQuantity"`
+}
+
+// アイテムの一覧
+var itemCatalog = []itemInfo{
+	{ID: itemStreakShield, Name: "連続正解シールド", Description: "次に間違えたとき、1回だけ連続正解が途切れなくなる", MaxQuantity: maxStreakShieldsInHand},
+}
+
+// lookupItem は、IDからアイテムの種類を返します。
+func lookupItem(id string) (itemInfo, bool) {
+	for _, item := range itemCatalog {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return itemInfo{}, false
+}
+
+// --- データベースモデル ---
+
+// ユーザーの持ち物
+type InventoryItem struct {
+	gorm.Model
+	UserID   uint   `gorm:"uniqueIndex:idx_inventory_item;not null"`
+	Item     string `gorm:"uniqueIndex:idx_inventory_item;not null"`
+	Quantity int    `gorm:"default:0"`
+	Active   bool   // 使って効果が続いている（シールドを構えている）
+}
+
+// lockInventoryItem は、持ち物のレコードをロックして取得します。なければ作成します。
+func lockInventoryItem(tx *gorm.DB, userID uint, item string) (InventoryItem, error) {
+	// 同時に作成されても一意制約で1件になるよう、既にあれば何もしない
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&InventoryItem{UserID: userID, Item: item}).Error; err != nil {
+		return InventoryItem{}, err
+	}
+	var inv InventoryItem
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND item = ?", userID, item).First(&inv).Error
+	return inv, err
+}
+
+// consumeStreakShield は、構えているシールドがあれば使い切って true を返します。
+func consumeStreakShield(tx *gorm.DB, userID uint) (bool, error) {
+	res := tx.Model(&InventoryItem{}).Where("user_id = ? AND item = ? AND active = ?", userID, itemStreakShield, true).Update("active", false)
+	return res.RowsAffected > 0, res.Error
+}
+
+// grantStreakShield は、シールドを1つ獲得させます。持てる数の上限に達していれば何もせず false を返します。
+func grantStreakShield(tx *gorm.DB, userID uint) (bool, error) {
+	inv, err := lockInventoryItem(tx, userID, itemStreakShield)
+	if err != nil || inv.Quantity >= maxStreakShieldsInHand {
+		return false, err
+	}
+	inv.Quantity++
+	return true, tx.Save(&inv).Error
+}
+
+// needsStreakShield は、この回答で構えているシールドを使うか（間違えて連続正解が途切れるか）を返します。
+func needsStreakShield(stat *UserStat, a statsAnswer) bool {
+	return !a.IsCorrect && stat.CurrentStreak > 0
+}
+
+// earnsStreakShield は、回答を反映した後の連続正解が、シールドを獲得する区切りの数に達したかを返します。
+func earnsStreakShield(a statsAnswer, streak answerStreak) bool {
+	return a.IsCorrect && streak.Current > 0 && streak.Current%streakShieldEvery == 0
+}
+
+// useInventoryItem は、持ち物のアイテムを1つ使って構えます（保存はしない）。
+func useInventoryItem(inv *InventoryItem) error {
+	// 効果は重ねられないので、構えている間は次を使えない
+	if inv.Active {
+		return errItemAlreadyActive
+	}
+	if inv.Quantity <= 0 {
+		return errItemNotOwned
+	}
+	inv.Quantity--
+	inv.Active = true
+	return nil
+}
+
+// applyStreakShieldBefore は applyAnswer の前に呼び、間違えたときに構えているシールドがあれば使って、
+// 連続正解を守るよう回答に印を付けます。
+func applyStreakShieldBefore(tx *gorm.DB, userID uint, stat *UserStat, a statsAnswer) (statsAnswer, error) {
+	if !needsStreakShield(stat, a) {
+		return a, nil
+	}
+	shielded, err := consumeStreakShield(tx, userID)
+	a.StreakShielded = shielded
+	return a, err
+}
+
+// applyStreakShieldAfter は applyAnswer の後に呼び、連続正解が区切りの数に達していればシールドを獲得させます。
+func applyStreakShieldAfter(tx *gorm.DB, userID uint, a statsAnswer, streak *answerStreak) error {
+	if !earnsStreakShield(a, *streak) {
+		return nil
+	}
+	earned, err := grantStreakShield(tx, userID)
+	if earned {
+		streak.ShieldEarned = true
+	}
+	return err
+}
+
+// --- アイテムのハンドラ ---
+
+// handleGetItems は、ユーザーの持ち物を返します。
+func handleGetItems(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	owned, err := users.Items(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load items"})
+		return
+	}
+	byItem := make(map[string]InventoryItem, len(owned))
+	for _, inv := range owned {
+		byItem[inv.Item] = inv
+	}
+	items := make([]gin.H, len(itemCatalog))
+	for i, item := range itemCatalog {
+		items[i] = gin.H{"item": item, "quantity": byItem[item.ID].Quantity, "active": byItem[item.ID].Active}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleUseItem は、持っているアイテムを1つ使います。
+func handleUseItem(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	item, ok := lookupItem(c.Param("item"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	inv, err := users.UseItem(userID, item.ID)
+	switch {
+	case errors.Is(err, errItemAlreadyActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "This item is already active"})
+	case errors.Is(err, errItemNotOwned):
+		c.JSON(http.StatusConflict, gin.H{"error": "You do not have this item"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use item"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"item": item, "quantity": inv.Quantity, "active": inv.Active})
+	}
+}
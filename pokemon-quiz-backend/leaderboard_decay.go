@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// --- 活動量で重み付けしたランキング ---
+
+// XPのランキングは積み上げなので、昔たくさん遊んだだけのアカウントがいつまでも上位に残ります。
+// GET /leaderboard?view=weighted では、最後に回答（またはスキップ）してからの経過時間に応じてXPを減らした値で並べます。
+// XPは LEADERBOARD_HALF_LIFE（既定は14日）遊ばないごとに半分になり、また遊ぶと元のXPに戻ります（記録したXPは減らさない）。
+// 各エントリには、どちらの並びでも元のXP（totals.xp）と重み付けしたXP（weightedXp）の両方を返します。
+
+const (
+	leaderboardViewRaw         = "raw"
+	leaderboardViewWeighted    = "weighted"
+	defaultLeaderboardHalfLife = 14 * 24 * time.Hour
+)
+
+var leaderboardHalfLife = defaultLeaderboardHalfLife
+
+// decayedXP は、最後に遊んでからの経過時間に応じて減らしたXPを返します。
+func decayedXP(t activityTotals, now time.Time, halfLife time.Duration) float64 {
+	idle := now.Sub(t.LastActiveAt)
+	if idle <= 0 || halfLife <= 0 {
+		return float64(t.XP)
+	}
+	return float64(t.XP) * math.Exp2(-idle.Hours()/halfLife.Hours())
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- ライフライン（50/50） ---
+
+// POST /quiz/:questionID/fifty-fifty で、出題中の問題の不正解の選択肢を2つ取り除いた選択肢を返します。
+// 取り除く選択肢は、問題を出したときにサーバーが覚えておいた選択肢から選ぶので、
+// クライアントが送った選択肢を信用せずに済みます。1つの問題で使えるのは1回だけです。
+// 使えるのはログインユーザーだけで、1日に使える回数（FIFTY_FIFTY_DAILY_LIMIT、既定は3回）を
+// ライフラインの種類ごとにデータベースで数えます。
+
+const (
+	lifelineFiftyFifty             = "fifty_fifty"
+	lifelineSkip                   = "skip"
+	defaultFiftyFiftyDailyLimit    = 3
+	defaultSkipDailyLimit          = 5
+	fiftyFiftyRemovedOptions       = 2
+	minOptionsForFiftyFiftyRemoval = fiftyFiftyRemovedOptions + 1
+)
+
+// 1日にライフラインを使える回数
+var (
+	fiftyFiftyDailyLimit = defaultFiftyFiftyDailyLimit
+	skipDailyLimit       = defaultSkipDailyLimit
+)
+
+var errLifelineQuotaExceeded = errors.New("lifeline quota exceeded")
+
+// --- データベースモデル ---
+
+// ユーザーがライフラインを使った回数（1日ごと）
+type LifelineUsage struct {
+	gorm.Model
+	UserID   uint   `gorm:"uniqueIndex:idx_lifeline_usage;not null"`
+	Date     string `gorm:"uniqueIndex:idx_lifeline_usage;not null"` // YYYY-MM-DD
+	Lifeline string `gorm:"uniqueIndex:idx_lifeline_usage;not null"` // fifty_fifty など
+	Count    int    `gorm:"default:0"`
+}
+
+// useLifeline は、その日のライフラインの使用回数を1つ増やし、残りの回数を返します。
+// 上限に達していれば errLifelineQuotaExceeded を返します。
+func useLifeline(userID uint, lifeline string, limit int, now time.Time) (int, error) {
+	remaining := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		today := dateKey(now)
+		// 同時に作成されても一意制約で1件になるよう、既にあれば何もしない
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LifelineUsage{UserID: userID, Date: today, Lifeline: lifeline}).Error; err != nil {
+			return err
+		}
+		var usage LifelineUsage
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND date = ? AND lifeline = ?", userID, today, lifeline).First(&usage).Error
+		if err != nil {
+			return err
+		}
+		if usage.Count >= limit {
+			return errLifelineQuotaExceeded
+		}
+		usage.Count++
+		remaining = limit - usage.Count
+		return tx.Save(&usage).Error
+	})
+	return remaining, err
+}
+
+// refundLifeline は、useLifeline で数えた1回分を取り消します（使った後にリクエストを断ったときのため）。
+// now には useLifeline に渡したのと同じ時刻を渡します。
+func refundLifeline(userID uint, lifeline string, now time.Time) error {
+	return db.Model(&LifelineUsage{}).
+		Where("user_id = ? AND date = ? AND lifeline = ? AND count > 0", userID, dateKey(now), lifeline).
+		Update("count", gorm.Expr("count - 1")).Error
+}
+
+// respondLifelineError は、ライフラインの回数を数えられなかったときのエラーを返します。
+func respondLifelineError(c *gin.Context, err error, lifeline string) {
+	if errors.Is(err, errLifelineQuotaExceeded) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "You have used all of today's " + lifeline + " lifelines"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use lifeline"})
+}
+
+// fiftyFiftyOptions は、選択肢から正解以外をランダムに2つ取り除き、取り除いた選択肢とあわせて返します。
+func fiftyFiftyOptions(options []string, answer string) ([]string, []string, error) {
+	var wrong []string
+	for _, o := range options {
+		if o != answer {
+			wrong = append(wrong, o)
+		}
+	}
+	var removed []string
+	for len(removed) < fiftyFiftyRemovedOptions {
+		idx, err := randomIndex(len(wrong))
+		if err != nil {
+			return nil, nil, err
+		}
+		removed = append(removed, wrong[idx])
+		wrong = slices.Delete(wrong, idx, idx+1)
+	}
+	kept := make([]string, 0, len(options)-len(removed))
+	for _, o := range options {
+		if !slices.Contains(removed, o) {
+			kept = append(kept, o) // 出題したときの並び順を保つ
+		}
+	}
+	return kept, removed, nil
+}
+
+// handleFiftyFifty は、出題中の問題の不正解の選択肢を2つ取り除きます。
+func handleFiftyFifty(c *gin.Context) {
+	userID, exists := optionalUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Log in to use lifelines"})
+		return
+	}
+
+	servedQuestionsMu.Lock()
+	q, ok := lookupServedQuestion(c.Param("questionID"), userID)
+	var status int
+	var message string
+	switch {
+	case !ok:
+		status, message = http.StatusNotFound, "Question not found"
+	case quizOnlyModes[q.Mode]:
+		status, message = http.StatusConflict, "Lifelines are not available in this quiz mode"
+	case q.FiftyFiftyUsed:
+		status, message = http.StatusConflict, "50/50 has already been used on this question"
+	case len(q.Options) < minOptionsForFiftyFiftyRemoval || !slices.Contains(q.Options, answerName(q.pokemon, q.Mode)):
+		status, message = http.StatusConflict, "This question does not have enough options for 50/50"
+	default:
+		// 同時に呼ばれても1回しか使えないよう、回数を数える前に使ったことにしておく
+		q.FiftyFiftyUsed = true
+	}
+	servedQuestionsMu.Unlock()
+	if status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	remaining, err := useLifeline(userID, lifelineFiftyFifty, fiftyFiftyDailyLimit, time.Now())
+	if err != nil {
+		servedQuestionsMu.Lock()
+		q.FiftyFiftyUsed = false
+		servedQuestionsMu.Unlock()
+		respondLifelineError(c, err, "50/50")
+		return
+	}
+
+	kept, removed, err := fiftyFiftyOptions(q.Options, answerName(q.pokemon, q.Mode))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use lifeline"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"questionId": q.ID,
+		"options":    kept,
+		"removed":    removed,
+		"remaining":  remaining,
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 地域に合わせた数値・日付の表記 ---
+
+// 共有する文章・メール・ダイジェストなど、人が読む文章に入れる数値（桁区切り）・割合・日付を、ユーザーの地域に合わせて表記します。
+// 通知を作る処理はここの localeFormat を使い、それぞれで表記を組み立てないようにします。
+// 地域は ?locale= で指定するか、指定がなければ Accept-Language ヘッダーから決めます（どちらもなければ日本語）。
+// 日付は、日替わりの区切りと同じく日本時間で表記します。
+
+const defaultLocale = "ja"
+
+// 地域ごとの表記
+type localeFormat struct {
+	Tag           string
+	groupSep      string // 桁区切り
+	decimalSep    string // 小数点
+	percentSuffix string
+	dateLayout    string
+	// 結果を共有する文章（正解数・問題数・正答率・得点・評価・日付の順に埋める）
+	shareTemplate string
+}
+
+// 対応している地域
+var localeFormats = map[string]localeFormat{
+	"ja": {
+		Tag: "ja", groupSep: ",", decimalSep: ".", percentSuffix: "%", dateLayout: "2006年1月2日",
+		shareTemplate: "ポケモンクイズで%[2]s問中%[1]s問正解（正答率%[3]s）、%[4]s点で評価%[5]sでした！（%[6]s）",
+	},
+	"en": {
+		Tag: "en", groupSep: ",", decimalSep: ".", percentSuffix: "%", dateLayout: "Jan 2, 2006",
+		shareTemplate: "I got %[1]s of %[2]s right (%[3]s) on the Pokémon quiz and scored %[4]s points, grade %[5]s! (%[6]s)",
+	},
+	"de": {
+		Tag: "de", groupSep: ".", decimalSep: ",", percentSuffix: " %", dateLayout: "2.1.2006",
+		shareTemplate: "Ich habe im Pokémon-Quiz %[1]s von %[2]s richtig (%[3]s) und %[4]s Punkte mit Note %[5]s erreicht! (%[6]s)",
+	},
+	"fr": {
+		Tag: "fr", groupSep: " ", decimalSep: ",", percentSuffix: " %", dateLayout: "02/01/2006",
+		shareTemplate: "J’ai trouvé %[1]s réponses sur %[2]s (%[3]s) au quiz Pokémon avec %[4]s points, note %[5]s ! (%[6]s)",
+	},
+}
+
+// lookupLocaleFormat は、"en-US" のような言語タグから表記を返します。対応していなければ false を返します。
+func lookupLocaleFormat(tag string) (localeFormat, bool) {
+	lang, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	f, ok := localeFormats[strings.ToLower(lang)]
+	return f, ok
+}
+
+// requestLocaleFormat は、リクエストの ?locale= または Accept-Language ヘッダーから表記を決めます。
+func requestLocaleFormat(c *gin.Context) localeFormat {
+	if f, ok := lookupLocaleFormat(c.Query("locale")); ok {
+		return f
+	}
+	// Accept-Language は好ましい順に並んでいるので、最初に対応しているものを使う
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		if f, ok := lookupLocaleFormat(tag); ok {
+			return f
+		}
+	}
+	return localeFormats[defaultLocale]
+}
+
+// Number は、整数を桁区切りを付けて表記します。
+func (f localeFormat) Number(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(f.groupSep)
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// Percent は、割合（0〜1）を小数点以下1桁までの百分率で表記します（端数がなければ整数で表記）。
+func (f localeFormat) Percent(ratio float64) string {
+	tenths := int64(math.Round(ratio * 1000))
+	s := f.Number(tenths / 10)
+	if rem := tenths % 10; rem != 0 {
+		s += f.decimalSep + strconv.FormatInt(rem, 10)
+	}
+	return s + f.percentSuffix
+}
+
+// Date は、日付を表記します。英語の月名は time の表記をそのまま使います。
+func (f localeFormat) Date(t time.Time) string {
+	return t.In(jst).Format(f.dateLayout)
+}
+
+// sessionShareText は、セッションのまとめから結果を共有する文章を作ります。
+func (f localeFormat) sessionShareText(s SessionSummary) string {
+	return fmt.Sprintf(f.shareTemplate,
+		f.Number(int64(s.Correct)), f.Number(int64(s.Answered)), f.Percent(s.accuracy()),
+		f.Number(int64(s.Score)), s.Grade, f.Date(s.FinishedAt))
+}
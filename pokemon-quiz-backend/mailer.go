@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- メールの送信 ---
+
+// パスワードの再設定・メールアドレスの確認・ダイジェスト・ログインの通知などのメールは mailer を通して送り、
+// 送信方法を設定で差し替えられるようにします。MAILER で次のどれかを選びます。
+//   - log（既定）: 送らずにログに出すだけ（開発用のドライラン）
+//   - smtp: SMTP_HOST・SMTP_PORT（既定は587）・SMTP_USERNAME・SMTP_PASSWORD で指定したサーバーから送る
+//   - sendgrid: SendGrid の Web API で送る（SENDGRID_API_KEY）
+//   - ses: Amazon SES の API（v2）で送る（AWS_REGION・AWS_ACCESS_KEY_ID・AWS_SECRET_ACCESS_KEY、必要なら AWS_SESSION_TOKEN）
+//
+// 送信元のアドレスは MAIL_FROM で指定します（log 以外では必須）。
+
+const (
+	defaultSMTPPort   = 587
+	mailSendTimeout   = 10 * time.Second
+	sendGridEndpoint  = "https://api.sendgrid.com/v3/mail/send"
+	sesEndpointFormat = "https://email.%s.amazonaws.com/v2/email/outbound-emails"
+)
+
+var errMailerNotConfigured = errors.New("mailer is not configured")
+
+// 送信するメール（本文はプレーンテキスト）
+type mailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// メールの送信方法
+type mailer interface {
+	// Send は、メールを1通送ります。
+	Send(msg mailMessage) error
+}
+
+// main で設定から選ぶまではドライラン
+var mail mailer = logMailer{}
+
+// newMailer は、環境変数で選んだ送信方法を返します。
+func newMailer() (mailer, error) {
+	kind := os.Getenv("MAILER")
+	if kind == "" || kind == "log" {
+		return logMailer{}, nil
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("%w: MAIL_FROM is required", errMailerNotConfigured)
+	}
+	client := &http.Client{Timeout: mailSendTimeout}
+	switch kind {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("%w: SMTP_HOST is required", errMailerNotConfigured)
+		}
+		return smtpMailer{
+			host:     host,
+			port:     envInt("SMTP_PORT", defaultSMTPPort),
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     from,
+		}, nil
+	case "sendgrid":
+		apiKey := os.Getenv("SENDGRID_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("%w: SENDGRID_API_KEY is required", errMailerNotConfigured)
+		}
+		return sendGridMailer{apiKey: apiKey, from: from, client: client}, nil
+	case "ses":
+		m := sesMailer{
+			region:       os.Getenv("AWS_REGION"),
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			from:         from,
+			client:       client,
+		}
+		if m.region == "" || m.accessKey == "" || m.secretKey == "" {
+			return nil, fmt.Errorf("%w: AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required", errMailerNotConfigured)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%w: unknown MAILER %q", errMailerNotConfigured, kind)
+}
+
+// --- ドライラン ---
+
+// 送らずにログに出す
+type logMailer struct{}
+
+func (logMailer) Send(msg mailMessage) error {
+	log.Printf("[mail dry-run] to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// --- SMTP ---
+
+type smtpMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func (m smtpMailer) Send(msg mailMessage) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	// smtp.SendMail はサーバーが対応していれば STARTTLS で暗号化する
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	return smtp.SendMail(addr, auth, m.from, []string{msg.To}, buildMIMEMessage(m.from, msg))
+}
+
+// buildMIMEMessage は、日本語の件名・本文をそのまま送れるよう UTF-8 のメールを組み立てます。
+func buildMIMEMessage(from string, msg mailMessage) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// --- SendGrid ---
+
+type sendGridMailer struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func (m sendGridMailer) Send(msg mailMessage) error {
+	body, err := json.Marshal(map[string]any{
+		"personalizations": []map[string]any{{"to": []map[string]string{{"email": msg.To}}}},
+		"from":             map[string]string{"email": m.from},
+		"subject":          msg.Subject,
+		"content":          []map[string]string{{"type": "text/plain", "value": msg.Body}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sendGridEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	return doMailRequest(m.client, req, "SendGrid")
+}
+
+// doMailRequest は、メール送信APIにリクエストを送り、2xx 以外ならエラーを返します。
+func doMailRequest(client *http.Client, req *http.Request, service string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s request failed with status %d: %s", service, resp.StatusCode, detail)
+	}
+	return nil
+}
+
+// --- Amazon SES ---
+
+type sesMailer struct {
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	from         string
+	client       *http.Client
+}
+
+func (m sesMailer) Send(msg mailMessage) error {
+	body, err := json.Marshal(map[string]any{
+		"FromEmailAddress": m.from,
+		"Destination":      map[string]any{"ToAddresses": []string{msg.To}},
+		"Content": map[string]any{
+			"Simple": map[string]any{
+				"Subject": map[string]string{"Data": msg.Subject, "Charset": "UTF-8"},
+				"Body":    map[string]any{"Text": map[string]string{"Data": msg.Body, "Charset": "UTF-8"}},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(sesEndpointFormat, m.region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	m.sign(req, body, time.Now().UTC())
+	return doMailRequest(m.client, req, "SES")
+}
+
+// sign は、リクエストに AWS Signature Version 4 の署名を付けます。
+func (m sesMailer) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+	}
+	signedHeaders := "content-type;host;x-amz-date"
+	if m.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", m.sessionToken)
+		headers["x-amz-security-token"] = m.sessionToken
+		signedHeaders += ";x-amz-security-token"
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + m.region + "/ses/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + m.secretKey)
+	for _, part := range []string{date, m.region, "ses", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+m.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// hmacSHA256 は、key で data の HMAC-SHA256 を計算します。
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
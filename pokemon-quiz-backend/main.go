@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,46 +11,39 @@ import (
 	"math/big"
 	"net/http"
 	"os"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite" // CGO不要のドライバをインポート
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"pokemon-quiz-backend/auth"
+	"pokemon-quiz-backend/quiz"
 )
 
 // --- 構造体の定義 ---
 
-// クライアントに返すポケモンの情報
-type Pokemon struct {
-	ID          int          `json:"id"`
-	Name        string       `json:"name"` // 日本語名
-	EnglishName string       `json:"englishName"`
-	Category    string       `json:"category"` // "kanto", "mega", "gmax" など (JSONに含めるように変更)
-	Stats       PokemonStats `json:"stats"`
-	ImageURL    string       `json:"imageUrl"`
-	Height      float32      `json:"height"` // m単位
-	Weight      float32      `json:"weight"` // kg単位
-	Types       []string     `json:"types"`  // 日本語のタイプ名
-}
+// クライアントに返すポケモンの情報（出題と答え合わせは quiz パッケージで行う）
+type Pokemon = quiz.Pokemon
+
+// ポケモンの珍しさ
+const (
+	rarityNormal    = "normal"
+	rarityLegendary = "legendary"
+	rarityMythical  = "mythical"
+)
 
 // ポケモンの種族値
-type PokemonStats struct {
-	HP        int `json:"hp"`
-	Attack    int `json:"attack"`
-	Defense   int `json:"defense"`
-	SpAttack  int `json:"sp_attack"`
-	SpDefense int `json:"sp_defense"`
-	Speed     int `json:"speed"`
-}
+type PokemonStats = quiz.PokemonStats
 
 // --- PokeAPIからのレスポンスをパースするための構造体 ---
 
@@ -67,8 +61,10 @@ type pokeAPIPokemonResponse struct {
 		Other struct {
 			OfficialArtwork struct {
 				FrontDefault string `json:"front_default"`
+				FrontShiny   string `json:"front_shiny"`
 			} `json:"official-artwork"`
 		} `json:"other"`
+		FrontShiny string `json:"front_shiny"`
 	} `json:"sprites"`
 	Species struct {
 		URL string `json:"url"`
@@ -80,10 +76,32 @@ type pokeAPIPokemonResponse struct {
 			Name string `json:"name"`
 		} `json:"type"`
 	} `json:"types"`
+	Abilities []struct {
+		Ability struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"ability"`
+		IsHidden bool `json:"is_hidden"`
+	} `json:"abilities"`
+	Moves []struct {
+		Move struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"move"`
+		VersionGroupDetails []pokeAPIMoveLearnDetail `json:"version_group_details"`
+	} `json:"moves"`
+}
+
+// 技を覚える方法（バージョンごと）
+type pokeAPIMoveLearnDetail struct {
+	MoveLearnMethod struct {
+		Name string `json:"name"`
+	} `json:"move_learn_method"`
 }
 
 // /pokemon-species/{id} のレスポンス
 type pokeAPISpeciesResponse struct {
+	ID    int `json:"id"`
 	Names []struct {
 		Language struct {
 			Name string `json:"name"`
@@ -96,10 +114,45 @@ type pokeAPISpeciesResponse struct {
 			Name string `json:"name"`
 		} `json:"pokemon"`
 	} `json:"varieties"`
+	CaptureRate int `json:"capture_rate"`
+	EggGroups   []struct {
+		Name string `json:"name"`
+	} `json:"egg_groups"`
+	GrowthRate struct {
+		Name string `json:"name"`
+	} `json:"growth_rate"`
+	Genera []struct {
+		Genus    string `json:"genus"`
+		Language struct {
+			Name string `json:"name"`
+		} `json:"language"`
+	} `json:"genera"`
+	FlavorTextEntries []struct {
+		FlavorText string `json:"flavor_text"`
+		Language   struct {
+			Name string `json:"name"`
+		} `json:"language"`
+	} `json:"flavor_text_entries"`
+	EvolvesFromSpecies *struct {
+		URL string `json:"url"`
+	} `json:"evolves_from_species"`
+	IsLegendary bool `json:"is_legendary"`
+	IsMythical  bool `json:"is_mythical"`
 }
 
 // /type/{id} のレスポンス
 type pokeAPITypeResponse struct {
+	Name  string `json:"name"` // /pokemon/{id} のタイプと同じ英語の識別子（"grass" など）
+	Names []struct {
+		Language struct {
+			Name string `json:"name"`
+		} `json:"language"`
+		Name string `json:"name"`
+	} `json:"names"`
+}
+
+// /ability/{name} と /move/{name} のレスポンス（日本語名の取得に使う）
+type pokeAPINamesResponse struct {
 	Names []struct {
 		Language struct {
 			Name string `json:"name"`
@@ -123,6 +176,11 @@ type User struct {
 	gorm.Model
 	Username     string `gorm:"unique;not null"`
 	PasswordHash string `gorm:"not null"`
+	IsAdmin      bool   `gorm:"default:false"`
+	// パスワードを変えた時刻
+	PasswordChangedAt *time.Time
+	// ログイントークンの版。パスワードを変えるたびに上がり、前の版のトークンは使えなくなる（auth.Revoked）
+	TokenVersion int `gorm:"default:0"`
 }
 
 type UserStat struct {
@@ -132,9 +190,56 @@ type UserStat struct {
 	TotalCorrect   int    `gorm:"default:0"`
 	WrongAnswers   string `gorm:"type:text"`              // 間違えたポケモンIDをJSON配列の文字列として保存
 	RegionalStats  string `gorm:"type:text;default:'{}'"` // 地方ごとの成績をJSONで保存
+	ModeStats      string `gorm:"type:text;default:'{}'"` // 出題形式ごとの成績をJSONで保存
+	CurrentStreak  int    `gorm:"default:0"`              // 現在の連続正解数
+	BestStreak     int    `gorm:"default:0"`              // 連続正解数の最高記録
+	TotalSkipped   int    `gorm:"default:0"`              // スキップした問題の数（正答率には含めない）
+	TotalScore     int    `gorm:"default:0"`              // 得点の合計
+	BonusXP        int    `gorm:"default:0"`              // XPの倍率で上乗せされた経験値（modifiers.go）
+}
+
+// 回答後の連続正解の状況
+type answerStreak struct {
+	Current   int  `json:"current"`
+	Best      int  `json:"best"`
+	IsNewBest bool `json:"isNewBest"` // この回答で最高記録を更新したか
+	// 間違えたが連続正解シールドで連続正解が途切れなかった / この回答でシールドを獲得した
+	Shielded     bool `json:"shielded,omitempty"`
+	ShieldEarned bool `json:"shieldEarned,omitempty"`
+}
+
+// 回答後の成績の集計（答え合わせの応答に含め、毎問 /stats を呼び直さなくて済むようにする）
+type statsAggregates struct {
+	TotalQuestions int                 `json:"totalQuestions"`
+	TotalCorrect   int                 `json:"totalCorrect"`
+	Accuracy       float64             `json:"accuracy"` // 正答率（0〜1）
+	XP             int                 `json:"xp"`
+	TotalScore     int                 `json:"totalScore"`
+	Region         string              `json:"region,omitempty"`        // 回答したポケモンの地方
+	RegionalTally  *RegionalStatDetail `json:"regionalTally,omitempty"` // その地方の成績
+	Mode           string              `json:"mode,omitempty"`          // 回答した問題の出題形式
+	ModeTally      *RegionalStatDetail `json:"modeTally,omitempty"`     // その出題形式の成績
+}
+
+// 1問分の回答を成績に反映した結果
+type answerStatsResult struct {
+	Streak answerStreak
+	Stats  statsAggregates
+	Score  answerScore // この回答の得点
+}
+
+// 経験値は回答数と正解数から計算する
+const (
+	xpPerAnswer  = 1
+	xpPerCorrect = 10
+)
+
+// userXP は、成績から経験値を計算します。XP2倍などの期間中に上乗せされた分も含めます。
+func userXP(stat *UserStat) int {
+	return stat.TotalQuestions*xpPerAnswer + stat.TotalCorrect*xpPerCorrect + stat.BonusXP
 }
 
-// 地方ごとの成績詳細
+// 地方ごとの成績詳細（出題形式ごとの成績にも使う）
 type RegionalStatDetail struct {
 	Total   int `json:"total"`
 	Correct int `json:"correct"`
@@ -147,36 +252,151 @@ var (
 	jwtKey = []byte(os.Getenv("JWT_SECRET_KEY")) // 環境変数からJWTキーを読み込む
 )
 
-const TOKEN_DURATION = time.Hour * 24 // トークンの有効期限
+// SQLiteの接続オプション。同時に書き込むとすぐに SQLITE_BUSY で失敗するので、ロックが空くまで最大5秒待ち、
+// トランザクションは最初から書き込みのロックを取る（読んでから書くトランザクション同士が行き詰まらないようにする）
+const sqliteDSNOptions = "_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// 間違えたリストに残すポケモンの数の上限（WRONG_ANSWERS_CAP で変更でき、0以下なら無制限）
+const defaultWrongAnswersCap = 500
+
+var wrongAnswersCap = defaultWrongAnswersCap
+
+// フォルム違いのポケモンの図鑑番号に足す値（元の番号と重ならないように10000番台に割り当てる）
+const formIDOffset = quiz.FormIDOffset
+
+// envInt は、環境変数を整数として読み取ります。未設定や数値でない場合は fallback を返します。
+func envInt(name string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
 
 // --- グローバル変数 ---
 
 // 地方ごとのポケモンデータを保持する
 var (
-	pokemonListByRegion = make(map[string][]*Pokemon) // ポインタのスライスに変更（メモリ節約）
-	pokemonMapByID      = make(map[int]*Pokemon)      // ポインタのマップに変更
+	pokemonListByRegion     = make(map[string][]*Pokemon)            // ポインタのスライスに変更（メモリ節約）
+	pokemonListByRegionType = make(map[string]map[string][]*Pokemon) // 地方ごと・タイプ（日本語名）ごとの一覧
+	pokemonMapByID          = make(map[int]*Pokemon)                 // ポインタのマップに変更
+	pokemonEvolvesInto      = make(map[int][]*Pokemon)               // 進化前の図鑑番号ごとの進化先
+	nameReadings            = make(map[string]string)                // 日本語名から読みへの対応表
 )
 
 // タイプの英語名と日本語名の対応表
 var typeNameMap = make(map[string]string)
 
+// 特性の英語名と日本語名の対応表（ポケモンデータの取得中に必要な分だけ取得する）
+var (
+	abilityNameMap = make(map[string]string)
+	abilityNameMu  sync.Mutex
+	moveNameMap    = make(map[string]string)
+	moveNameMu     sync.Mutex
+)
+
+// タマゴグループの英語名と日本語名の対応表
+// PokeAPIのegg-groupには日本語名が揃っていないため、固定の対応表を使う
+var eggGroupNameMap = map[string]string{
+	"monster":       "かいじゅう",
+	"water1":        "すいちゅう1",
+	"water2":        "すいちゅう2",
+	"water3":        "すいちゅう3",
+	"bug":           "むし",
+	"flying":        "ひこう",
+	"ground":        "りくじょう",
+	"fairy":         "ようせい",
+	"plant":         "しょくぶつ",
+	"humanshape":    "ひとがた",
+	"mineral":       "こうぶつ",
+	"indeterminate": "ふていけい",
+	"ditto":         "メタモン",
+	"dragon":        "ドラゴン",
+	"no-eggs":       "タマゴみはっけん",
+}
+
+// 成長速度（経験値タイプ）の英語名と日本語名の対応表
+var growthRateNameMap = map[string]string{
+	"slow-then-very-fast": "60万タイプ",
+	"fast":                "80万タイプ",
+	"medium":              "100万タイプ",
+	"medium-slow":         "105万タイプ",
+	"slow":                "125万タイプ",
+	"fast-then-very-slow": "164万タイプ",
+}
+
 // 地方名とPokeAPIの世代IDの対応表
 var regionGenerationMap = map[string]int{
-	"kanto":    1,
-	"johto":    2,
-	"hoenn":    3,
-	"sinnoh":   4,
-	"unova":    5,
-	"kalos":    6,
-	"alola":    7,
-	"galar":    8,
-	"paldea":   9,
-	"mega":     -1, // 特殊カテゴリ
-	"gmax":     -2, // 特殊カテゴリ
-	"regional": -3, // 特殊カテゴリ
-}
-
-const pokemonDataFile = "pokemon.json"
+	"kanto":     1,
+	"johto":     2,
+	"hoenn":     3,
+	"sinnoh":    4,
+	"unova":     5,
+	"kalos":     6,
+	"alola":     7,
+	"galar":     8,
+	"paldea":    9,
+	"mega":      -1, // 特殊カテゴリ
+	"gmax":      -2, // 特殊カテゴリ
+	"regional":  -3, // 特殊カテゴリ
+	"legendary": -4, // 特殊カテゴリ（伝説のポケモン。地方のカテゴリとは別に、どの地方のポケモンも含む）
+	"mythical":  -5, // 特殊カテゴリ（幻のポケモン。同上）
+	"starters":  -6, // 特殊カテゴリ（御三家とその進化形。同上）
+}
+
+// 各世代の御三家の最初の進化段階の図鑑番号
+// 進化形は進化先の索引からたどるので、新しい世代が出たらここに3匹追加するだけでよい
+var starterPokemonIDs = []int{
+	1, 4, 7, // カントー
+	152, 155, 158, // ジョウト
+	252, 255, 258, // ホウエン
+	387, 390, 393, // シンオウ
+	495, 498, 501, // イッシュ
+	650, 653, 656, // カロス
+	722, 725, 728, // アローラ
+	810, 813, 816, // ガラル
+	906, 909, 912, // パルデア
+}
+
+var pokemonDataFile = "pokemon.json" // オフライン開発モードでは一時ディレクトリに置く
+
+// クイズの出題形式
+const (
+	quizModeStats    = "stats"     // 種族値・タイプ・高さ・重さから当てる（デフォルト）
+	quizModeTrivia   = "trivia"    // 捕獲率・タマゴグループ・成長速度から当てる（マニア向け）
+	quizModeAbility  = "ability"   // 「特性Yを持つことがあるポケモンは？」
+	quizModeGenus    = "genus"     // 「〇〇ポケモン」という分類から当てる
+	quizModeMove     = "move"      // 「技Mをレベルアップで覚えるポケモンは？」
+	quizModeEnToJa   = "en_to_ja"  // 英語名を見て日本語名を当てる
+	quizModeJaToEn   = "ja_to_en"  // 日本語名を見て英語名を当てる
+	quizModeEggGroup = "egg_group" // 「タマゴグループGに属するポケモンは？」
+)
+
+// 有効な出題形式の一覧
+var quizModes = map[string]bool{
+	quizModeStats:    true,
+	quizModeTrivia:   true,
+	quizModeAbility:  true,
+	quizModeGenus:    true,
+	quizModeMove:     true,
+	quizModeEnToJa:   true,
+	quizModeJaToEn:   true,
+	quizModeEggGroup: true,
+	quizModeCrop:     true,
+}
+
+// /quiz でだけ使える出題形式（名前ではなく選択肢の番号やIDで答え合わせをするため、セッションやデイリーでは使えない）
+var quizOnlyModes = map[string]bool{
+	quizModeReverseStats: true,
+	quizModeBSTBracket:   true,
+}
+
+// 選択肢の数
+const (
+	defaultOptionCount = 4
+	minOptionCount     = 2
+	maxOptionCount     = 8
+)
 
 func main() {
 	// .envファイルから環境変数を読み込む（ファイルが存在しなくてもエラーにはならない）
@@ -184,49 +404,144 @@ func main() {
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Printf("Error loading .env file: %v", err)
 	}
+	parseFlags()
+	if offlineDev {
+		setupOfflineDev()
+	}
 
 	jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
 	if len(jwtKey) == 0 {
 		log.Fatal("FATAL: JWT_SECRET_KEY environment variable is not set.")
 	}
+	wrongAnswersCap = envInt("WRONG_ANSWERS_CAP", defaultWrongAnswersCap)
+	loadTokenSettings()
+	loginTokens = auth.NewTokens(jwtKey, tokenDuration)
+	loadAttestationKeys()
+	fiftyFiftyDailyLimit = envInt("FIFTY_FIFTY_DAILY_LIMIT", defaultFiftyFiftyDailyLimit)
+	skipDailyLimit = envInt("SKIP_DAILY_LIMIT", defaultSkipDailyLimit)
+	offlinePackTTL = envDuration("OFFLINE_PACK_TTL", defaultOfflinePackTTL)
+	leaderboardHalfLife = envDuration("LEADERBOARD_HALF_LIFE", defaultLeaderboardHalfLife)
+	answerIdempotency = newIdempotencyStore(envDuration("IDEMPOTENCY_KEY_TTL", defaultIdempotencyKeyTTL))
+	questionDeadline = min(envDuration("QUESTION_DEADLINE", defaultQuestionDeadline), questionTokenTTL)
+	routeSLO = newSLOTracker(os.Getenv("SLO_THRESHOLD_MS"), os.Getenv("SLO_ROUTE_THRESHOLDS"))
+	if mail, err = newMailer(); err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
 
 	// データベースの初期化
 	// Render.comなどのPaaSに対応するため、DATABASE_URL環境変数を使用
+	// STORAGE=memory の場合は、DATABASE_URL がなければその他のデータもメモリ上のSQLiteに置く（デモ用）
+	storage := os.Getenv("STORAGE")
 	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
+	if dsn == "" && storage == "memory" {
+		db, err = gorm.Open(sqlite.Open("file::memory:?cache=shared&"+sqliteDSNOptions), &gorm.Config{})
+	} else if dsn == "" {
 		// ローカル開発用にSQLiteにフォールバック
 		log.Println("DATABASE_URL is not set. Falling back to SQLite.")
 		dsn = "pokemon_quiz.db"
-		db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(sqlite.Open(dsn+"?"+sqliteDSNOptions), &gorm.Config{})
 	} else {
 		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	}
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	db.AutoMigrate(&User{}, &UserStat{}) // テーブルを自動生成
+	// テーブルを自動生成
+	db.AutoMigrate(
+		&User{},
+		&UserStat{},
+		&MatchRecord{},
+		&MatchSnapshot{},
+		&MatchParticipant{},
+		&Tournament{},
+		&TournamentEntry{},
+		&QuizEvent{},
+		&QuizEventEntry{},
+		&QuizEventAnswer{},
+		&UserGoal{},
+		&DailyProgress{},
+		&APIUsage{},
+		&DailyOverride{},
+		&QuizPreset{},
+		&SurvivalRun{},
+		&APIKey{},
+		&PokemonAttempt{},
+		&ActivityEvent{},
+		&AdminAuditLog{},
+		&NameRule{},
+		&LifelineUsage{},
+		&AnswerScore{},
+		&SessionSummary{},
+		&AccountSignal{},
+		&DuplicateFlag{},
+		&OfflinePackSubmission{},
+		&InventoryItem{},
+		&QuizExclusion{},
+		&DatasetDiff{},
+		&RefreshToken{},
+		&QuizPool{},
+		&Playlist{},
+		&CalendarEntry{},
+	)
+
+	// ユーザーと成績の保存先を選ぶ
+	users = newUserStore(storage, db)
+
+	// 環境変数で指定されたユーザーを管理者にする
+	promoteAdmins()
+	if err := loadNameRules(); err != nil {
+		log.Printf("Failed to load name rules: %v", err)
+	}
+	if err := loadExclusions(); err != nil {
+		log.Printf("Failed to load exclusions: %v", err)
+	}
+
+	// /answer の成績の書き込みを行うワーカーを起動
+	statsQueue = startStatsWorkers(envInt("STATS_WORKERS", defaultStatsWorkers), envInt("STATS_QUEUE_SIZE", defaultStatsQueueSize))
+
+	// コンテンツカレンダーの予定を自動で始める（XP2倍の期間はランキングの集計より先に読み込む）
+	startCalendarScheduler()
+
+	// 出題・回答の行動記録の書き込みを開始
+	activity = startActivityLog()
+
+	// APIの利用状況の件数を定期的に書き込む
+	startUsageFlusher(usageFlushInterval)
+
+	// 問題の難しさの公開データセットを定期的に作り直す
+	startDatasetPublisher(time.Duration(envInt("DATASET_INTERVAL_HOURS", defaultDatasetIntervalHours)) * time.Hour)
 
 	// ポケモンデータをファイルから読み込むか、APIから取得する
-	if err := loadOrFetchPokemonData(); err != nil {
-		log.Fatalf("Failed to initialize Pokemon data: %v", err)
-	}
+	// 起動を待たせないようバックグラウンドで行う（タイプ名はAPIから取得するときだけ読み込む）
+	loadPokemonDataInBackground()
 
-	// タイプ名を初期化
-	if err := loadTypeNames(); err != nil {
-		log.Fatalf("Failed to initialize Pokemon type names: %v", err)
+	// 追加のコンテンツパックを読み込む
+	packsDir := os.Getenv("PACKS_DIR")
+	if packsDir == "" {
+		packsDir = defaultPacksDir
 	}
+	loadContentPacks(packsDir)
 
 	// --- Ginサーバーの設定 ---
 	// Ginを本番環境向けに設定
 	gin.SetMode(gin.ReleaseMode)
 
 	router := gin.New()
+	// 登録されていないメソッドには Allow ヘッダー付きの 405 を返す
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(handleMethodNotAllowed)
 	router.Use(gin.Logger())   // リクエストログを出力するミドルウェア
 	router.Use(gin.Recovery()) // パニックから回復するミドルウェア
 
+	// ルートごとのレスポンス時間を記録するミドルウェア
+	router.Use(sloMiddleware())
+
 	// セキュリティヘッダーを追加するミドルウェア
 	router.Use(securityHeadersMiddleware())
 
+	// ログインユーザーのリクエスト数を記録するミドルウェア
+	router.Use(usageMiddleware())
+
 	// 環境変数からフロントエンドのURLを取得
 	frontendURL := os.Getenv("FRONTEND_URL")
 	var allowOrigins []string
@@ -239,23 +554,70 @@ func main() {
 	// CORS (Cross-Origin Resource Sharing) の設定
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     allowOrigins, // 環境変数から取得したURLを許可
-		AllowMethods:     []string{"GET", "POST"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowMethods:     corsAllowMethods,
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", matchPingHeader, deviceIDHeader, idempotencyKeyHeader, attestationHeader},
+		ExposeHeaders:    []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", refreshedTokenHeader, idempotencyReplayHeader},
 		AllowCredentials: true,
 	}))
 
+	// ポケモンデータの準備ができるまでリクエストを断るミドルウェア（CORSのヘッダーを付けてから断る）
+	router.Use(dataReadyMiddleware())
+
 	// 信頼するプロキシを設定してセキュリティ警告を解消
 	router.SetTrustedProxies([]string{"127.0.0.1"})
 
 	// --- APIエンドポイント ---
 
+	// クイズのエンドポイントはクライアントごとにリクエスト数を制限する
+	quizLimit := rateLimitMiddleware(newRateLimiter(quizRateLimit, quizRateWindow))
+
 	// 認証不要なAPIグループ
 	public := router.Group("/")
 	{
+		public.GET("/healthz", handleHealthz)
+		public.GET("/readyz", handleReadyz)
+		public.GET("/warmup", handleWarmup)
+		public.GET("/capabilities", handleCapabilities)
 		public.POST("/register", handleRegister)
 		public.POST("/login", handleLogin)
-		public.GET("/quiz", handleGetQuiz)
-		public.POST("/answer", handleAnswer)
+		public.POST("/refresh", handleRefreshToken)
+		public.GET("/quiz", quizLimit, handleGetQuiz)
+		public.GET("/quiz/offline-pack", quizLimit, handleGetOfflinePack)
+		public.POST("/answer", quizLimit, idempotencyMiddleware(answerIdempotency), handleAnswer)
+		public.GET("/pokemon/:id", handleGetPokemon)
+		public.GET("/packs", handleListPacks)
+		public.GET("/types", handleListTypes)
+		public.GET("/types/:name", handleGetType)
+		public.GET("/metrics", handleMetrics)
+		public.GET("/daily", handleGetDailyChallenge)
+		public.GET("/quiz/crop/:token", handleGetCropImage)
+		public.POST("/quiz/:questionID/skip", quizLimit, handleSkipQuestion)
+		public.GET("/quiz/:questionID/hint", handleGetHint)
+		public.POST("/quiz/:questionID/fifty-fifty", handleFiftyFifty)
+		public.GET("/quiz/:questionID/silhouette", handleGetSilhouette)
+		public.GET("/leaderboard", handleGetLeaderboard)
+		public.GET("/playlists", handleListPlaylists)
+		public.GET("/calendar", handleGetCalendar)
+		public.POST("/playlists/:id/play", quizLimit, handlePlayPlaylist)
+		public.GET("/datasets/difficulty.json", handleGetDifficultyDataset)
+		public.GET("/datasets/difficulty.csv", handleGetDifficultyDatasetCSV)
+		public.POST("/daily/answer", quizLimit, handleDailyChallengeAnswer)
+
+		// クイズセッション（ログインしていれば成績も記録される）
+		public.POST("/quiz/session", quizLimit, handleCreateQuizSession)
+		public.GET("/quiz/session/:id", handleGetQuizSession)
+		public.GET("/quiz/session/:id/question", quizLimit, handleNextSessionQuestion)
+		public.POST("/quiz/session/:id/answer", quizLimit, handleSessionAnswer)
+		public.POST("/quiz/session/:id/skip", quizLimit, handleSessionSkip)
+		public.GET("/quiz/session/:id/result", handleGetSessionResult)
+		public.GET("/sessions/:id/summary", handleGetSessionSummary)
+		public.POST("/quiz/session/:id/finish", handleFinishQuizSession)
+		public.POST("/quiz/session/:id/submit", quizLimit, handleSubmitQuizSession)
+		public.GET("/results/verify", handleVerifyResult)
+		public.GET("/tournaments/:id", handleGetTournament)
+		public.GET("/tournaments/:id/stream", handleTournamentStream)
+		public.GET("/events/:code", handleGetQuizEvent)
+		public.GET("/events/:code/stream", handleQuizEventStream)
 	}
 
 	// 認証が必要なAPIグループ
@@ -263,7 +625,91 @@ func main() {
 	protected.Use(authMiddleware())
 	{
 		protected.GET("/me", handleMe)
+		protected.POST("/me/password", handleChangePassword)
 		protected.GET("/stats", handleGetStats)
+		protected.GET("/me/matches", handleGetMyMatches)
+		protected.GET("/me/goals", handleGetGoals)
+		protected.GET("/me/items", handleGetItems)
+		protected.POST("/me/items/:item/use", handleUseItem)
+		protected.PATCH("/me/goals", handleUpdateGoals)
+		protected.GET("/me/usage", handleGetMyUsage)
+		protected.GET("/me/survival-runs", handleGetMySurvivalRuns)
+		protected.GET("/me/api-keys", handleListAPIKeys)
+		protected.POST("/me/api-keys", handleCreateAPIKey)
+		protected.POST("/me/api-keys/:id/revoke", handleRevokeAPIKey)
+
+		// プリセット
+		protected.GET("/me/presets", handleListPresets)
+		protected.POST("/me/presets", handleCreatePreset)
+		protected.POST("/me/presets/import", handleImportPreset)
+		protected.GET("/me/presets/:id/export", handleExportPreset)
+
+		// カスタムプール
+		protected.GET("/pools", handleListPools)
+		protected.POST("/pools", handleCreatePool)
+		protected.DELETE("/pools/:id", handleDeletePool)
+
+		// 対戦ルーム
+		protected.POST("/matches", handleCreateMatch)
+		protected.POST("/matches/resume", handleResumeMatch)
+		protected.GET("/matches/:id", handleGetMatch)
+		protected.POST("/matches/:id/join", handleJoinMatch)
+		protected.POST("/matches/:id/pick", handleMatchPick)
+		protected.POST("/matches/:id/answer", handleMatchAnswer)
+		protected.POST("/matches/:id/rematch", handleRematch)
+
+		// トーナメント
+		protected.POST("/tournaments", handleCreateTournament)
+		protected.POST("/tournaments/:id/join", handleJoinTournament)
+		protected.POST("/tournaments/:id/finish", handleFinishTournament)
+
+		// 配信者向けイベント
+		protected.POST("/events", handleCreateQuizEvent)
+		protected.GET("/events/:code/questions", handleGetQuizEventQuestions)
+		protected.POST("/events/:code/answer", handleQuizEventAnswer)
+		protected.POST("/events/:code/ban", handleBanQuizEventEntry)
+		protected.POST("/events/:code/end", handleEndQuizEvent)
+	}
+
+	// APIキーで利用する読み取り専用の公開API
+	publicAPI := router.Group("/api/v1")
+	publicAPI.Use(apiKeyMiddleware(), rateLimitMiddleware(newRateLimiter(publicAPIRate, time.Minute)))
+	{
+		publicAPI.GET("/stats", handlePublicGlobalStats)
+		publicAPI.GET("/pokemon/hardest", handlePublicHardestPokemon)
+		publicAPI.GET("/daily", handlePublicDailyMeta)
+	}
+
+	// 管理者用のAPIグループ
+	admin := router.Group("/admin")
+	admin.Use(authMiddleware(), adminMiddleware())
+	{
+		admin.GET("/daily-overrides", handleListDailyOverrides)
+		admin.POST("/daily-overrides", handleSetDailyOverride)
+		admin.GET("/leaderboard/recompute", handleRecomputeLeaderboard)
+		admin.GET("/duplicates", handleListDuplicateGroups)
+		admin.POST("/duplicates/scan", handleScanDuplicateAccounts)
+		admin.POST("/regional-stats/backfill", handleBackfillRegionalStats)
+		admin.PUT("/duplicates/:userId", handleReviewDuplicateAccount)
+		admin.GET("/playlists", handleAdminListPlaylists)
+		admin.POST("/playlists", handleCreatePlaylist)
+		admin.PUT("/playlists/:id", handleUpdatePlaylist)
+		admin.DELETE("/playlists/:id", handleDeletePlaylist)
+		admin.GET("/name-rules", handleListNameRules)
+		admin.POST("/name-rules", handleCreateNameRule)
+		admin.DELETE("/name-rules/:id", handleDeleteNameRule)
+		admin.GET("/name-rules/check", handleCheckName)
+		admin.GET("/data/diffs", handleListDatasetDiffs)
+		admin.GET("/exclusions", handleListExclusions)
+		admin.POST("/exclusions", handleCreateExclusion)
+		admin.DELETE("/exclusions/:id", handleDeleteExclusion)
+		admin.GET("/backups", handleListBackups)
+		admin.POST("/backups", handleCreateBackup)
+		admin.POST("/backups/:name/restore", handleRestoreBackup)
+		admin.GET("/calendar", handleListCalendarEntries)
+		admin.POST("/calendar", handleCreateCalendarEntry)
+		admin.PUT("/calendar/:id", handleUpdateCalendarEntry)
+		admin.DELETE("/calendar/:id", handleDeleteCalendarEntry)
 	}
 
 	// Renderなどのホスティング環境から提供されるポート番号を取得
@@ -273,7 +719,13 @@ func main() {
 	}
 
 	log.Printf("Starting server on :%s", port)
-	router.Run(":" + port)
+	// HEADはGETのエンドポイントで処理する
+	handler := withHeadSupport(router)
+	// フロントエンドのビルド結果があれば / で一緒に配信する（セルフホスト用）
+	if fsys := frontendFS(); fsys != nil {
+		handler = withFrontend(handler, fsys, newAPIRoutePatterns(router.Routes()))
+	}
+	serve(":"+port, handler)
 }
 
 // --- ハンドラ関数 ---
@@ -282,24 +734,99 @@ func handleGetQuiz(c *gin.Context) {
 	// クエリパラメータから地方とリトライオプションを取得
 	region := c.DefaultQuery("region", "kanto")
 	retry := c.DefaultQuery("retry", "false") == "true"
+	mode := c.DefaultQuery("mode", quizModeStats)
+	if !quizModes[mode] && !quizOnlyModes[mode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz mode specified"})
+		return
+	}
+	if difficulty := c.Query("difficulty"); difficulty != "" && !difficulties[difficulty] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid difficulty specified"})
+		return
+	}
+	if _, ok := optionCountParam(c); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "options must be between 2 and 8"})
+		return
+	}
+	if _, ok := timeLimitParam(c); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeLimit must be between 1 and 600 seconds"})
+		return
+	}
+	if _, ok := optionOrderParam(c); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be random, kana or dex"})
+		return
+	}
+	pack, ok := lookupPack(c.Query("pack"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown content pack specified"})
+		return
+	}
+	if !pack.isDefaultPack() {
+		// コンテンツパックには地方がないことが多いので、指定がなければ全件から出題する
+		region = c.DefaultQuery("region", "all")
+		if retry {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Retry mode is not available for content packs"})
+			return
+		}
+	}
+	dexFrom, dexTo, dexRange, ok := dexRangeParam(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be Pokedex numbers with from <= to"})
+		return
+	}
+	if dexRange && (retry || c.Query("preset") != "" || !pack.isDefaultPack() || c.Query("region") != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A Pokedex range cannot be combined with region, retry mode, presets or content packs"})
+		return
+	}
+	typeFilter := c.Query("type")
+	if typeFilter != "" && (retry || c.Query("preset") != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The type filter cannot be combined with retry mode or presets"})
+		return
+	}
+	// seed を指定すると、同じ seed・round には同じ問題と選択肢を出題する
+	var qr *quizRand
+	if seed := c.Query("seed"); seed != "" {
+		round, err := strconv.Atoi(c.DefaultQuery("round", "0"))
+		if !validQuizSeed(seed) || err != nil || round < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "seed must be at most 64 characters and round must be a non-negative number"})
+			return
+		}
+		if retry {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A seed cannot be combined with retry mode"})
+			return
+		}
+		qr = newQuizRand(seed, round)
+	}
+
+	// 保存したプリセットで出題する場合
+	if presetID := c.Query("preset"); presetID != "" {
+		preset, ok := findMyPreset(c, presetID)
+		if !ok {
+			return
+		}
+		pool, ok := preset.pool()
+		pool = withoutExcluded(pool)
+		if !ok || len(pool) == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Preset can no longer be used with the current dataset"})
+			return
+		}
+		if c.Query("mode") == "" {
+			mode = preset.Mode
+		}
+		if qr != nil {
+			pool = sortedByID(pool)
+		}
+		idx, err := qr.index(len(pool))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select a random pokemon"})
+			return
+		}
+		sendQuiz(c, qr, pool[idx], pool, mode, "")
+		return
+	}
 
 	// 「間違えた問題」モードの場合
 	if retry { // このブロックを修正
-		userID, exists := c.Get("userID")
-		if !exists {
-			// ログインしていないユーザーの場合、認証ヘッダーがないので手動でトークンを検証
-			authHeader := c.GetHeader("Authorization")
-			if strings.HasPrefix(authHeader, "Bearer ") {
-				tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-				claims := &jwt.RegisteredClaims{}
-				token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) { return jwtKey, nil })
-				if err == nil && token.Valid {
-					uid, _ := strconv.Atoi(claims.Subject)
-					userID = uint(uid)
-					exists = true
-				}
-			}
-		}
+		userID, exists := optionalUserID(c)
 
 		// トークンが見つからない、または無効な場合はエラー
 		if !exists {
@@ -307,15 +834,26 @@ func handleGetQuiz(c *gin.Context) {
 			return
 		}
 
-		var stat UserStat
-		// ユーザーの成績レコードを取得。なければ作成。
-		db.FirstOrCreate(&stat, UserStat{UserID: userID.(uint)})
+		// ユーザーの成績を取得（まだなければ間違えた問題もない）
+		stat, err := users.Stats(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+			return
+		}
+		if stat == nil {
+			stat = &UserStat{UserID: userID}
+		}
 
 		var wrongIDs []int
 		// JSON文字列をスライスにデコード
 		if stat.WrongAnswers != "" {
 			json.Unmarshal([]byte(stat.WrongAnswers), &wrongIDs)
 		}
+		// 出題から外したポケモンは、間違えた問題でも出題しない
+		wrongIDs = slices.DeleteFunc(wrongIDs, func(id int) bool {
+			p, ok := pokemonMapByID[id]
+			return ok && isExcluded(p)
+		})
 
 		if len(wrongIDs) == 0 {
 			c.JSON(http.StatusNotFound, gin.H{"error": "間違えた問題はありません"})
@@ -345,107 +883,543 @@ func handleGetQuiz(c *gin.Context) {
 				optionsPool = append(optionsPool, p)
 			}
 		}
-		sendQuiz(c, pokemon, optionsPool)
+		sendQuiz(c, nil, pokemon, optionsPool, mode, pokemon.Category)
 		return
 	}
 
 	// 通常モード
-	targetPokemonList, ok := pokemonListByRegion[region]
-	if !ok || len(targetPokemonList) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified"})
+	// 地方はカンマ区切りで複数指定でき、その場合は全ての地方のポケモンから出題する
+	regionNames := strings.Split(region, ",")
+	targetPokemonList, badRegion := sharedRegionPools(pack, regionNames)
+	// 図鑑番号の範囲の指定があれば、地方の代わりにその範囲から出題する
+	if dexRange {
+		targetPokemonList, badRegion = dexRangePool(dexFrom, dexTo), ""
+		optionCount, _ := optionCountParam(c)
+		if len(targetPokemonList) < optionCount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The Pokedex range must contain at least %d Pokemon", optionCount)})
+			return
+		}
+	}
+	// region=pool:<id> なら、ログインユーザーが作成したプールから出題する
+	poolID, fromPool := poolFromRegion(region)
+	if fromPool {
+		if !pack.isDefaultPack() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Custom pools cannot be combined with content packs"})
+			return
+		}
+		pool, ok := findMyPool(c, poolID)
+		if !ok {
+			return
+		}
+		targetPokemonList, badRegion = pool.pool(), ""
+		if len(targetPokemonList) == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Pool can no longer be used with the current dataset"})
+			return
+		}
+	}
+	customList := dexRange || fromPool // 地方ごとの索引が使えない一覧
+	if badRegion != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified: " + badRegion})
 		return
 	}
-	randIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(targetPokemonList))))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select a random pokemon"})
+	// 地方から選んだ一覧の絞り込みは、同じ条件のリクエストで作り置きを分け合う（quiz_pool_cache.go）
+	poolKey := ""
+	if !customList {
+		poolKey = quizPoolKey(pack, region)
+	}
+	basePool := targetPokemonList
+	poolKey = quizPoolStageKey(poolKey, "excluded")
+	targetPokemonList = sharedQuizPool(poolKey, func() []*Pokemon { return withoutExcluded(basePool) })
+	if len(targetPokemonList) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "All Pokemon in this selection are excluded from the quiz"})
 		return
 	}
-	randomPokemon := targetPokemonList[randIndex.Int64()]
-	sendQuiz(c, randomPokemon, targetPokemonList)
+	// タイプの指定があれば、正解も不正解の選択肢もそのタイプのポケモンから選ぶ
+	if typeFilter != "" {
+		unfiltered := targetPokemonList
+		poolKey = quizPoolStageKey(poolKey, "type="+typeFilter)
+		targetPokemonList = sharedQuizPool(poolKey, func() []*Pokemon {
+			if pack.isDefaultPack() && len(regionNames) == 1 && !customList {
+				return withoutExcluded(pokemonListByRegionType[region][typeFilter])
+			}
+			return quiz.FilterByType(unfiltered, typeFilter)
+		})
+		if len(targetPokemonList) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No Pokemon of the specified type in this region"})
+			return
+		}
+	}
+	// includeForms=false なら、メガシンカ・キョダイマックス・リージョンフォームなどのフォルム違いを出題しない
+	excludeForms := pack.isDefaultPack() && c.Query("includeForms") == "false"
+	if excludeForms {
+		withForms := targetPokemonList
+		poolKey = quizPoolStageKey(poolKey, "noforms")
+		targetPokemonList = sharedQuizPool(poolKey, func() []*Pokemon { return quiz.WithoutForms(withForms) })
+		if len(targetPokemonList) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No Pokemon left after excluding forms"})
+			return
+		}
+	}
+	// ログイン中は苦手なポケモンやまだ出題されていないポケモンを優先する（adaptive=false なら一様に選ぶ）
+	// シードを指定した場合は、誰でも同じ問題になるよう一様に選ぶ
+	var randomPokemon *Pokemon
+	if qr != nil {
+		targetPokemonList = sortedByID(targetPokemonList)
+		idx, _ := qr.index(len(targetPokemonList))
+		randomPokemon = targetPokemonList[idx]
+	} else if userID, loggedIn := optionalUserID(c); loggedIn && c.Query("adaptive") != "false" {
+		p, err := pickAdaptivePokemon(userID, targetPokemonList)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select a random pokemon"})
+			return
+		}
+		randomPokemon = p
+	} else {
+		randIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(targetPokemonList))))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select a random pokemon"})
+			return
+		}
+		randomPokemon = targetPokemonList[randIndex.Int64()]
+	}
+	if !pack.isDefaultPack() || typeFilter != "" || len(regionNames) > 1 || excludeForms || customList {
+		region = "" // 近傍の索引はポケモンのデータの地方ごとにしかない
+	}
+	sendQuiz(c, qr, randomPokemon, targetPokemonList, mode, region)
 }
 
-func sendQuiz(c *gin.Context, pokemon *Pokemon, optionsPool []*Pokemon) {
-	// 選択肢プールから正解のポケモンを除外した新しいスライスを作成
-	filteredOptionsPool := make([]*Pokemon, 0, len(optionsPool)-1)
-	for _, p := range optionsPool {
-		if p.ID != pokemon.ID {
-			filteredOptionsPool = append(filteredOptionsPool, p)
-		}
+// optionCountParam は、options クエリパラメータから選択肢の数を返します（省略時は4）。
+// 範囲外や数値でない場合は false を返します。
+func optionCountParam(c *gin.Context) (int, bool) {
+	q := c.Query("options")
+	if q == "" {
+		return defaultOptionCount, true
+	}
+	n, err := strconv.Atoi(q)
+	if err != nil || n < minOptionCount || n > maxOptionCount {
+		return 0, false
+	}
+	return n, true
+}
+
+// timeLimitParam は、timeLimit クエリパラメータから問題の回答の制限時間を返します（省略時は0）。
+// 範囲外や数値でない場合は false を返します。
+func timeLimitParam(c *gin.Context) (time.Duration, bool) {
+	q := c.Query("timeLimit")
+	if q == "" {
+		return 0, true
 	}
+	n, err := strconv.Atoi(q)
+	if err != nil || n < 1 || n > maxQuestionTimeLimit {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
 
-	options := make([]string, 0, 4)
-	options = append(options, pokemon.Name)
+// sendQuiz は、問題を組み立てて返します。region には optionsPool がどの地方の一覧かを渡します。
+func sendQuiz(c *gin.Context, qr *quizRand, pokemon *Pokemon, optionsPool []*Pokemon, mode, region string) {
+	optionCount, _ := optionCountParam(c)
+	optionsPool = optionsPoolForDifficulty(pokemon, optionsPool, c.Query("difficulty"), region, optionCount)
+	question, err := newQuizQuestion(qr, pokemon, optionsPool, mode, optionCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quiz"})
+		return
+	}
+	order, _ := optionOrderParam(c)
+	orderOptions(question, order, pokemon, optionsPool, mode)
+	// accessible=true の場合は画像がなくても答えられるヒントを加える（種族値を使う形式では答えの手がかりになるので加えない）
+	hinted := c.Query("accessible") == "true" && !quizOnlyModes[mode]
+	if hinted {
+		addAccessibleHints(question, pokemon)
+	}
+	// shiny=true の場合は、答え合わせで色違いの画像（correctPokemon.shinyImageUrl）を表示するよう伝える
+	// 画像のURLには図鑑番号が含まれるため、問題には含めない
+	if c.Query("shiny") == "true" {
+		question["shiny"] = pokemon.ShinyImageURL != ""
+	}
+	userID, _ := optionalUserID(c)
+	if err := registerServedQuestion(question, pokemon, mode, c.Query("pack"), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quiz"})
+		return
+	}
+	timeLimit, _ := timeLimitParam(c)
+	if err := addQuestionToken(question, pokemon, c.Query("pack"), timeLimit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quiz"})
+		return
+	}
+	recordQuestionServed(userID, pokemon.ID, mode, c.Query("pack"), "quiz", hinted)
+	c.JSON(http.StatusOK, question)
+}
 
-	// 候補からランダムに3つ選ぶ
-	// crypto/randには直接Shuffleがないため、手動でシャッフルします
-	for i := len(filteredOptionsPool) - 1; i > 0; i-- {
-		jBig, _ := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
-		j := jBig.Int64()
-		filteredOptionsPool[i], filteredOptionsPool[j] = filteredOptionsPool[j], filteredOptionsPool[i]
+// newQuizQuestion は、出題形式に応じて optionCount 個の選択肢を選び、問題を組み立てます。
+// 特性の問題では、出題した特性を持つことがあるポケモンを不正解の選択肢から除外します。
+// qr が nil でなければ、その乱数で選ぶので同じ問題・選択肢を再現できます。
+func newQuizQuestion(qr *quizRand, pokemon *Pokemon, optionsPool []*Pokemon, mode string, optionCount int) (gin.H, error) {
+	if mode == quizModeReverseStats {
+		return buildReverseStatsQuestion(qr, pokemon, optionCount)
+	}
+	if mode == quizModeBSTBracket {
+		return buildBSTBracketQuestion(qr, pokemon, optionsPool, optionCount), nil
+	}
+	if mode == quizModeAbility && len(pokemon.Abilities) > 0 {
+		idx, err := qr.index(len(pokemon.Abilities))
+		if err != nil {
+			return nil, err
+		}
+		ability := pokemon.Abilities[idx]
+		filteredPool := make([]*Pokemon, 0, len(optionsPool))
+		for _, p := range optionsPool {
+			if !quiz.HasAbility(p, ability) {
+				filteredPool = append(filteredPool, p)
+			}
+		}
+		options, err := generateOptions(qr, pokemon, filteredPool, optionCount)
+		if err != nil {
+			return nil, err
+		}
+		question := buildQuizQuestion(pokemon, options, mode)
+		question["ability"] = ability
+		return question, nil
+	}
+	if mode == quizModeMove && len(pokemon.Moves) > 0 {
+		idx, err := qr.index(len(pokemon.Moves))
+		if err != nil {
+			return nil, err
+		}
+		move := pokemon.Moves[idx]
+		// 同じ技を覚える他のポケモンは正解になってしまうため選択肢から除外する
+		filteredPool := make([]*Pokemon, 0, len(optionsPool))
+		for _, p := range optionsPool {
+			if !quiz.LearnsMove(p, move) {
+				filteredPool = append(filteredPool, p)
+			}
+		}
+		options, err := generateOptions(qr, pokemon, filteredPool, optionCount)
+		if err != nil {
+			return nil, err
+		}
+		question := buildQuizQuestion(pokemon, options, mode)
+		question["move"] = move
+		return question, nil
+	}
+	if mode == quizModeEggGroup && len(pokemon.EggGroups) > 0 {
+		idx, err := qr.index(len(pokemon.EggGroups))
+		if err != nil {
+			return nil, err
+		}
+		eggGroup := pokemon.EggGroups[idx]
+		// 同じタマゴグループのポケモンは正解になってしまうため選択肢から除外する
+		filteredPool := make([]*Pokemon, 0, len(optionsPool))
+		for _, p := range optionsPool {
+			if !quiz.InEggGroup(p, eggGroup) {
+				filteredPool = append(filteredPool, p)
+			}
+		}
+		options, err := generateOptions(qr, pokemon, filteredPool, optionCount)
+		if err != nil {
+			return nil, err
+		}
+		question := buildQuizQuestion(pokemon, options, mode)
+		question["eggGroup"] = eggGroup
+		return question, nil
+	}
+	if mode == quizModeCrop && pokemon.ImageURL != "" {
+		options, err := generateOptions(qr, pokemon, optionsPool, optionCount)
+		if err != nil {
+			return nil, err
+		}
+		question := buildQuizQuestion(pokemon, options, mode)
+		return question, addCropQuestion(question, pokemon, qr.cropSeed())
+	}
+	if mode == quizModeEnToJa || mode == quizModeJaToEn {
+		// フォルム違いは日本語名が同じため、同じ名前のポケモンを選択肢から除外する
+		filteredPool := make([]*Pokemon, 0, len(optionsPool))
+		for _, p := range optionsPool {
+			if p.Name != pokemon.Name {
+				filteredPool = append(filteredPool, p)
+			}
+		}
+		options, err := generateOptionsBy(qr, pokemon, filteredPool, optionCount, func(p *Pokemon) string { return answerName(p, mode) })
+		if err != nil {
+			return nil, err
+		}
+		return buildQuizQuestion(pokemon, options, mode), nil
+	}
+	if mode == quizModeGenus && pokemon.Genus != "" {
+		// 同じ分類のポケモンが選択肢に混ざると正解が複数になるため除外する
+		filteredPool := make([]*Pokemon, 0, len(optionsPool))
+		for _, p := range optionsPool {
+			if p.Genus != pokemon.Genus {
+				filteredPool = append(filteredPool, p)
+			}
+		}
+		options, err := generateOptions(qr, pokemon, filteredPool, optionCount)
+		if err != nil {
+			return nil, err
+		}
+		return buildQuizQuestion(pokemon, options, mode), nil
+	}
+	if mode == quizModeAbility || mode == quizModeGenus || mode == quizModeMove || mode == quizModeEggGroup || mode == quizModeCrop {
+		// 特性や分類、技、タマゴグループ、イラストのデータがないポケモンは通常の形式で出題する
+		mode = quizModeStats
+	}
+	if mode == quizModeStats {
+		// ヒントが正解と全く同じポケモンは見分けられないため選択肢から除外する
+		filteredPool := make([]*Pokemon, 0, len(optionsPool))
+		for _, p := range optionsPool {
+			if !quiz.SameStatsHints(p, pokemon) {
+				filteredPool = append(filteredPool, p)
+			}
+		}
+		optionsPool = filteredPool
 	}
-	for i := 0; i < 3 && i < len(filteredOptionsPool); i++ {
-		options = append(options, filteredOptionsPool[i].Name)
+	options, err := generateOptions(qr, pokemon, optionsPool, optionCount)
+	if err != nil {
+		return nil, err
 	}
+	return buildQuizQuestion(pokemon, options, mode), nil
+}
 
-	// 最終的な選択肢をシャッフル
-	for i := len(options) - 1; i > 0; i-- {
-		jBig, _ := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
-		j := jBig.Int64()
-		options[i], options[j] = options[j], options[i]
+// mergeRegionPools は、指定した地方の一覧をつなげ、同じポケモンが重複しないようにして返します。
+// 存在しない地方やポケモンのいない地方が含まれていれば、その地方名を2つ目の戻り値で返します。
+func mergeRegionPools(regions map[string][]*Pokemon, names []string) ([]*Pokemon, string) {
+	seen := make(map[int]bool)
+	merged := make([]*Pokemon, 0)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		list := regions[name]
+		if len(list) == 0 {
+			if name == "" {
+				name = "(empty)"
+			}
+			return nil, name
+		}
+		if len(names) == 1 {
+			return list, ""
+		}
+		for _, p := range list {
+			if !seen[p.ID] {
+				seen[p.ID] = true
+				merged = append(merged, p)
+			}
+		}
 	}
+	return merged, ""
+}
 
-	c.JSON(http.StatusOK, gin.H{
+// answerName は、出題形式に応じて正解として扱う名前を返します。
+// 日本語名を見て英語名を当てる形式だけは英語名で答え合わせをします。
+func answerName(p *Pokemon, mode string) string {
+	if mode == quizModeJaToEn {
+		return p.EnglishName
+	}
+	return p.Name
+}
+
+// isOfferedOption は、回答の名前が出題した選択肢に含まれているかを返します。
+// 名前で答えない形式（選択肢が名前の一覧でない問題）では常に true を返します。
+// 出題されたIDから名前を調べて答えるなど、選択肢にない名前での回答を断るために使います。
+func isOfferedOption(question gin.H, name string) bool {
+	options, ok := question["options"].([]string)
+	return !ok || slices.ContainsFunc(options, func(o string) bool { return quiz.IsSameAnswer(name, o) })
+}
+
+// generateOptions は、正解のポケモンと選択肢プールからランダムな count 個の選択肢を作ります。
+// プールの候補が足りない場合は、選択肢はその分だけ少なくなります。qr が nil なら crypto/rand で選びます。
+func generateOptions(qr *quizRand, pokemon *Pokemon, optionsPool []*Pokemon, count int) ([]string, error) {
+	return generateOptionsBy(qr, pokemon, optionsPool, count, func(p *Pokemon) string { return p.Name })
+}
+
+// generateOptionsBy は、generateOptions と同じ手順で、nameOf が返す名前を選択肢にします。
+func generateOptionsBy(qr *quizRand, pokemon *Pokemon, optionsPool []*Pokemon, count int, nameOf func(*Pokemon) string) ([]string, error) {
+	// 出題から外したポケモンも選択肢に出さない
+	return quiz.GenerateOptions(pokemon, optionsPool, quiz.OptionsConfig{
+		Count:  count,
+		Index:  qr.index,
+		NameOf: nameOf,
+		Skip:   currentExclusions().has,
+	})
+}
+
+// buildQuizQuestion は、出題形式に応じてクライアントに見せるヒントを組み立てます。
+func buildQuizQuestion(pokemon *Pokemon, options []string, mode string) gin.H {
+	question := gin.H{
 		"id":      pokemon.ID,
-		"stats":   pokemon.Stats,
+		"mode":    mode,
 		"options": options,
-		"height":  pokemon.Height,
-		"weight":  pokemon.Weight,
 		"types":   pokemon.Types,
-	})
+	}
+	// 選択肢と同じ順番で読みを返す（漢字の名前にふりがなを振るため）
+	readings := make([]string, len(options))
+	for i, name := range options {
+		readings[i] = nameReadings[name]
+	}
+	question["optionReadings"] = readings
+	switch mode {
+	case quizModeTrivia:
+		question["captureRate"] = pokemon.CaptureRate
+		question["eggGroups"] = pokemon.EggGroups
+		question["growthRate"] = pokemon.GrowthRate
+	case quizModeAbility:
+		// 出題する特性は newQuizQuestion で追加する
+	case quizModeGenus:
+		question["genus"] = pokemon.Genus
+	case quizModeMove:
+		// 出題する技は newQuizQuestion で追加する
+	case quizModeEggGroup:
+		// 出題するタマゴグループは newQuizQuestion で追加する
+	case quizModeCrop:
+		// 切り抜いた画像は newQuizQuestion で追加する
+	case quizModeEnToJa:
+		question["englishName"] = pokemon.EnglishName
+	case quizModeJaToEn:
+		// 選択肢は英語名なので、ふりがなは出題する日本語名に付ける
+		question["name"] = pokemon.Name
+		question["nameReading"] = pokemon.NameReading
+		delete(question, "optionReadings")
+	default:
+		question["stats"] = pokemon.Stats
+		question["height"] = pokemon.Height
+		question["weight"] = pokemon.Weight
+	}
+	return question
 }
 
 func handleAnswer(c *gin.Context) {
 	var requestBody struct {
-		ID   int    `json:"id"`
-		Name string `json:"name"`
+		// 問題の questionToken（正解・出題形式・コンテンツパック・選択肢は token から取り出す）
+		QuestionToken string `json:"questionToken" binding:"required"`
+		Name          string `json:"name"`
+		// 種族値を当てる形式では、名前の代わりに選んだ選択肢の番号を送る
+		OptionIndex *int `json:"optionIndex"`
+		// 種族値の合計を比べる形式では、選んだポケモンのIDを送る
+		ID int `json:"id"`
 	}
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "questionToken from the question is required"})
+		return
+	}
+	question, err := parseQuestionToken(requestBody.QuestionToken)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Question token is invalid or has expired"})
 		return
 	}
 
-	correctPokemon, ok := pokemonMapByID[requestBody.ID]
+	pack, ok := lookupPack(question.Pack)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown content pack specified"})
+		return
+	}
+	correctPokemon, ok := pack.byID[question.PokemonID]
 	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Pokemon not found"})
 		return
 	}
 
-	isCorrect := requestBody.Name == correctPokemon.Name
-
-	// 認証済みユーザーの成績を更新
-	userID, exists := c.Get("userID")
-	if !exists {
-		// ログインしていないユーザーの場合、認証ヘッダーがないので手動でトークンを検証
-		authHeader := c.GetHeader("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			claims := &jwt.RegisteredClaims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) { return jwtKey, nil })
-			if err == nil && token.Valid {
-				uid, _ := strconv.Atoi(claims.Subject)
-				userID = uint(uid)
-				exists = true
-			}
+	isCorrect := quiz.IsSameAnswer(requestBody.Name, answerName(correctPokemon, question.Mode))
+	switch question.Mode {
+	case quizModeBSTBracket:
+		winner, valid := bstBracketWinner(pack.byID, question.OptionIDs)
+		if !valid || !slices.Contains(question.OptionIDs, requestBody.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id must be one of the options from the question"})
+			return
+		}
+		isCorrect = requestBody.ID == winner.ID
+		correctPokemon = winner
+	case quizModeReverseStats:
+		var valid bool
+		isCorrect, valid = checkReverseStatsAnswer(correctPokemon, question.Seed, question.Count, requestBody.OptionIndex)
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "optionIndex must be one of the options from the question"})
+			return
+		}
+	default:
+		// 選択肢にない名前で答えを探れないようにする
+		if len(question.Options) > 0 && !isOfferedOption(gin.H{"options": question.Options}, requestBody.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name must be one of the options from the question"})
+			return
 		}
 	}
-	if exists {
-		updateUserStats(db, userID.(uint), correctPokemon.ID, isCorrect)
+	if !markQuestionAnswered(question) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This question has already been answered"})
+		return
+	}
+	// 締め切りを過ぎた回答は、選んだものにかかわらず不正解にする
+	timedOut := question.timedOut(time.Now())
+	if timedOut {
+		isCorrect = false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"isCorrect":      isCorrect,
+		"timedOut":       timedOut,
 		"correctPokemon": correctPokemon,
-	})
+		"explanation":    buildExplanation(correctPokemon),
+	}
+
+	// 認証済みユーザーの成績を更新（コンテンツパックの問題は成績に含めない）
+	userID, exists := optionalUserID(c)
+	answer := statsAnswer{PokemonID: correctPokemon.ID, Mode: question.Mode, IsCorrect: isCorrect, AnsweredAt: time.Now()}
+	if q, ok := takeServedQuestion(question.QuestionID, userID); ok {
+		response["hintsUsed"] = q.HintsUsed
+		answer.HintsUsed, answer.Elapsed = q.HintsUsed, time.Since(q.servedAt)
+	}
+	if xp, ok := recordAnswerSubmitted(c, userID, correctPokemon.ID, question.Mode, question.Pack, "quiz", isCorrect); ok {
+		response["xp"] = xp
+	}
+	// 書き込みはキューに積み、少しだけ待っても終わらなければ集計を含めずに応答を先に返す
+	if exists && pack.isDefaultPack() {
+		res, ok, pending := updateUserStats(userID, answer)
+		if ok {
+			response["streak"] = res.Streak
+			response["stats"] = res.Stats
+			response["score"] = res.Score
+		}
+		if pending {
+			response["statsPending"] = true
+		}
+	} else {
+		// 成績に反映しない回答は、連続正解のボーナスなしで得点だけを返す
+		response["score"] = scoreAnswer(answer, 0)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// buildExplanation は、答え合わせの画面で紹介する「豆知識」を組み立てます。
+func buildExplanation(p *Pokemon) gin.H {
+	evolution := gin.H{"from": nil, "to": []gin.H{}}
+	if from, ok := pokemonMapByID[p.EvolvesFrom]; ok {
+		evolution["from"] = gin.H{"id": from.ID, "name": from.Name, "nameReading": from.NameReading}
+	}
+	to := []gin.H{}
+	for _, next := range pokemonEvolvesInto[p.SpeciesID] {
+		to = append(to, gin.H{"id": next.ID, "name": next.Name, "nameReading": next.NameReading})
+	}
+	evolution["to"] = to
+
+	return gin.H{
+		"genus":      p.Genus,
+		"flavorText": p.FlavorText,
+		"evolution":  evolution,
+	}
+}
+
+// handleGetPokemon は、指定されたIDのポケモンの詳細情報を返します。
+func handleGetPokemon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pokemon ID"})
+		return
+	}
+
+	pokemon, ok := pokemonMapByID[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pokemon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pokemon)
 }
 
 // --- 認証関連のハンドラ ---
@@ -461,27 +1435,32 @@ func handleRegister(c *gin.Context) {
 	}
 
 	// ユーザー名とパスワードのバリデーション
-	if !isValidCredentials(req.Username) || !isValidCredentials(req.Password) {
+	if !auth.ValidCredentials(req.Username) || !auth.ValidCredentials(req.Password) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password must be at least 8 characters long and contain both letters and numbers."})
 		return
 	}
+	if rejectBlockedName(c, "username", req.Username) {
+		return
+	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
-	user := User{Username: req.Username, PasswordHash: string(hashedPassword)}
-	result := db.Create(&user)
-	if result.Error != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+	// ユーザー統計情報も一緒に作成される
+	user := User{Username: req.Username, PasswordHash: hashedPassword}
+	if err := users.CreateUser(&user); err != nil {
+		if errors.Is(err, errUsernameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
 	}
 
-	// ユーザー統計情報も作成
-	db.Create(&UserStat{UserID: user.ID, WrongAnswers: "[]"})
-
+	recordAccountSignals(c, user.ID)
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
 }
 
@@ -495,37 +1474,36 @@ func handleLogin(c *gin.Context) {
 		return
 	}
 
-	var user User
-	if err := db.First(&user, "username = ?", req.Username).Error; err != nil {
+	user, err := users.UserByUsername(req.Username)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	if !auth.CheckPassword(user.PasswordHash, req.Password) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	expirationTime := time.Now().Add(TOKEN_DURATION)
-	claims := &jwt.RegisteredClaims{
-		Subject:   strconv.Itoa(int(user.ID)),
-		ExpiresAt: jwt.NewNumericDate(expirationTime),
+	now := time.Now()
+	tokenString, expiresAt, err := issueLoginToken(user.ID, user.TokenVersion, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	refreshToken, refreshExpiresAt, err := issueRefreshToken(db, user.ID, "", now, now)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
 		return
 	}
+	recordAccountSignals(c, user.ID)
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "expiresAt": expiresAt, "refreshToken": refreshToken, "refreshExpiresAt": refreshExpiresAt})
 }
 
 func handleMe(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	var user User
-	if err := db.First(&user, userID).Error; err != nil {
+	user, err := users.UserByID(c.MustGet("userID").(uint))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -534,27 +1512,27 @@ func handleMe(c *gin.Context) {
 
 func handleGetStats(c *gin.Context) {
 	userID, _ := c.Get("userID")
-	var userStat UserStat
-	if err := db.First(&userStat, "user_id = ?", userID).Error; err != nil {
-		// まだ成績がない場合は空の統計情報を返す
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusOK, UserStat{UserID: userID.(uint), WrongAnswers: "[]"})
-			return
-		}
+	userStat, err := users.Stats(userID.(uint))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Stats not found"})
 		return
 	}
-
-	// RegionalStatsをパースして返す
-	var regionalStats map[string]RegionalStatDetail
-	if userStat.RegionalStats != "" && userStat.RegionalStats != "{}" {
-		json.Unmarshal([]byte(userStat.RegionalStats), &regionalStats)
+	// まだ成績がない場合は空の統計情報を返す
+	if userStat == nil {
+		c.JSON(http.StatusOK, UserStat{UserID: userID.(uint), WrongAnswers: "[]"})
+		return
 	}
 
-	// 過去データからのマイグレーション処理
+	// RegionalStats・ModeStatsをパースして返す
+	regionalStats := parseStatTallies(userStat.RegionalStats)
+	modeStats := parseStatTallies(userStat.ModeStats)
+
+	// 地方ごとの成績を記録する前の成績しかない場合は、ポケモンごとの回答記録から集計する
+	// （保存し直すのは管理者の再集計で行う）
 	if len(regionalStats) == 0 && userStat.TotalQuestions > 0 {
-		log.Printf("Migrating regional stats for user %d...", userID)
-		regionalStats = migrateRegionalStatsFromWrongAnswers(&userStat)
+		if attempts, err := users.PokemonAttempts(userStat.UserID); err == nil {
+			regionalStats, _ = regionalStatsFromAttempts(attempts)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -563,44 +1541,15 @@ func handleGetStats(c *gin.Context) {
 		"TotalCorrect":   userStat.TotalCorrect,
 		"WrongAnswers":   userStat.WrongAnswers,
 		"RegionalStats":  regionalStats, // パースした結果を返す
+		"ModeStats":      modeStats,
+		"CurrentStreak":  userStat.CurrentStreak,
+		"BestStreak":     userStat.BestStreak,
+		"TotalSkipped":   userStat.TotalSkipped,
+		"TotalScore":     userStat.TotalScore,
+		"XP":             userXP(userStat),
 	})
 }
 
-// migrateRegionalStatsFromWrongAnswers は WrongAnswers の情報から地方別成績を復元する
-func migrateRegionalStatsFromWrongAnswers(stat *UserStat) map[string]RegionalStatDetail {
-	regionalStats := make(map[string]RegionalStatDetail)
-	var wrongIDs []int
-	if stat.WrongAnswers != "" && stat.WrongAnswers != "null" {
-		json.Unmarshal([]byte(stat.WrongAnswers), &wrongIDs)
-	}
-	wrongSet := make(map[int]bool)
-	for _, id := range wrongIDs {
-		wrongSet[id] = true
-	}
-
-	// 全ポケモンをループして、正解・不正解を判定し、地方別に集計
-	// この方法はTotalQuestionsと一致しない可能性があるが、近似値として扱う
-	// より正確に行うには、回答履歴をすべてDBに保存する設計変更が必要
-	for id, pokemon := range pokemonMapByID {
-		if pokemon.Category == "" {
-			continue
-		}
-		// このポケモンに回答したことがあると仮定できるか？
-		// 現状のデータだけでは「回答したすべての問題」を知ることができないため、
-		// 「TotalQuestions」から「不正解数」を引いたものを正解数として、各ポケモンに割り振ることは困難。
-		// ここでは、不正解リストにあるポケモンは不正解としてカウントし、
-		// 地方別成績のtotalに加算する。
-		if _, isWrong := wrongSet[id]; isWrong {
-			regionStat := regionalStats[pokemon.Category]
-			regionStat.Total++
-			regionalStats[pokemon.Category] = regionStat
-		}
-	}
-	// TotalCorrect を TotalQuestions と 不正解数から再計算し、地方に割り振るのは複雑なため、
-	// このマイグレーションでは不正解だった問題の地方分布のみを復元する。
-	return regionalStats
-}
-
 // --- ミドルウェア ---
 
 func authMiddleware() gin.HandlerFunc {
@@ -612,129 +1561,258 @@ func authMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := &jwt.RegisteredClaims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// 署名方式が期待通りか検証
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
-			// エラーの種類によってログレベルを変える
-			if errors.Is(err, jwt.ErrTokenExpired) {
+		userID, claims, err := loginTokens.Parse(tokenString)
+		if err != nil {
+			// エラーの種類によってメッセージを変える
+			switch {
+			case errors.Is(err, auth.ErrTokenExpired):
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
-				return
+			case errors.Is(err, auth.ErrInvalidSubject):
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+			default:
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
 
-		userID, err := strconv.Atoi(claims.Subject)
+		// トークン内のユーザーIDがDBに実際に存在するか確認
+		user, err := users.UserByID(userID)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found for token"})
 			return
 		}
-
-		// トークン内のユーザーIDがDBに実際に存在するか確認
-		var user User
-		if err := db.First(&user, uint(userID)).Error; err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found for token"})
+		if auth.Revoked(claims, user.TokenVersion) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked, please log in again"})
 			return
 		}
 
-		// c.Set("userID", user.ID) // user.ID をセットする
-		c.Set("userID", uint(userID)) // 既存のコードとの互換性のため、こちらを維持
+		refreshLoginToken(c, userID, claims)
+
+		c.Set("userID", userID)
 		c.Next()
 	}
 }
 
 // --- ヘルパー関数 ---
 
-func updateUserStats(db *gorm.DB, userID uint, pokemonID int, isCorrect bool) {
-	// トランザクションを開始
-	err := db.Transaction(func(tx *gorm.DB) error {
-		var stat UserStat
-		// レコードをロックして取得し、なければ作成
-		if err := tx.FirstOrCreate(&stat, UserStat{UserID: userID}).Error; err != nil {
-			return err
-		}
+// optionalUserID は、認証が必須ではないエンドポイントでログインユーザーのIDを取得します。
+// authMiddlewareを通っていない場合は、Authorizationヘッダーのトークンを手動で検証します。
+func optionalUserID(c *gin.Context) (uint, bool) {
+	if userID, exists := c.Get("userID"); exists {
+		return userID.(uint), true
+	}
+	authHeader := c.GetHeader("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return 0, false
+	}
+	uid, claims, err := loginTokens.Parse(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return 0, false
+	}
+	// パスワードを変える前のトークンはログインしていないものとして扱う
+	if user, err := users.UserByID(uid); err == nil && auth.Revoked(claims, user.TokenVersion) {
+		return 0, false
+	}
+	refreshLoginToken(c, uid, claims)
+	return uid, true
+}
 
-		stat.TotalQuestions++
-		var wrongIDs []int
-		if stat.WrongAnswers != "" && stat.WrongAnswers != "null" {
-			if err := json.Unmarshal([]byte(stat.WrongAnswers), &wrongIDs); err != nil {
-				// JSONのパースに失敗した場合、空のスライスとして扱う
-				wrongIDs = []int{}
-			}
+// updateUserStats は、1問分の回答結果をユーザーの成績に反映し、更新後の連続正解の状況と成績の集計を返します。
+// 更新に失敗した場合は ok が false、書き込みを待ち切れなかった場合は pending が true になります（stats_queue.go）。
+func updateUserStats(userID uint, answer statsAnswer) (res answerStatsResult, ok, pending bool) {
+	res, pending, err := writeUserStats(userID, []statsAnswer{answer}, answerStatsWait)
+	return res, err == nil && !pending, pending
+}
+
+// applyAnswerToStats は、トランザクションの中で1問分の回答結果をユーザーの成績に反映します（gormUserStore が使う）。
+// 複数の回答をまとめて反映する場合は、同じトランザクションで繰り返し呼び出します。
+func applyAnswerToStats(tx *gorm.DB, userID uint, a statsAnswer) (answerStatsResult, error) {
+	// レコードをロックして取得し、なければ作成
+	stat, err := lockUserStat(tx, userID)
+	if err != nil {
+		return answerStatsResult{}, err
+	}
+
+	if a, err = applyStreakShieldBefore(tx, userID, &stat, a); err != nil {
+		return answerStatsResult{}, err
+	}
+	result := applyAnswer(&stat, a)
+	if err := applyStreakShieldAfter(tx, userID, a, &result.Streak); err != nil {
+		return answerStatsResult{}, err
+	}
+
+	// ポケモンごとの回答記録を更新（苦手なポケモンを優先する出題に使う）
+	if err := recordPokemonAttempt(tx, userID, a.PokemonID, a.IsCorrect); err != nil {
+		return answerStatsResult{}, err
+	}
+
+	if err := recordAnswerScore(tx, userID, a, result.Score); err != nil {
+		return answerStatsResult{}, err
+	}
+
+	// デイリー目標の進捗を更新
+	if err := updateDailyProgress(tx, userID, a.IsCorrect, time.Now()); err != nil {
+		return answerStatsResult{}, err
+	}
+
+	if err := tx.Save(&stat).Error; err != nil {
+		return answerStatsResult{}, err
+	}
+	return result, nil
+}
+
+// applyAnswer は、1問分の回答結果を成績に反映し、更新後の連続正解の状況と成績の集計を返します（保存はしない）。
+func applyAnswer(stat *UserStat, a statsAnswer) answerStatsResult {
+	pokemonID, isCorrect := a.PokemonID, a.IsCorrect
+	var streak answerStreak
+	var aggregates statsAggregates
+
+	stat.TotalQuestions++
+	var wrongIDs []int
+	if stat.WrongAnswers != "" && stat.WrongAnswers != "null" {
+		if err := json.Unmarshal([]byte(stat.WrongAnswers), &wrongIDs); err != nil {
+			// JSONのパースに失敗した場合、空のスライスとして扱う
+			wrongIDs = []int{}
 		}
+	}
 
-		// 地方ごとの成績を更新
-		pokemon, ok := pokemonMapByID[pokemonID]
-		if ok && pokemon.Category != "" {
-			updateRegionalStats(&stat, pokemon.Category, isCorrect)
-		} else {
-			log.Printf("Warning: Could not find category for pokemon ID %d to update regional stats.", pokemonID)
+	// 地方ごとの成績を更新
+	pokemon, ok := pokemonMapByID[pokemonID]
+	if ok && pokemon.Category != "" {
+		tally := updateRegionalStats(stat, pokemon.Category, isCorrect)
+		aggregates.Region = pokemon.Category
+		aggregates.RegionalTally = &tally
+	} else {
+		log.Printf("Warning: Could not find category for pokemon ID %d to update regional stats.", pokemonID)
+	}
+	// 出題形式ごとの成績を更新（出題形式が分からない回答は、全体と地方ごとの成績にだけ数える）
+	if a.Mode != "" {
+		tally := updateStatTally(&stat.ModeStats, a.Mode, isCorrect)
+		aggregates.Mode = a.Mode
+		aggregates.ModeTally = &tally
+	}
+
+	// 連続正解数を更新
+	streak = answerStreak{}
+	if isCorrect {
+		stat.CurrentStreak++
+		if stat.CurrentStreak > stat.BestStreak {
+			stat.BestStreak = stat.CurrentStreak
+			streak.IsNewBest = true
 		}
+	} else if a.StreakShielded {
+		streak.Shielded = true
+	} else {
+		stat.CurrentStreak = 0
+	}
+	streak.Current = stat.CurrentStreak
+	streak.Best = stat.BestStreak
 
-		if isCorrect {
-			stat.TotalCorrect++
-			// 間違えたリストから削除
-			newWrongIDs := make([]int, 0, len(wrongIDs))
-			for _, id := range wrongIDs {
-				if id != pokemonID {
-					newWrongIDs = append(newWrongIDs, id)
-				}
-			}
-			wrongIDs = newWrongIDs
-		} else {
-			// 間違えたリストに追加（重複しないように）
-			found := false
-			for _, id := range wrongIDs {
-				if id == pokemonID {
-					found = true
-					break
-				}
-			}
-			if !found {
-				wrongIDs = append(wrongIDs, pokemonID)
+	if isCorrect {
+		stat.TotalCorrect++
+		// 間違えたリストから削除
+		newWrongIDs := make([]int, 0, len(wrongIDs))
+		for _, id := range wrongIDs {
+			if id != pokemonID {
+				newWrongIDs = append(newWrongIDs, id)
 			}
 		}
+		wrongIDs = newWrongIDs
+	} else {
+		wrongIDs = recordWrongAnswer(wrongIDs, pokemonID, wrongAnswersCap)
+	}
 
-		updatedWrong, _ := json.Marshal(wrongIDs)
-		stat.WrongAnswers = string(updatedWrong)
+	updatedWrong, _ := json.Marshal(wrongIDs)
+	stat.WrongAnswers = string(updatedWrong)
 
-		return tx.Save(&stat).Error
-	})
-	if err != nil {
-		log.Printf("Failed to update user stats for user %d: %v", userID, err)
+	aggregates.TotalQuestions = stat.TotalQuestions
+	aggregates.TotalCorrect = stat.TotalCorrect
+	aggregates.Accuracy = float64(stat.TotalCorrect) / float64(stat.TotalQuestions)
+	stat.BonusXP += bonusXP(a)
+	aggregates.XP = userXP(stat)
+
+	// 得点は連続正解を反映した後に計算する
+	score := scoreAnswer(a, stat.CurrentStreak)
+	stat.TotalScore += score.Points
+	aggregates.TotalScore = stat.TotalScore
+	return answerStatsResult{Streak: streak, Stats: aggregates, Score: score}
+}
+
+// lockUserStat は、ユーザーの成績のレコードを SELECT ... FOR UPDATE でロックして取得し、なければ作成します。
+// 同じユーザーの回答が同時に届いても（ダブルタップや複数のタブ）、後の回答はトランザクションが終わるまで待たされるので加算が失われません。
+// SQLiteはロック句に対応していない（ドライバが FOR UPDATE を落とす）ので、代わりにトランザクションを BEGIN IMMEDIATE で始めて
+// 書き込みのロックを最初に取り、他の書き込みは busy_timeout の間ロックが空くのを待たせます（sqliteDSNOptions）。
+func lockUserStat(tx *gorm.DB, userID uint) (UserStat, error) {
+	var stat UserStat
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).Limit(1).Find(&stat)
+	if result.Error != nil {
+		return UserStat{}, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return stat, nil
+	}
+	// 同時に作成されても一意制約で1件になるよう、既にあれば何もしない
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserStat{UserID: userID}).Error; err != nil {
+		return UserStat{}, err
 	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&stat).Error; err != nil {
+		return UserStat{}, err
+	}
+	return stat, nil
 }
 
-func updateRegionalStats(stat *UserStat, region string, isCorrect bool) {
-	var regionalStats map[string]RegionalStatDetail
-	if stat.RegionalStats != "" && stat.RegionalStats != "{}" {
-		if err := json.Unmarshal([]byte(stat.RegionalStats), &regionalStats); err != nil {
-			log.Printf("Error unmarshalling regional stats: %v. Initializing new map.", err)
-			regionalStats = make(map[string]RegionalStatDetail)
+// recordWrongAnswer は、間違えたリストの末尾にポケモンを追加します（既にあれば末尾に移動する）。
+// リストは古く間違えた順に並び、上限を超えた分は最後に間違えたのが古いものから捨てます。
+func recordWrongAnswer(wrongIDs []int, pokemonID, limit int) []int {
+	updated := make([]int, 0, len(wrongIDs)+1)
+	for _, id := range wrongIDs {
+		if id != pokemonID {
+			updated = append(updated, id)
+		}
+	}
+	updated = append(updated, pokemonID)
+	if limit > 0 && len(updated) > limit {
+		updated = updated[len(updated)-limit:]
+	}
+	return updated
+}
+
+// updateRegionalStats は、地方ごとの成績に1問分の結果を加え、更新後のその地方の成績を返します。
+func updateRegionalStats(stat *UserStat, region string, isCorrect bool) RegionalStatDetail {
+	return updateStatTally(&stat.RegionalStats, region, isCorrect)
+}
+
+// updateStatTally は、JSONで保存した地方ごと・出題形式ごとの成績の key の分に1問加え、その成績を返します。
+func updateStatTally(data *string, key string, isCorrect bool) RegionalStatDetail {
+	tallies := make(map[string]RegionalStatDetail)
+	if *data != "" && *data != "{}" {
+		if err := json.Unmarshal([]byte(*data), &tallies); err != nil {
+			log.Printf("Error unmarshalling stats for %q: %v. Initializing new map.", key, err)
+			tallies = make(map[string]RegionalStatDetail)
 		}
-	} else {
-		regionalStats = make(map[string]RegionalStatDetail)
 	}
 
-	regionStat := regionalStats[region]
-	regionStat.Total++
+	tally := tallies[key]
+	tally.Total++
 	if isCorrect {
-		regionStat.Correct++
+		tally.Correct++
 	}
-	regionalStats[region] = regionStat
+	tallies[key] = tally
 
-	updatedStats, err := json.Marshal(regionalStats)
+	updatedStats, err := json.Marshal(tallies)
 	if err == nil {
-		stat.RegionalStats = string(updatedStats)
+		*data = string(updatedStats)
+	}
+	return tally
+}
+
+// parseStatTallies は、JSONで保存した地方ごと・出題形式ごとの成績を読み込みます（なければ nil）。
+func parseStatTallies(data string) map[string]RegionalStatDetail {
+	var tallies map[string]RegionalStatDetail
+	if data != "" && data != "{}" {
+		json.Unmarshal([]byte(data), &tallies)
 	}
+	return tallies
 }
 
 // --- ミドルウェア ---
@@ -756,16 +1834,18 @@ func securityHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
-// isValidCredentials は、ユーザー名とパスワードが要件を満たしているか検証します。
-func isValidCredentials(cred string) bool {
-	if len(cred) < 8 {
-		return false
-	}
-	hasLetter, _ := regexp.MatchString(`[a-zA-Z]`, cred)
-	hasNumber, _ := regexp.MatchString(`[0-9]`, cred)
-	isAlphanumeric, _ := regexp.MatchString(`^[a-zA-Z0-9]+$`, cred)
+// randomIndex は、crypto/randを使って 0 以上 n 未満の乱数を返します。
+func randomIndex(n int) (int, error) {
+	return quiz.CryptoIndex(n)
+}
 
-	return hasLetter && hasNumber && isAlphanumeric
+// newRandomID は、対戦ルームやセッションに使う推測されにくいIDを生成します。
+func newRandomID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
 // loadOrFetchPokemonData は、pokemon.jsonが存在すればそこからデータを読み込み、
@@ -782,22 +1862,36 @@ func loadOrFetchPokemonData() error {
 			return fmt.Errorf("failed to unmarshal pokemon data: %w", err)
 		}
 		log.Printf("Successfully loaded %d Pokemon from file.", len(pokemonMapByID))
+		// PokeAPIから取得し直した分の差分を記録するため、取得前のデータを写しておく
+		before := snapshotPokemonData()
 
 		// 読み込んだデータに不足がないか確認し、あればAPIから再取得する
 		// 最初のポケモンデータで判定
-		if p, ok := pokemonMapByID[1]; ok && (len(p.Types) == 0 || p.Height == 0 || p.Weight == 0) {
+		// 色違いの画像はないポケモンもいるので、フシギダネにあるかどうかだけで判定する
+		if p, ok := pokemonMapByID[1]; ok && (isPokemonDataIncomplete(p) || p.ShinyImageURL == "") {
 			log.Println("Cached data is incomplete. Refetching all data from PokeAPI...")
 			// マップをクリアして再取得
 			pokemonMapByID = make(map[int]*Pokemon)
 			if err := fetchAllPokemonData(); err != nil {
 				return fmt.Errorf("failed to refetch pokemon data: %w", err)
 			}
+			// 取得し直したポケモンにはカテゴリがないので、改めて付与する（付与しないと地方別の出題範囲が空になる）
+			log.Println("Fetching category data from PokeAPI...")
+			fetchCategoryData()
 			// 新しいデータでファイルを上書き
 			data, err := json.MarshalIndent(pokemonMapByID, "", "  ")
 			if err != nil {
 				return fmt.Errorf("failed to marshal refetched pokemon data: %w", err)
 			}
-			os.WriteFile(pokemonDataFile, data, 0o644) // エラーは無視（最悪次回再取得される）
+			if err := os.WriteFile(pokemonDataFile, data, 0o644); err == nil { // エラーは無視（最悪次回再取得される）
+				clearFetchCheckpoint()
+			}
+			recordDatasetDiff(datasetSyncRefetch, before)
+		} else if err := topUpPokemonData(); err != nil {
+			// 追加の取得に失敗しても、読み込んだデータだけで起動する
+			log.Printf("Failed to top up pokemon data: %v", err)
+		} else {
+			recordDatasetDiff(datasetSyncTopUp, before)
 		}
 	} else if errors.Is(err, os.ErrNotExist) {
 		// ファイルが存在しない場合
@@ -818,7 +1912,9 @@ func loadOrFetchPokemonData() error {
 		if err := os.WriteFile(pokemonDataFile, data, 0o644); err != nil {
 			return fmt.Errorf("failed to write pokemon data file: %w", err)
 		}
+		clearFetchCheckpoint()
 		log.Printf("Successfully fetched and saved %d Pokemon to %s", len(pokemonMapByID), pokemonDataFile)
+		recordDatasetDiff(datasetSyncInitial, nil)
 	} else {
 		// その他のエラー
 		return fmt.Errorf("failed to check pokemon data file: %w", err)
@@ -827,14 +1923,91 @@ func loadOrFetchPokemonData() error {
 	// メモリ上のマップから地方別リストを構築（APIコールなし）
 	log.Println("Organizing pokemon by region...")
 	organizePokemonByRegion()
+	reportDatasetSummary()
+
+	return nil
+}
+
+// discoverMaxPokemonID は、取得するポケモンの図鑑番号の上限を返します。
+// MAX_POKEMON_ID が設定されていればその値、なければPokeAPIの種族の一覧の件数を使います。
+// どちらも得られなければ既定の上限を返し、2つ目の戻り値を false にします。
+func discoverMaxPokemonID() (int, bool) {
+	if n := envInt("MAX_POKEMON_ID", 0); n > 0 {
+		pokemonIDUpperBound = n
+		return n, true
+	}
+	client := newPokeAPIClient(20 * time.Second)
+	resp, err := client.Get("https://pokeapi.co/api/v2/pokemon-species?limit=1")
+	if err != nil {
+		log.Printf("Failed to discover the number of Pokemon species, using %d: %v", expectedPokemonCount, err)
+		return expectedPokemonCount, false
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Count int `json:"count"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&list) != nil || list.Count <= 0 {
+		log.Printf("Failed to discover the number of Pokemon species (status %d), using %d.", resp.StatusCode, expectedPokemonCount)
+		return expectedPokemonCount, false
+	}
+	pokemonIDUpperBound = list.Count
+	return list.Count, true
+}
+
+// topUpPokemonData は、pokemon.json にない図鑑番号（新しく追加されたポケモンや、前回取得できなかったポケモン）だけを取得して追加します。
+// 上限が分からない場合（PokeAPIに接続できないなど）は何もしません。
+func topUpPokemonData() error {
+	maxID, ok := discoverMaxPokemonID()
+	if !ok {
+		return nil
+	}
+	var missing []int
+	for id := 1; id <= maxID; id++ {
+		if _, exists := pokemonMapByID[id]; !exists {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	log.Printf("Fetching %d Pokemon missing from %s (up to ID %d)...", len(missing), pokemonDataFile, maxID)
+	if err := fetchPokemonData(missing); err != nil {
+		return err
+	}
+	// 追加したポケモンのカテゴリを付与（カテゴリが設定済みのポケモンは変わらない）
+	fetchCategoryData()
 
+	data, err := json.MarshalIndent(pokemonMapByID, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pokemon data: %w", err)
+	}
+	if err := os.WriteFile(pokemonDataFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write pokemon data file: %w", err)
+	}
+	clearFetchCheckpoint()
+	log.Printf("Topped up %s: now %d Pokemon including forms.", pokemonDataFile, len(pokemonMapByID))
 	return nil
 }
 
-// fetchAllPokemonData は、PokeAPIから指定された数のポケモンデータを並行して取得します。
+// isPokemonDataIncomplete は、キャッシュされたポケモンデータに後から追加した項目が欠けていないか判定します。
+func isPokemonDataIncomplete(p *Pokemon) bool {
+	return len(p.Types) == 0 || p.Height == 0 || p.Weight == 0 || len(p.EggGroups) == 0 || p.GrowthRate == "" || len(p.Abilities) == 0 || p.Genus == "" || p.NameReading == "" || p.Moves == nil || p.Rarity == ""
+}
+
+// fetchAllPokemonData は、PokeAPIから全てのポケモンデータを並行して取得します。
 func fetchAllPokemonData() error {
+	maxID, _ := discoverMaxPokemonID()
+	ids := make([]int, 0, maxID)
+	for i := 1; i <= maxID; i++ {
+		ids = append(ids, i)
+	}
+	return fetchPokemonData(ids)
+}
+
+// fetchPokemonData は、PokeAPIから指定した図鑑番号のポケモンデータ（フォルム違いを含む）を並行して取得します。
+func fetchPokemonData(ids []int) error {
 	var wg sync.WaitGroup
-	client := &http.Client{Timeout: 20 * time.Second} // タイムアウトを少し延長
+	client := newPokeAPIClient(20 * time.Second) // タイムアウトを少し延長
 
 	// タイプの日本語名を先に読み込む
 	if err := loadTypeNames(); err != nil {
@@ -846,11 +2019,15 @@ func fetchAllPokemonData() error {
 	semaphore := make(chan struct{}, 10)
 
 	// 1. まず全てのポケモンの基本データを並行取得してマップに格納
-	// PokeAPIの仕様上、IDは1025(Paldea) + α 程度まで存在する
-	const MAX_POKEMON_ID = 1025 // 必要に応じて調整
 	var mu sync.Mutex
 
-	for i := 1; i <= MAX_POKEMON_ID; i++ {
+	// 前回の取得が途中で止まっていれば、取得済みのIDは飛ばす
+	progress := loadFetchCheckpoint(&mu)
+
+	for _, i := range ids {
+		if progress.isCompleted(i) {
+			continue
+		}
 		semaphore <- struct{}{} // セマフォを取得
 		wg.Add(1)
 		go func(id int) {
@@ -874,6 +2051,7 @@ func fetchAllPokemonData() error {
 			}
 
 			if pokemonResp.StatusCode == http.StatusNotFound {
+				progress.markCompleted(id)
 				return // 存在しないIDはスキップ
 			}
 
@@ -883,6 +2061,10 @@ func fetchAllPokemonData() error {
 				return
 			}
 
+			// 特性と技の日本語名を取得
+			loadAbilityNames(client, apiPokemon)
+			loadMoveNames(client, apiPokemon)
+
 			// ポケモンの日本語名を取得
 			speciesResp, err := client.Get(fmt.Sprintf("https://pokeapi.co/api/v2/pokemon-species/%d", id))
 			if err != nil {
@@ -911,44 +2093,64 @@ func fetchAllPokemonData() error {
 			pokemonMapByID[pokemon.ID] = &pokemon
 
 			// 2. フォルム違いを特定して追加
+			// フォルム違いの取得が全て終わってから、このIDを取得済みとして途中経過に残す
+			var varietyWG sync.WaitGroup
+			var varietyFailed atomic.Bool
+			fetchVariety := func(vName, category string) {
+				wg.Add(1)
+				varietyWG.Add(1)
+				go func() {
+					defer varietyWG.Done()
+					if !fetchAndAddVariety(vName, category, &wg, semaphore, &mu) {
+						varietyFailed.Store(true)
+					}
+				}()
+			}
 			for _, variety := range apiSpecies.Varieties {
 				if !variety.IsDefault {
 					vName := variety.Pokemon.Name
-					// wg.Add(1) をゴルーチン起動の前に追加
 					if strings.Contains(vName, "-mega") || strings.Contains(vName, "-mega-x") || strings.Contains(vName, "-mega-y") {
-						wg.Add(1)
-						go fetchAndAddVariety(vName, "mega", &wg, semaphore, &mu)
+						fetchVariety(vName, "mega")
 					} else if strings.Contains(vName, "-gmax") {
-						wg.Add(1)
-						go fetchAndAddVariety(vName, "gmax", &wg, semaphore, &mu)
+						fetchVariety(vName, "gmax")
 					} else if strings.Contains(vName, "-alola") || strings.Contains(vName, "-galar") || strings.Contains(vName, "-hisui") || strings.Contains(vName, "-paldea") {
-						wg.Add(1)
-						go fetchAndAddVariety(vName, "regional", &wg, semaphore, &mu)
+						fetchVariety(vName, "regional")
 					}
 				}
 			}
 			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				varietyWG.Wait()
+				if !varietyFailed.Load() {
+					progress.markCompleted(id)
+				}
+			}()
 		}(i)
 	}
 	wg.Wait()
+	progress.save()
 
 	return nil // 成功
 }
 
 // fetchAndAddVariety は、フォルム違いのポケモンデータを取得してマップに追加するヘルパー関数です。
-func fetchAndAddVariety(name string, category string, wg *sync.WaitGroup, semaphore chan struct{}, mu *sync.Mutex) {
+// 取得に失敗した場合は false を返します（存在しない場合や既に追加済みの場合は true）。
+func fetchAndAddVariety(name string, category string, wg *sync.WaitGroup, semaphore chan struct{}, mu *sync.Mutex) bool {
 	defer wg.Done()
 	semaphore <- struct{}{}
 	defer func() { <-semaphore }()
 
-	client := &http.Client{Timeout: 20 * time.Second}
+	client := newPokeAPIClient(20 * time.Second)
 
 	// 既にマップに存在するかチェック（重複追加を避ける）
 	mu.Lock()
 	for _, p := range pokemonMapByID {
 		if p.EnglishName == name {
 			mu.Unlock()
-			return
+			return true
 		}
 	}
 	mu.Unlock()
@@ -957,32 +2159,36 @@ func fetchAndAddVariety(name string, category string, wg *sync.WaitGroup, semaph
 	pokemonResp, err := client.Get(fmt.Sprintf("https://pokeapi.co/api/v2/pokemon/%s", name))
 	if err != nil {
 		log.Printf("Error fetching variety %s: %v", name, err)
-		return
+		return false
 	}
 	defer pokemonResp.Body.Close()
 
 	if pokemonResp.StatusCode == http.StatusNotFound {
-		return // 存在しない場合はスキップ
+		return true // 存在しない場合はスキップ
 	}
 
 	var apiPokemon pokeAPIPokemonResponse
 	if err := json.NewDecoder(pokemonResp.Body).Decode(&apiPokemon); err != nil {
 		log.Printf("Error decoding variety %s: %v", name, err)
-		return
+		return false
 	}
 
+	// 特性と技の日本語名を取得
+	loadAbilityNames(client, apiPokemon)
+	loadMoveNames(client, apiPokemon)
+
 	// ポケモンの日本語名を取得
 	speciesResp, err := client.Get(apiPokemon.Species.URL)
 	if err != nil {
 		log.Printf("Error fetching species for variety %s: %v", name, err)
-		return
+		return false
 	}
 	defer speciesResp.Body.Close()
 
 	var apiSpecies pokeAPISpeciesResponse
 	if err := json.NewDecoder(speciesResp.Body).Decode(&apiSpecies); err != nil {
 		log.Printf("Error decoding species for variety %s: %v", name, err)
-		return
+		return false
 	}
 
 	// 必要な情報を抽出
@@ -992,9 +2198,10 @@ func fetchAndAddVariety(name string, category string, wg *sync.WaitGroup, semaph
 	// スレッドセーフにマップに追加
 	mu.Lock()
 	// IDが重複しないように、10000番台をフォルム違いに割り当てる
-	pokemon.ID += 10000
+	pokemon.ID += formIDOffset
 	pokemonMapByID[pokemon.ID] = &pokemon
 	mu.Unlock()
+	return true
 }
 
 // loadTypeNames は、PokeAPIからタイプの日本語名を取得してマップに保存します。
@@ -1003,7 +2210,7 @@ func loadTypeNames() error {
 		return nil // 既に読み込み済み
 	}
 	log.Println("Fetching Pokemon type names...")
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newPokeAPIClient(10 * time.Second)
 	// タイプは18種類 + 不明・かげ
 	for i := 1; i <= 18; i++ {
 		resp, err := client.Get(fmt.Sprintf("https://pokeapi.co/api/v2/type/%d", i))
@@ -1017,10 +2224,10 @@ func loadTypeNames() error {
 			return fmt.Errorf("failed to decode type %d: %w", i, err)
 		}
 
-		// 英語のtype名を取得
-		englishTypeName := ""
+		// 英語のtype名を取得（/pokemon/{id} のタイプは識別子で参照するので、識別子があればそれを使う）
+		englishTypeName := typeResp.Name
 		for _, nameInfo := range typeResp.Names {
-			if nameInfo.Language.Name == "en" {
+			if englishTypeName == "" && nameInfo.Language.Name == "en" {
 				englishTypeName = nameInfo.Name
 				break
 			}
@@ -1035,9 +2242,94 @@ func loadTypeNames() error {
 	return nil
 }
 
+// loadAbilityNames は、ポケモンが持つ特性のうち、まだ日本語名を取得していないものをPokeAPIから取得します。
+// 取得に失敗した特性は英語名のまま扱います。
+func loadAbilityNames(client *http.Client, apiPokemon pokeAPIPokemonResponse) {
+	for _, a := range apiPokemon.Abilities {
+		abilityNameMu.Lock()
+		_, ok := abilityNameMap[a.Ability.Name]
+		abilityNameMu.Unlock()
+		if ok {
+			continue
+		}
+
+		japaneseName, err := fetchJapaneseName(client, a.Ability.URL)
+		if err != nil {
+			log.Printf("Error fetching ability %s: %v", a.Ability.Name, err)
+			continue
+		}
+		if japaneseName == "" {
+			continue
+		}
+		abilityNameMu.Lock()
+		abilityNameMap[a.Ability.Name] = japaneseName
+		abilityNameMu.Unlock()
+	}
+}
+
+// loadMoveNames は、ポケモンがレベルアップで覚える技の日本語名を取得してマップに保存します。
+func loadMoveNames(client *http.Client, apiPokemon pokeAPIPokemonResponse) {
+	for _, m := range apiPokemon.Moves {
+		if !isLevelUpMove(m.VersionGroupDetails) {
+			continue
+		}
+		moveNameMu.Lock()
+		_, ok := moveNameMap[m.Move.Name]
+		moveNameMu.Unlock()
+		if ok {
+			continue
+		}
+
+		japaneseName, err := fetchJapaneseName(client, m.Move.URL)
+		if err != nil {
+			log.Printf("Error fetching move %s: %v", m.Move.Name, err)
+			continue
+		}
+		if japaneseName == "" {
+			continue
+		}
+		moveNameMu.Lock()
+		moveNameMap[m.Move.Name] = japaneseName
+		moveNameMu.Unlock()
+	}
+}
+
+// isLevelUpMove は、いずれかのバージョンでレベルアップにより覚える技かどうかを返します。
+func isLevelUpMove(details []pokeAPIMoveLearnDetail) bool {
+	for _, d := range details {
+		if d.MoveLearnMethod.Name == "level-up" {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchJapaneseName は、特性や技などのリソースのURLから日本語名を取得します。
+// タイプ名と同じく ja-Hrkt を優先し、なければ ja を使います。見つからなければ空文字を返します。
+func fetchJapaneseName(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var namesResp pokeAPINamesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&namesResp); err != nil {
+		return "", err
+	}
+	for _, lang := range []string{"ja-Hrkt", "ja"} {
+		for _, nameInfo := range namesResp.Names {
+			if nameInfo.Language.Name == lang {
+				return nameInfo.Name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
 // fetchCategoryData は、APIを使ってカテゴリ情報を取得し、pokemonMapByIDを更新します。
 func fetchCategoryData() {
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := newPokeAPIClient(30 * time.Second)
 
 	// まず、名前から特殊カテゴリを判定して設定する
 	for _, p := range pokemonMapByID {
@@ -1086,6 +2378,9 @@ func fetchCategoryData() {
 
 // organizePokemonByRegion は、メモリ上の pokemonMapByID から pokemonListByRegion を構築します。
 func organizePokemonByRegion() {
+	// フォルム違いを元のポケモンと区別できる名前にする
+	applyFormDisplayNames()
+
 	// マップを初期化
 	pokemonListByRegion = make(map[string][]*Pokemon)
 
@@ -1096,6 +2391,60 @@ func organizePokemonByRegion() {
 		}
 		// "all" カテゴリに追加
 		pokemonListByRegion["all"] = append(pokemonListByRegion["all"], p)
+		// 伝説・幻のポケモンは地方のカテゴリとは別に専用のカテゴリにも追加
+		if p.Rarity == rarityLegendary || p.Rarity == rarityMythical {
+			pokemonListByRegion[p.Rarity] = append(pokemonListByRegion[p.Rarity], p)
+		}
+	}
+
+	// 進化先の索引を構築（フォルム違いは除く）
+	pokemonEvolvesInto = make(map[int][]*Pokemon)
+	for _, p := range pokemonMapByID {
+		if p.EvolvesFrom != 0 && p.ID == p.SpeciesID {
+			pokemonEvolvesInto[p.EvolvesFrom] = append(pokemonEvolvesInto[p.EvolvesFrom], p)
+		}
+	}
+
+	// 御三家とその進化形（フォルム違いを含む）を専用のカテゴリに追加
+	starterSpecies := make(map[int]bool)
+	queue := append([]int(nil), starterPokemonIDs...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if starterSpecies[id] {
+			continue
+		}
+		starterSpecies[id] = true
+		for _, evolved := range pokemonEvolvesInto[id] {
+			queue = append(queue, evolved.ID)
+		}
+	}
+	for _, p := range pokemonListByRegion["all"] {
+		speciesID := p.SpeciesID
+		if speciesID == 0 {
+			speciesID = p.ID
+		}
+		if starterSpecies[speciesID] {
+			pokemonListByRegion["starters"] = append(pokemonListByRegion["starters"], p)
+		}
+	}
+
+	// 地方とタイプの両方で絞り込むための索引を構築
+	pokemonListByRegionType = make(map[string]map[string][]*Pokemon, len(pokemonListByRegion))
+	for region, list := range pokemonListByRegion {
+		byType := make(map[string][]*Pokemon)
+		for _, p := range list {
+			for _, t := range p.Types {
+				byType[t] = append(byType[t], p)
+			}
+		}
+		pokemonListByRegionType[region] = byType
+	}
+
+	// 選択肢の名前にふりがなを付けるための読みの対応表を構築
+	nameReadings = make(map[string]string)
+	for _, p := range pokemonMapByID {
+		nameReadings[p.Name] = p.NameReading
 	}
 
 	// ログ出力
@@ -1124,6 +2473,15 @@ func buildPokemon(apiPokemon pokeAPIPokemonResponse, apiSpecies pokeAPISpeciesRe
 		}
 	}
 
+	// 漢字の名前にふりがなを振れるよう、ja-Hrkt (ひらがな・カタカナ) の読みも保存する
+	var nameReading string
+	for _, nameInfo := range apiSpecies.Names {
+		if nameInfo.Language.Name == "ja-Hrkt" {
+			nameReading = nameInfo.Name
+			break
+		}
+	}
+
 	var japaneseName string
 	// ja (公式の漢字名) を最優先で探す
 	for _, nameInfo := range apiSpecies.Names {
@@ -1145,6 +2503,9 @@ func buildPokemon(apiPokemon pokeAPIPokemonResponse, apiSpecies pokeAPISpeciesRe
 	if japaneseName == "" {
 		japaneseName = apiPokemon.Name // 日本語名がなければ英語名を使う
 	}
+	if nameReading == "" {
+		nameReading = japaneseName
+	}
 
 	// タイプの日本語名を取得
 	var japaneseTypes []string
@@ -1155,14 +2516,113 @@ func buildPokemon(apiPokemon pokeAPIPokemonResponse, apiSpecies pokeAPISpeciesRe
 		}
 	}
 
+	// タマゴグループと成長速度の日本語名を取得
+	var eggGroups []string
+	for _, eggGroup := range apiSpecies.EggGroups {
+		if name, ok := eggGroupNameMap[eggGroup.Name]; ok {
+			eggGroups = append(eggGroups, name)
+		} else {
+			eggGroups = append(eggGroups, eggGroup.Name)
+		}
+	}
+	growthRate, ok := growthRateNameMap[apiSpecies.GrowthRate.Name]
+	if !ok {
+		growthRate = apiSpecies.GrowthRate.Name
+	}
+
+	// 特性の日本語名を取得
+	var abilities []string
+	abilityNameMu.Lock()
+	for _, a := range apiPokemon.Abilities {
+		if name, ok := abilityNameMap[a.Ability.Name]; ok {
+			abilities = append(abilities, name)
+		} else {
+			abilities = append(abilities, a.Ability.Name)
+		}
+	}
+	abilityNameMu.Unlock()
+
+	// レベルアップで覚える技の日本語名を取得（重複は除く）
+	moves := []string{}
+	seenMoves := make(map[string]bool)
+	moveNameMu.Lock()
+	for _, m := range apiPokemon.Moves {
+		if !isLevelUpMove(m.VersionGroupDetails) {
+			continue
+		}
+		name, ok := moveNameMap[m.Move.Name]
+		if !ok {
+			name = m.Move.Name
+		}
+		if !seenMoves[name] {
+			seenMoves[name] = true
+			moves = append(moves, name)
+		}
+	}
+	moveNameMu.Unlock()
+
+	// 分類と図鑑の説明文の日本語版を取得（説明文は最新のバージョンのものを使う）
+	var genus string
+	for _, lang := range []string{"ja", "ja-Hrkt"} {
+		for _, g := range apiSpecies.Genera {
+			if genus == "" && g.Language.Name == lang {
+				genus = g.Genus
+			}
+		}
+	}
+	var flavorText string
+	for _, lang := range []string{"ja", "ja-Hrkt"} {
+		for _, entry := range apiSpecies.FlavorTextEntries {
+			if entry.Language.Name == lang {
+				flavorText = entry.FlavorText
+			}
+		}
+		if flavorText != "" {
+			break
+		}
+	}
+	flavorText = strings.NewReplacer("\n", "　", "\f", "　").Replace(flavorText)
+
+	rarity := rarityNormal
+	if apiSpecies.IsMythical {
+		rarity = rarityMythical
+	} else if apiSpecies.IsLegendary {
+		rarity = rarityLegendary
+	}
+
+	// 進化前のポケモンの図鑑番号をURLから抽出
+	evolvesFrom := 0
+	if apiSpecies.EvolvesFromSpecies != nil {
+		urlParts := strings.Split(strings.TrimSuffix(apiSpecies.EvolvesFromSpecies.URL, "/"), "/")
+		evolvesFrom, _ = strconv.Atoi(urlParts[len(urlParts)-1])
+	}
+
+	// 色違いの公式イラストがないフォルムもあるので、その場合はドット絵を使う
+	shinyImage := apiPokemon.Sprites.Other.OfficialArtwork.FrontShiny
+	if shinyImage == "" {
+		shinyImage = apiPokemon.Sprites.FrontShiny
+	}
+
 	return Pokemon{
-		ID:          apiPokemon.ID,
-		Name:        japaneseName,
-		EnglishName: apiPokemon.Name, // 英語名を構造体にセット
-		Stats:       stats,
-		ImageURL:    apiPokemon.Sprites.Other.OfficialArtwork.FrontDefault,
-		Height:      apiPokemon.Height / 10.0, // デシメートルからメートルに変換
-		Weight:      apiPokemon.Weight / 10.0, // ヘクトグラムからキログラムに変換
-		Types:       japaneseTypes,
+		ID:            apiPokemon.ID,
+		Name:          japaneseName,
+		NameReading:   nameReading,
+		EnglishName:   apiPokemon.Name, // 英語名を構造体にセット
+		Stats:         stats,
+		ImageURL:      apiPokemon.Sprites.Other.OfficialArtwork.FrontDefault,
+		ShinyImageURL: shinyImage,
+		Height:        apiPokemon.Height / 10.0, // デシメートルからメートルに変換
+		Weight:        apiPokemon.Weight / 10.0, // ヘクトグラムからキログラムに変換
+		Types:         japaneseTypes,
+		CaptureRate:   apiSpecies.CaptureRate,
+		EggGroups:     eggGroups,
+		GrowthRate:    growthRate,
+		Abilities:     abilities,
+		Moves:         moves,
+		SpeciesID:     apiSpecies.ID,
+		Genus:         genus,
+		FlavorText:    flavorText,
+		EvolvesFrom:   evolvesFrom,
+		Rarity:        rarity,
 	}
 }
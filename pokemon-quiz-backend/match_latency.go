@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- クイズ対戦の通信遅延の補正 ---
+
+// 回答の速さで点が決まるクイズ対戦で、回線の遅いプレイヤーが不利にならないよう、
+//   - 回答時間は出題した時刻（全員共通）ではなく、そのプレイヤーに問題を初めて返した時刻から計り、
+//   - さらに、測定した往復の通信時間（RTT）を差し引きます。
+//
+// RTTは、ルームの状態に含める pingToken（サーバーの時刻）を、クライアントが次のリクエストの
+// X-Match-Ping ヘッダーでそのまま送り返すことで測ります。わざと遅く送り返して得をしないよう、
+// 補正する時間は maxRTTCompensation までにします。
+
+const (
+	matchPingHeader    = "X-Match-Ping"
+	maxRTTSample       = 5 * time.Second        // これより長い測定値は使わない
+	maxRTTCompensation = 500 * time.Millisecond // 回答時間から差し引く上限
+)
+
+// プレイヤーごとの往復の通信時間の推定値（TCPと同じく、測定値を 1/8 ずつ反映する）
+type rttEstimator struct {
+	srtt    time.Duration
+	samples int
+}
+
+// observe は、RTTの測定値を推定値に反映します。
+func (e *rttEstimator) observe(sample time.Duration) {
+	if sample < 0 || sample > maxRTTSample {
+		return
+	}
+	if e.samples == 0 {
+		e.srtt = sample
+	} else {
+		e.srtt += (sample - e.srtt) / 8
+	}
+	e.samples++
+}
+
+// compensation は、回答時間から差し引く時間を返します。まだ測定していなければ0です。
+func (e *rttEstimator) compensation() time.Duration {
+	if e.samples == 0 {
+		return 0
+	}
+	return min(e.srtt, maxRTTCompensation)
+}
+
+// pingToken は、クライアントに送り返してもらうサーバーの時刻を返します。
+func pingToken(now time.Time) string {
+	return strconv.FormatInt(now.UnixMilli(), 10)
+}
+
+// observeMatchPing は、リクエストに送り返された pingToken があれば、プレイヤーのRTTを測定します。
+func observeMatchPing(c *gin.Context, r *matchRoom, player int, now time.Time) {
+	if player < 0 {
+		return
+	}
+	ms, err := strconv.ParseInt(c.GetHeader(matchPingHeader), 10, 64)
+	if err != nil {
+		return
+	}
+	r.Players[player].rtt.observe(now.Sub(time.UnixMilli(ms)))
+}
+
+// markSent は、プレイヤーに問題を初めて返した時刻を記録します。
+func (q *matchQuestion) markSent(player int, now time.Time) {
+	if player < 0 {
+		return
+	}
+	if _, ok := q.sentAt[player]; !ok {
+		q.sentAt[player] = now
+	}
+}
+
+// sentTime は、プレイヤーに問題を返した時刻を返します（CPUや、まだ返していない場合は出題した時刻）。
+func (q *matchQuestion) sentTime(player int) time.Time {
+	if t, ok := q.sentAt[player]; ok {
+		return t
+	}
+	return q.startedAt
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// --- 対戦の再接続と再開 ---
+
+// 対戦中のルームの状態をデータベースにも保存し、通信が切れたりサーバーが再起動したりしても、
+// 同じ問題から対戦を続けられるようにします（対戦はHTTPのポーリングで進めるので、接続が切れても負けにはならない）。
+// ルームの状態には、参加者ごとの再開トークン（resumeToken）を含めます。
+// ルームのIDが分からなくなったクライアント（ページの再読み込みなど）は、POST /matches/resume に
+// 再開トークンを送ると、そのルームの現在の状態を受け取って対戦に戻れます。
+// 終了した対戦は MatchRecord に記録されるので、保存した状態は削除します。
+
+const matchResumeIssuer = "pokequiz-match-resume"
+
+// --- データベースモデル ---
+
+// 対戦中のルームの状態
+type MatchSnapshot struct {
+	gorm.Model
+	MatchID string `gorm:"uniqueIndex;not null"`
+	State   string `gorm:"type:text;not null"` // matchSnapshotData のJSON
+}
+
+// 保存するルームの状態（ポケモンはIDで保存する）
+type matchSnapshotData struct {
+	ID           string                 `json:"id"`
+	Mode         string                 `json:"mode"`
+	Region       string                 `json:"region"`
+	Rounds       int                    `json:"rounds"`
+	Round        int                    `json:"round"`
+	Status       string                 `json:"status"`
+	Players      []matchSnapshotPlayer  `json:"players"`
+	Turn         int                    `json:"turn"`
+	History      []topTrumpsRound       `json:"history"`
+	QuizHistory  []quizRound            `json:"quizHistory"`
+	Question     *matchSnapshotQuestion `json:"question,omitempty"`
+	RematchID    string                 `json:"rematchId"`
+	TournamentID uint                   `json:"tournamentId"`
+	CreatedAt    time.Time              `json:"createdAt"`
+}
+
+type matchSnapshotPlayer struct {
+	matchPlayer
+	CardID     int           `json:"cardId"`
+	RTT        time.Duration `json:"rtt"`
+	RTTSamples int           `json:"rttSamples"`
+}
+
+type matchSnapshotQuestion struct {
+	PokemonID  int                  `json:"pokemonId"`
+	Options    []string             `json:"options"`
+	StartedAt  time.Time            `json:"startedAt"`
+	SentAt     map[int]time.Time    `json:"sentAt"`
+	Answers    map[int]*matchAnswer `json:"answers"`
+	AnsweredAt map[int]time.Time    `json:"answeredAt"`
+	BotTimes   map[int]time.Time    `json:"botTimes"`
+}
+
+// snapshot は、ルームの状態を保存できる形に変換します。呼び出し側で r.mu をロックしておく必要があります。
+func (r *matchRoom) snapshot() matchSnapshotData {
+	data := matchSnapshotData{
+		ID: r.ID, Mode: r.Mode, Region: r.Region, Rounds: r.Rounds, Round: r.Round, Status: r.Status,
+		Turn: r.Turn, History: r.History, QuizHistory: r.QuizHistory,
+		RematchID: r.RematchID, TournamentID: r.TournamentID, CreatedAt: r.CreatedAt,
+	}
+	for _, p := range r.Players {
+		sp := matchSnapshotPlayer{matchPlayer: *p, RTT: p.rtt.srtt, RTTSamples: p.rtt.samples}
+		if p.card != nil {
+			sp.CardID = p.card.ID
+		}
+		data.Players = append(data.Players, sp)
+	}
+	if q := r.question; q != nil {
+		sq := &matchSnapshotQuestion{
+			PokemonID: q.pokemon.ID, Options: q.options, StartedAt: q.startedAt,
+			SentAt: q.sentAt, Answers: q.answers, AnsweredAt: make(map[int]time.Time), BotTimes: q.botTimes,
+		}
+		for i, a := range q.answers {
+			sq.AnsweredAt[i] = a.at
+		}
+		data.Question = sq
+	}
+	return data
+}
+
+// restore は、保存した状態からルームを作り直します。データにいないポケモンがあれば失敗します。
+func (data *matchSnapshotData) restore() (*matchRoom, error) {
+	r := &matchRoom{
+		ID: data.ID, Mode: data.Mode, Region: data.Region, Rounds: data.Rounds, Round: data.Round, Status: data.Status,
+		Turn: data.Turn, History: data.History, QuizHistory: data.QuizHistory,
+		RematchID: data.RematchID, TournamentID: data.TournamentID, CreatedAt: data.CreatedAt,
+	}
+	for _, sp := range data.Players {
+		p := sp.matchPlayer
+		p.rtt = rttEstimator{srtt: sp.RTT, samples: sp.RTTSamples}
+		if sp.CardID != 0 {
+			card, ok := pokemonMapByID[sp.CardID]
+			if !ok {
+				return nil, fmt.Errorf("pokemon %d not found", sp.CardID)
+			}
+			p.card = card
+		}
+		r.Players = append(r.Players, &p)
+	}
+	if sq := data.Question; sq != nil {
+		pokemon, ok := pokemonMapByID[sq.PokemonID]
+		if !ok {
+			return nil, fmt.Errorf("pokemon %d not found", sq.PokemonID)
+		}
+		q := &matchQuestion{
+			pokemon: pokemon, options: sq.Options, startedAt: sq.StartedAt,
+			sentAt: sq.SentAt, answers: sq.Answers, botTimes: sq.BotTimes,
+		}
+		if q.sentAt == nil {
+			q.sentAt = make(map[int]time.Time)
+		}
+		if q.answers == nil {
+			q.answers = make(map[int]*matchAnswer)
+		}
+		if q.botTimes == nil {
+			q.botTimes = make(map[int]time.Time)
+		}
+		for i, a := range q.answers {
+			a.at = sq.AnsweredAt[i]
+		}
+		r.question = q
+	}
+	return r, nil
+}
+
+// persist は、対戦中のルームの状態を保存します。終了したルームの状態は削除します。
+// 呼び出し側で r.mu をロックしておく必要があります。
+func (r *matchRoom) persist() {
+	if r.Status == matchStatusFinished {
+		if r.savedState != "" {
+			if err := db.Where("match_id = ?", r.ID).Delete(&MatchSnapshot{}).Error; err != nil {
+				log.Printf("Failed to delete match snapshot %s: %v", r.ID, err)
+			}
+			r.savedState = ""
+		}
+		return
+	}
+	state, err := json.Marshal(r.snapshot())
+	if err != nil {
+		log.Printf("Failed to encode match snapshot %s: %v", r.ID, err)
+		return
+	}
+	if string(state) == r.savedState {
+		return // 変わっていなければ書き込まない
+	}
+	snapshot := MatchSnapshot{MatchID: r.ID}
+	err = db.Where(MatchSnapshot{MatchID: r.ID}).Assign(MatchSnapshot{State: string(state)}).FirstOrCreate(&snapshot).Error
+	if err != nil {
+		log.Printf("Failed to save match snapshot %s: %v", r.ID, err)
+		return
+	}
+	r.savedState = string(state)
+}
+
+// loadMatchSnapshot は、保存したルームの状態を読み込みます。なければ false を返します。
+func loadMatchSnapshot(id string) (*matchRoom, bool) {
+	var snapshot MatchSnapshot
+	result := db.Where("match_id = ?", id).Limit(1).Find(&snapshot)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false
+	}
+	var data matchSnapshotData
+	if err := json.Unmarshal([]byte(snapshot.State), &data); err != nil {
+		log.Printf("Failed to decode match snapshot %s: %v", id, err)
+		return nil, false
+	}
+	if time.Since(data.CreatedAt) > matchRoomTTL {
+		db.Delete(&snapshot)
+		return nil, false
+	}
+	room, err := data.restore()
+	if err != nil {
+		log.Printf("Failed to restore match %s: %v", id, err)
+		return nil, false
+	}
+	room.savedState = snapshot.State
+	return room, true
+}
+
+// respondMatch は、プレイヤーから見たルームの状態を再開トークンと一緒に返し、ルームの状態を保存します。
+// 呼び出し側で room.mu をロックしておく必要があります。
+func respondMatch(c *gin.Context, status int, room *matchRoom, viewer int) {
+	view := room.view(viewer)
+	if viewer >= 0 && room.Status != matchStatusFinished {
+		if token, err := issueMatchResumeToken(room, viewer); err == nil {
+			view["resumeToken"] = token
+		}
+	}
+	room.persist()
+	c.JSON(status, view)
+}
+
+// --- 再開トークン ---
+
+// 再開トークンの中身
+type matchResumeClaims struct {
+	MatchID string `json:"mid"`
+	Player  int    `json:"player"`
+	jwt.RegisteredClaims
+}
+
+// issueMatchResumeToken は、プレイヤーがルームに戻るための再開トークンを発行します。
+func issueMatchResumeToken(r *matchRoom, player int) (string, error) {
+	claims := matchResumeClaims{
+		MatchID: r.ID,
+		Player:  player,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    matchResumeIssuer,
+			Subject:   fmt.Sprint(r.Players[player].UserID),
+			ExpiresAt: jwt.NewNumericDate(r.CreatedAt.Add(matchRoomTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(derivedSigningKey(matchResumeIssuer))
+}
+
+// parseMatchResumeToken は、再開トークンの署名を検証して中身を返します。
+func parseMatchResumeToken(tokenString string) (*matchResumeClaims, error) {
+	claims := &matchResumeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return derivedSigningKey(matchResumeIssuer), nil
+	}, jwt.WithIssuer(matchResumeIssuer))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// handleResumeMatch は、再開トークンのルームの現在の状態を返し、対戦に戻れるようにします。
+func handleResumeMatch(c *gin.Context) {
+	var req struct {
+		ResumeToken string `json:"resumeToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resumeToken is required"})
+		return
+	}
+	claims, err := parseMatchResumeToken(req.ResumeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Resume token is invalid or has expired"})
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	if claims.Subject != fmt.Sprint(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This resume token belongs to another user"})
+		return
+	}
+	room, ok := getMatchRoom(claims.MatchID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	idx := room.playerIndex(userID)
+	if idx != claims.Player {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a player in this match"})
+		return
+	}
+	now := time.Now()
+	observeMatchPing(c, room, idx, now)
+	if err := room.advance(now); err != nil {
+		respondMatchError(c, err, "Failed to advance match")
+		return
+	}
+	respondMatch(c, http.StatusOK, room, idx)
+}
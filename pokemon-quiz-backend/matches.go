@@ -0,0 +1,930 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"pokemon-quiz-backend/quiz"
+)
+
+// --- 対戦ルーム ---
+
+// 対戦の種類
+const (
+	matchModeTopTrumps = "toptrumps" // 配られたポケモンの種族値を比べ合う
+	matchModeQuiz      = "quiz"      // 同じ問題に早く正確に答えた方が勝つ
+)
+
+// 対戦ルームの状態
+const (
+	matchStatusWaiting  = "waiting"  // 対戦相手の参加待ち
+	matchStatusPlaying  = "playing"  // 対戦中
+	matchStatusFinished = "finished" // 対戦終了
+)
+
+const (
+	defaultMatchRounds = 5
+	maxMatchRounds     = 20
+	matchRoomTTL       = time.Hour        // これより古いルームは破棄する
+	matchQuestionLimit = 20 * time.Second // クイズ対戦の1問あたりの制限時間
+)
+
+// トップトランプで比較できる項目
+var topTrumpsStats = map[string]func(s PokemonStats) int{
+	"hp":         func(s PokemonStats) int { return s.HP },
+	"attack":     func(s PokemonStats) int { return s.Attack },
+	"defense":    func(s PokemonStats) int { return s.Defense },
+	"sp_attack":  func(s PokemonStats) int { return s.SpAttack },
+	"sp_defense": func(s PokemonStats) int { return s.SpDefense },
+	"speed":      func(s PokemonStats) int { return s.Speed },
+	"total":      func(s PokemonStats) int { return s.Total() },
+}
+
+// CPU対戦相手の強さ設定
+type botProfile struct {
+	Accuracy float64       // 正解する（トップトランプでは最善の項目を選ぶ）確率
+	Delay    time.Duration // クイズ対戦で回答するまでの平均時間
+}
+
+var botProfiles = map[string]botProfile{
+	"easy":   {Accuracy: 0.5, Delay: 9 * time.Second},
+	"normal": {Accuracy: 0.75, Delay: 6 * time.Second},
+	"hard":   {Accuracy: 0.95, Delay: 3 * time.Second},
+}
+
+// 対戦の参加者
+type matchPlayer struct {
+	UserID uint         `json:"userId"` // CPUの場合は0
+	Name   string       `json:"name"`
+	IsBot  bool         `json:"isBot"`
+	Bot    string       `json:"bot,omitempty"` // CPUの強さ設定名
+	Score  int          `json:"score"`
+	card   *Pokemon     // 現在のラウンドで配られたポケモン
+	rtt    rttEstimator // クイズ対戦で回答時間を補正するための通信時間
+}
+
+// トップトランプの1ラウンドの結果
+type topTrumpsRound struct {
+	Round    int        `json:"round"`
+	PickedBy int        `json:"pickedBy"` // 項目を選んだプレイヤーのインデックス
+	Stat     string     `json:"stat"`
+	Cards    []*Pokemon `json:"cards"`
+	Values   []int      `json:"values"`
+	Winner   int        `json:"winner"` // 引き分けの場合は-1
+}
+
+// クイズ対戦のプレイヤーの回答
+type matchAnswer struct {
+	Name      string `json:"name"`
+	IsCorrect bool   `json:"isCorrect"`
+	TimeMs    int64  `json:"timeMs"`    // 問題を返してから回答までの時間（通信時間を補正済み）
+	RawTimeMs int64  `json:"rawTimeMs"` // 補正する前の時間
+	RTTMs     int64  `json:"rttMs"`     // 差し引いた通信時間
+	Points    int    `json:"points"`
+	at        time.Time
+}
+
+// クイズ対戦の出題中の問題
+type matchQuestion struct {
+	pokemon   *Pokemon
+	options   []string
+	startedAt time.Time
+	sentAt    map[int]time.Time    // プレイヤーごとに問題を初めて返した時刻
+	answers   map[int]*matchAnswer // プレイヤーのインデックスごとの回答
+	botTimes  map[int]time.Time    // CPUが回答する予定時刻
+}
+
+// クイズ対戦の1ラウンドの結果
+type quizRound struct {
+	Round          int                  `json:"round"`
+	CorrectPokemon *Pokemon             `json:"correctPokemon"`
+	Answers        map[int]*matchAnswer `json:"answers"`
+}
+
+// 対戦ルーム
+type matchRoom struct {
+	mu           sync.Mutex
+	ID           string
+	Mode         string
+	Region       string
+	Rounds       int
+	Round        int // 現在のラウンド（1始まり）
+	Status       string
+	Players      []*matchPlayer
+	Turn         int // トップトランプで項目を選ぶプレイヤーのインデックス
+	History      []topTrumpsRound
+	QuizHistory  []quizRound
+	question     *matchQuestion
+	RematchID    string // 再戦用に作られたルームのID
+	TournamentID uint   // トーナメントの対戦の場合のトーナメントID
+	CreatedAt    time.Time
+	savedState   string // 最後に保存した状態（変わっていなければ保存しない）
+}
+
+// --- データベースモデル ---
+
+// 終了した対戦の記録
+type MatchRecord struct {
+	gorm.Model
+	MatchID    string `gorm:"uniqueIndex;not null"`
+	Mode       string `gorm:"not null"`
+	Region     string `gorm:"not null"`
+	Rounds     int    `gorm:"not null"`
+	Bot        string // CPU対戦の場合の強さ設定名
+	Players    string `gorm:"type:text"` // 参加者と得点をJSON配列の文字列として保存
+	Outcomes   string `gorm:"type:text"` // ラウンドごとの結果をJSON配列の文字列として保存
+	FinishedAt time.Time
+}
+
+// 対戦記録とユーザーの対応（ユーザーごとの対戦履歴の検索用）
+type MatchParticipant struct {
+	gorm.Model
+	MatchRecordID uint `gorm:"index;not null"`
+	UserID        uint `gorm:"index;not null"`
+	Score         int
+	Won           bool
+}
+
+var (
+	matchRooms   = make(map[string]*matchRoom)
+	matchRoomsMu sync.Mutex
+)
+
+// getMatchRoom は、IDから対戦ルームを取得します。期限切れのルームはここで破棄します。
+func getMatchRoom(id string) (*matchRoom, bool) {
+	matchRoomsMu.Lock()
+	defer matchRoomsMu.Unlock()
+	for roomID, room := range matchRooms {
+		if time.Since(room.CreatedAt) > matchRoomTTL {
+			delete(matchRooms, roomID)
+		}
+	}
+	if room, ok := matchRooms[id]; ok {
+		return room, true
+	}
+	// サーバーの再起動などでメモリ上にないときは、保存した状態から作り直す
+	room, ok := loadMatchSnapshot(id)
+	if ok {
+		matchRooms[id] = room
+	}
+	return room, ok
+}
+
+// newBotPlayer は、指定した強さのCPUプレイヤーを作ります。
+func newBotPlayer(profile string) *matchPlayer {
+	return &matchPlayer{Name: "CPU (" + profile + ")", IsBot: true, Bot: profile}
+}
+
+// botSucceeds は、CPUの正答率に従って今回正解するかどうかを決めます。
+func botSucceeds(profile string) bool {
+	n, err := randomIndex(1000)
+	if err != nil {
+		return false
+	}
+	return float64(n) < botProfiles[profile].Accuracy*1000
+}
+
+// playerIndex は、ユーザーがルームの何番目の参加者かを返します。参加していなければ-1を返します。
+func (r *matchRoom) playerIndex(userID uint) int {
+	for i, p := range r.Players {
+		if !p.IsBot && p.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dealCards は、各プレイヤーに地方のプールからポケモンを1匹ずつ配ります。
+// 出題から外したため地方にポケモンがいなければ、対戦を終了して errRegionUnavailable を返します。
+func (r *matchRoom) dealCards() error {
+	pool := regionRotation(r.Region)
+	if len(pool) == 0 {
+		r.finish()
+		return errRegionUnavailable
+	}
+	used := make(map[int]bool)
+	for _, p := range r.Players {
+		for {
+			idx, err := randomIndex(len(pool))
+			if err != nil {
+				return err
+			}
+			if !used[pool[idx].ID] || len(pool) < len(r.Players) {
+				used[pool[idx].ID] = true
+				p.card = pool[idx]
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// start は、参加者が揃ったルームの対戦を開始します。
+func (r *matchRoom) start() error {
+	r.Status = matchStatusPlaying
+	r.Round = 1
+	r.Turn = 0
+	if r.Mode == matchModeQuiz {
+		return r.nextQuestion(time.Now())
+	}
+	if err := r.dealCards(); err != nil {
+		return err
+	}
+	return r.playBotTurns()
+}
+
+// resolveTopTrumps は、指定された項目で現在のラウンドを判定し、次のラウンドへ進めます。
+func (r *matchRoom) resolveTopTrumps(stat string) error {
+	statValue := topTrumpsStats[stat]
+	result := topTrumpsRound{
+		Round:    r.Round,
+		PickedBy: r.Turn,
+		Stat:     stat,
+		Winner:   -1,
+	}
+	best := -1
+	tied := false
+	for i, p := range r.Players {
+		v := statValue(p.card.Stats)
+		result.Cards = append(result.Cards, p.card)
+		result.Values = append(result.Values, v)
+		if v > best {
+			best = v
+			result.Winner = i
+			tied = false
+		} else if v == best {
+			tied = true
+		}
+	}
+	if tied {
+		result.Winner = -1
+	} else {
+		r.Players[result.Winner].Score++
+		r.Turn = result.Winner // 勝者が次の項目を選ぶ
+	}
+	r.History = append(r.History, result)
+
+	if r.Round >= r.Rounds {
+		r.finish()
+		return nil
+	}
+	r.Round++
+	return r.dealCards()
+}
+
+// playBotTurns は、トップトランプでCPUの手番であればCPUに項目を選ばせて判定します。
+// CPUは正答率に応じて、自分のカードで最も高い項目かランダムな項目を選びます。
+func (r *matchRoom) playBotTurns() error {
+	stats := []string{"hp", "attack", "defense", "sp_attack", "sp_defense", "speed"}
+	for r.Status == matchStatusPlaying && r.Players[r.Turn].IsBot {
+		bot := r.Players[r.Turn]
+		var pick string
+		if botSucceeds(bot.Bot) {
+			bestValue := -1
+			for _, stat := range stats {
+				if v := topTrumpsStats[stat](bot.card.Stats); v > bestValue {
+					pick, bestValue = stat, v
+				}
+			}
+		} else {
+			idx, err := randomIndex(len(stats))
+			if err != nil {
+				return err
+			}
+			pick = stats[idx]
+		}
+		if err := r.resolveTopTrumps(pick); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextQuestion は、クイズ対戦の次の問題を出題し、CPUの回答予定時刻を決めます。
+// 出題から外したため地方にポケモンがいなければ、対戦を終了して errRegionUnavailable を返します。
+func (r *matchRoom) nextQuestion(startedAt time.Time) error {
+	pool := regionRotation(r.Region)
+	if len(pool) == 0 {
+		r.question = nil
+		r.finish()
+		return errRegionUnavailable
+	}
+	idx, err := randomIndex(len(pool))
+	if err != nil {
+		return err
+	}
+	options, err := generateOptions(nil, pool[idx], pool, defaultOptionCount)
+	if err != nil {
+		return err
+	}
+	q := &matchQuestion{
+		pokemon:   pool[idx],
+		options:   options,
+		startedAt: startedAt,
+		sentAt:    make(map[int]time.Time),
+		answers:   make(map[int]*matchAnswer),
+		botTimes:  make(map[int]time.Time),
+	}
+	for i, p := range r.Players {
+		if !p.IsBot {
+			continue
+		}
+		// 回答時間は平均の70%〜130%の間でばらつかせる
+		jitter, err := randomIndex(61)
+		if err != nil {
+			return err
+		}
+		delay := botProfiles[p.Bot].Delay * time.Duration(70+jitter) / 100
+		q.botTimes[i] = startedAt.Add(delay)
+	}
+	r.question = q
+	return nil
+}
+
+// submitAnswer は、クイズ対戦でプレイヤーの回答を記録します。
+// 回答時間は、そのプレイヤーに問題を返した時刻から計り、通信時間を差し引きます。
+func (r *matchRoom) submitAnswer(player int, name string, at time.Time) {
+	q := r.question
+	raw := at.Sub(q.sentTime(player))
+	rtt := r.Players[player].rtt.compensation()
+	r.question.answers[player] = &matchAnswer{
+		Name:      name,
+		IsCorrect: quiz.IsSameAnswer(name, q.pokemon.Name),
+		TimeMs:    max(raw-rtt, 0).Milliseconds(),
+		RawTimeMs: raw.Milliseconds(),
+		RTTMs:     rtt.Milliseconds(),
+		at:        at,
+	}
+}
+
+// advance は、現在時刻までに起きるべきCPUの回答やラウンドの終了を処理します。
+// クイズ対戦はゴルーチンを使わず、ルームへのアクセス時にまとめて進めます。
+func (r *matchRoom) advance(now time.Time) error {
+	for r.Status == matchStatusPlaying && r.Mode == matchModeQuiz {
+		q := r.question
+		deadline := q.startedAt.Add(matchQuestionLimit)
+
+		// 予定時刻を過ぎたCPUの回答を反映
+		for i, at := range q.botTimes {
+			if _, answered := q.answers[i]; answered || at.After(now) || at.After(deadline) {
+				continue
+			}
+			name := q.pokemon.Name
+			if !botSucceeds(r.Players[i].Bot) {
+				for _, option := range q.options {
+					if option != q.pokemon.Name {
+						name = option
+						break
+					}
+				}
+			}
+			r.submitAnswer(i, name, at)
+		}
+
+		// 全員が回答したか、制限時間を過ぎたらラウンド終了
+		endedAt := deadline
+		if len(q.answers) == len(r.Players) {
+			endedAt = q.startedAt
+			for _, a := range q.answers {
+				if a.at.After(endedAt) {
+					endedAt = a.at
+				}
+			}
+		} else if now.Before(deadline) {
+			return nil
+		}
+		if err := r.finishQuestion(endedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishQuestion は、クイズ対戦のラウンドを採点して次の問題へ進めます。
+// 正解者には1点、最も早く正解したプレイヤーにはさらに1点を与えます。
+func (r *matchRoom) finishQuestion(endedAt time.Time) error {
+	q := r.question
+	fastest := -1
+	for i, a := range q.answers {
+		if !a.IsCorrect {
+			continue
+		}
+		a.Points = 1
+		if fastest < 0 || a.TimeMs < q.answers[fastest].TimeMs {
+			fastest = i
+		}
+	}
+	if fastest >= 0 {
+		q.answers[fastest].Points++
+	}
+	for i, a := range q.answers {
+		r.Players[i].Score += a.Points
+	}
+	r.QuizHistory = append(r.QuizHistory, quizRound{
+		Round:          r.Round,
+		CorrectPokemon: q.pokemon,
+		Answers:        q.answers,
+	})
+
+	if r.Round >= r.Rounds {
+		r.question = nil
+		r.finish()
+		return nil
+	}
+	r.Round++
+	return r.nextQuestion(endedAt)
+}
+
+// finish は、対戦を終了して結果をデータベースに記録します。
+func (r *matchRoom) finish() {
+	r.Status = matchStatusFinished
+
+	players, _ := json.Marshal(r.Players)
+	var outcomes []byte
+	if r.Mode == matchModeQuiz {
+		outcomes, _ = json.Marshal(r.QuizHistory)
+	} else {
+		outcomes, _ = json.Marshal(r.History)
+	}
+	record := MatchRecord{
+		MatchID:    r.ID,
+		Mode:       r.Mode,
+		Region:     r.Region,
+		Rounds:     r.Rounds,
+		Players:    string(players),
+		Outcomes:   string(outcomes),
+		FinishedAt: time.Now(),
+	}
+	topScore := 0
+	for _, p := range r.Players {
+		if p.IsBot {
+			record.Bot = p.Bot
+		}
+		if p.Score > topScore {
+			topScore = p.Score
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		for _, p := range r.Players {
+			if p.IsBot {
+				continue
+			}
+			participant := MatchParticipant{
+				MatchRecordID: record.ID,
+				UserID:        p.UserID,
+				Score:         p.Score,
+				Won:           p.Score > 0 && p.Score == topScore,
+			}
+			if err := tx.Create(&participant).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to save match record %s: %v", r.ID, err)
+	}
+
+	if r.TournamentID != 0 {
+		recordTournamentResult(r)
+	}
+}
+
+// view は、指定したプレイヤーから見た対戦ルームの状態を返します。
+// 相手に配られたポケモンや出題中の正解は、判定されるまで伏せておきます。
+func (r *matchRoom) view(viewer int) gin.H {
+	state := gin.H{
+		"id":      r.ID,
+		"mode":    r.Mode,
+		"region":  r.Region,
+		"status":  r.Status,
+		"round":   r.Round,
+		"rounds":  r.Rounds,
+		"you":     viewer,
+		"players": r.Players,
+	}
+	if r.RematchID != "" {
+		state["rematchId"] = r.RematchID
+	}
+	if r.TournamentID != 0 {
+		state["tournamentId"] = r.TournamentID
+	}
+	if r.Mode == matchModeQuiz {
+		state["history"] = r.QuizHistory
+		state["pingToken"] = pingToken(time.Now())
+		if q := r.question; q != nil && r.Status == matchStatusPlaying {
+			q.markSent(viewer, time.Now())
+			question := buildQuizQuestion(q.pokemon, q.options, quizModeStats)
+			delete(question, "id")
+			question["deadline"] = q.startedAt.Add(matchQuestionLimit)
+			_, answered := q.answers[viewer]
+			question["answered"] = answered
+			state["question"] = question
+		}
+		return state
+	}
+
+	var card *Pokemon
+	if viewer >= 0 && r.Status == matchStatusPlaying {
+		card = r.Players[viewer].card
+	}
+	state["turn"] = r.Turn
+	state["card"] = card
+	state["history"] = r.History
+	return state
+}
+
+// --- 対戦ルームのハンドラ ---
+
+// handleCreateMatch は、新しい対戦ルームを作成します。
+// botを指定した場合（vsCpuは"normal"の省略形）はCPUと即座に対戦を開始します。
+func handleCreateMatch(c *gin.Context) {
+	var req struct {
+		Mode         string `json:"mode"`
+		Region       string `json:"region"`
+		Rounds       int    `json:"rounds"`
+		VsCPU        bool   `json:"vsCpu"`
+		Bot          string `json:"bot"`
+		TournamentID uint   `json:"tournamentId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+
+	// トーナメントの対戦はトーナメントの設定に従い、参加者同士でのみ行う
+	if req.TournamentID != 0 {
+		var tournament Tournament
+		if err := db.First(&tournament, req.TournamentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tournament not found"})
+			return
+		}
+		if tournament.Status != tournamentStatusOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tournament has already finished"})
+			return
+		}
+		if !isTournamentEntrant(tournament.ID, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not an entrant of this tournament"})
+			return
+		}
+		req.Mode, req.Region, req.Rounds = tournament.Mode, tournament.Region, tournament.Rounds
+		req.VsCPU, req.Bot = false, ""
+	}
+	if req.Mode == "" {
+		req.Mode = matchModeTopTrumps
+	}
+	if req.Mode != matchModeTopTrumps && req.Mode != matchModeQuiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid match mode specified"})
+		return
+	}
+	if req.Region == "" {
+		req.Region = "all"
+	}
+	if len(regionRotation(req.Region)) < 4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified"})
+		return
+	}
+	if req.Rounds == 0 {
+		req.Rounds = defaultMatchRounds
+	}
+	if req.Rounds < 1 || req.Rounds > maxMatchRounds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rounds must be between 1 and 20"})
+		return
+	}
+	if req.VsCPU && req.Bot == "" {
+		req.Bot = "normal"
+	}
+	if _, ok := botProfiles[req.Bot]; req.Bot != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bot profile specified"})
+		return
+	}
+
+	user, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create match"})
+		return
+	}
+	room := &matchRoom{
+		ID:           id,
+		Mode:         req.Mode,
+		Region:       req.Region,
+		Rounds:       req.Rounds,
+		Status:       matchStatusWaiting,
+		Players:      []*matchPlayer{{UserID: user.ID, Name: user.Username}},
+		TournamentID: req.TournamentID,
+		CreatedAt:    time.Now(),
+	}
+	if req.Bot != "" {
+		room.Players = append(room.Players, newBotPlayer(req.Bot))
+		if err := room.start(); err != nil {
+			respondMatchError(c, err, "Failed to start match")
+			return
+		}
+	}
+
+	matchRoomsMu.Lock()
+	matchRooms[room.ID] = room
+	matchRoomsMu.Unlock()
+
+	respondMatch(c, http.StatusCreated, room, 0)
+}
+
+// respondMatchError は、対戦を進められなかったときのエラーを返します。
+// 出題から外したため地方にポケモンがいない場合は、対戦を終了したうえで 409 を返します。
+func respondMatchError(c *gin.Context, err error, message string) {
+	if errors.Is(err, errRegionUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "No Pokemon are available in this region; the match has ended", "code": "region_unavailable"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// handleJoinMatch は、参加待ちの対戦ルームに参加して対戦を開始します。
+func handleJoinMatch(c *gin.Context) {
+	room, ok := getMatchRoom(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	user, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if idx := room.playerIndex(userID); idx >= 0 {
+		respondMatch(c, http.StatusOK, room, idx)
+		return
+	}
+	if room.Status != matchStatusWaiting {
+		c.JSON(http.StatusConflict, gin.H{"error": "Match has already started"})
+		return
+	}
+	if room.TournamentID != 0 && !isTournamentEntrant(room.TournamentID, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not an entrant of this tournament"})
+		return
+	}
+	room.Players = append(room.Players, &matchPlayer{UserID: user.ID, Name: user.Username})
+	if err := room.start(); err != nil {
+		respondMatchError(c, err, "Failed to start match")
+		return
+	}
+	respondMatch(c, http.StatusOK, room, len(room.Players)-1)
+}
+
+// handleGetMatch は、対戦ルームの現在の状態を返します。
+func handleGetMatch(c *gin.Context) {
+	room, ok := getMatchRoom(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	now := time.Now()
+	idx := room.playerIndex(c.MustGet("userID").(uint))
+	observeMatchPing(c, room, idx, now)
+	if err := room.advance(now); err != nil {
+		respondMatchError(c, err, "Failed to advance match")
+		return
+	}
+	respondMatch(c, http.StatusOK, room, idx)
+}
+
+// handleMatchPick は、トップトランプで手番のプレイヤーが比較する項目を選び、ラウンドを判定します。
+func handleMatchPick(c *gin.Context) {
+	var req struct {
+		Stat string `json:"stat" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if _, ok := topTrumpsStats[req.Stat]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stat specified"})
+		return
+	}
+
+	room, ok := getMatchRoom(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	idx := room.playerIndex(c.MustGet("userID").(uint))
+	if idx < 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a player in this match"})
+		return
+	}
+	if room.Mode != matchModeTopTrumps || room.Status != matchStatusPlaying {
+		c.JSON(http.StatusConflict, gin.H{"error": "Match is not in progress"})
+		return
+	}
+	if room.Turn != idx {
+		c.JSON(http.StatusConflict, gin.H{"error": "It is not your turn"})
+		return
+	}
+
+	if err := room.resolveTopTrumps(req.Stat); err != nil {
+		respondMatchError(c, err, "Failed to resolve round")
+		return
+	}
+	if err := room.playBotTurns(); err != nil {
+		respondMatchError(c, err, "Failed to resolve round")
+		return
+	}
+	respondMatch(c, http.StatusOK, room, idx)
+}
+
+// handleMatchAnswer は、クイズ対戦で出題中の問題に回答します。
+func handleMatchAnswer(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	room, ok := getMatchRoom(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	idx := room.playerIndex(c.MustGet("userID").(uint))
+	if idx < 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a player in this match"})
+		return
+	}
+
+	now := time.Now()
+	observeMatchPing(c, room, idx, now)
+	if err := room.advance(now); err != nil {
+		respondMatchError(c, err, "Failed to advance match")
+		return
+	}
+	if room.Mode != matchModeQuiz || room.Status != matchStatusPlaying {
+		c.JSON(http.StatusConflict, gin.H{"error": "Match is not in progress"})
+		return
+	}
+	if _, answered := room.question.answers[idx]; answered {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already answered this question"})
+		return
+	}
+
+	room.submitAnswer(idx, req.Name, now)
+	if err := room.advance(now); err != nil {
+		respondMatchError(c, err, "Failed to advance match")
+		return
+	}
+	respondMatch(c, http.StatusOK, room, idx)
+}
+
+// handleRematch は、終了した対戦と同じ設定で新しい対戦ルームを作成します。
+// 相手が既に再戦ルームを作っていれば、そのルームに参加します。
+func handleRematch(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var record MatchRecord
+	if err := db.First(&record, "match_id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Finished match not found"})
+		return
+	}
+	var participant MatchParticipant
+	if err := db.First(&participant, "match_record_id = ? AND user_id = ?", record.ID, userID).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a player in this match"})
+		return
+	}
+
+	// 元のルームがまだメモリ上にあれば、再戦ルームを共有する
+	oldRoom, hasOldRoom := getMatchRoom(record.MatchID)
+	if hasOldRoom {
+		oldRoom.mu.Lock()
+		defer oldRoom.mu.Unlock()
+		if oldRoom.RematchID != "" {
+			if room, ok := getMatchRoom(oldRoom.RematchID); ok {
+				room.mu.Lock()
+				defer room.mu.Unlock()
+				if idx := room.playerIndex(userID); idx >= 0 {
+					respondMatch(c, http.StatusOK, room, idx)
+					return
+				}
+				if room.Status == matchStatusWaiting {
+					room.Players = append(room.Players, &matchPlayer{UserID: user.ID, Name: user.Username})
+					if err := room.start(); err != nil {
+						respondMatchError(c, err, "Failed to start match")
+						return
+					}
+					respondMatch(c, http.StatusOK, room, len(room.Players)-1)
+					return
+				}
+			}
+		}
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create match"})
+		return
+	}
+	room := &matchRoom{
+		ID:        id,
+		Mode:      record.Mode,
+		Region:    record.Region,
+		Rounds:    record.Rounds,
+		Status:    matchStatusWaiting,
+		Players:   []*matchPlayer{{UserID: user.ID, Name: user.Username}},
+		CreatedAt: time.Now(),
+	}
+	if record.Bot != "" {
+		room.Players = append(room.Players, newBotPlayer(record.Bot))
+		if err := room.start(); err != nil {
+			respondMatchError(c, err, "Failed to start match")
+			return
+		}
+	}
+
+	matchRoomsMu.Lock()
+	matchRooms[room.ID] = room
+	matchRoomsMu.Unlock()
+	if hasOldRoom {
+		oldRoom.RematchID = room.ID
+	}
+
+	respondMatch(c, http.StatusCreated, room, 0)
+}
+
+// handleGetMyMatches は、ログインユーザーの対戦履歴を新しい順に返します。
+func handleGetMyMatches(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	var participants []MatchParticipant
+	if err := db.Where("user_id = ?", userID).Order("id desc").Limit(limit).Find(&participants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load match history"})
+		return
+	}
+
+	matches := make([]gin.H, 0, len(participants))
+	for _, participant := range participants {
+		var record MatchRecord
+		if err := db.First(&record, participant.MatchRecordID).Error; err != nil {
+			continue
+		}
+		var players, outcomes []any
+		json.Unmarshal([]byte(record.Players), &players)
+		json.Unmarshal([]byte(record.Outcomes), &outcomes)
+		matches = append(matches, gin.H{
+			"id":         record.MatchID,
+			"mode":       record.Mode,
+			"region":     record.Region,
+			"rounds":     record.Rounds,
+			"bot":        record.Bot,
+			"score":      participant.Score,
+			"won":        participant.Won,
+			"players":    players,
+			"outcomes":   outcomes,
+			"finishedAt": record.FinishedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matches": matches})
+}
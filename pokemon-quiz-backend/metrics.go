@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- PokeAPI取得のメトリクス ---
+
+// PokeAPIへのリクエストをエンドポイントごとに成功・失敗・所要時間で集計し、Prometheus形式で /metrics に公開します。
+// 取得の最後には期待した数と実際に読み込めた数を記録するので、データが欠けたまま起動したことに気付けます。
+
+const expectedPokemonCount = 1025 // 取得するポケモンの図鑑番号の上限の既定値（PokeAPIから分からない場合に使う）
+
+// 取得するポケモンの図鑑番号の上限（データを読み込むときに discoverMaxPokemonID で更新する）
+var pokemonIDUpperBound = expectedPokemonCount
+
+// 所要時間のヒストグラムのバケット（秒）
+var fetchDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20}
+
+// 1つのラベルの組み合わせのヒストグラム
+type fetchHistogram struct {
+	counts []uint64 // バケットごとの件数（累積ではない）
+	sum    float64
+	count  uint64
+}
+
+// 取得の結果の集計
+type fetchMetrics struct {
+	mu         sync.Mutex
+	histograms map[[2]string]*fetchHistogram // [エンドポイント, 結果] ごと
+	expected   int
+	loaded     int
+	missing    []int
+}
+
+var pokeAPIMetrics = &fetchMetrics{histograms: make(map[[2]string]*fetchHistogram)}
+
+// observe は、1回分のリクエストの結果を記録します。
+func (m *fetchMetrics) observe(endpoint, outcome string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{endpoint, outcome}
+	h, ok := m.histograms[key]
+	if !ok {
+		h = &fetchHistogram{counts: make([]uint64, len(fetchDurationBuckets))}
+		m.histograms[key] = h
+	}
+	seconds := d.Seconds()
+	for i, le := range fetchDurationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// pokeAPIEndpoint は、PokeAPIのURLからエンドポイント名（"pokemon"・"pokemon-species" など）を取り出します。
+func pokeAPIEndpoint(path string) string {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v2/"), "/"), "/")
+	if parts[0] == "" {
+		return "unknown"
+	}
+	return parts[0]
+}
+
+// 取得の結果を記録する http.RoundTripper
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	outcome := "success"
+	switch {
+	case err != nil:
+		outcome = "failure"
+	case resp.StatusCode == http.StatusNotFound:
+		outcome = "not_found"
+	case resp.StatusCode == http.StatusNotModified:
+		outcome = "not_modified"
+	case resp.StatusCode >= 400:
+		outcome = "failure"
+	}
+	pokeAPIMetrics.observe(pokeAPIEndpoint(req.URL.Path), outcome, time.Since(start))
+	return resp, err
+}
+
+// newPokeAPIClient は、メトリクスを記録し、レスポンスをディスクにキャッシュするPokeAPI用のHTTPクライアントを作成します。
+func newPokeAPIClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: newPokeAPITransport()}
+}
+
+// reportDatasetSummary は、期待したポケモンの数と実際に読み込めた数を記録し、欠けていれば警告を出します。
+func reportDatasetSummary() {
+	var missing []int
+	loaded := 0
+	expected := pokemonIDUpperBound
+	for id := 1; id <= expected; id++ {
+		if _, ok := pokemonMapByID[id]; ok {
+			loaded++
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	pokeAPIMetrics.mu.Lock()
+	pokeAPIMetrics.expected = expected
+	pokeAPIMetrics.loaded = loaded
+	pokeAPIMetrics.missing = missing
+	// このプロセスでPokeAPIから取得した場合は、エンドポイントごとの結果もあわせて出力する
+	totals := make(map[string]map[string]uint64)
+	for k, h := range pokeAPIMetrics.histograms {
+		if totals[k[0]] == nil {
+			totals[k[0]] = make(map[string]uint64)
+		}
+		totals[k[0]][k[1]] += h.count
+	}
+	pokeAPIMetrics.mu.Unlock()
+	for endpoint, outcomes := range totals {
+		log.Printf("PokeAPI %s requests: %d succeeded, %d failed, %d not found, %d from cache (%d revalidated).",
+			endpoint, outcomes["success"], outcomes["failure"], outcomes["not_found"], outcomes["cache_hit"], outcomes["not_modified"])
+	}
+
+	if len(missing) == 0 {
+		log.Printf("Dataset summary: loaded %d/%d Pokemon (%d including forms).", loaded, expected, len(pokemonMapByID))
+		return
+	}
+	shown := missing
+	if len(shown) > 20 {
+		shown = shown[:20]
+	}
+	log.Printf("Warning: dataset is incomplete: loaded %d/%d Pokemon, missing IDs %v (showing %d of %d).", loaded, expected, shown, len(shown), len(missing))
+}
+
+// --- メトリクスのハンドラ ---
+
+// handleMetrics は、PokeAPI取得とレスポンス時間のメトリクスをPrometheusのテキスト形式で返します。
+func handleMetrics(c *gin.Context) {
+	m := pokeAPIMetrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP pokequiz_pokeapi_request_duration_seconds Latency of PokeAPI requests by endpoint and outcome.\n")
+	b.WriteString("# TYPE pokequiz_pokeapi_request_duration_seconds histogram\n")
+	keys := make([][2]string, 0, len(m.histograms))
+	for k := range m.histograms {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		h := m.histograms[k]
+		labels := fmt.Sprintf(`endpoint="%s",outcome="%s"`, k[0], k[1])
+		var cumulative uint64
+		for i, le := range fetchDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "pokequiz_pokeapi_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, le, cumulative)
+		}
+		fmt.Fprintf(&b, "pokequiz_pokeapi_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "pokequiz_pokeapi_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(&b, "pokequiz_pokeapi_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	b.WriteString("# HELP pokequiz_dataset_pokemon_expected Number of Pokemon the dataset is expected to contain.\n")
+	b.WriteString("# TYPE pokequiz_dataset_pokemon_expected gauge\n")
+	fmt.Fprintf(&b, "pokequiz_dataset_pokemon_expected %d\n", m.expected)
+	b.WriteString("# HELP pokequiz_dataset_pokemon_loaded Number of expected Pokemon actually loaded.\n")
+	b.WriteString("# TYPE pokequiz_dataset_pokemon_loaded gauge\n")
+	fmt.Fprintf(&b, "pokequiz_dataset_pokemon_loaded %d\n", m.loaded)
+	b.WriteString("# HELP pokequiz_dataset_pokemon_missing Number of expected Pokemon missing from the dataset.\n")
+	b.WriteString("# TYPE pokequiz_dataset_pokemon_missing gauge\n")
+	fmt.Fprintf(&b, "pokequiz_dataset_pokemon_missing %d\n", len(m.missing))
+
+	if statsQueue != nil {
+		b.WriteString("# HELP pokequiz_stats_queue_pending Answer results waiting to be written to user stats.\n")
+		b.WriteString("# TYPE pokequiz_stats_queue_pending gauge\n")
+		fmt.Fprintf(&b, "pokequiz_stats_queue_pending %d\n", statsQueue.pending())
+	}
+
+	// ルートごとのレスポンス時間
+	writeRouteMetrics(&b)
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- ユーザーが付ける名前のモデレーション ---
+
+// ユーザー名・トーナメント名・イベント名・プリセットやプールの名前はランキングや一覧で他のユーザーにも見えるので、
+// 作成するときに禁止語を含んでいないかを確認します。
+// 禁止語は、組み込みの一覧・環境変数 NAME_BLOCKLIST（カンマ区切り）・管理者が登録したルールを合わせたものです。
+// 管理者は「許可」のルールも登録でき、禁止語を含んでいても問題のない語（地名など）を例外にできます。
+// 大文字・小文字、全角・半角、記号や空白の挟み込み、よくある数字への置き換え（0→o など）は区別せずに判定します。
+
+const (
+	nameRuleBlock = "block"
+	nameRuleAllow = "allow"
+
+	maxNameRuleLength = 50
+)
+
+// 組み込みの禁止語
+var defaultBlockedTerms = []string{
+	"fuck", "shit", "bitch", "cunt", "nigger", "faggot", "nazi",
+	"死ね", "殺す", "ころす", "ちんこ", "まんこ",
+}
+
+var errNameBlocked = errors.New("name contains a blocked word")
+
+// --- データベースモデル ---
+
+// 管理者が登録した名前のルール
+type NameRule struct {
+	gorm.Model
+	Term   string `gorm:"uniqueIndex;not null"` // normalizeName した語
+	Action string `gorm:"not null"`             // block / allow
+}
+
+// 判定に使うルール（組み込み・環境変数・データベースのルールを合わせたもの）
+type nameRuleSet struct {
+	blocked []string
+	allowed []string
+}
+
+var (
+	nameRulesMu sync.RWMutex
+	nameRules   *nameRuleSet
+)
+
+// 数字や記号による置き換えを元の文字に戻す表
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+
+// normalizeName は、見た目の違いを取り除いた、判定用の名前を返します。
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		// 全角英数字を半角にする
+		if r >= '！' && r <= '～' {
+			r -= 0xFEE0
+		}
+		r = unicode.ToLower(r)
+		// 置き換えに使う数字や記号は残し、それ以外の区切り文字は取り除く
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '$' {
+			b.WriteRune(r)
+		}
+	}
+	return leetReplacer.Replace(b.String())
+}
+
+// loadNameRules は、判定に使うルールを読み込み直します。
+func loadNameRules() error {
+	var rules []NameRule
+	if err := db.Find(&rules).Error; err != nil {
+		return err
+	}
+	set := &nameRuleSet{}
+	terms := append([]string{}, defaultBlockedTerms...)
+	for _, t := range strings.Split(os.Getenv("NAME_BLOCKLIST"), ",") {
+		terms = append(terms, t)
+	}
+	for _, t := range terms {
+		if t = normalizeName(t); t != "" {
+			set.blocked = append(set.blocked, t)
+		}
+	}
+	for _, r := range rules {
+		if r.Action == nameRuleAllow {
+			set.allowed = append(set.allowed, r.Term)
+		} else {
+			set.blocked = append(set.blocked, r.Term)
+		}
+	}
+	// 長い許可語から先に取り除く（短い語で先に削ると長い語が一致しなくなるため）
+	sort.Slice(set.allowed, func(i, j int) bool { return len(set.allowed[i]) > len(set.allowed[j]) })
+
+	nameRulesMu.Lock()
+	nameRules = set
+	nameRulesMu.Unlock()
+	return nil
+}
+
+// blockedTermIn は、名前に含まれる禁止語を返します。含まれていなければ空文字列を返します。
+func blockedTermIn(name string) string {
+	nameRulesMu.RLock()
+	set := nameRules
+	nameRulesMu.RUnlock()
+	if set == nil {
+		if err := loadNameRules(); err != nil {
+			log.Printf("Failed to load name rules: %v", err)
+			return ""
+		}
+		return blockedTermIn(name)
+	}
+
+	normalized := normalizeName(name)
+	for _, a := range set.allowed {
+		normalized = strings.ReplaceAll(normalized, a, " ")
+	}
+	for _, b := range set.blocked {
+		if strings.Contains(normalized, b) {
+			return b
+		}
+	}
+	return ""
+}
+
+// checkName は、名前が禁止語を含んでいれば errNameBlocked を返します。
+func checkName(name string) error {
+	if term := blockedTermIn(name); term != "" {
+		log.Printf("Rejected name %q (matched %q)", name, term)
+		return errNameBlocked
+	}
+	return nil
+}
+
+// rejectBlockedName は、名前が禁止語を含んでいればエラーを返して true を返します。
+func rejectBlockedName(c *gin.Context, field, name string) bool {
+	if checkName(name) == nil {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The " + field + " contains a word that is not allowed"})
+	return true
+}
+
+// --- 名前のルールのハンドラ（管理者用） ---
+
+// handleListNameRules は、管理者が登録したルールの一覧を返します。
+func handleListNameRules(c *gin.Context) {
+	var rules []NameRule
+	if err := db.Order("term asc").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load name rules"})
+		return
+	}
+	result := make([]gin.H, len(rules))
+	for i, r := range rules {
+		result[i] = gin.H{"id": r.ID, "term": r.Term, "action": r.Action}
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": result, "builtinBlocked": len(defaultBlockedTerms)})
+}
+
+// handleCreateNameRule は、禁止語または許可語を登録します。同じ語が既にあれば種類を置き換えます。
+func handleCreateNameRule(c *gin.Context) {
+	var req struct {
+		Term   string `json:"term" binding:"required"`
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "term is required"})
+		return
+	}
+	if req.Action == "" {
+		req.Action = nameRuleBlock
+	}
+	if req.Action != nameRuleBlock && req.Action != nameRuleAllow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be block or allow"})
+		return
+	}
+	term := normalizeName(req.Term)
+	if term == "" || len([]rune(term)) > maxNameRuleLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "term must contain between 1 and 50 letters or digits"})
+		return
+	}
+
+	rule := NameRule{Term: term}
+	err := db.Where(NameRule{Term: term}).Assign(NameRule{Action: req.Action}).FirstOrCreate(&rule).Error
+	recordAudit(c.MustGet("userID").(uint), "name_rule_"+req.Action, term, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save name rule"})
+		return
+	}
+	if err := loadNameRules(); err != nil {
+		log.Printf("Failed to reload name rules: %v", err)
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": rule.ID, "term": rule.Term, "action": rule.Action})
+}
+
+// handleDeleteNameRule は、登録したルールを削除します。
+func handleDeleteNameRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+	var rule NameRule
+	if err := db.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Name rule not found"})
+		return
+	}
+	err = db.Unscoped().Delete(&rule).Error
+	recordAudit(c.MustGet("userID").(uint), "name_rule_delete", rule.Term, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete name rule"})
+		return
+	}
+	if err := loadNameRules(); err != nil {
+		log.Printf("Failed to reload name rules: %v", err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleCheckName は、名前がルールに引っかかるかを確認します（ルールを登録する前の確認用）。
+func handleCheckName(c *gin.Context) {
+	name := c.Query("name")
+	term := blockedTermIn(name)
+	c.JSON(http.StatusOK, gin.H{"name": name, "normalized": normalizeName(name), "blocked": term != "", "matched": term})
+}
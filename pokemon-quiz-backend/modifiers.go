@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// --- XPの倍率（モディファイア） ---
+
+// コンテンツカレンダー（content_calendar.go）の double_xp の予定を、期間中の回答のXPに掛ける倍率として読み込みます。
+// 予定に region を指定すると、その地方のポケモンの問題への回答だけに掛けます（地方はポケモンの Category で判断する）。
+// 期間が重なった倍率は掛け合わせ、最大 maxStackedXPMultiplier 倍までにします。
+// ランキングの集計（activity.go）と回答の応答の "xp" は、どちらも answerXP で同じ計算をします。
+// プロフィールのXP（userXP）は回答数と正解数から計算するので、倍率で増えた分を UserStat.BonusXP に別に加えます。
+// 回答ごとの得点（scoring.go）にも同じ倍率を掛けます。
+
+const maxStackedXPMultiplier = 10
+
+// XPの倍率
+type xpModifier struct {
+	ID         uint      `json:"id"` // コンテンツカレンダーの予定のID
+	Title      string    `json:"title"`
+	Region     string    `json:"region,omitempty"`
+	Multiplier int       `json:"multiplier"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt"`
+}
+
+// 1問の回答で得たXP
+type xpAward struct {
+	Base       int          `json:"base"`       // 倍率を掛ける前のXP
+	Multiplier int          `json:"multiplier"` // 掛けた倍率
+	Gained     int          `json:"gained"`     // ランキングに加わるXP
+	Modifiers  []xpModifier `json:"modifiers"`  // 掛かった倍率の一覧
+}
+
+var (
+	xpModifiersMu sync.RWMutex
+	xpModifiers   []xpModifier
+)
+
+// loadXPModifiers は、コンテンツカレンダーからXPの倍率を読み込み直します。
+func loadXPModifiers() error {
+	var entries []CalendarEntry
+	if err := db.Where("kind = ?", calendarKindDoubleXP).Order("starts_at asc").Find(&entries).Error; err != nil {
+		return err
+	}
+	modifiers := make([]xpModifier, len(entries))
+	for i, e := range entries {
+		modifiers[i] = xpModifier{ID: e.ID, Title: e.Title, Region: e.Region, Multiplier: e.Multiplier, StartsAt: e.StartsAt, EndsAt: e.EndsAt}
+	}
+	xpModifiersMu.Lock()
+	xpModifiers = modifiers
+	xpModifiersMu.Unlock()
+	return nil
+}
+
+// activeXPModifiers は、その時刻にそのポケモンの問題への回答に掛かる倍率を返します。
+func activeXPModifiers(t time.Time, pokemonID int) []xpModifier {
+	region := ""
+	if pokemon, ok := pokemonMapByID[pokemonID]; ok {
+		region = pokemon.Category
+	}
+	xpModifiersMu.RLock()
+	defer xpModifiersMu.RUnlock()
+	var active []xpModifier
+	for _, m := range xpModifiers {
+		if t.Before(m.StartsAt) || !t.Before(m.EndsAt) {
+			continue
+		}
+		if m.Region != "" && m.Region != region {
+			continue
+		}
+		active = append(active, m)
+	}
+	return active
+}
+
+// stackedMultiplier は、重なった倍率を掛け合わせた倍率を返します。
+func stackedMultiplier(modifiers []xpModifier) int {
+	multiplier := 1
+	for _, m := range modifiers {
+		multiplier = min(multiplier*m.Multiplier, maxStackedXPMultiplier)
+	}
+	return multiplier
+}
+
+// answerXP は、回答の行動記録から、その回答で得たXPを計算します。
+func answerXP(rules scoringRules, e ActivityEvent) xpAward {
+	award := xpAward{Base: rules.PerAnswer, Modifiers: activeXPModifiers(e.CreatedAt, e.PokemonID)}
+	if e.Correct {
+		award.Base += rules.PerCorrect
+	}
+	award.Multiplier = stackedMultiplier(award.Modifiers)
+	award.Gained = award.Base * award.Multiplier
+	if award.Modifiers == nil {
+		award.Modifiers = []xpModifier{}
+	}
+	return award
+}
+
+// bonusXP は、倍率によってプロフィールのXPに上乗せする分を返します。
+func bonusXP(a statsAnswer) int {
+	award := answerXP(currentScoringRules, ActivityEvent{CreatedAt: a.answeredAt(), PokemonID: a.PokemonID, Correct: a.IsCorrect})
+	return award.Gained - award.Base
+}
+
+// answeredAt は、倍率を判断する時刻（回答した時刻。分からなければ現在時刻）を返します。
+func (a statsAnswer) answeredAt() time.Time {
+	if a.AnsweredAt.IsZero() {
+		return time.Now()
+	}
+	return a.AnsweredAt
+}
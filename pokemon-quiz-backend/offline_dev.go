@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- オフライン開発モード ---
+
+// --offline-dev を付けて起動すると、PokeAPIへのリクエストをネットワークに出さず、
+// testdata/pokeapi に記録したレスポンスを返します（POKEAPI_FIXTURE_DIR で場所を変更できる）。
+// ネットワークにつながらない環境でも、ポケモンデータの取得の流れ（種族の数の確認・タイプ名・特性・技・フォルム違い・地方の分類）と
+// クイズの一通りの操作を試せます。記録していないURLには 404 を返し、PokeAPI以外への接続はエラーにします。
+// 毎回取得の流れを通るよう、ポケモンデータは一時ディレクトリに保存し、起動のたびに消します。
+// 外部につながる設定（DATABASE_URL・MAILER）は無視し、STORAGE と JWT_SECRET_KEY が未設定なら開発用の値を使います。
+//
+// --record-fixtures を付けて起動すると、実際のPokeAPIから取得したレスポンスを testdata/pokeapi に記録します。
+// MAX_POKEMON_ID で取得する数を絞ってから記録してください。
+
+const (
+	defaultPokeAPIFixtureDir = "testdata/pokeapi"
+	pokeAPIBaseURL           = "https://pokeapi.co/api/v2/"
+	offlineDevJWTKey         = "offline-dev-secret"
+)
+
+var (
+	offlineDev     bool
+	recordFixtures bool
+)
+
+// parseFlags は、コマンドラインの引数を読み取ります。
+func parseFlags() {
+	flag.BoolVar(&offlineDev, "offline-dev", false, "serve PokeAPI responses from recorded fixtures without network access")
+	flag.BoolVar(&recordFixtures, "record-fixtures", false, "record PokeAPI responses as fixtures for --offline-dev")
+	flag.Parse()
+	if offlineDev && recordFixtures {
+		log.Fatal("FATAL: --offline-dev and --record-fixtures cannot be used together.")
+	}
+}
+
+// pokeAPIFixtureDir は、PokeAPIのレスポンスを記録する場所を返します。
+func pokeAPIFixtureDir() string {
+	if dir := os.Getenv("POKEAPI_FIXTURE_DIR"); dir != "" {
+		return dir
+	}
+	return defaultPokeAPIFixtureDir
+}
+
+// setupOfflineDev は、オフライン開発モードで外部に接続しないよう設定を上書きします。
+func setupOfflineDev() {
+	log.Printf("Offline dev mode: serving PokeAPI responses from %s.", pokeAPIFixtureDir())
+	os.Unsetenv("DATABASE_URL")
+	os.Setenv("MAILER", "log")
+	if os.Getenv("STORAGE") == "" {
+		os.Setenv("STORAGE", "memory")
+	}
+	if os.Getenv("JWT_SECRET_KEY") == "" {
+		os.Setenv("JWT_SECRET_KEY", offlineDevJWTKey)
+	}
+
+	dir := filepath.Join(os.TempDir(), "pokequiz-offline-dev")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalf("FATAL: failed to create %s: %v", dir, err)
+	}
+	pokemonDataFile = filepath.Join(dir, "pokemon.json")
+	os.Remove(pokemonDataFile)
+	os.Remove(fetchCheckpointFile())
+
+	cropClient.Transport = fixtureTransport{dir: pokeAPIFixtureDir()}
+}
+
+// fixturePath は、PokeAPIのURLに対応する記録のファイルのパスを返します。PokeAPIのURLでなければ空を返します。
+// クエリは無視します（"pokemon-species?limit=1" は pokemon-species.json）。
+func fixturePath(dir, url string) string {
+	rest, ok := strings.CutPrefix(url, pokeAPIBaseURL)
+	if !ok {
+		return ""
+	}
+	rest, _, _ = strings.Cut(rest, "?")
+	rest = strings.Trim(rest, "/")
+	if rest == "" || strings.Contains(rest, "..") {
+		return ""
+	}
+	return filepath.Join(dir, filepath.FromSlash(rest)+".json")
+}
+
+// 記録したレスポンスを返す http.RoundTripper
+type fixtureTransport struct {
+	dir string
+}
+
+func (t fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	path := fixturePath(t.dir, url)
+	if path == "" {
+		return nil, fmt.Errorf("offline dev mode: network access to %s is disabled", req.URL.Host)
+	}
+	status := http.StatusOK
+	body, err := os.ReadFile(path)
+	if err != nil {
+		status = http.StatusNotFound
+		body = []byte("Not Found")
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// 取得したレスポンスを記録する http.RoundTripper
+type recordingTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	path := fixturePath(t.dir, req.URL.String())
+	if path == "" {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		err = os.WriteFile(path, body, 0o644)
+	}
+	if err != nil {
+		log.Printf("Failed to record PokeAPI fixture %s: %v", path, err)
+	}
+	return resp, nil
+}
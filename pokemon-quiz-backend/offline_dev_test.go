@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testdata/pokeapi に記録したPokeAPIのレスポンスを使って、ポケモンデータの取得の流れ全体
+// （種族の数の確認・タイプ名・特性・技・フォルム違い・地方の分類）を通し、組み立てたポケモンを確かめます。
+// PokeAPIのレスポンスの形が変わったときは、--record-fixtures で記録し直してからこのテストを直してください。
+func TestFetchPokemonDataFromFixtures(t *testing.T) {
+	offlineDev = true
+	pokemonDataFile = filepath.Join(t.TempDir(), "pokemon.json")
+	pokemonMapByID = make(map[int]*Pokemon)
+	typeNameMap = make(map[string]string)
+	t.Cleanup(func() { offlineDev = false })
+
+	if err := fetchAllPokemonData(); err != nil {
+		t.Fatalf("fetchAllPokemonData: %v", err)
+	}
+	fetchCategoryData()
+
+	if pokemonIDUpperBound != 9 {
+		t.Errorf("pokemonIDUpperBound = %d, want 9 (pokemon-species.json の count)", pokemonIDUpperBound)
+	}
+	for id := 1; id <= 9; id++ {
+		if _, ok := pokemonMapByID[id]; !ok {
+			t.Errorf("pokemon %d was not fetched", id)
+		}
+	}
+
+	bulbasaur := pokemonMapByID[1]
+	if bulbasaur == nil {
+		t.Fatal("pokemon 1 was not fetched")
+	}
+	if bulbasaur.Name != "フシギダネ" || bulbasaur.EnglishName != "bulbasaur" {
+		t.Errorf("name = %q / %q, want フシギダネ / bulbasaur", bulbasaur.Name, bulbasaur.EnglishName)
+	}
+	if want := (PokemonStats{HP: 45, Attack: 49, Defense: 49, SpAttack: 65, SpDefense: 65, Speed: 45}); bulbasaur.Stats != want {
+		t.Errorf("stats = %+v, want %+v", bulbasaur.Stats, want)
+	}
+	if want := []string{"くさ", "どく"}; !slices.Equal(bulbasaur.Types, want) {
+		t.Errorf("types = %v, want %v", bulbasaur.Types, want)
+	}
+	if bulbasaur.Height != 0.7 || bulbasaur.Weight != 6.9 {
+		t.Errorf("height / weight = %v / %v, want 0.7 / 6.9", bulbasaur.Height, bulbasaur.Weight)
+	}
+	if bulbasaur.Category != "kanto" {
+		t.Errorf("category = %q, want kanto", bulbasaur.Category)
+	}
+	if len(bulbasaur.Abilities) == 0 || len(bulbasaur.Moves) == 0 || bulbasaur.Genus == "" || bulbasaur.NameReading == "" {
+		t.Errorf("abilities, moves, genus or reading is missing: %+v", bulbasaur)
+	}
+	if isPokemonDataIncomplete(bulbasaur) {
+		t.Errorf("pokemon 1 is incomplete: %+v", bulbasaur)
+	}
+
+	// フォルム違いはフォルム違い用のIDに、元のポケモンと同じ図鑑番号で追加される
+	var mega *Pokemon
+	for _, p := range pokemonMapByID {
+		if p.EnglishName == "venusaur-mega" {
+			mega = p
+		}
+	}
+	if mega == nil {
+		t.Fatal("venusaur-mega was not fetched")
+	}
+	if mega.ID <= formIDOffset || mega.SpeciesID != 3 || mega.Category != "mega" {
+		t.Errorf("venusaur-mega: id = %d, speciesId = %d, category = %q", mega.ID, mega.SpeciesID, mega.Category)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- オフライン用の問題パック ---
+
+// 通信できない場所でもPWAで遊べるよう、GET /quiz/offline-pack?region=&count= で問題をまとめて配布します。
+// 問題には正解の名前そのものではなく、次のハッシュ（answerHash）を付けます。PWA は選んだ名前で同じ計算をして正誤を表示します。
+//
+//	answerHash = hex(SHA-256(salt + ":" + questionNumber + ":" + 正解の名前))
+//
+// パックには、正解のポケモンと answerHash をサーバーの鍵で暗号化した packToken を付けます。
+// オンラインに戻ったら、まとめて出題するセッションと同じ POST /quiz/session/:id/submit（:id はパックの packId）に
+// packToken と回答を送ると、サーバーが回答のハッシュを packToken の answerHash と照らし合わせて採点します。
+// salt と選択肢がパックに入っているため、クライアントはすべての選択肢のハッシュを計算して正解を知ることができます。
+// そのためオフラインの結果は公式の記録として扱わず、成績・XP・ランキングには反映しません。
+// 採点結果は送られたパックごとに OfflinePackSubmission に別に記録し、同じパックを2回送ると断ります（409）。
+// パックの有効期限は OFFLINE_PACK_TTL（既定は7日）です。
+
+const (
+	offlinePackPurpose     = "pokequiz-offline-pack"
+	defaultOfflinePackSize = 20
+	defaultOfflinePackTTL  = 7 * 24 * time.Hour
+)
+
+// main で OFFLINE_PACK_TTL から設定する
+var offlinePackTTL = defaultOfflinePackTTL
+
+// packToken の中身
+type offlinePackClaims struct {
+	PackID     string   `json:"id"`
+	UserID     uint     `json:"u,omitempty"`
+	Region     string   `json:"r"`
+	Mode       string   `json:"m"`
+	Salt       string   `json:"s"`
+	PokemonIDs []int    `json:"p"`
+	Hashes     []string `json:"h"`
+	ExpiresAt  int64    `json:"e"`
+}
+
+// --- データベースモデル ---
+
+// 送られたオフライン用の問題パックの採点結果（成績とは別に記録する。同じパックを2回採点しないためにも使う）
+type OfflinePackSubmission struct {
+	ID          uint   `gorm:"primarykey"`
+	PackID      string `gorm:"uniqueIndex;not null"`
+	UserID      uint   `gorm:"index"`
+	Answered    int
+	Correct     int
+	SubmittedAt time.Time
+}
+
+// offlineAnswerHash は、問題の answerHash を計算します（PWA でも同じ計算をする）。
+func offlineAnswerHash(salt string, questionNumber int, name string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + strconv.Itoa(questionNumber) + ":" + name))
+	return hex.EncodeToString(sum[:])
+}
+
+// --- オフライン用の問題パックのハンドラ ---
+
+// handleGetOfflinePack は、オフラインで遊ぶための問題をまとめて返します。
+func handleGetOfflinePack(c *gin.Context) {
+	region := c.DefaultQuery("region", "kanto")
+	pool := regionRotation(region)
+	if len(pool) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified"})
+		return
+	}
+	count := defaultOfflinePackSize
+	if v := c.Query("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSessionQuestion {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and 100"})
+			return
+		}
+		count = n
+	}
+	packID, err := newRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create offline pack"})
+		return
+	}
+	salt, err := newRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create offline pack"})
+		return
+	}
+	userID, _ := optionalUserID(c)
+	expiresAt := time.Now().Add(offlinePackTTL)
+	claims := offlinePackClaims{PackID: packID, UserID: userID, Region: region, Mode: quizModeStats, Salt: salt, ExpiresAt: expiresAt.Unix()}
+
+	// 地方のポケモンが足りる限り、同じポケモンは2回出題しない
+	remaining := append([]*Pokemon(nil), pool...)
+	questions := make([]gin.H, 0, count)
+	for i := 1; i <= count; i++ {
+		if len(remaining) == 0 {
+			remaining = append(remaining, pool...)
+		}
+		idx, err := randomIndex(len(remaining))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create offline pack"})
+			return
+		}
+		pokemon := remaining[idx]
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+
+		question, err := newQuizQuestion(nil, pokemon, pool, claims.Mode, defaultOptionCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create offline pack"})
+			return
+		}
+		hash := offlineAnswerHash(salt, i, answerName(pokemon, claims.Mode))
+		delete(question, "id") // 正解が分からないようにIDは返さない
+		question["questionNumber"] = i
+		question["answerHash"] = hash
+		questions = append(questions, question)
+		claims.PokemonIDs = append(claims.PokemonIDs, pokemon.ID)
+		claims.Hashes = append(claims.Hashes, hash)
+		recordQuestionServed(userID, pokemon.ID, claims.Mode, "", "offline", false)
+	}
+
+	token, err := sealJSON(offlinePackPurpose, claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create offline pack"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"packId":    packID,
+		"packToken": token,
+		"region":    region,
+		"mode":      claims.Mode,
+		"salt":      salt,
+		"expiresAt": expiresAt,
+		"questions": questions,
+	})
+}
+
+// submitOfflinePack は、オフラインで解いたパックの回答を採点し、結果を記録します（成績・XPには反映しない）。
+// handleSubmitQuizSession から、packToken が送られたときに呼びます。
+func submitOfflinePack(c *gin.Context, packToken string, answers []string) {
+	var claims offlinePackClaims
+	if err := openJSON(offlinePackPurpose, packToken, &claims); err != nil || claims.PackID != c.Param("id") || time.Now().Unix() > claims.ExpiresAt {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired pack token"})
+		return
+	}
+	userID, _ := optionalUserID(c)
+	if claims.UserID != userID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired pack token"})
+		return
+	}
+	if len(answers) != len(claims.PokemonIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("answers must contain exactly %d entries", len(claims.PokemonIDs))})
+		return
+	}
+
+	results := make([]gin.H, len(claims.PokemonIDs))
+	correct := 0
+	for i, id := range claims.PokemonIDs {
+		// 回答のハッシュを、パックを作ったときの answerHash と照らし合わせる
+		hash := offlineAnswerHash(claims.Salt, i+1, answers[i])
+		isCorrect := subtle.ConstantTimeCompare([]byte(hash), []byte(claims.Hashes[i])) == 1
+		if isCorrect {
+			correct++
+		}
+		result := gin.H{"questionNumber": i + 1, "answer": answers[i], "isCorrect": isCorrect}
+		// データの更新でポケモンがいなくなっていても、採点はハッシュだけでできる
+		if pokemon, ok := pokemonMapByID[id]; ok {
+			result["correctPokemon"] = pokemon
+			result["explanation"] = buildExplanation(pokemon)
+		}
+		results[i] = result
+	}
+
+	submission := OfflinePackSubmission{PackID: claims.PackID, UserID: userID, Answered: len(answers), Correct: correct, SubmittedAt: time.Now()}
+	// unofficial: 成績・XP・ランキングには反映していないことを表す
+	response := gin.H{"packId": claims.PackID, "answered": len(answers), "correct": correct, "results": results, "unofficial": true}
+	if err := db.Create(&submission).Error; err != nil {
+		var existing int64
+		if db.Model(&OfflinePackSubmission{}).Where("pack_id = ?", claims.PackID).Count(&existing); existing > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "This pack has already been submitted"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save results, please submit again"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"pokemon-quiz-backend/quiz"
+)
+
+// --- 選択肢の並び順 ---
+
+// 選択肢の位置で覚えてしまわないよう、選択肢は毎回ランダムに並べています。
+// 一方で、名前を覚える練習では毎回同じ並びの方が探しやすいので、/quiz の order で並び順を選べるようにします。
+//   - random: ランダム（既定）
+//   - kana:   名前の読みの五十音順（英語名で答える形式ではアルファベット順）
+//   - dex:    図鑑番号の順（フォルム違いは元のポケモンの後ろ）
+// 対戦・トーナメント・イベントなど、順位を競う出題は常にランダムです。
+// 選択肢がポケモンの名前でない形式（種族値を当てる形式など）では並べ替えません。
+
+const (
+	optionOrderRandom = "random"
+	optionOrderKana   = "kana"
+	optionOrderDex    = "dex"
+)
+
+var optionOrders = []string{optionOrderRandom, optionOrderKana, optionOrderDex}
+
+// optionOrderParam は、order クエリパラメータから選択肢の並び順を返します（省略時は random）。
+// 知らない並び順の場合は false を返します。
+func optionOrderParam(c *gin.Context) (string, bool) {
+	order := c.DefaultQuery("order", optionOrderRandom)
+	for _, o := range optionOrders {
+		if o == order {
+			return order, true
+		}
+	}
+	return "", false
+}
+
+// orderOptions は、問題の選択肢（と読み）を order の順に並べ替えます。
+// 選択肢の名前は pokemon と pool のポケモンから探し、見つからない名前があれば並べ替えません。
+func orderOptions(question gin.H, order string, pokemon *Pokemon, pool []*Pokemon, mode string) {
+	options, ok := question["options"].([]string)
+	if !ok || order == optionOrderRandom {
+		return
+	}
+	byName := make(map[string]*Pokemon, len(options))
+	for _, name := range options {
+		byName[name] = nil
+	}
+	for _, p := range append([]*Pokemon{pokemon}, pool...) {
+		if found, wanted := byName[answerName(p, mode)]; wanted && found == nil {
+			byName[answerName(p, mode)] = p
+		}
+	}
+	for _, p := range byName {
+		if p == nil {
+			return
+		}
+	}
+
+	switch order {
+	case optionOrderKana:
+		key := func(name string) string {
+			if reading := nameReadings[name]; reading != "" && mode != quizModeJaToEn {
+				name = reading
+			}
+			return quiz.NormalizeAnswer(name) // ひらがなとカタカナ、大文字と小文字をそろえて比べる
+		}
+		sort.SliceStable(options, func(i, j int) bool { return key(options[i]) < key(options[j]) })
+	case optionOrderDex:
+		sort.SliceStable(options, func(i, j int) bool {
+			a, b := byName[options[i]], byName[options[j]]
+			if a.SpeciesID != b.SpeciesID {
+				return a.SpeciesID < b.SpeciesID
+			}
+			return a.ID < b.ID
+		})
+	}
+	if _, ok := question["optionReadings"]; ok {
+		readings := make([]string, len(options))
+		for i, name := range options {
+			readings[i] = nameReadings[name]
+		}
+		question["optionReadings"] = readings
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- コンテンツパック ---
+
+// PokeAPI 以外のデータ（ファン作成の地方、学校の単語帳など）をJSONファイルから読み込み、
+// 通常のクイズと同じ仕組みで出題します。`pack=` パラメータで出題するパックを選びます。
+//
+// パックのファイルは次の形式です。entries の各要素は Pokemon と同じJSON形式で、
+// id と name は必須、category を書くと地方と同じように region で絞り込めます。
+//
+//	{
+//	  "id": "school-vocab",
+//	  "name": "英単語パック",
+//	  "description": "中学1年の英単語",
+//	  "entries": [{"id": 1, "name": "りんご", "englishName": "apple", "types": ["くだもの"]}, ...]
+//	}
+
+const (
+	defaultPackID   = "pokeapi" // PokeAPI から取得したポケモンのデータ
+	defaultPacksDir = "packs"
+	minPackEntries  = 4 // 選択肢を4つ作るのに必要な件数
+)
+
+// クイズの出題元となるデータ
+type contentPack struct {
+	ID          string
+	Name        string
+	Description string
+	regions     map[string][]*Pokemon // 地方（カテゴリ）ごとの一覧。"all" は全件
+	byID        map[int]*Pokemon
+}
+
+// パックのJSONファイルの形式
+type contentPackFile struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Entries     []Pokemon `json:"entries"`
+}
+
+// 読み込んだコンテンツパック（起動時に一度だけ読み込むのでロックは不要）
+var contentPacks = make(map[string]*contentPack)
+
+// lookupPack は、IDからコンテンツパックを返します。空文字の場合は PokeAPI のデータを返します。
+func lookupPack(id string) (*contentPack, bool) {
+	if id == "" || id == defaultPackID {
+		return &contentPack{
+			ID:      defaultPackID,
+			Name:    "ポケモン",
+			regions: pokemonListByRegion,
+			byID:    pokemonMapByID,
+		}, true
+	}
+	pack, ok := contentPacks[id]
+	return pack, ok
+}
+
+// isDefaultPack は、PokeAPI のデータかどうかを返します。成績の記録はこのデータでのみ行います。
+func (p *contentPack) isDefaultPack() bool {
+	return p.ID == defaultPackID
+}
+
+// loadContentPacks は、ディレクトリ内のJSONファイルをコンテンツパックとして読み込みます。
+// 形式に誤りがあるファイルはログに出して読み飛ばします。
+func loadContentPacks(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) == 0 {
+		return
+	}
+	for _, file := range files {
+		pack, err := loadContentPack(file)
+		if err != nil {
+			log.Printf("Skipping content pack %s: %v", file, err)
+			continue
+		}
+		if _, exists := contentPacks[pack.ID]; exists || pack.ID == defaultPackID {
+			log.Printf("Skipping content pack %s: duplicate pack id %q", file, pack.ID)
+			continue
+		}
+		contentPacks[pack.ID] = pack
+		log.Printf("Loaded content pack %q with %d entries.", pack.ID, len(pack.byID))
+	}
+}
+
+// loadContentPack は、1つのJSONファイルを読み込んで検証します。
+func loadContentPack(file string) (*contentPack, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var packFile contentPackFile
+	if err := json.Unmarshal(data, &packFile); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if packFile.ID == "" || packFile.Name == "" {
+		return nil, errors.New("id and name are required")
+	}
+	if len(packFile.Entries) < minPackEntries {
+		return nil, fmt.Errorf("at least %d entries are required", minPackEntries)
+	}
+
+	pack := &contentPack{
+		ID:          packFile.ID,
+		Name:        packFile.Name,
+		Description: packFile.Description,
+		regions:     make(map[string][]*Pokemon),
+		byID:        make(map[int]*Pokemon),
+	}
+	names := make(map[string]bool)
+	for i := range packFile.Entries {
+		entry := &packFile.Entries[i]
+		if entry.ID == 0 || entry.Name == "" {
+			return nil, fmt.Errorf("entry %d: id and name are required", i)
+		}
+		if _, exists := pack.byID[entry.ID]; exists {
+			return nil, fmt.Errorf("entry %d: duplicate id %d", i, entry.ID)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("entry %d: duplicate name %q", i, entry.Name)
+		}
+		names[entry.Name] = true
+		if entry.NameReading == "" {
+			entry.NameReading = entry.Name
+		}
+		pack.byID[entry.ID] = entry
+		if entry.Category != "" {
+			pack.regions[entry.Category] = append(pack.regions[entry.Category], entry)
+		}
+		pack.regions["all"] = append(pack.regions["all"], entry)
+	}
+	return pack, nil
+}
+
+// handleListPacks は、選択できるコンテンツパックの一覧を返します。
+func handleListPacks(c *gin.Context) {
+	packs := []gin.H{}
+	ids := []string{defaultPackID}
+	for id := range contentPacks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids[1:])
+	for _, id := range ids {
+		pack, _ := lookupPack(id)
+		regions := make([]string, 0, len(pack.regions))
+		for region := range pack.regions {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+		packs = append(packs, gin.H{
+			"id":          pack.ID,
+			"name":        pack.Name,
+			"description": pack.Description,
+			"regions":     regions,
+			"entries":     len(pack.byID),
+		})
+	}
+	c.JSON(http.StatusOK, packs)
+}
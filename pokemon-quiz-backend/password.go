@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"pokemon-quiz-backend/auth"
+)
+
+// --- パスワードの変更 ---
+
+// ログイン中のユーザーは POST /me/password で、今のパスワードを確かめたうえでパスワードを変えられます。
+// 新しいパスワードは登録時と同じ要件（8文字以上の英数字で、英字と数字の両方を含む）を満たす必要があります。
+// パスワードを変えると、ユーザーのトークンの版（User.TokenVersion）を上げるので、
+// それより前に発行したログイントークンとリフレッシュトークンは全て使えなくなり、
+// 変更したリクエストには新しいログイントークンとリフレッシュトークンを返します（他の端末ではもう一度ログインが必要になる）。
+// 今のパスワードが違う場合は、トークンの送り直しと区別できるように 401 ではなく 403 を返します。
+// パスワードの要件・ハッシュ化と、変更前のトークンの判定は auth パッケージにあります。
+
+// --- パスワードの変更のハンドラ ---
+
+// handleChangePassword は、今のパスワードを確かめてパスワードを変え、新しいトークンを返します。
+func handleChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currentPassword and newPassword are required"})
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	user, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if !auth.ValidCredentials(req.NewPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters long and contain both letters and numbers."})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different from the current password"})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	now := time.Now()
+	if err := users.UpdatePassword(userID, hashedPassword, now); err != nil {
+		if errors.Is(err, errUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// 今までのリフレッシュトークンを無効にして、新しいログインとしてトークンを発行し直す
+	var refreshToken string
+	var refreshExpiresAt time.Time
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		refreshToken, refreshExpiresAt, err = issueRefreshToken(tx, userID, "", now, now)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke existing tokens"})
+		return
+	}
+	updated, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	tokenString, expiresAt, err := issueLoginToken(userID, updated.TokenVersion, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Password updated",
+		"token":            tokenString,
+		"expiresAt":        expiresAt,
+		"refreshToken":     refreshToken,
+		"refreshExpiresAt": refreshExpiresAt,
+	})
+}
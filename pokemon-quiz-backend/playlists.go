@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- プレイリスト（テーマ別の出題リスト） ---
+
+// 「イーブイの進化形」「ジムリーダーの切り札」のように、管理者がテーマに沿って並べたポケモンの一覧を保存し、
+// 誰でも GET /playlists で一覧を見て、POST /playlists/:id/play で決まった順に出題するセッションとして遊べます。
+// 出題はクイズセッションの仕組み（/quiz/session/:id/question・answer）をそのまま使い、
+// ランダムではなくプレイリストの順に出題し、不正解の選択肢も同じプレイリストから選びます。
+// 一覧には出題順が答えになるのでポケモンを含めず、中身は管理者用のAPIでのみ返します。
+
+const (
+	sessionTypePlaylist    = "playlist"
+	minPlaylistPokemon     = 4
+	maxPlaylistPokemon     = maxSessionQuestion
+	maxPlaylistTitleLength = 100
+	maxPlaylistDescLength  = 500
+)
+
+// --- データベースモデル ---
+
+// 管理者が作成したプレイリスト
+type Playlist struct {
+	gorm.Model
+	Title       string `gorm:"not null"`
+	Description string
+	Mode        string `gorm:"not null"`
+	PokemonIDs  string `gorm:"type:text;not null"` // 出題順に並べたポケモンIDのJSON配列
+}
+
+// pokemonIDs は、プレイリストのポケモンIDを出題順に返します。
+func (p *Playlist) pokemonIDs() []int {
+	var ids []int
+	json.Unmarshal([]byte(p.PokemonIDs), &ids)
+	return ids
+}
+
+// pokemon は、プレイリストのポケモンのうち、現在のデータにいるものを出題順に返します。
+func (p *Playlist) pokemon() []*Pokemon {
+	ids := p.pokemonIDs()
+	list := make([]*Pokemon, 0, len(ids))
+	for _, id := range ids {
+		if pokemon, ok := pokemonMapByID[id]; ok {
+			list = append(list, pokemon)
+		}
+	}
+	return list
+}
+
+// playlistView は、誰でも見られるプレイリストの情報を組み立てます（ポケモンは含めない）。
+func playlistView(p *Playlist) gin.H {
+	return gin.H{
+		"id":          p.ID,
+		"title":       p.Title,
+		"description": p.Description,
+		"mode":        p.Mode,
+		"questions":   len(p.pokemonIDs()),
+	}
+}
+
+// playlistAdminView は、管理者に返すプレイリストの情報を組み立てます。
+func playlistAdminView(p *Playlist) gin.H {
+	view := playlistView(p)
+	view["pokemonIds"] = p.pokemonIDs()
+	return view
+}
+
+// playlistRequest は、プレイリストの作成・更新のリクエストです。
+type playlistRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Mode        string `json:"mode"`
+	PokemonIDs  []int  `json:"pokemonIds"`
+}
+
+// validate は、リクエストの内容を検証し、問題があれば列挙して返します。
+func (r *playlistRequest) validate() []string {
+	var problems []string
+	if r.Title == "" || len([]rune(r.Title)) > maxPlaylistTitleLength {
+		problems = append(problems, "title must be between 1 and 100 characters")
+	}
+	if len([]rune(r.Description)) > maxPlaylistDescLength {
+		problems = append(problems, "description must be at most 500 characters")
+	}
+	if r.Mode == "" {
+		r.Mode = quizModeStats
+	}
+	if !quizModes[r.Mode] {
+		problems = append(problems, fmt.Sprintf("unknown quiz mode %q", r.Mode))
+	}
+	if len(r.PokemonIDs) < minPlaylistPokemon || len(r.PokemonIDs) > maxPlaylistPokemon {
+		problems = append(problems, "pokemonIds must contain between 4 and 100 entries")
+	}
+	seen := make(map[int]bool)
+	for _, id := range r.PokemonIDs {
+		if seen[id] {
+			problems = append(problems, fmt.Sprintf("pokemon %d is listed more than once", id))
+		} else if _, ok := pokemonMapByID[id]; !ok {
+			problems = append(problems, fmt.Sprintf("pokemon %d does not exist in the current dataset", id))
+		}
+		seen[id] = true
+	}
+	return problems
+}
+
+// apply は、検証済みのリクエストの内容をプレイリストに反映します。
+func (r *playlistRequest) apply(p *Playlist) error {
+	data, err := json.Marshal(r.PokemonIDs)
+	if err != nil {
+		return err
+	}
+	p.Title = r.Title
+	p.Description = r.Description
+	p.Mode = r.Mode
+	p.PokemonIDs = string(data)
+	return nil
+}
+
+// findPlaylist は、URLパラメータのIDからプレイリストを取得します。
+func findPlaylist(c *gin.Context) (*Playlist, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist ID"})
+		return nil, false
+	}
+	var playlist Playlist
+	if err := db.First(&playlist, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return nil, false
+	}
+	return &playlist, true
+}
+
+// --- プレイリストのハンドラ ---
+
+// handleListPlaylists は、プレイリストの一覧を返します。
+func handleListPlaylists(c *gin.Context) {
+	var playlists []Playlist
+	if err := db.Order("id asc").Find(&playlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load playlists"})
+		return
+	}
+	result := make([]gin.H, len(playlists))
+	for i := range playlists {
+		result[i] = playlistView(&playlists[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handlePlayPlaylist は、プレイリストの順に出題するクイズセッションを開始します。
+func handlePlayPlaylist(c *gin.Context) {
+	playlist, ok := findPlaylist(c)
+	if !ok {
+		return
+	}
+	list := playlist.pokemon()
+	if len(list) < minPlaylistPokemon {
+		c.JSON(http.StatusConflict, gin.H{"error": "Playlist can no longer be used with the current dataset"})
+		return
+	}
+	id, err := newRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	userID, _ := optionalUserID(c)
+	now := time.Now()
+	session := &quizSession{
+		ID:            id,
+		UserID:        userID,
+		Mode:          playlist.Mode,
+		Type:          sessionTypePlaylist,
+		Accessible:    c.Query("accessible") == "true",
+		QuestionLimit: len(list),
+		PlaylistID:    playlist.ID,
+		playlist:      list,
+		CreatedAt:     now,
+		updatedAt:     now,
+	}
+
+	quizSessionsMu.Lock()
+	quizSessions[session.ID] = session
+	quizSessionsMu.Unlock()
+
+	response := session.state()
+	response["playlist"] = playlistView(playlist)
+	c.JSON(http.StatusCreated, response)
+}
+
+// handleAdminListPlaylists は、ポケモンを含めたプレイリストの一覧を返します（管理者用）。
+func handleAdminListPlaylists(c *gin.Context) {
+	var playlists []Playlist
+	if err := db.Order("id asc").Find(&playlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load playlists"})
+		return
+	}
+	result := make([]gin.H, len(playlists))
+	for i := range playlists {
+		result[i] = playlistAdminView(&playlists[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleCreatePlaylist は、新しいプレイリストを作成します（管理者用）。
+func handleCreatePlaylist(c *gin.Context) {
+	var req playlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if problems := req.validate(); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid playlist", "problems": problems})
+		return
+	}
+	var playlist Playlist
+	if err := req.apply(&playlist); err != nil || db.Create(&playlist).Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save playlist"})
+		return
+	}
+	c.JSON(http.StatusCreated, playlistAdminView(&playlist))
+}
+
+// handleUpdatePlaylist は、プレイリストの内容を置き換えます（管理者用）。
+func handleUpdatePlaylist(c *gin.Context) {
+	playlist, ok := findPlaylist(c)
+	if !ok {
+		return
+	}
+	var req playlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if problems := req.validate(); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid playlist", "problems": problems})
+		return
+	}
+	if err := req.apply(playlist); err != nil || db.Save(playlist).Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save playlist"})
+		return
+	}
+	c.JSON(http.StatusOK, playlistAdminView(playlist))
+}
+
+// handleDeletePlaylist は、プレイリストを削除します（管理者用）。遊んでいる途中のセッションはそのまま続けられます。
+func handleDeletePlaylist(c *gin.Context) {
+	playlist, ok := findPlaylist(c)
+	if !ok {
+		return
+	}
+	if err := db.Delete(playlist).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete playlist"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
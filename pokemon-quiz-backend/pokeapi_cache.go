@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- PokeAPIのレスポンスのキャッシュ ---
+
+// PokeAPIのレスポンスをURLごとにディスクに保存し、再取得のたびに同じデータを取りに行かないようにします。
+// Cache-Control の max-age の間はディスクのデータをそのまま使い、それを過ぎたら ETag を付けて更新の有無だけを確認します。
+// POKEAPI_CACHE=off で無効にでき、保存先は POKEAPI_CACHE_DIR で変更できます。
+
+const (
+	defaultPokeAPICacheDir = ".pokeapi-cache"
+	defaultPokeAPICacheTTL = 24 * time.Hour // max-age がないレスポンスを新しいとみなす期間
+)
+
+// ディスクに保存するレスポンス
+type cachedResponse struct {
+	URL         string    `json:"url"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	StoredAt    time.Time `json:"storedAt"`
+	MaxAge      int       `json:"maxAge"` // 秒
+	Body        []byte    `json:"body"`
+}
+
+// isFresh は、更新を確認せずに使ってよい期間内かどうかを返します。
+func (r *cachedResponse) isFresh(now time.Time) bool {
+	return now.Before(r.StoredAt.Add(time.Duration(r.MaxAge) * time.Second))
+}
+
+// response は、保存したレスポンスから http.Response を組み立てます。
+func (r *cachedResponse) response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	if r.ETag != "" {
+		header.Set("ETag", r.ETag)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// レスポンスをディスクにキャッシュする http.RoundTripper
+type cachingTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+// newPokeAPITransport は、PokeAPI用のクライアントが使う http.RoundTripper を組み立てます。
+// オフライン開発モードでは記録したレスポンスを返し、記録するときはキャッシュから返したレスポンスも記録する。
+func newPokeAPITransport() http.RoundTripper {
+	switch {
+	case offlineDev:
+		// 記録したレスポンスを返すだけなので、ディスクのキャッシュは使わない
+		return instrumentedTransport{base: fixtureTransport{dir: pokeAPIFixtureDir()}}
+	case recordFixtures:
+		return recordingTransport{base: newCachingPokeAPITransport(), dir: pokeAPIFixtureDir()}
+	}
+	return newCachingPokeAPITransport()
+}
+
+// newCachingPokeAPITransport は、レスポンスをディスクにキャッシュする http.RoundTripper を組み立てます。
+func newCachingPokeAPITransport() http.RoundTripper {
+	var transport http.RoundTripper = instrumentedTransport{base: http.DefaultTransport}
+	if os.Getenv("POKEAPI_CACHE") == "off" {
+		return transport
+	}
+	dir := os.Getenv("POKEAPI_CACHE_DIR")
+	if dir == "" {
+		dir = defaultPokeAPICacheDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Failed to create PokeAPI cache directory %s, caching disabled: %v", dir, err)
+		return transport
+	}
+	return cachingTransport{base: transport, dir: dir}
+}
+
+// path は、URLに対応するキャッシュファイルのパスを返します。
+func (t cachingTransport) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load は、URLのキャッシュを読み込みます。なければ nil を返します。
+func (t cachingTransport) load(url string) *cachedResponse {
+	data, err := os.ReadFile(t.path(url))
+	if err != nil {
+		return nil
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != url {
+		return nil
+	}
+	return &cached
+}
+
+// store は、レスポンスをキャッシュに保存します。同じURLを同時に保存しても壊れないよう、一時ファイルから置き換えます。
+func (t cachingTransport) store(cached *cachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(t.dir, "tmp-*")
+	if err != nil {
+		log.Printf("Failed to write PokeAPI cache: %v", err)
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), t.path(cached.URL)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// cacheMaxAge は、Cache-Control ヘッダーの max-age を返します。なければ既定の期間を返します。
+func cacheMaxAge(header http.Header) int {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if v, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+				return n
+			}
+		}
+	}
+	return int(defaultPokeAPICacheTTL / time.Second)
+}
+
+func (t cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	url := req.URL.String()
+	now := time.Now()
+	cached := t.load(url)
+	if cached != nil && cached.isFresh(now) {
+		pokeAPIMetrics.observe(pokeAPIEndpoint(req.URL.Path), "cache_hit", time.Since(now))
+		return cached.response(req), nil
+	}
+
+	// 古くなったキャッシュは ETag で更新の有無を確認する
+	if cached != nil && cached.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		cached.StoredAt = now
+		cached.MaxAge = cacheMaxAge(resp.Header)
+		t.store(cached)
+		return cached.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.store(&cachedResponse{
+		URL:         url,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+		StoredAt:    now,
+		MaxAge:      cacheMaxAge(resp.Header),
+		Body:        body,
+	})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
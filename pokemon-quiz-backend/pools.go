@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- カスタムプール（自分で選んだポケモンの一覧） ---
+
+// ログインユーザーが名前を付けてポケモンの一覧を保存し、/quiz?region=pool:<id> でその一覧から出題できるようにします。
+// プリセットと違って出題形式などは保存しないので、タイプの指定や形式など他のパラメータと組み合わせて使えます。
+
+const (
+	poolRegionPrefix  = "pool:"
+	minPoolPokemon    = 4
+	maxPoolPokemon    = 2000
+	maxPoolsPerUser   = 50
+	maxPoolNameLength = 50
+)
+
+// --- データベースモデル ---
+
+// ユーザーが作成したポケモンの一覧
+type QuizPool struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	PokemonIDs string `gorm:"type:text;not null"` // ポケモンIDのJSON配列
+}
+
+// pokemonIDs は、プールのポケモンIDを返します。
+func (p *QuizPool) pokemonIDs() []int {
+	var ids []int
+	json.Unmarshal([]byte(p.PokemonIDs), &ids)
+	return ids
+}
+
+// pool は、プールのポケモンのうち、現在のデータにいるものを返します。
+func (p *QuizPool) pool() []*Pokemon {
+	ids := p.pokemonIDs()
+	list := make([]*Pokemon, 0, len(ids))
+	for _, id := range ids {
+		if pokemon, ok := pokemonMapByID[id]; ok {
+			list = append(list, pokemon)
+		}
+	}
+	return list
+}
+
+// poolView は、クライアントに返すプールの情報を組み立てます。
+func poolView(p *QuizPool) gin.H {
+	return gin.H{
+		"id":         p.ID,
+		"name":       p.Name,
+		"region":     poolRegionPrefix + strconv.Itoa(int(p.ID)),
+		"pokemonIds": p.pokemonIDs(),
+	}
+}
+
+// validatePool は、プールの名前とポケモンIDを検証し、問題があれば列挙して返します。
+func validatePool(name string, ids []int) []string {
+	var problems []string
+	if name == "" || len([]rune(name)) > maxPoolNameLength {
+		problems = append(problems, "name must be between 1 and 50 characters")
+	} else if checkName(name) != nil {
+		problems = append(problems, "name contains a word that is not allowed")
+	}
+	if len(ids) < minPoolPokemon || len(ids) > maxPoolPokemon {
+		problems = append(problems, "pokemonIds must contain between 4 and 2000 entries")
+	}
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if seen[id] {
+			problems = append(problems, fmt.Sprintf("pokemon %d is listed more than once", id))
+		} else if _, ok := pokemonMapByID[id]; !ok {
+			problems = append(problems, fmt.Sprintf("pokemon %d does not exist in the current dataset", id))
+		}
+		seen[id] = true
+	}
+	return problems
+}
+
+// poolFromRegion は、region が pool:<id> の形式ならプールのIDを返します。
+func poolFromRegion(region string) (string, bool) {
+	return strings.CutPrefix(region, poolRegionPrefix)
+}
+
+// findMyPool は、IDからログインユーザーのプールを取得します。見つからなければエラーを返して false を返します。
+func findMyPool(c *gin.Context, idParam string) (*QuizPool, bool) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pool ID"})
+		return nil, false
+	}
+	userID, exists := optionalUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return nil, false
+	}
+	var pool QuizPool
+	if err := db.First(&pool, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return nil, false
+	}
+	return &pool, true
+}
+
+// --- プールのハンドラ ---
+
+// handleListPools は、ログインユーザーのプールの一覧を返します。
+func handleListPools(c *gin.Context) {
+	var pools []QuizPool
+	if err := db.Where("user_id = ?", c.MustGet("userID").(uint)).Order("id asc").Find(&pools).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load pools"})
+		return
+	}
+	result := make([]gin.H, len(pools))
+	for i := range pools {
+		result[i] = poolView(&pools[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleCreatePool は、新しいプールを作成します。
+func handleCreatePool(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name"`
+		PokemonIDs []int  `json:"pokemonIds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if problems := validatePool(req.Name, req.PokemonIDs); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid pool", "problems": problems})
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	var count int64
+	if err := db.Model(&QuizPool{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pool"})
+		return
+	}
+	if count >= maxPoolsPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many pools, delete one first"})
+		return
+	}
+	data, err := json.Marshal(req.PokemonIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pool"})
+		return
+	}
+	pool := QuizPool{UserID: userID, Name: req.Name, PokemonIDs: string(data)}
+	if err := db.Create(&pool).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pool"})
+		return
+	}
+	c.JSON(http.StatusCreated, poolView(&pool))
+}
+
+// handleDeletePool は、プールを削除します。
+func handleDeletePool(c *gin.Context) {
+	pool, ok := findMyPool(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := db.Delete(pool).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pool"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
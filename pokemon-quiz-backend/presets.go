@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- プリセット（自分用の出題設定） ---
+
+// 出題するパック・地方・形式と、出題するポケモンの一覧（カスタムプール）を名前を付けて保存します。
+// 保存したプリセットはJSONとして書き出して他のユーザーと共有でき、取り込むときは現在のデータと照合します。
+
+const (
+	presetExportFormat  = "pokequiz-preset"
+	presetExportVersion = 1
+	maxPresetPokemon    = 2000
+	maxPresetNameLength = 50
+)
+
+// --- データベースモデル ---
+
+// ユーザーが保存した出題設定
+type QuizPreset struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	Pack       string `gorm:"not null"`
+	Region     string // カスタムプールがない場合に出題する地方
+	Mode       string `gorm:"not null"`
+	PokemonIDs string `gorm:"type:text"` // カスタムプールのポケモンIDのJSON配列（空なら地方から出題）
+}
+
+// 書き出したプリセットのJSON形式
+type presetExport struct {
+	Format  string                `json:"format"`
+	Version int                   `json:"version"`
+	Name    string                `json:"name"`
+	Pack    string                `json:"pack"`
+	Region  string                `json:"region,omitempty"`
+	Mode    string                `json:"mode"`
+	Pokemon []presetExportPokemon `json:"pokemon,omitempty"`
+}
+
+// 書き出したプリセットに含めるポケモン。名前はデータが変わっていないか照合するために含める
+type presetExportPokemon struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	EnglishName string `json:"englishName,omitempty"`
+}
+
+// validatePreset は、プリセットの内容が現在のデータで出題できるか検証します。
+// 問題があれば、その内容を列挙して返します。
+func validatePreset(p *presetExport) []string {
+	var problems []string
+	if p.Name == "" || len([]rune(p.Name)) > maxPresetNameLength {
+		problems = append(problems, "name must be between 1 and 50 characters")
+	} else if checkName(p.Name) != nil {
+		problems = append(problems, "name contains a word that is not allowed")
+	}
+	if p.Mode == "" {
+		p.Mode = quizModeStats
+	}
+	if !quizModes[p.Mode] {
+		problems = append(problems, fmt.Sprintf("unknown quiz mode %q", p.Mode))
+	}
+	pack, ok := lookupPack(p.Pack)
+	if !ok {
+		return append(problems, fmt.Sprintf("unknown content pack %q", p.Pack))
+	}
+	p.Pack = pack.ID
+
+	if len(p.Pokemon) == 0 {
+		if p.Region == "" {
+			p.Region = "all"
+		}
+		if len(pack.regions[p.Region]) < 4 {
+			problems = append(problems, fmt.Sprintf("region %q is unknown or has too few entries", p.Region))
+		}
+		return problems
+	}
+
+	if len(p.Pokemon) < 4 || len(p.Pokemon) > maxPresetPokemon {
+		problems = append(problems, "pokemon must contain between 4 and 2000 entries")
+	}
+	seen := make(map[int]bool)
+	for _, entry := range p.Pokemon {
+		current, ok := pack.byID[entry.ID]
+		switch {
+		case seen[entry.ID]:
+			problems = append(problems, fmt.Sprintf("pokemon %d is listed more than once", entry.ID))
+		case !ok:
+			problems = append(problems, fmt.Sprintf("pokemon %d does not exist in the current dataset", entry.ID))
+		case entry.Name != "" && entry.Name != current.Name:
+			problems = append(problems, fmt.Sprintf("pokemon %d is %q in the current dataset, not %q", entry.ID, current.Name, entry.Name))
+		}
+		seen[entry.ID] = true
+	}
+	return problems
+}
+
+// toExport は、保存したプリセットを書き出し用の形式に変換します。
+func (p *QuizPreset) toExport() presetExport {
+	export := presetExport{
+		Format:  presetExportFormat,
+		Version: presetExportVersion,
+		Name:    p.Name,
+		Pack:    p.Pack,
+		Region:  p.Region,
+		Mode:    p.Mode,
+	}
+	pack, _ := lookupPack(p.Pack)
+	for _, id := range p.pokemonIDs() {
+		entry := presetExportPokemon{ID: id}
+		if pack != nil {
+			if pokemon, ok := pack.byID[id]; ok {
+				entry.Name = pokemon.Name
+				entry.EnglishName = pokemon.EnglishName
+			}
+		}
+		export.Pokemon = append(export.Pokemon, entry)
+	}
+	return export
+}
+
+// pokemonIDs は、カスタムプールのポケモンIDを返します。
+func (p *QuizPreset) pokemonIDs() []int {
+	var ids []int
+	if p.PokemonIDs != "" {
+		json.Unmarshal([]byte(p.PokemonIDs), &ids)
+	}
+	return ids
+}
+
+// pool は、プリセットで出題するポケモンの一覧を返します。
+func (p *QuizPreset) pool() ([]*Pokemon, bool) {
+	pack, ok := lookupPack(p.Pack)
+	if !ok {
+		return nil, false
+	}
+	ids := p.pokemonIDs()
+	if len(ids) == 0 {
+		return pack.regions[p.Region], true
+	}
+	pool := make([]*Pokemon, 0, len(ids))
+	for _, id := range ids {
+		if pokemon, ok := pack.byID[id]; ok {
+			pool = append(pool, pokemon)
+		}
+	}
+	return pool, true
+}
+
+// presetView は、クライアントに返すプリセットの情報を組み立てます。
+func presetView(p *QuizPreset) gin.H {
+	return gin.H{
+		"id":         p.ID,
+		"name":       p.Name,
+		"pack":       p.Pack,
+		"region":     p.Region,
+		"mode":       p.Mode,
+		"pokemonIds": p.pokemonIDs(),
+	}
+}
+
+// savePreset は、検証済みの内容をユーザーのプリセットとして保存します。
+func savePreset(userID uint, export *presetExport) (*QuizPreset, error) {
+	preset := QuizPreset{
+		UserID: userID,
+		Name:   export.Name,
+		Pack:   export.Pack,
+		Region: export.Region,
+		Mode:   export.Mode,
+	}
+	if len(export.Pokemon) > 0 {
+		ids := make([]int, len(export.Pokemon))
+		for i, entry := range export.Pokemon {
+			ids[i] = entry.ID
+		}
+		data, err := json.Marshal(ids)
+		if err != nil {
+			return nil, err
+		}
+		preset.PokemonIDs = string(data)
+		preset.Region = ""
+	}
+	if err := db.Create(&preset).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// findMyPreset は、URLパラメータのIDからログインユーザーのプリセットを取得します。
+func findMyPreset(c *gin.Context, idParam string) (*QuizPreset, bool) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preset ID"})
+		return nil, false
+	}
+	userID, exists := optionalUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+		return nil, false
+	}
+	var preset QuizPreset
+	if err := db.First(&preset, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+		return nil, false
+	}
+	return &preset, true
+}
+
+// --- プリセットのハンドラ ---
+
+// handleListPresets は、ログインユーザーのプリセットの一覧を返します。
+func handleListPresets(c *gin.Context) {
+	var presets []QuizPreset
+	if err := db.Where("user_id = ?", c.MustGet("userID").(uint)).Order("id asc").Find(&presets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load presets"})
+		return
+	}
+	result := make([]gin.H, len(presets))
+	for i := range presets {
+		result[i] = presetView(&presets[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleCreatePreset は、新しいプリセットを作成します。
+func handleCreatePreset(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name"`
+		Pack       string `json:"pack"`
+		Region     string `json:"region"`
+		Mode       string `json:"mode"`
+		PokemonIDs []int  `json:"pokemonIds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	export := presetExport{Name: req.Name, Pack: req.Pack, Region: req.Region, Mode: req.Mode}
+	for _, id := range req.PokemonIDs {
+		export.Pokemon = append(export.Pokemon, presetExportPokemon{ID: id})
+	}
+	if problems := validatePreset(&export); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid preset", "problems": problems})
+		return
+	}
+	preset, err := savePreset(c.MustGet("userID").(uint), &export)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preset"})
+		return
+	}
+	c.JSON(http.StatusCreated, presetView(preset))
+}
+
+// handleExportPreset は、プリセットを共有できるJSONとして書き出します。
+func handleExportPreset(c *gin.Context) {
+	preset, ok := findMyPreset(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, preset.toExport())
+}
+
+// handleImportPreset は、他のユーザーが書き出したプリセットを検証して取り込みます。
+func handleImportPreset(c *gin.Context) {
+	var export presetExport
+	if err := c.ShouldBindJSON(&export); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if export.Format != presetExportFormat {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not a pokequiz preset"})
+		return
+	}
+	if export.Version != presetExportVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported preset version"})
+		return
+	}
+	if problems := validatePreset(&export); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Preset does not match the current dataset", "problems": problems})
+		return
+	}
+	preset, err := savePreset(c.MustGet("userID").(uint), &export)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preset"})
+		return
+	}
+	c.JSON(http.StatusCreated, presetView(preset))
+}
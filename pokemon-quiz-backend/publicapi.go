@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 公開API ---
+
+// コミュニティサイトの制作者向けに、読み取り専用の統計APIをAPIキー付きで提供します。
+// APIキーはログインユーザーが発行し、リクエストの X-API-Key ヘッダーに付けて使います。
+// キーごとにレート制限がかかり、利用状況は発行したユーザーの /me/usage に記録されます。
+
+const (
+	apiKeyPrefix      = "pq_"
+	maxAPIKeysPerUser = 5
+	publicAPIRate     = 60 // 1分あたりのリクエスト数
+	maxHardestLimit   = 50
+)
+
+// --- データベースモデル ---
+
+// ユーザーが発行したAPIキー。キーそのものは保存せず、ハッシュ値だけを保存する
+type APIKey struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	KeyHash    string `gorm:"uniqueIndex;not null"`
+	Prefix     string `gorm:"not null"` // 一覧で見分けるためのキーの先頭部分
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// hashAPIKey は、APIキーのハッシュ値を返します。
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyView は、クライアントに返すAPIキーの情報を組み立てます（キーそのものは含めない）。
+func apiKeyView(k *APIKey) gin.H {
+	return gin.H{
+		"id":         k.ID,
+		"name":       k.Name,
+		"prefix":     k.Prefix,
+		"createdAt":  k.CreatedAt,
+		"lastUsedAt": k.LastUsedAt,
+		"revoked":    k.RevokedAt != nil,
+	}
+}
+
+// apiKeyMiddleware は、X-API-Key ヘッダーのAPIキーを検証します。
+// 有効なキーであれば、発行したユーザーのIDとキーのIDをコンテキストに設定します。
+func apiKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "X-API-Key header is required"})
+			return
+		}
+		var apiKey APIKey
+		found := db.Where("key_hash = ?", hashAPIKey(key)).Limit(1).Find(&apiKey).RowsAffected > 0
+		if !found || apiKey.RevokedAt != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		now := time.Now()
+		db.Model(&apiKey).UpdateColumn("last_used_at", now)
+
+		c.Set("userID", apiKey.UserID)
+		c.Set("apiKeyID", apiKey.ID)
+		c.Next()
+	}
+}
+
+// --- APIキーのハンドラ ---
+
+// handleListAPIKeys は、ログインユーザーが発行したAPIキーの一覧を返します。
+func handleListAPIKeys(c *gin.Context) {
+	var keys []APIKey
+	if err := db.Where("user_id = ?", c.MustGet("userID").(uint)).Order("id asc").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load API keys"})
+		return
+	}
+	result := make([]gin.H, len(keys))
+	for i := range keys {
+		result[i] = apiKeyView(&keys[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleCreateAPIKey は、新しいAPIキーを発行します。キーそのものはこのレスポンスでしか返しません。
+func handleCreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API key name is required"})
+		return
+	}
+	userID := c.MustGet("userID").(uint)
+	var active int64
+	db.Model(&APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active)
+	if active >= maxAPIKeysPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "You can have at most 5 active API keys"})
+		return
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+	apiKey := APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		KeyHash: hashAPIKey(key),
+		Prefix:  key[:len(apiKeyPrefix)+6],
+	}
+	if err := db.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	response := apiKeyView(&apiKey)
+	response["key"] = key
+	c.JSON(http.StatusCreated, response)
+}
+
+// handleRevokeAPIKey は、APIキーを無効にします。
+func handleRevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+	var apiKey APIKey
+	if err := db.First(&apiKey, "id = ? AND user_id = ?", id, c.MustGet("userID").(uint)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		if err := db.Save(&apiKey).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, apiKeyView(&apiKey))
+}
+
+// --- 公開APIのハンドラ ---
+
+// handlePublicGlobalStats は、全ユーザーの回答数と正答率を返します。
+func handlePublicGlobalStats(c *gin.Context) {
+	totals, err := users.GlobalTotals()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+		return
+	}
+	accuracy := 0.0
+	if totals.Questions > 0 {
+		accuracy = float64(totals.Correct) / float64(totals.Questions)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"players":   totals.Players,
+		"questions": totals.Questions,
+		"correct":   totals.Correct,
+		"accuracy":  accuracy,
+		"pokemon":   len(pokemonMapByID),
+	})
+}
+
+// handlePublicHardestPokemon は、間違えたままにしているユーザーが多いポケモンを返します。
+func handlePublicHardestPokemon(c *gin.Context) {
+	limit := 10
+	if q := c.Query("limit"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n < 1 || n > maxHardestLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50"})
+			return
+		}
+		limit = n
+	}
+
+	wrongLists, err := users.WrongAnswerLists()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+		return
+	}
+	counts := make(map[int]int)
+	for _, list := range wrongLists {
+		var ids []int
+		if json.Unmarshal([]byte(list), &ids) != nil {
+			continue
+		}
+		for _, id := range ids {
+			counts[id]++
+		}
+	}
+
+	type hardEntry struct {
+		ID      int    `json:"id"`
+		Name    string `json:"name"`
+		Players int    `json:"players"` // このポケモンを間違えたままにしているユーザー数
+	}
+	entries := make([]hardEntry, 0, len(counts))
+	for id, n := range counts {
+		if p, ok := pokemonMapByID[id]; ok {
+			entries = append(entries, hardEntry{ID: id, Name: p.Name, Players: n})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Players != entries[j].Players {
+			return entries[i].Players > entries[j].Players
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// handlePublicDailyMeta は、今日のデイリーチャレンジの概要を返します（問題や正解は含めない）。
+func handlePublicDailyMeta(c *gin.Context) {
+	date := dateKey(time.Now())
+	var override DailyOverride
+	hasOverride := db.Where("date = ?", date).Limit(1).Find(&override).RowsAffected > 0
+	meta := gin.H{
+		"date":      date,
+		"questions": dailyChallengeSize,
+		"region":    dailyChallengeRegion,
+		"special":   hasOverride,
+	}
+	if hasOverride {
+		meta["note"] = override.Note
+	}
+	c.JSON(http.StatusOK, meta)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 問題の token ---
+
+// /quiz の問題に正解のポケモンのIDを含めると、/answer に好きなIDと名前を送って答えを総当たりで調べたり、
+// 出題される前に答えを覚えたりできてしまいます。そこで /quiz では正解のIDの代わりに、
+// 問題の内容（questionId・正解・出題形式・選択肢・期限）を暗号化して改ざんを検出できるようにした token（questionToken）を返し、
+// /answer では token を受け取って答え合わせをします。
+// token は1回しか使えず（answer_nonces.go）、選択肢にない名前で答えることもできません。
+// token はサーバーの鍵で暗号化するので、中身をクライアントから読んだり書き換えたりすることはできません。
+//
+// 問題には回答の締め切り（expiresAt）を付け、締め切りを過ぎた回答は不正解として答え合わせします（応答の timedOut が true になる）。
+// 締め切りは /quiz の ?timeLimit=（秒）で問題ごとに指定でき、指定がなければ QUESTION_DEADLINE（既定は10分）です。
+// 通信にかかる時間の分だけ、締め切りから answerDeadlineGrace までは間に合ったものとして扱います。
+
+const (
+	questionTokenPurpose = "pokequiz-question"
+	// questionTokenTTL は、問題の token の有効期限です（ヒントのために覚えておく期間と同じ）。
+	questionTokenTTL = servedQuestionTTL
+
+	defaultQuestionDeadline = 10 * time.Minute
+	maxQuestionTimeLimit    = 600 // ?timeLimit= の上限（秒）
+	answerDeadlineGrace     = 2 * time.Second
+)
+
+// main で QUESTION_DEADLINE から設定する（token の有効期限より長くはできない）
+var questionDeadline = defaultQuestionDeadline
+
+var errInvalidSealedToken = errors.New("invalid token")
+
+// token に入れる問題の内容
+type questionTokenClaims struct {
+	QuestionID string   `json:"q"`
+	PokemonID  int      `json:"p"`
+	Mode       string   `json:"m"`
+	Pack       string   `json:"k,omitempty"`
+	Options    []string `json:"o,omitempty"` // 名前で答える形式の選択肢
+	OptionIDs  []int    `json:"i,omitempty"` // 種族値の合計を比べる形式の選択肢
+	Seed       string   `json:"s,omitempty"` // 種族値を当てる形式の seed と選択肢の数
+	Count      int      `json:"n,omitempty"`
+	Deadline   int64    `json:"d"` // 回答の締め切り（UnixMilli）
+	ExpiresAt  int64    `json:"e"`
+}
+
+// sealJSON は、v をJSONにして、用途ごとの鍵のAES-GCMで暗号化した token を作ります。
+func sealJSON(purpose string, v any) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(derivedSigningKey(purpose))
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// openJSON は、sealJSON で作った token を復号して v に読み込みます。改ざんされた token はエラーにします。
+func openJSON(purpose, token string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return errInvalidSealedToken
+	}
+	block, err := aes.NewCipher(derivedSigningKey(purpose))
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	if len(data) < aead.NonceSize() {
+		return errInvalidSealedToken
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil || json.Unmarshal(plain, v) != nil {
+		return errInvalidSealedToken
+	}
+	return nil
+}
+
+// addQuestionToken は、registerServedQuestion で questionId を付けた問題に token と回答の締め切りを加え、正解のIDを問題から取り除きます。
+// timeLimit が0なら、締め切りは questionDeadline 後にします。
+func addQuestionToken(question gin.H, pokemon *Pokemon, pack string, timeLimit time.Duration) error {
+	if timeLimit <= 0 {
+		timeLimit = questionDeadline
+	}
+	now := time.Now()
+	deadline := now.Add(min(timeLimit, questionTokenTTL))
+	claims := questionTokenClaims{
+		PokemonID: pokemon.ID,
+		Pack:      pack,
+		Deadline:  deadline.UnixMilli(),
+		ExpiresAt: now.Add(questionTokenTTL).Unix(),
+	}
+	claims.QuestionID, _ = question["questionId"].(string)
+	claims.Mode, _ = question["mode"].(string)
+	claims.Options, _ = question["options"].([]string)
+	claims.OptionIDs, _ = question["optionIds"].([]int)
+	claims.Seed, _ = question["seed"].(string)
+	claims.Count, _ = question["optionCount"].(int)
+
+	token, err := sealJSON(questionTokenPurpose, claims)
+	if err != nil {
+		return err
+	}
+	question["questionToken"] = token
+	question["expiresAt"] = deadline
+	delete(question, "id") // 正解が分からないようにIDは返さない
+	return nil
+}
+
+// parseQuestionToken は、token を復号して問題の内容を返します。改ざんされた token や期限切れの token はエラーにします。
+func parseQuestionToken(token string) (questionTokenClaims, error) {
+	var claims questionTokenClaims
+	if err := openJSON(questionTokenPurpose, token, &claims); err != nil {
+		return claims, err
+	}
+	if claims.QuestionID == "" || time.Now().Unix() > claims.ExpiresAt {
+		return claims, errInvalidSealedToken
+	}
+	return claims, nil
+}
+
+// timedOut は、締め切りを過ぎてから答えた場合に true を返します。
+func (q questionTokenClaims) timedOut(now time.Time) bool {
+	return now.After(time.UnixMilli(q.Deadline).Add(answerDeadlineGrace))
+}
+
+// markQuestionAnswered は、問題の答え合わせが済んだことを記録します。既に答え合わせが済んでいれば false を返します。
+func markQuestionAnswered(claims questionTokenClaims) bool {
+	return consumeAnswerNonce(questionAnswerNonce(claims.QuestionID), time.Unix(claims.ExpiresAt, 0))
+}
+
+// questionAnswerNonce は、/quiz の問題の答え合わせ（またはスキップ）が済んだことを表す nonce を返します。
+func questionAnswerNonce(questionID string) string {
+	return "quiz:" + questionID
+}
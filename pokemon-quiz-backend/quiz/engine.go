@@ -0,0 +1,134 @@
+// Package quiz は、ポケモンクイズの出題と答え合わせをHTTPを通さずに使えるようにしたものです。
+//
+// サーバー（pokemon-quiz-backend）の選択肢の作り方や回答の比べ方と同じ手順で出題するので、
+// コマンドラインのクイズや Discord のボットなど、他の Go のプログラムから同じクイズを組み込めます。
+//
+//	pokemon, err := quiz.LoadPokemonFile("pokemon.json")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	engine := quiz.NewEngine(pokemon)
+//	q, err := engine.NewQuestion("kanto")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Println(q.Pokemon.Stats, q.Options)
+//	fmt.Println(q.Check("フシギダネ"))
+package quiz
+
+import (
+	"errors"
+	"sort"
+)
+
+// --- クイズのエンジン ---
+
+// 既定の選択肢の数（サーバーの /quiz と同じ）
+const DefaultOptionCount = 4
+
+// 出題するポケモンがいないカテゴリを指定した場合のエラー
+var ErrNoPokemon = errors.New("no pokemon in the category")
+
+// Engine は、読み込んだポケモンのデータから種族値のクイズを出題します。複数の goroutine から同時に使えます。
+type Engine struct {
+	pokemon     map[int]*Pokemon
+	byCategory  map[string][]*Pokemon
+	index       IndexFunc
+	optionCount int
+}
+
+// EngineOption は、NewEngine に渡す設定です。
+type EngineOption func(*Engine)
+
+// WithIndex は、出題と選択肢に使う乱数を変えます（シードを固定して同じ問題を再現したい場合など）。
+// 同時に使う場合、f は goroutine セーフである必要があります。
+func WithIndex(f IndexFunc) EngineOption {
+	return func(e *Engine) { e.index = f }
+}
+
+// WithOptionCount は、正解を含めた選択肢の数を変えます。
+func WithOptionCount(n int) EngineOption {
+	return func(e *Engine) {
+		if n >= 2 {
+			e.optionCount = n
+		}
+	}
+}
+
+// NewEngine は、図鑑番号をキーにしたポケモンの一覧からエンジンを作ります。
+// ポケモンはカテゴリ（地方名や "mega" など）ごとと、全てをまとめた "all" に分けて出題します。
+func NewEngine(pokemon map[int]*Pokemon, opts ...EngineOption) *Engine {
+	e := &Engine{
+		pokemon:     pokemon,
+		byCategory:  make(map[string][]*Pokemon),
+		index:       CryptoIndex,
+		optionCount: DefaultOptionCount,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	for _, p := range pokemon {
+		if p.Category != "" {
+			e.byCategory[p.Category] = append(e.byCategory[p.Category], p)
+		}
+		e.byCategory["all"] = append(e.byCategory["all"], p)
+	}
+	// 同じ乱数で同じ問題になるよう、図鑑番号の順に並べておく
+	for _, list := range e.byCategory {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+	return e
+}
+
+// Categories は、出題できるカテゴリを名前の順に返します。
+func (e *Engine) Categories() []string {
+	names := make([]string, 0, len(e.byCategory))
+	for name := range e.byCategory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pokemon は、図鑑番号のポケモンを返します。
+func (e *Engine) Pokemon(id int) (*Pokemon, bool) {
+	p, ok := e.pokemon[id]
+	return p, ok
+}
+
+// Question は、出題した問題です。Pokemon は答えなので、利用者に見せるのはタイプ・高さ・重さ・種族値だけにしてください。
+type Question struct {
+	Pokemon *Pokemon
+	Options []string
+}
+
+// NewQuestion は、カテゴリ（空なら "all"）からポケモンを1匹選び、種族値のクイズを出題します。
+func (e *Engine) NewQuestion(category string) (*Question, error) {
+	if category == "" {
+		category = "all"
+	}
+	list := e.byCategory[category]
+	if len(list) == 0 {
+		return nil, ErrNoPokemon
+	}
+	i, err := e.index(len(list))
+	if err != nil {
+		return nil, err
+	}
+	pokemon := list[i]
+	options, err := GenerateOptions(pokemon, list, OptionsConfig{
+		Count: e.optionCount,
+		Index: e.index,
+		// ヒントが正解と全く同じポケモンは見分けられないため選択肢から除外する
+		Skip: func(p *Pokemon) bool { return SameStatsHints(p, pokemon) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Question{Pokemon: pokemon, Options: options}, nil
+}
+
+// Check は、回答が正解かどうかを、サーバーと同じように正規化してから比べます。
+func (q *Question) Check(answer string) bool {
+	return IsSameAnswer(answer, q.Pokemon.Name)
+}
@@ -0,0 +1,36 @@
+package quiz
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// --- 回答の正規化 ---
+
+// キーボードや入力方法によって、同じ名前でも全角・半角や文字の表し方（濁点を別の文字で入力するなど）が違うことがあり、
+// そのまま == で比べると正しい回答が不正解になってしまいます。回答と正解はどちらも NormalizeAnswer で正規化してから比べます。
+// 選択肢から選ぶ形式でも、名前を入力する形式でも同じ比べ方をします。
+//   - Unicode の NFKC 正規化（全角英数字・半角カタカナ・結合文字の濁点などをそろえる）
+//   - ひらがなをカタカナにする
+//   - 前後の空白を取り除き、続いた空白を1つにまとめる
+//   - 英字を小文字にする（英語名で答える形式のため）
+
+// NormalizeAnswer は、回答を比べるための形にそろえます。
+func NormalizeAnswer(s string) string {
+	s = norm.NFKC.String(s)
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Map(func(r rune) rune {
+		// ひらがな（ぁ〜ゖ、ゝゞ）はカタカナと同じ並びなので、差を足せばカタカナになる
+		if (r >= 'ぁ' && r <= 'ゖ') || r == 'ゝ' || r == 'ゞ' {
+			return r + ('ァ' - 'ぁ')
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// IsSameAnswer は、回答が正解と同じかどうかを、正規化してから比べます。
+func IsSameAnswer(given, correct string) bool {
+	return NormalizeAnswer(given) == NormalizeAnswer(correct)
+}
@@ -0,0 +1,99 @@
+package quiz
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// --- 選択肢の作成 ---
+
+// IndexFunc は、0 以上 n 未満の乱数を返す関数です。同じ乱数を返せば、同じ選択肢を再現できます。
+type IndexFunc func(n int) (int, error)
+
+// CryptoIndex は、crypto/rand で 0 以上 n 未満の乱数を返します。
+func CryptoIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
+
+// OptionsConfig は、選択肢の作り方です。
+type OptionsConfig struct {
+	Count  int                   // 正解を含めた選択肢の数
+	Index  IndexFunc             // nil なら CryptoIndex を使う
+	NameOf func(*Pokemon) string // 選択肢にする名前（nil なら日本語名）
+	Skip   func(*Pokemon) bool   // true を返したポケモンは不正解の選択肢に出さない（nil なら全て使う）
+}
+
+// GenerateOptions は、正解のポケモンと選択肢プールからランダムな cfg.Count 個の選択肢を作ります。
+// プールの候補が足りない場合は、選択肢はその分だけ少なくなります。cfg.Index がエラーを返せば、そのエラーを返します。
+func GenerateOptions(pokemon *Pokemon, optionsPool []*Pokemon, cfg OptionsConfig) ([]string, error) {
+	index := cfg.Index
+	if index == nil {
+		index = CryptoIndex
+	}
+	nameOf := cfg.NameOf
+	if nameOf == nil {
+		nameOf = func(p *Pokemon) string { return p.Name }
+	}
+
+	// 選択肢プールから正解のポケモンを除外した新しいスライスを作成
+	// 名前が同じポケモン（正解と同じ名前や、同じ名前どうし）は、選択肢に同じ名前が並ばないよう1匹だけ残す
+	filteredOptionsPool := make([]*Pokemon, 0, len(optionsPool))
+	seenNames := map[string]bool{nameOf(pokemon): true}
+	for _, p := range optionsPool {
+		if name := nameOf(p); p.ID != pokemon.ID && !seenNames[name] && (cfg.Skip == nil || !cfg.Skip(p)) {
+			seenNames[name] = true
+			filteredOptionsPool = append(filteredOptionsPool, p)
+		}
+	}
+
+	distractors := cfg.Count - 1
+	if distractors > len(filteredOptionsPool) {
+		distractors = len(filteredOptionsPool)
+	}
+	options := make([]string, 0, distractors+1)
+	options = append(options, nameOf(pokemon))
+
+	// 候補からランダムに count-1 個選ぶ
+	// crypto/randには直接Shuffleがないため、手動でシャッフルします（必要な数だけ先頭に並べれば十分）
+	for i := 0; i < distractors; i++ {
+		k, err := index(len(filteredOptionsPool) - i)
+		if err != nil {
+			return nil, err
+		}
+		j := i + k
+		filteredOptionsPool[i], filteredOptionsPool[j] = filteredOptionsPool[j], filteredOptionsPool[i]
+		options = append(options, nameOf(filteredOptionsPool[i]))
+	}
+
+	// 表示しているタイプを持つ選択肢が正解だけだと消去法で答えられてしまうため、
+	// 候補にいれば、少なくとも1つは同じタイプを持つポケモンを不正解の選択肢に混ぜる
+	if distractors > 0 && len(pokemon.Types) > 0 && !AnySharesType(pokemon, filteredOptionsPool[:distractors]) {
+		sharing := make([]*Pokemon, 0)
+		for _, p := range filteredOptionsPool[distractors:] {
+			if SharesType(pokemon, p) {
+				sharing = append(sharing, p)
+			}
+		}
+		if len(sharing) > 0 {
+			k, err := index(len(sharing))
+			if err != nil {
+				return nil, err
+			}
+			options[distractors] = nameOf(sharing[k])
+		}
+	}
+
+	// 最終的な選択肢をシャッフル
+	for i := len(options) - 1; i > 0; i-- {
+		j, err := index(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		options[i], options[j] = options[j], options[i]
+	}
+	return options, nil
+}
@@ -0,0 +1,155 @@
+package quiz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// --- ポケモンのデータ ---
+
+// ポケモンの情報
+type Pokemon struct {
+	ID            int          `json:"id"`
+	Name          string       `json:"name"`        // 日本語名
+	NameReading   string       `json:"nameReading"` // 日本語名の読み（ふりがな用）
+	EnglishName   string       `json:"englishName"`
+	Category      string       `json:"category"` // "kanto", "mega", "gmax" など
+	Stats         PokemonStats `json:"stats"`
+	ImageURL      string       `json:"imageUrl"`
+	ShinyImageURL string       `json:"shinyImageUrl"` // 色違いの公式イラスト（なければドット絵）
+	Height        float32      `json:"height"`        // m単位
+	Weight        float32      `json:"weight"`        // kg単位
+	Types         []string     `json:"types"`         // 日本語のタイプ名
+	CaptureRate   int          `json:"captureRate"`   // 捕獲率 (0〜255)
+	EggGroups     []string     `json:"eggGroups"`     // 日本語のタマゴグループ名
+	GrowthRate    string       `json:"growthRate"`    // 日本語の経験値タイプ名
+	Abilities     []string     `json:"abilities"`     // 日本語の特性名（隠れ特性を含む）
+	Moves         []string     `json:"moves"`         // レベルアップで覚える技の日本語名
+	SpeciesID     int          `json:"speciesId"`     // 図鑑番号（フォルム違いは元のポケモンと同じ）
+	Genus         string       `json:"genus"`         // 分類（「たねポケモン」など）
+	FlavorText    string       `json:"flavorText"`    // 図鑑の説明文
+	EvolvesFrom   int          `json:"evolvesFrom"`   // 進化前のポケモンの図鑑番号（いなければ0）
+	Rarity        string       `json:"rarity"`        // "normal"・"legendary"（伝説）・"mythical"（幻）のいずれか
+}
+
+// ポケモンの種族値
+type PokemonStats struct {
+	HP        int `json:"hp"`
+	Attack    int `json:"attack"`
+	Defense   int `json:"defense"`
+	SpAttack  int `json:"sp_attack"`
+	SpDefense int `json:"sp_defense"`
+	Speed     int `json:"speed"`
+}
+
+// Total は、種族値の合計を返します。
+func (s PokemonStats) Total() int {
+	return s.HP + s.Attack + s.Defense + s.SpAttack + s.SpDefense + s.Speed
+}
+
+// フォルム違いのポケモンの図鑑番号に足す値（元の番号と重ならないように10000番台に割り当てる）
+const FormIDOffset = 10000
+
+// LoadPokemonFile は、サーバーが保存した pokemon.json（図鑑番号をキーにしたポケモンの一覧）を読み込みます。
+func LoadPokemonFile(path string) (map[int]*Pokemon, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pokemon data file: %w", err)
+	}
+	pokemon := make(map[int]*Pokemon)
+	if err := json.Unmarshal(data, &pokemon); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pokemon data: %w", err)
+	}
+	return pokemon, nil
+}
+
+// HasAbility は、ポケモンが指定した特性を持つことがあるかを返します。
+func HasAbility(p *Pokemon, ability string) bool {
+	for _, a := range p.Abilities {
+		if a == ability {
+			return true
+		}
+	}
+	return false
+}
+
+// SharesType は、2匹のポケモンに共通するタイプがあるかを返します。
+func SharesType(a, b *Pokemon) bool {
+	for _, t := range a.Types {
+		for _, u := range b.Types {
+			if t == u {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AnySharesType は、一覧に pokemon と共通するタイプを持つポケモンがいるかを返します。
+func AnySharesType(pokemon *Pokemon, list []*Pokemon) bool {
+	for _, p := range list {
+		if SharesType(pokemon, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// SameStatsHints は、種族値の問題で見せるヒント（タイプ・高さ・重さ・種族値）が2匹で全く同じかを返します。
+func SameStatsHints(a, b *Pokemon) bool {
+	if a.Stats != b.Stats || a.Height != b.Height || a.Weight != b.Weight || len(a.Types) != len(b.Types) {
+		return false
+	}
+	for i := range a.Types {
+		if a.Types[i] != b.Types[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// InEggGroup は、ポケモンが指定したタマゴグループに属するかを返します。
+func InEggGroup(p *Pokemon, eggGroup string) bool {
+	for _, g := range p.EggGroups {
+		if g == eggGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// LearnsMove は、ポケモンが指定した技をレベルアップで覚えるかを返します。
+func LearnsMove(p *Pokemon, move string) bool {
+	for _, m := range p.Moves {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterByType は、一覧から指定したタイプを持つポケモンだけを返します。
+func FilterByType(list []*Pokemon, typeName string) []*Pokemon {
+	filtered := make([]*Pokemon, 0, len(list))
+	for _, p := range list {
+		for _, t := range p.Types {
+			if t == typeName {
+				filtered = append(filtered, p)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// WithoutForms は、一覧からフォルム違い（図鑑番号が10000番台）を除いたポケモンを返します。
+func WithoutForms(list []*Pokemon) []*Pokemon {
+	filtered := make([]*Pokemon, 0, len(list))
+	for _, p := range list {
+		if p.ID < FormIDOffset {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,157 @@
+package quiz
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testPokemon は、タイプと種族値の違うポケモンを n 匹作ります（1〜n 番、カテゴリは kanto）。
+func testPokemon(n int) map[int]*Pokemon {
+	types := []string{"ほのお", "みず", "くさ", "でんき"}
+	pokemon := make(map[int]*Pokemon, n)
+	for id := 1; id <= n; id++ {
+		pokemon[id] = &Pokemon{
+			ID: id, Name: "ポケ" + string(rune('A'+id-1)), Category: "kanto",
+			Types: []string{types[id%len(types)]}, Stats: PokemonStats{HP: id},
+		}
+	}
+	return pokemon
+}
+
+// sequenceIndex は、呼ばれるたびに 0 から順に n 未満の値を返す IndexFunc を返します（同じ選択肢を再現するため）。
+func sequenceIndex() IndexFunc {
+	i := 0
+	return func(n int) (int, error) {
+		v := i % n
+		i++
+		return v, nil
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	pokemon := testPokemon(8)
+	pool := make([]*Pokemon, 0, len(pokemon))
+	for id := 1; id <= len(pokemon); id++ {
+		pool = append(pool, pokemon[id])
+	}
+	answer := pokemon[1]
+
+	options, err := GenerateOptions(answer, pool, OptionsConfig{Count: 4, Index: sequenceIndex()})
+	if err != nil {
+		t.Fatalf("GenerateOptions: %v", err)
+	}
+	if len(options) != 4 {
+		t.Fatalf("len(options) = %d, want 4: %v", len(options), options)
+	}
+	if !slices.Contains(options, answer.Name) {
+		t.Errorf("options %v do not contain the answer %q", options, answer.Name)
+	}
+	seen := make(map[string]bool)
+	for _, o := range options {
+		if seen[o] {
+			t.Errorf("option %q appears twice: %v", o, options)
+		}
+		seen[o] = true
+	}
+
+	// 同じ乱数なら同じ選択肢になる
+	again, err := GenerateOptions(answer, pool, OptionsConfig{Count: 4, Index: sequenceIndex()})
+	if err != nil {
+		t.Fatalf("GenerateOptions: %v", err)
+	}
+	if !slices.Equal(options, again) {
+		t.Errorf("options with the same index = %v, want %v", again, options)
+	}
+}
+
+func TestGenerateOptionsSkipAndShortPool(t *testing.T) {
+	pokemon := testPokemon(3)
+	pool := []*Pokemon{pokemon[1], pokemon[2], pokemon[3]}
+
+	// Skip したポケモンは出さず、候補が足りなければ選択肢は少なくなる
+	options, err := GenerateOptions(pokemon[1], pool, OptionsConfig{
+		Count: 4,
+		Skip:  func(p *Pokemon) bool { return p.ID == 3 },
+	})
+	if err != nil {
+		t.Fatalf("GenerateOptions: %v", err)
+	}
+	slices.Sort(options)
+	if want := []string{pokemon[1].Name, pokemon[2].Name}; !slices.Equal(options, want) {
+		t.Errorf("options = %v, want %v", options, want)
+	}
+}
+
+func TestGenerateOptionsIndexError(t *testing.T) {
+	pokemon := testPokemon(5)
+	pool := []*Pokemon{pokemon[1], pokemon[2], pokemon[3], pokemon[4], pokemon[5]}
+	errIndex := errors.New("no randomness")
+
+	_, err := GenerateOptions(pokemon[1], pool, OptionsConfig{
+		Count: 4,
+		Index: func(int) (int, error) { return 0, errIndex },
+	})
+	if !errors.Is(err, errIndex) {
+		t.Errorf("err = %v, want %v", err, errIndex)
+	}
+}
+
+func TestEngineNewQuestion(t *testing.T) {
+	engine := NewEngine(testPokemon(6), WithIndex(sequenceIndex()), WithOptionCount(3))
+
+	if got, want := engine.Categories(), []string{"all", "kanto"}; !slices.Equal(got, want) {
+		t.Errorf("Categories() = %v, want %v", got, want)
+	}
+	q, err := engine.NewQuestion("kanto")
+	if err != nil {
+		t.Fatalf("NewQuestion: %v", err)
+	}
+	if len(q.Options) != 3 || !slices.Contains(q.Options, q.Pokemon.Name) {
+		t.Errorf("options = %v, want 3 options including %q", q.Options, q.Pokemon.Name)
+	}
+	if !q.Check(q.Pokemon.Name) {
+		t.Errorf("Check(%q) = false, want true", q.Pokemon.Name)
+	}
+	if _, err := engine.NewQuestion("johto"); !errors.Is(err, ErrNoPokemon) {
+		t.Errorf("NewQuestion(johto) error = %v, want ErrNoPokemon", err)
+	}
+}
+
+func TestIsSameAnswer(t *testing.T) {
+	tests := []struct {
+		given, correct string
+		want           bool
+	}{
+		{"ピカチュウ", "ピカチュウ", true},
+		{"ぴかちゅう", "ピカチュウ", true},        // ひらがな
+		{"ﾋﾟｶﾁｭｳ", "ピカチュウ", true},       // 半角カタカナ
+		{"  Pikachu ", "pikachu", true}, // 前後の空白と大文字
+		{"Mr.  Mime", "mr. mime", true}, // 続いた空白
+		{"ライチュウ", "ピカチュウ", false},
+	}
+	for _, tt := range tests {
+		if got := IsSameAnswer(tt.given, tt.correct); got != tt.want {
+			t.Errorf("IsSameAnswer(%q, %q) = %v, want %v", tt.given, tt.correct, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPokemonFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pokemon.json")
+	if err := os.WriteFile(path, []byte(`{"25": {"id": 25, "name": "ピカチュウ", "category": "kanto", "types": ["でんき"]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pokemon, err := LoadPokemonFile(path)
+	if err != nil {
+		t.Fatalf("LoadPokemonFile: %v", err)
+	}
+	if p := pokemon[25]; p == nil || p.Name != "ピカチュウ" || p.Category != "kanto" {
+		t.Errorf("pokemon[25] = %+v", p)
+	}
+	if _, err := LoadPokemonFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadPokemonFile of a missing file succeeded")
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"pokemon-quiz-backend/quiz"
+)
+
+// --- 配信者向けイベント ---
+
+// 配信者などの主催者が開催する時間限定の公開イベントです。
+// イベントコードを知っている人は誰でも参加でき、同じ問題セットに答えて共通のランキングで競います。
+
+const (
+	eventCodeLength          = 6
+	eventCodeChars           = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 読み間違えやすい文字を除く
+	defaultEventQuestions    = 10
+	maxEventQuestions        = 50
+	defaultEventDurationMins = 30
+	maxEventDurationMins     = 24 * 60
+	eventLeaderboardSize     = 50
+)
+
+// --- データベースモデル ---
+
+// 主催者が作成したイベント
+type QuizEvent struct {
+	gorm.Model
+	Code        string    `gorm:"uniqueIndex;not null"`
+	HostUserID  uint      `gorm:"index;not null"`
+	Title       string    `gorm:"not null"`
+	Region      string    `gorm:"not null"`
+	QuestionSet string    `gorm:"type:text"` // 出題するポケモンIDと選択肢をJSON配列の文字列として保存
+	StartsAt    time.Time `gorm:"not null"`
+	EndsAt      time.Time `gorm:"not null"`
+}
+
+// イベントの参加者と成績
+type QuizEventEntry struct {
+	gorm.Model
+	QuizEventID   uint   `gorm:"uniqueIndex:idx_event_user;not null"`
+	UserID        uint   `gorm:"uniqueIndex:idx_event_user;not null"`
+	Username      string `gorm:"not null"`
+	Score         int    `gorm:"default:0"`
+	Answered      int    `gorm:"default:0"`
+	Banned        bool   `gorm:"default:false"` // 主催者によって除外された参加者
+	LastCorrectAt *time.Time
+}
+
+// イベントの各問題への回答（同じ問題への再回答を防ぐ）
+type QuizEventAnswer struct {
+	gorm.Model
+	QuizEventID   uint `gorm:"uniqueIndex:idx_event_answer;not null"`
+	UserID        uint `gorm:"uniqueIndex:idx_event_answer;not null"`
+	QuestionIndex int  `gorm:"uniqueIndex:idx_event_answer;not null"`
+	IsCorrect     bool
+}
+
+// イベントの1問分の問題
+type eventQuestion struct {
+	PokemonID int      `json:"pokemonId"`
+	Options   []string `json:"options"`
+}
+
+// newEventCode は、参加者に共有するイベントコードを生成します。
+func newEventCode() (string, error) {
+	b := make([]byte, eventCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = eventCodeChars[int(b[i])%len(eventCodeChars)]
+	}
+	return string(b), nil
+}
+
+// eventTopic は、イベントのランキング更新を配信するイベントバスのトピック名を返します。
+func eventTopic(code string) string {
+	return "event:" + code
+}
+
+// status は、現在時刻におけるイベントの状態を返します。
+func (e *QuizEvent) status(now time.Time) string {
+	switch {
+	case now.Before(e.StartsAt):
+		return "scheduled"
+	case now.Before(e.EndsAt):
+		return "running"
+	default:
+		return "ended"
+	}
+}
+
+// questions は、イベントの問題セットを返します。
+func (e *QuizEvent) questions() []eventQuestion {
+	var questions []eventQuestion
+	json.Unmarshal([]byte(e.QuestionSet), &questions)
+	return questions
+}
+
+// loadEventLeaderboard は、除外されていない参加者のランキングを返します。
+// 同点の場合は、先に最後の正解にたどり着いた参加者を上位にします。
+func loadEventLeaderboard(eventID uint) ([]gin.H, error) {
+	var entries []QuizEventEntry
+	err := db.Where("quiz_event_id = ? AND banned = ?", eventID, false).
+		Order("score desc, last_correct_at asc, id asc").
+		Limit(eventLeaderboardSize).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	leaderboard := make([]gin.H, 0, len(entries))
+	for i, entry := range entries {
+		leaderboard = append(leaderboard, gin.H{
+			"rank":     i + 1,
+			"userId":   entry.UserID,
+			"username": entry.Username,
+			"score":    entry.Score,
+			"answered": entry.Answered,
+		})
+	}
+	return leaderboard, nil
+}
+
+// eventState は、イベントの公開情報とランキングを組み立てます。
+func eventState(e *QuizEvent) (gin.H, error) {
+	leaderboard, err := loadEventLeaderboard(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"code":        e.Code,
+		"title":       e.Title,
+		"region":      e.Region,
+		"questions":   len(e.questions()),
+		"startsAt":    e.StartsAt,
+		"endsAt":      e.EndsAt,
+		"status":      e.status(time.Now()),
+		"leaderboard": leaderboard,
+	}, nil
+}
+
+// publishEventState は、最新のランキングをイベントの購読者に配信します。
+func publishEventState(e *QuizEvent) {
+	state, err := eventState(e)
+	if err != nil {
+		log.Printf("Failed to load leaderboard for event %s: %v", e.Code, err)
+		return
+	}
+	events.Publish(eventTopic(e.Code), "leaderboard", state)
+}
+
+// findQuizEvent は、URLパラメータのコードからイベントを取得します。見つからなければエラーレスポンスを返します。
+func findQuizEvent(c *gin.Context) (*QuizEvent, bool) {
+	var event QuizEvent
+	if err := db.First(&event, "code = ?", strings.ToUpper(c.Param("code"))).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return nil, false
+	}
+	return &event, true
+}
+
+// findHostedQuizEvent は、ログインユーザーが主催するイベントを取得します。主催者でなければエラーレスポンスを返します。
+func findHostedQuizEvent(c *gin.Context) (*QuizEvent, bool) {
+	event, ok := findQuizEvent(c)
+	if !ok {
+		return nil, false
+	}
+	if event.HostUserID != c.MustGet("userID").(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the host can moderate this event"})
+		return nil, false
+	}
+	return event, true
+}
+
+// --- イベントのハンドラ ---
+
+// handleCreateQuizEvent は、ログインユーザーを主催者として新しいイベントを作成し、問題セットを確定します。
+func handleCreateQuizEvent(c *gin.Context) {
+	var req struct {
+		Title           string    `json:"title" binding:"required"`
+		Region          string    `json:"region"`
+		Questions       int       `json:"questions"`
+		StartsAt        time.Time `json:"startsAt"`
+		DurationMinutes int       `json:"durationMinutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event title is required"})
+		return
+	}
+	if rejectBlockedName(c, "event title", req.Title) {
+		return
+	}
+	if req.Region == "" {
+		req.Region = "all"
+	}
+	pool := regionRotation(req.Region)
+	if len(pool) < 4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified"})
+		return
+	}
+	if req.Questions == 0 {
+		req.Questions = defaultEventQuestions
+	}
+	if req.Questions < 1 || req.Questions > maxEventQuestions || req.Questions > len(pool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid number of questions"})
+		return
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = defaultEventDurationMins
+	}
+	if req.DurationMinutes < 1 || req.DurationMinutes > maxEventDurationMins {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event duration"})
+		return
+	}
+	if req.StartsAt.IsZero() {
+		req.StartsAt = time.Now()
+	}
+
+	// 重複しないように問題を選び、選択肢も作成時に確定させて全員に同じ問題を出す
+	questions := make([]eventQuestion, 0, req.Questions)
+	used := make(map[int]bool)
+	for len(questions) < req.Questions {
+		idx, err := randomIndex(len(pool))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate questions"})
+			return
+		}
+		if used[pool[idx].ID] {
+			continue
+		}
+		used[pool[idx].ID] = true
+		options, err := generateOptions(nil, pool[idx], pool, defaultOptionCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate questions"})
+			return
+		}
+		questions = append(questions, eventQuestion{PokemonID: pool[idx].ID, Options: options})
+	}
+	questionSet, _ := json.Marshal(questions)
+
+	code, err := newEventCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
+		return
+	}
+	event := QuizEvent{
+		Code:        code,
+		HostUserID:  c.MustGet("userID").(uint),
+		Title:       req.Title,
+		Region:      req.Region,
+		QuestionSet: string(questionSet),
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.StartsAt.Add(time.Duration(req.DurationMinutes) * time.Minute),
+	}
+	if err := db.Create(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
+		return
+	}
+
+	state, _ := eventState(&event)
+	c.JSON(http.StatusCreated, state)
+}
+
+// handleGetQuizEvent は、イベントの情報と現在のランキングを返します。
+func handleGetQuizEvent(c *gin.Context) {
+	event, ok := findQuizEvent(c)
+	if !ok {
+		return
+	}
+	state, err := eventState(event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// handleQuizEventStream は、イベントのランキングの更新をServer-Sent Eventsで配信します。
+func handleQuizEventStream(c *gin.Context) {
+	event, ok := findQuizEvent(c)
+	if !ok {
+		return
+	}
+	state, err := eventState(event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+	streamEvents(c, eventTopic(event.Code), &busEvent{Type: "leaderboard", Data: state})
+}
+
+// handleGetQuizEventQuestions は、開催中のイベントの問題セットを返します。
+// 正解が分からないように、ポケモンIDは含めずにヒントと選択肢だけを返します。
+func handleGetQuizEventQuestions(c *gin.Context) {
+	event, ok := findQuizEvent(c)
+	if !ok {
+		return
+	}
+	if event.status(time.Now()) != "running" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event is not running"})
+		return
+	}
+
+	questions := event.questions()
+	result := make([]gin.H, 0, len(questions))
+	for i, q := range questions {
+		pokemon, ok := pokemonMapByID[q.PokemonID]
+		if !ok {
+			continue
+		}
+		question := buildQuizQuestion(pokemon, q.Options, quizModeStats)
+		delete(question, "id")
+		question["index"] = i
+		result = append(result, question)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": event.Code, "endsAt": event.EndsAt, "questions": result})
+}
+
+// handleQuizEventAnswer は、イベントの問題への回答を採点してランキングに反映します。
+// 1つの問題に回答できるのは1回だけです。
+func handleQuizEventAnswer(c *gin.Context) {
+	var req struct {
+		Index int    `json:"index"`
+		Name  string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	event, ok := findQuizEvent(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if event.status(now) != "running" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event is not running"})
+		return
+	}
+	questions := event.questions()
+	if req.Index < 0 || req.Index >= len(questions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question index"})
+		return
+	}
+	correctPokemon, ok := pokemonMapByID[questions[req.Index].PokemonID]
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ポケモンのデータが見つかりません"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	user, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	isCorrect := quiz.IsSameAnswer(req.Name, correctPokemon.Name)
+	errBanned := errors.New("banned")
+	errAnswered := errors.New("already answered")
+	var entry QuizEventEntry
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(QuizEventEntry{QuizEventID: event.ID, UserID: userID}).
+			Attrs(QuizEventEntry{Username: user.Username}).
+			FirstOrCreate(&entry).Error; err != nil {
+			return err
+		}
+		if entry.Banned {
+			return errBanned
+		}
+		var count int64
+		tx.Model(&QuizEventAnswer{}).
+			Where("quiz_event_id = ? AND user_id = ? AND question_index = ?", event.ID, userID, req.Index).
+			Count(&count)
+		if count > 0 {
+			return errAnswered
+		}
+		answer := QuizEventAnswer{QuizEventID: event.ID, UserID: userID, QuestionIndex: req.Index, IsCorrect: isCorrect}
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+
+		entry.Answered++
+		if isCorrect {
+			entry.Score++
+			entry.LastCorrectAt = &now
+		}
+		return tx.Save(&entry).Error
+	})
+	switch {
+	case errors.Is(err, errBanned):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You have been removed from this event"})
+		return
+	case errors.Is(err, errAnswered):
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already answered this question"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record answer"})
+		return
+	}
+
+	publishEventState(event)
+	c.JSON(http.StatusOK, gin.H{
+		"isCorrect":      isCorrect,
+		"correctPokemon": correctPokemon,
+		"score":          entry.Score,
+		"answered":       entry.Answered,
+	})
+}
+
+// handleBanQuizEventEntry は、主催者が参加者をイベントから除外します（banned=falseで復帰）。
+func handleBanQuizEventEntry(c *gin.Context) {
+	var req struct {
+		UserID uint  `json:"userId" binding:"required"`
+		Banned *bool `json:"banned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+	banned := req.Banned == nil || *req.Banned
+
+	event, ok := findHostedQuizEvent(c)
+	if !ok {
+		return
+	}
+	result := db.Model(&QuizEventEntry{}).
+		Where("quiz_event_id = ? AND user_id = ?", event.ID, req.UserID).
+		Update("banned", banned)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update participant"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Participant not found"})
+		return
+	}
+
+	publishEventState(event)
+	c.JSON(http.StatusOK, gin.H{"userId": req.UserID, "banned": banned})
+}
+
+// handleEndQuizEvent は、主催者がイベントを予定より早く終了させます。
+func handleEndQuizEvent(c *gin.Context) {
+	event, ok := findHostedQuizEvent(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if event.EndsAt.After(now) {
+		event.EndsAt = now
+		if event.StartsAt.After(now) {
+			event.StartsAt = now
+		}
+		if err := db.Save(event).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end event"})
+			return
+		}
+	}
+
+	publishEventState(event)
+	state, _ := eventState(event)
+	c.JSON(http.StatusOK, state)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// --- 出題の候補の作り置き ---
+
+// 配信者がリンクを貼った直後など、大勢のユーザーが同時に同じ条件で /quiz を求めると、
+// 同じ候補の一覧（複数の地方をまとめたもの、出題から外したポケモンを除いたもの、タイプやフォルムで絞り込んだもの）を
+// リクエストごとに作り直すことになり、CPUとメモリの割り当てが一度に増えます。
+// そこで候補の一覧は条件ごとのキーで作り置きし、作り置きのないキーを同時に求められたら singleflight で1回だけ作って分け合います。
+// キーには出題から外すポケモンの一覧の版を含めるので、一覧を変えると次のリクエストから作り直します。
+// 作り置きした一覧は複数のリクエストで共有するので、受け取った側で書き換えてはいけません（pokemonListByRegion と同じ）。
+// ユーザーが作ったプールや図鑑番号の範囲の一覧は、キーを空にして作り置きしません。
+// 切り抜きやシルエットの画像も、同じ画像を同時に求められたら1回だけ作ります（cachedImage）。
+
+const quizPoolCacheSize = 256
+
+var (
+	quizPoolCacheMu sync.RWMutex
+	quizPoolCache   = make(map[string][]*Pokemon)
+	quizPoolGroup   singleflight.Group
+)
+
+// sharedQuizPool は、key の一覧が作り置きしてあればそれを返し、なければ build で作って作り置きします。
+// 同じ key を同時に求められたら、build は1回だけ呼びます。key が空なら、作り置きせずに build の結果を返します。
+func sharedQuizPool(key string, build func() []*Pokemon) []*Pokemon {
+	if key == "" {
+		return build()
+	}
+	quizPoolCacheMu.RLock()
+	list, ok := quizPoolCache[key]
+	quizPoolCacheMu.RUnlock()
+	if ok {
+		return list
+	}
+	v, _, _ := quizPoolGroup.Do(key, func() (any, error) {
+		list := build()
+		quizPoolCacheMu.Lock()
+		if len(quizPoolCache) >= quizPoolCacheSize {
+			clear(quizPoolCache) // 条件の組み合わせはそれほど多くないので、いっぱいになったらまとめて消す
+		}
+		quizPoolCache[key] = list
+		quizPoolCacheMu.Unlock()
+		return list, nil
+	})
+	return v.([]*Pokemon)
+}
+
+// quizPoolKey は、コンテンツパックと地方から、作り置きのキーを作ります。
+func quizPoolKey(pack *contentPack, region string) string {
+	return pack.ID + "|" + region + "|x" + currentExclusions().version
+}
+
+// quizPoolStageKey は、作り置きのキーに絞り込みの条件を加えます。key が空なら空のままにします。
+func quizPoolStageKey(key, stage string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "|" + stage
+}
+
+// sharedRegionPools は mergeRegionPools と同じ一覧を返しますが、複数の地方をまとめた一覧は作り置きを分け合います。
+func sharedRegionPools(pack *contentPack, names []string) ([]*Pokemon, string) {
+	if len(names) == 1 {
+		return mergeRegionPools(pack.regions, names)
+	}
+	for _, name := range names {
+		if len(pack.regions[strings.TrimSpace(name)]) == 0 {
+			return mergeRegionPools(pack.regions, names) // 見つからない地方を返す
+		}
+	}
+	key := quizPoolStageKey(quizPoolKey(pack, strings.Join(names, ",")), "merged")
+	return sharedQuizPool(key, func() []*Pokemon {
+		merged, _ := mergeRegionPools(pack.regions, names)
+		return merged
+	}), ""
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- レート制限 ---
+
+// クイズのエンドポイントへのリクエスト数を、クライアントごとに一定時間あたりの上限で制限します。
+// 制限中は 429 とあわせて解除までの秒数を返すので、クライアントはカウントダウンを表示できます。
+
+const (
+	quizRateLimit  = 120         // 1つの区間で受け付けるリクエスト数
+	quizRateWindow = time.Minute // レート制限の区間の長さ
+)
+
+// クライアントごとのリクエスト数（固定区間）
+type rateWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// レート制限の状態
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	clients   map[string]*rateWindow
+	lastSweep time.Time // 区間が終わったクライアントを最後に破棄した時刻
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, clients: make(map[string]*rateWindow)}
+}
+
+// allow は、リクエストを1件数え、受け付けられるかどうかと残り回数、区間がリセットされる時刻を返します。
+func (l *rateLimiter) allow(key string, now time.Time) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// リクエストのたびに全体を見ると重いので、区間の長さごとに区間が終わったクライアントを破棄する
+	if now.Sub(l.lastSweep) > l.window {
+		for k, w := range l.clients {
+			if !now.Before(w.resetAt) {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.clients[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(l.window)}
+		l.clients[key] = w
+	}
+	if w.count >= l.limit {
+		return false, 0, w.resetAt
+	}
+	w.count++
+	return true, l.limit - w.count, w.resetAt
+}
+
+// rateLimitKey は、APIキーがあればキー、ログインしていればユーザーID、どちらもなければIPアドレスでクライアントを識別します。
+func rateLimitKey(c *gin.Context) string {
+	if keyID, ok := c.Get("apiKeyID"); ok {
+		return fmt.Sprintf("key:%d", keyID)
+	}
+	if userID, ok := optionalUserID(c); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// rateLimitMiddleware は、レート制限のヘッダーを付け、上限を超えたリクエストを 429 で拒否します。
+func rateLimitMiddleware(l *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		allowed, remaining, resetAt := l.allow(rateLimitKey(c), now)
+		retryAfter := int(resetAt.Sub(now).Round(time.Second) / time.Second)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(l.limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":      "Too many requests, please wait before trying again",
+				"code":       "rate_limited",
+				"retryAfter": retryAfter, // 解除までの秒数（カウントダウン表示用）
+				"resetAt":    resetAt.Unix(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- リフレッシュトークン ---
+
+// ログインすると、有効期限の短いログイントークン（TOKEN_DURATION、既定は15分）と、
+// 有効期限の長いリフレッシュトークン（REFRESH_TOKEN_DURATION、既定は7日）を返します。
+// ログイントークンが切れたら POST /refresh にリフレッシュトークンを送ると、新しいログイントークンと
+// 新しいリフレッシュトークンを返します（送ったリフレッシュトークンはもう使えなくなる）。
+// 使い終わったリフレッシュトークンがもう一度送られてきたら、盗まれて使われたものとみなし、
+// 同じログインから続くリフレッシュトークンを全て無効にします（もう一度ログインが必要になる）。
+// 送り直しても最初にログインしてから TOKEN_MAX_LIFETIME（既定は30日）を過ぎると延長しません。
+// リフレッシュトークンはハッシュ値だけをデータベースに保存します。
+
+const (
+	defaultRefreshTokenDuration = 7 * 24 * time.Hour
+	refreshTokenPrefix          = "pqr_"
+)
+
+var refreshTokenDuration = defaultRefreshTokenDuration
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token is invalid or has expired")
+	errRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// --- データベースモデル ---
+
+// 発行したリフレッシュトークン
+type RefreshToken struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	FamilyID   string `gorm:"index;not null"` // 同じログインから続くトークンに共通のID
+	TokenHash  string `gorm:"uniqueIndex;not null"`
+	LoggedInAt time.Time
+	ExpiresAt  time.Time
+	UsedAt     *time.Time // 新しいトークンと交換した時刻
+	RevokedAt  *time.Time
+}
+
+// issueRefreshToken は、リフレッシュトークンを発行して保存します。familyID が空なら新しいログインとして扱います。
+func issueRefreshToken(tx *gorm.DB, userID uint, familyID string, loggedInAt, now time.Time) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := refreshTokenPrefix + hex.EncodeToString(buf)
+	if familyID == "" {
+		familyID = hex.EncodeToString(buf[:8])
+	}
+	expiresAt := now.Add(refreshTokenDuration)
+	if limit := loggedInAt.Add(tokenMaxLifetime); limit.Before(expiresAt) {
+		expiresAt = limit
+	}
+	record := RefreshToken{
+		UserID:     userID,
+		FamilyID:   familyID,
+		TokenHash:  hashAPIKey(token),
+		LoggedInAt: loggedInAt,
+		ExpiresAt:  expiresAt,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	// 期限の切れたトークンは、発行のついでに消しておく
+	tx.Unscoped().Where("user_id = ? AND expires_at < ?", userID, now).Delete(&RefreshToken{})
+	return token, expiresAt, nil
+}
+
+// rotateRefreshToken は、リフレッシュトークンを使用済みにして、同じログインの新しいリフレッシュトークンを発行します。
+func rotateRefreshToken(token string, now time.Time) (RefreshToken, string, time.Time, error) {
+	var current RefreshToken
+	var newToken string
+	var expiresAt time.Time
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", hashAPIKey(token)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errRefreshTokenInvalid
+			}
+			return err
+		}
+		if current.RevokedAt != nil || !now.Before(current.ExpiresAt) {
+			return errRefreshTokenInvalid
+		}
+		// 同時に送られても交換できるのは1回だけにする
+		res := tx.Model(&RefreshToken{}).Where("id = ? AND used_at IS NULL", current.ID).Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		var err error
+		newToken, expiresAt, err = issueRefreshToken(tx, current.UserID, current.FamilyID, current.LoggedInAt, now)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		// 使用済みのトークンが送られてきたら、同じログインのトークンを全て無効にする
+		if err := db.Model(&RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", current.FamilyID).Update("revoked_at", now).Error; err != nil {
+			log.Printf("Failed to revoke refresh tokens for user %d: %v", current.UserID, err)
+		}
+		log.Printf("Refresh token reuse detected for user %d; revoked its login.", current.UserID)
+	}
+	return current, newToken, expiresAt, err
+}
+
+// --- リフレッシュトークンのハンドラ ---
+
+// handleRefreshToken は、リフレッシュトークンを新しいものと交換し、新しいログイントークンを返します。
+func handleRefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refreshToken is required"})
+		return
+	}
+	now := time.Now()
+	current, refreshToken, refreshExpiresAt, err := rotateRefreshToken(req.RefreshToken, now)
+	switch {
+	case errors.Is(err, errRefreshTokenInvalid), errors.Is(err, errRefreshTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is invalid or has expired, please log in again"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	user, err := users.UserByID(current.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is invalid or has expired, please log in again"})
+		return
+	}
+	tokenString, expiresAt, err := issueLoginToken(user.ID, user.TokenVersion, current.LoggedInAt, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":            tokenString,
+		"expiresAt":        expiresAt,
+		"refreshToken":     refreshToken,
+		"refreshExpiresAt": refreshExpiresAt,
+	})
+}
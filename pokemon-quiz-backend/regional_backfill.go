@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 地方ごとの成績の再集計 ---
+
+// 地方ごとの成績（UserStat.RegionalStats）は、導入前に答えた分が入っていなかったり、
+// 以前は間違えたリストから近似で復元していたりしたので、正確でないことがあります。
+// 管理者が POST /admin/regional-stats/backfill を呼ぶと、ポケモンごとの回答記録（PokemonAttempt）から全ユーザーの
+// 地方ごとの成績を集計し直して置き換えます。回答記録は成績に反映した回答ごとに加算しているので、正確な値になります。
+// ただし回答記録を始める前に答えた分は含まれないため、回答数の合計が成績の回答数より少ないユーザーは応答の partialUsers で数えます。
+
+// regionalStatsFromAttempts は、ポケモンごとの回答記録を地方ごとに合計します。
+func regionalStatsFromAttempts(attempts map[int]PokemonAttempt) (map[string]RegionalStatDetail, int) {
+	regionalStats := make(map[string]RegionalStatDetail)
+	answered := 0
+	for id, a := range attempts {
+		answered += a.Attempts
+		pokemon, ok := pokemonMapByID[id]
+		if !ok || pokemon.Category == "" {
+			continue
+		}
+		detail := regionalStats[pokemon.Category]
+		detail.Total += a.Attempts
+		detail.Correct += a.Correct
+		regionalStats[pokemon.Category] = detail
+	}
+	return regionalStats, answered
+}
+
+// --- 地方ごとの成績の再集計のハンドラ（管理者用） ---
+
+// handleBackfillRegionalStats は、全ユーザーの地方ごとの成績を回答記録から集計し直します。
+func handleBackfillRegionalStats(c *gin.Context) {
+	adminID := c.MustGet("userID").(uint)
+	ids, err := users.StatUserIDs()
+	if err != nil {
+		recordAudit(adminID, "regional_stats_backfill", "", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user stats"})
+		return
+	}
+	partial := 0
+	for _, id := range ids {
+		if err := backfillRegionalStats(id, &partial); err != nil {
+			recordAudit(adminID, "regional_stats_backfill", "", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to backfill regional stats"})
+			return
+		}
+	}
+	recordAudit(adminID, "regional_stats_backfill", "", nil)
+	c.JSON(http.StatusOK, gin.H{"users": len(ids), "partialUsers": partial})
+}
+
+// backfillRegionalStats は、1人分の地方ごとの成績を集計し直します。回答記録が成績の回答数に足りなければ partial を数えます。
+func backfillRegionalStats(userID uint, partial *int) error {
+	stat, err := users.Stats(userID)
+	if err != nil || stat == nil {
+		return err
+	}
+	attempts, err := users.PokemonAttempts(userID)
+	if err != nil {
+		return err
+	}
+	regionalStats, answered := regionalStatsFromAttempts(attempts)
+	if answered < stat.TotalQuestions {
+		*partial++
+	}
+	if err := users.SetRegionalStats(userID, regionalStats); err != nil {
+		return fmt.Errorf("user %d: %w", userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- 成績証明トークン ---
+
+// 終了したセッションの成績（スコア・シード・日時）にサーバーの署名を付けたトークンを発行します。
+// 外部の大会の主催者は、スクリーンショットの代わりにこのトークンを公開の検証APIに送って成績を確認できます。
+
+const resultTokenIssuer = "pokequiz-result"
+
+// 署名済みの成績
+type resultClaims struct {
+	SessionID  string    `json:"sid"` // 出題のシード（セッションIDから問題が決まる）
+	UserID     uint      `json:"uid,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	Type       string    `json:"type"`
+	Mode       string    `json:"mode"`
+	Region     string    `json:"region"`
+	Answered   int       `json:"answered"`
+	Correct    int       `json:"correct"`
+	Score      int       `json:"score"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	jwt.RegisteredClaims
+}
+
+// derivedSigningKey は、JWTの鍵から用途ごとに別の署名鍵を導出します。
+// ログイン用のトークンと取り違えられないよう、ログイン以外のトークンはこの鍵で署名します。
+func derivedSigningKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, jwtKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// resultSigningKey は、成績証明トークンの署名鍵を返します。
+func resultSigningKey() []byte {
+	return derivedSigningKey(resultTokenIssuer)
+}
+
+// issueResultToken は、終了したセッションの成績証明トークンを発行します。
+// 呼び出し側で session.mu をロックしておく必要があります。
+func issueResultToken(s *quizSession) (string, error) {
+	claims := resultClaims{
+		SessionID:  s.ID,
+		UserID:     s.UserID,
+		Type:       s.Type,
+		Mode:       s.Mode,
+		Region:     s.Region,
+		Answered:   s.Answered,
+		Correct:    s.Correct,
+		Score:      sessionScore(s),
+		StartedAt:  s.CreatedAt,
+		FinishedAt: s.finishedAt,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   resultTokenIssuer,
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if s.UserID != 0 {
+		if user, err := users.UserByID(s.UserID); err == nil {
+			claims.Username = user.Username
+		}
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(resultSigningKey())
+}
+
+// sessionScore は、成績証明に載せるスコアを返します。
+// ポイントを賭けるセッションは所持ポイント、それ以外は回答ごとの得点（scoring.go）の合計です。
+func sessionScore(s *quizSession) int {
+	if s.Wager {
+		return s.Balance
+	}
+	return summarizeSession(s).Score
+}
+
+// parseResultToken は、成績証明トークンの署名を検証して中身を返します。
+func parseResultToken(tokenString string) (*resultClaims, error) {
+	claims := &resultClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return resultSigningKey(), nil
+	}, jwt.WithIssuer(resultTokenIssuer))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// --- 成績証明のハンドラ ---
+
+// handleVerifyResult は、成績証明トークンが本物かどうかを検証し、署名された成績を返します。
+// 外部の大会の主催者が使うため、認証は不要です。
+func handleVerifyResult(c *gin.Context) {
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"valid": false, "error": "token is required"})
+		return
+	}
+	claims, err := parseResultToken(tokenString)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"valid": false, "error": "Result token is invalid or has been tampered with"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"valid":    true,
+		"issuedAt": claims.IssuedAt,
+		"result":   claims,
+	})
+}
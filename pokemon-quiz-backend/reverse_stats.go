@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 種族値を当てる形式 ---
+
+// ポケモンの名前と画像を見せて、選択肢の種族値の中から正しいものを当ててもらいます。
+// 不正解の選択肢は本物の種族値を少しずつ崩して作るので、合計や傾向だけでは見分けにくくなります。
+// 選択肢は問題ごとのシードから決まるので、答え合わせではシードから選択肢を作り直して、選んだ番号で判定します。
+
+const quizModeReverseStats = "reverse_stats"
+
+// 種族値の範囲
+const (
+	minBaseStat = 1
+	maxBaseStat = 255
+)
+
+// statValues は、種族値を HP・こうげき・ぼうぎょ・とくこう・とくぼう・すばやさ の順に並べて返します。
+func statValues(s PokemonStats) [6]int {
+	return [6]int{s.HP, s.Attack, s.Defense, s.SpAttack, s.SpDefense, s.Speed}
+}
+
+// statsFromValues は、statValues の順に並んだ値から種族値を作ります。
+func statsFromValues(v [6]int) PokemonStats {
+	return PokemonStats{HP: v[0], Attack: v[1], Defense: v[2], SpAttack: v[3], SpDefense: v[4], Speed: v[5]}
+}
+
+// clampBaseStat は、値を種族値として取りうる範囲に収めます。
+func clampBaseStat(n int) int {
+	return min(max(n, minBaseStat), maxBaseStat)
+}
+
+// perturbStats は、本物の種族値をもっともらしく崩した種族値を作ります。
+func perturbStats(s PokemonStats, rng *rand.Rand) PokemonStats {
+	v := statValues(s)
+	i := rng.IntN(len(v))
+	j := (i + 1 + rng.IntN(len(v)-1)) % len(v) // i とは別の種族値
+	switch rng.IntN(3) {
+	case 0:
+		// 2つの種族値を入れ替える（合計は同じ）
+		v[i], v[j] = v[j], v[i]
+	case 1:
+		// 合計はそのままで、ある種族値から別の種族値に振り分け直す
+		d := min(10+rng.IntN(31), v[i]-minBaseStat, maxBaseStat-v[j])
+		v[i] -= d
+		v[j] += d
+	default:
+		// 全体を少しずつ上下させる
+		for k := range v {
+			v[k] = clampBaseStat(v[k] + rng.IntN(21) - 10)
+		}
+	}
+	return statsFromValues(v)
+}
+
+// reverseStatsOptions は、シードから count 個の種族値の選択肢を作り、正解の位置とあわせて返します。
+// 同じポケモン・シード・個数からは必ず同じ選択肢が作られます。
+func reverseStatsOptions(pokemon *Pokemon, seed uint64, count int) ([]PokemonStats, int) {
+	rng := rand.New(rand.NewPCG(seed, uint64(pokemon.ID)))
+	options := []PokemonStats{pokemon.Stats}
+	seen := map[PokemonStats]bool{pokemon.Stats: true}
+	// 全ての種族値が同じポケモンなどは崩しても同じになることがあるので、試す回数に上限を設ける
+	for attempts := 0; len(options) < count && attempts < count*50; attempts++ {
+		candidate := perturbStats(pokemon.Stats, rng)
+		if !seen[candidate] {
+			seen[candidate] = true
+			options = append(options, candidate)
+		}
+	}
+	rng.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+	for i, o := range options {
+		if o == pokemon.Stats {
+			return options, i
+		}
+	}
+	return options, 0
+}
+
+// buildReverseStatsQuestion は、種族値を当てる形式の問題を組み立てます。
+func buildReverseStatsQuestion(qr *quizRand, pokemon *Pokemon, optionCount int) (gin.H, error) {
+	seed, err := qr.reverseStatsSeed()
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.ParseUint(seed, 16, 64)
+	options, _ := reverseStatsOptions(pokemon, n, optionCount)
+	return gin.H{
+		"id":          pokemon.ID,
+		"mode":        quizModeReverseStats,
+		"name":        pokemon.Name,
+		"nameReading": pokemon.NameReading,
+		"imageUrl":    pokemon.ImageURL,
+		"types":       pokemon.Types,
+		"options":     options,
+		"optionCount": optionCount, // 答え合わせで seed とあわせて送り返してもらう
+		"seed":        seed,
+	}, nil
+}
+
+// checkReverseStatsAnswer は、選んだ選択肢の番号が正しい種族値かどうかを判定します。
+// シードや番号が不正な場合は2つ目の戻り値が false になります。
+func checkReverseStatsAnswer(pokemon *Pokemon, seed string, optionCount int, optionIndex *int) (bool, bool) {
+	n, err := strconv.ParseUint(seed, 16, 64)
+	if err != nil || optionIndex == nil || optionCount < minOptionCount || optionCount > maxOptionCount {
+		return false, false
+	}
+	options, correct := reverseStatsOptions(pokemon, n, optionCount)
+	if *optionIndex < 0 || *optionIndex >= len(options) {
+		return false, false
+	}
+	return *optionIndex == correct, true
+}
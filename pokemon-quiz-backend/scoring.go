@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- 得点 ---
+
+// 回答ごとの得点はサーバーで計算し、クライアントが送った得点は使いません（ランキングなどで改ざんされないようにするため）。
+// 正解すると基本点が入り、速く答えるほど・連続正解が続くほどボーナスが付きます。ヒントを使うと基本点から差し引きます。
+// 答えるまでの時間は、サーバーが問題を出した時刻から測ります（/answer では questionToken に入っている questionId から）。
+// ログインユーザーの得点は回答ごとに AnswerScore として保存し、合計を UserStat.TotalScore に加算します。
+// XP2倍などの期間中（modifiers.go）に答えた問題は、得点にもXPと同じ倍率を掛けます。
+
+const (
+	scoreBasePoints      = 100              // 正解したときの基本点
+	scoreMinBasePoints   = 10               // ヒントを使っても残る基本点
+	scoreHintPenalty     = 25               // ヒント1つごとに差し引く点
+	scoreSpeedBonusMax   = 50               // すぐに答えたときの速さのボーナス
+	scoreSpeedWindow     = 10 * time.Second // この時間を過ぎると速さのボーナスはなし
+	scoreStreakBonusStep = 10               // 連続正解が1つ伸びるごとのボーナス
+	scoreStreakBonusMax  = 100              // 連続正解のボーナスの上限
+)
+
+// 1問分の得点と内訳
+type answerScore struct {
+	Points      int `json:"points"`
+	Base        int `json:"base"`
+	SpeedBonus  int `json:"speedBonus"`
+	StreakBonus int `json:"streakBonus"`
+	HintPenalty int `json:"hintPenalty"`
+	Multiplier  int `json:"multiplier"` // 掛けたXPの倍率
+}
+
+// --- データベースモデル ---
+
+// ログインユーザーの回答ごとの得点
+type AnswerScore struct {
+	gorm.Model
+	UserID      uint `gorm:"index;not null"`
+	PokemonID   int
+	Correct     bool
+	Points      int
+	SpeedBonus  int
+	StreakBonus int
+	HintPenalty int
+	Multiplier  int
+	ElapsedMs   int64 // 答えるまでにかかった時間（分からなければ0）
+}
+
+// scoreAnswer は、1問分の得点を計算します。streak には、この回答を反映した後の連続正解数を渡します。
+func scoreAnswer(a statsAnswer, streak int) answerScore {
+	multiplier := stackedMultiplier(activeXPModifiers(a.answeredAt(), a.PokemonID))
+	if !a.IsCorrect {
+		return answerScore{Multiplier: multiplier}
+	}
+	score := answerScore{Base: scoreBasePoints, Multiplier: multiplier}
+	score.HintPenalty = min(a.HintsUsed*scoreHintPenalty, scoreBasePoints-scoreMinBasePoints)
+	if a.Elapsed > 0 && a.Elapsed < scoreSpeedWindow {
+		score.SpeedBonus = int(int64(scoreSpeedBonusMax) * int64(scoreSpeedWindow-a.Elapsed) / int64(scoreSpeedWindow))
+	}
+	if streak > 1 {
+		score.StreakBonus = min((streak-1)*scoreStreakBonusStep, scoreStreakBonusMax)
+	}
+	score.Points = (score.Base - score.HintPenalty + score.SpeedBonus + score.StreakBonus) * score.Multiplier
+	return score
+}
+
+// recordAnswerScore は、トランザクションの中で回答の得点を保存します。
+func recordAnswerScore(tx *gorm.DB, userID uint, a statsAnswer, score answerScore) error {
+	record := newAnswerScore(userID, a, score)
+	return tx.Create(&record).Error
+}
+
+// newAnswerScore は、保存する回答の得点を組み立てます。
+func newAnswerScore(userID uint, a statsAnswer, score answerScore) AnswerScore {
+	return AnswerScore{
+		UserID:      userID,
+		PokemonID:   a.PokemonID,
+		Correct:     a.IsCorrect,
+		Points:      score.Points,
+		SpeedBonus:  score.SpeedBonus,
+		StreakBonus: score.StreakBonus,
+		HintPenalty: score.HintPenalty,
+		Multiplier:  score.Multiplier,
+		ElapsedMs:   a.Elapsed.Milliseconds(),
+	}
+}
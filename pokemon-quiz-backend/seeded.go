@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+)
+
+// --- シードを指定した出題 ---
+
+// /quiz?seed=...&round=N やセッションの作成時に seed を指定すると、同じ seed を指定した人には同じ順番で同じ問題・選択肢を出題します
+// （友だちと同じ問題で競う遊び方のため）。round は何問目か（0から）で、セッションでは出題した順に自動で進みます。
+// シードを指定しない場合はこれまでどおり crypto/rand で選びます。
+// 出題プールの並び順はデータの読み込み方で変わるので、シードを使うときはIDの順に並べ直してから選びます。
+// ログインユーザーの苦手なポケモンを優先する出題や「間違えた問題」モードは人によって結果が変わるので、シードと一緒には使えません。
+
+const maxQuizSeedLength = 64
+
+// 出題に使う乱数。nil なら crypto/rand を使う
+type quizRand struct {
+	rng *rand.Rand
+}
+
+// newQuizRand は、シードと何問目かから、出題に使う乱数を作ります。
+func newQuizRand(seed string, round int) *quizRand {
+	h := fnv.New64a()
+	h.Write([]byte("quiz:" + seed))
+	return &quizRand{rng: rand.New(rand.NewPCG(h.Sum64(), uint64(round)))}
+}
+
+// validQuizSeed は、シードとして使える文字列かどうかを返します。
+func validQuizSeed(seed string) bool {
+	return seed != "" && len(seed) <= maxQuizSeedLength
+}
+
+// index は、0 以上 n 未満の乱数を返します。
+func (q *quizRand) index(n int) (int, error) {
+	if q == nil {
+		return randomIndex(n)
+	}
+	return q.rng.IntN(n), nil
+}
+
+// cropSeed は、切り抜く範囲を決めるシードを返します。
+func (q *quizRand) cropSeed() uint64 {
+	if q == nil {
+		return newCropSeed()
+	}
+	return q.rng.Uint64()
+}
+
+// reverseStatsSeed は、種族値を当てる形式の選択肢を決めるシード（newRandomID と同じ12桁の16進数）を返します。
+func (q *quizRand) reverseStatsSeed() (string, error) {
+	if q == nil {
+		return newRandomID()
+	}
+	return fmt.Sprintf("%012x", q.rng.Uint64()>>16), nil
+}
+
+// sortedByID は、IDの順に並べた一覧のコピーを返します。
+func sortedByID(list []*Pokemon) []*Pokemon {
+	sorted := slices.Clone(list)
+	slices.SortFunc(sorted, func(a, b *Pokemon) int { return a.ID - b.ID })
+	return sorted
+}
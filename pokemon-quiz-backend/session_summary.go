@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- セッションのまとめ ---
+
+// セッションが終わったら、得点・評価（S/A/B/C）・最も速く正解した問題・最も難しかった問題をまとめて保存し、
+// GET /sessions/:id/summary で返します。結果を共有するカードや文章（shareText）はこのまとめから作ります。
+// 得点は回答ごとの得点（scoring.go）をセッションの中の連続正解で計算して合計したもので、評価は正答率で決めます。
+// 最も難しかった問題は、そのセッションで出題したポケモンのうち、全ユーザーの正答率が最も低いものです。
+
+const (
+	gradeS = "S"
+	gradeA = "A"
+	gradeB = "B"
+	gradeC = "C"
+)
+
+// 評価の基準（正答率の下限）。上から順に当てはめる
+var gradeThresholds = []struct {
+	grade    string
+	accuracy float64
+}{
+	{gradeS, 0.9},
+	{gradeA, 0.75},
+	{gradeB, 0.5},
+}
+
+// --- データベースモデル ---
+
+// 終了したセッションのまとめ
+type SessionSummary struct {
+	gorm.Model
+	SessionID        string    `gorm:"uniqueIndex;not null" json:"sessionId"`
+	UserID           uint      `gorm:"index" json:"userId"` // ログインしていない場合は0
+	Type             string    `json:"type"`
+	Region           string    `json:"region"`
+	Mode             string    `json:"mode"`
+	Answered         int       `json:"answered"`
+	Correct          int       `json:"correct"`
+	Skipped          int       `json:"skipped"`
+	Score            int       `json:"score"`
+	Grade            string    `json:"grade"`
+	FastestPokemonID int       `json:"fastestPokemonId,omitempty"` // 最も速く正解したポケモン（分からなければ0）
+	FastestMs        int64     `json:"fastestMs,omitempty"`
+	HardestPokemonID int       `json:"hardestPokemonId,omitempty"` // 最も難しかったポケモン（分からなければ0）
+	HardestAccuracy  float64   `json:"hardestAccuracy,omitempty"`  // そのポケモンの全ユーザーの正答率
+	StartedAt        time.Time `json:"startedAt"`
+	FinishedAt       time.Time `json:"finishedAt"`
+}
+
+// accuracy は、まとめの正答率（0〜1）を返します。
+func (s SessionSummary) accuracy() float64 {
+	if s.Answered == 0 {
+		return 0
+	}
+	return float64(s.Correct) / float64(s.Answered)
+}
+
+// sessionGrade は、正答率から評価を決めます。
+func sessionGrade(answered, correct int) string {
+	if answered == 0 {
+		return gradeC
+	}
+	accuracy := float64(correct) / float64(answered)
+	for _, t := range gradeThresholds {
+		if accuracy >= t.accuracy {
+			return t.grade
+		}
+	}
+	return gradeC
+}
+
+// hardestPokemon は、回答したポケモンのうち全ユーザーの正答率が最も低いものと、その正答率を返します。
+func hardestPokemon(answers []statsAnswer) (int, float64) {
+	totals, err := users.PokemonAttemptTotals()
+	if err != nil {
+		log.Printf("Failed to load attempt totals for session summary: %v", err)
+		return 0, 0
+	}
+	byID := make(map[int]pokemonAttemptTotal, len(totals))
+	for _, t := range totals {
+		byID[t.PokemonID] = t
+	}
+	hardestID, hardest := 0, 0.0
+	for _, a := range answers {
+		t, ok := byID[a.PokemonID]
+		if !ok || t.Attempts == 0 {
+			continue
+		}
+		accuracy := float64(t.Correct) / float64(t.Attempts)
+		if hardestID == 0 || accuracy < hardest {
+			hardestID, hardest = a.PokemonID, accuracy
+		}
+	}
+	return hardestID, hardest
+}
+
+// summarizeSession は、セッションの回答からまとめを作ります。
+// 呼び出し側で session.mu をロックしておく必要があります。
+func summarizeSession(s *quizSession) SessionSummary {
+	summary := SessionSummary{
+		SessionID:  s.ID,
+		UserID:     s.UserID,
+		Type:       s.Type,
+		Region:     s.Region,
+		Mode:       s.Mode,
+		Answered:   s.Answered,
+		Correct:    s.Correct,
+		Skipped:    s.Skipped,
+		Grade:      sessionGrade(s.Answered, s.Correct),
+		StartedAt:  s.CreatedAt,
+		FinishedAt: s.finishedAt,
+	}
+	streak := 0
+	for _, a := range s.answerLog {
+		if !a.IsCorrect {
+			streak = 0
+			continue
+		}
+		streak++
+		summary.Score += scoreAnswer(a, streak).Points
+		if a.Elapsed > 0 && (summary.FastestPokemonID == 0 || a.Elapsed.Milliseconds() < summary.FastestMs) {
+			summary.FastestPokemonID, summary.FastestMs = a.PokemonID, a.Elapsed.Milliseconds()
+		}
+	}
+	summary.HardestPokemonID, summary.HardestAccuracy = hardestPokemon(s.answerLog)
+	return summary
+}
+
+// recordSessionSummary は、終了したセッションのまとめを保存します。既に保存していれば何もしません。
+// 呼び出し側で session.mu をロックしておく必要があります。
+func recordSessionSummary(s *quizSession) {
+	if s.summaryRecorded {
+		return
+	}
+	summary := summarizeSession(s)
+	if err := db.Create(&summary).Error; err != nil {
+		log.Printf("Failed to record summary for session %s: %v", s.ID, err)
+		return
+	}
+	s.summaryRecorded = true
+}
+
+// --- セッションのまとめのハンドラ ---
+
+// handleGetSessionSummary は、終了したセッションのまとめを返します。
+func handleGetSessionSummary(c *gin.Context) {
+	var summary SessionSummary
+	err := db.First(&summary, "session_id = ?", c.Param("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if _, ok := getQuizSession(c.Param("id")); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "The session has not finished yet"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "No summary has been recorded for this session"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load session summary"})
+		return
+	}
+
+	response := gin.H{"summary": summary}
+	// 共有する文章と、画面にそのまま表示できる表記を、リクエストの地域に合わせて返す
+	format := requestLocaleFormat(c)
+	response["locale"] = format.Tag
+	response["formatted"] = gin.H{
+		"score":      format.Number(int64(summary.Score)),
+		"accuracy":   format.Percent(summary.accuracy()),
+		"finishedAt": format.Date(summary.FinishedAt),
+	}
+	response["shareText"] = format.sessionShareText(summary)
+	if p, ok := pokemonMapByID[summary.FastestPokemonID]; ok {
+		response["fastest"] = gin.H{"pokemon": p, "elapsedMs": summary.FastestMs}
+	}
+	if p, ok := pokemonMapByID[summary.HardestPokemonID]; ok {
+		response["hardest"] = gin.H{"pokemon": p, "accuracy": summary.HardestAccuracy}
+	}
+	c.JSON(http.StatusOK, response)
+}
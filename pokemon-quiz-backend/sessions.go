@@ -0,0 +1,582 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"pokemon-quiz-backend/quiz"
+)
+
+// --- クイズセッション ---
+
+// 複数の問題を続けて解くプレイの状態をサーバー側で保持します。
+// 出題した問題の正解や所持ポイントはサーバーだけが知っているため、クライアントから改ざんできません。
+
+const (
+	quizSessionTTL     = 2 * time.Hour // 最後の操作からこの時間が経ったセッションは破棄する
+	sessionBasePoint   = 10            // 正解1問あたりに獲得するポイント
+	maxSessionQuestion = 100           // 1セッションで出題できる問題数の上限
+	maxSessionSeconds  = 3600          // 制限時間の上限（秒）
+)
+
+// 賭けに使える倍率
+var wagerMultipliers = map[int]bool{2: true, 3: true, 5: true}
+
+// セッションで出題中の問題
+type sessionQuestion struct {
+	pokemon  *Pokemon
+	question gin.H // クライアントに見せる問題（IDを除く）
+	issuedAt time.Time
+}
+
+// クイズセッション
+type quizSession struct {
+	mu         sync.Mutex
+	ID         string
+	UserID     uint // ログインしていない場合は0
+	Region     string
+	Mode       string
+	Type       string // "standard"・"survival"・"batch"・"playlist" のいずれか
+	Wager      bool   // 賭けを有効にしたセッションかどうか
+	Accessible bool   // 画像を使わないアクセシブルな出題にするかどうか
+	// タイムアタック用の設定（0なら制限なし）。時間はサーバーの時計で計るため、クライアント側で延長できない
+	QuestionLimit int
+	TimeLimit     time.Duration
+	// サバイバルモードのライフ。0になるとセッションが終了する
+	MaxLives    int
+	Lives       int
+	runRecorded bool
+	// シードを指定したセッションでは、rounds 問目の問題をシードから決める
+	Seed   string
+	rounds int
+	// 回答の記録（終了したときのまとめに使う）
+	answerLog       []statsAnswer
+	summaryRecorded bool
+	// 終了したセッションの情報
+	ended       bool // プレイヤーが自分で終了したか
+	finishedAt  time.Time
+	resultToken string // 成績証明トークン
+	Balance     int    // 所持ポイント
+	Answered    int
+	Correct     int
+	Skipped     int
+	current     *sessionQuestion
+	// スキップしたポケモン（このセッションでは出題しない）
+	skippedPokemon map[int]bool
+	batch          []*sessionQuestion // まとめて出題した問題（"batch" のセッションのみ）
+	// プレイリストのセッションで出題するポケモン（出題順）
+	PlaylistID uint
+	playlist   []*Pokemon
+	CreatedAt  time.Time
+	updatedAt  time.Time
+}
+
+var (
+	quizSessions   = make(map[string]*quizSession)
+	quizSessionsMu sync.Mutex
+)
+
+// getQuizSession は、IDからセッションを取得します。しばらく操作されていないセッションはここで破棄します。
+func getQuizSession(id string) (*quizSession, bool) {
+	quizSessionsMu.Lock()
+	defer quizSessionsMu.Unlock()
+	for sessionID, session := range quizSessions {
+		session.mu.Lock()
+		expired := time.Since(session.updatedAt) > quizSessionTTL
+		session.mu.Unlock()
+		if expired {
+			delete(quizSessions, sessionID)
+		}
+	}
+	session, ok := quizSessions[id]
+	return session, ok
+}
+
+// findQuizSession は、URLパラメータのIDからセッションを取得し、操作する権限があるか確認します。
+// ログインして作成したセッションは、作成したユーザー本人しか操作できません。
+func findQuizSession(c *gin.Context) (*quizSession, bool) {
+	session, ok := getQuizSession(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return nil, false
+	}
+	if session.UserID != 0 {
+		if userID, exists := optionalUserID(c); !exists || userID != session.UserID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This session belongs to another user"})
+			return nil, false
+		}
+	}
+	return session, true
+}
+
+// nextQuestionRand は、次の問題を選ぶ乱数を返します。シードを指定していなければ nil（crypto/rand を使う）です。
+// 呼び出し側で session.mu をロックしておく必要があります。
+func (s *quizSession) nextQuestionRand() *quizRand {
+	if s.Seed == "" {
+		return nil
+	}
+	qr := newQuizRand(s.Seed, s.rounds)
+	s.rounds++
+	return qr
+}
+
+// regionPool は、出題する地方のポケモンの一覧を返します。シードを指定したセッションではIDの順に並べ直します。
+func (s *quizSession) regionPool() []*Pokemon {
+	if s.Seed == "" {
+		return regionRotation(s.Region)
+	}
+	return sortedByID(regionRotation(s.Region))
+}
+
+// unskipped は、出題の候補からスキップしたポケモンを除いた一覧を返します。
+// 全てスキップしていれば、除かずにそのまま返します。
+func (s *quizSession) unskipped(pool []*Pokemon) []*Pokemon {
+	if len(s.skippedPokemon) == 0 {
+		return pool
+	}
+	candidates := make([]*Pokemon, 0, len(pool))
+	for _, p := range pool {
+		if !s.skippedPokemon[p.ID] {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return pool
+	}
+	return candidates
+}
+
+// deadline は、制限時間のあるセッションの終了時刻を返します。
+func (s *quizSession) deadline() (time.Time, bool) {
+	if s.TimeLimit == 0 {
+		return time.Time{}, false
+	}
+	return s.CreatedAt.Add(s.TimeLimit), true
+}
+
+// isExpired は、制限時間を過ぎたかどうかを返します。
+func (s *quizSession) isExpired(now time.Time) bool {
+	deadline, ok := s.deadline()
+	return ok && !now.Before(deadline)
+}
+
+// isOutOfLives は、サバイバルモードでライフがなくなったかを返します。
+func (s *quizSession) isOutOfLives() bool {
+	return s.Type == sessionTypeSurvival && s.Lives <= 0
+}
+
+// isFinished は、問題数の上限まで回答したか、制限時間を過ぎたか、ライフがなくなったかを返します。
+func (s *quizSession) isFinished(now time.Time) bool {
+	return s.ended || (s.QuestionLimit > 0 && s.Answered >= s.QuestionLimit) || s.isExpired(now) || s.isOutOfLives()
+}
+
+// finalize は、終了したセッションの記録を残し、成績証明トークンを発行します。何度呼んでも結果は同じです。
+func (s *quizSession) finalize(now time.Time) {
+	if s.finishedAt.IsZero() {
+		s.finishedAt = now
+		if deadline, ok := s.deadline(); ok && deadline.Before(now) {
+			s.finishedAt = deadline
+		}
+	}
+	recordSurvivalRun(s)
+	recordSessionSummary(s)
+	if s.resultToken == "" {
+		token, err := issueResultToken(s)
+		if err != nil {
+			log.Printf("Failed to issue result token for session %s: %v", s.ID, err)
+			return
+		}
+		s.resultToken = token
+	}
+}
+
+// state は、クライアントに返すセッションの状態を組み立てます。
+func (s *quizSession) state() gin.H {
+	now := time.Now()
+	state := gin.H{
+		"sessionId":     s.ID,
+		"region":        s.Region,
+		"mode":          s.Mode,
+		"type":          s.Type,
+		"wager":         s.Wager,
+		"accessible":    s.Accessible,
+		"balance":       s.Balance,
+		"answered":      s.Answered,
+		"correct":       s.Correct,
+		"skipped":       s.Skipped,
+		"questionLimit": s.QuestionLimit,
+		"finished":      s.isFinished(now),
+	}
+	if s.Seed != "" {
+		state["seed"] = s.Seed
+	}
+	if deadline, ok := s.deadline(); ok {
+		remaining := deadline.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		state["timeLimit"] = int(s.TimeLimit / time.Second)
+		state["startedAt"] = s.CreatedAt
+		state["remainingMs"] = remaining.Milliseconds()
+	}
+	if s.Type == sessionTypePlaylist {
+		state["playlistId"] = s.PlaylistID
+	}
+	if s.Type == sessionTypeSurvival {
+		state["lives"] = s.Lives
+		state["maxLives"] = s.MaxLives
+	}
+	if s.resultToken != "" {
+		state["resultToken"] = s.resultToken
+	}
+	return state
+}
+
+// sessionOverError は、終了したセッションへの操作を拒否するときのレスポンスを組み立てます。
+func sessionOverError(s *quizSession) gin.H {
+	response := s.state()
+	if s.isOutOfLives() {
+		response["error"] = "No lives remaining in this session"
+		response["code"] = "out_of_lives"
+	} else if s.isExpired(time.Now()) {
+		response["error"] = "Time is up for this session"
+		response["code"] = "session_expired"
+	} else if s.ended {
+		response["error"] = "This session has already been finished"
+		response["code"] = "session_finished"
+	} else {
+		response["error"] = "All questions in this session have been answered"
+		response["code"] = "session_finished"
+	}
+	return response
+}
+
+// --- クイズセッションのハンドラ ---
+
+// handleCreateQuizSession は、新しいクイズセッションを開始します。
+func handleCreateQuizSession(c *gin.Context) {
+	var req struct {
+		Region     string `json:"region"`
+		Mode       string `json:"mode"`
+		Wager      bool   `json:"wager"`
+		Accessible bool   `json:"accessible"`
+		Questions  int    `json:"questions"` // 出題する問題数（0なら無制限、"batch" では省略時10問）
+		TimeLimit  int    `json:"timeLimit"` // セッション全体の制限時間（秒、0なら無制限）
+		Type       string `json:"type"`      // "survival" でサバイバルモード、"batch" でまとめて出題
+		Lives      int    `json:"lives"`     // サバイバルモードのライフ（省略時は3）
+		Seed       string `json:"seed"`      // 指定すると、同じ seed のセッションには同じ順番で同じ問題を出題する
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.Region == "" {
+		req.Region = "kanto"
+	}
+	if len(regionRotation(req.Region)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = quizModeStats
+	}
+	if !quizModes[req.Mode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz mode specified"})
+		return
+	}
+	if req.Questions < 0 || req.Questions > maxSessionQuestion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "questions must be between 0 and 100"})
+		return
+	}
+	if req.TimeLimit < 0 || req.TimeLimit > maxSessionSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeLimit must be between 0 and 3600 seconds"})
+		return
+	}
+	if req.Type == "" {
+		req.Type = sessionTypeStandard
+	}
+	if req.Type != sessionTypeStandard && req.Type != sessionTypeSurvival && req.Type != sessionTypeBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session type specified"})
+		return
+	}
+	if req.Type == sessionTypeBatch {
+		if req.Wager {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wagers are not available for batch sessions"})
+			return
+		}
+		if req.Questions == 0 {
+			req.Questions = defaultBatchQuestions
+		}
+	}
+	if req.Type == sessionTypeSurvival && req.Lives == 0 {
+		req.Lives = defaultSurvivalLives
+	}
+	if req.Type != sessionTypeSurvival {
+		req.Lives = 0
+	}
+	if req.Lives < 0 || req.Lives > maxSurvivalLives {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lives must be between 1 and 10"})
+		return
+	}
+	if req.Seed != "" && !validQuizSeed(req.Seed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seed must be at most 64 characters"})
+		return
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	userID, _ := optionalUserID(c)
+	now := time.Now()
+	session := &quizSession{
+		ID:            id,
+		UserID:        userID,
+		Region:        req.Region,
+		Mode:          req.Mode,
+		Type:          req.Type,
+		Wager:         req.Wager,
+		Accessible:    req.Accessible,
+		QuestionLimit: req.Questions,
+		TimeLimit:     time.Duration(req.TimeLimit) * time.Second,
+		MaxLives:      req.Lives,
+		Lives:         req.Lives,
+		Seed:          req.Seed,
+		CreatedAt:     now,
+		updatedAt:     now,
+	}
+
+	response := session.state()
+	if session.Type == sessionTypeBatch {
+		if err := prepareBatchQuestions(session, req.Questions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quiz"})
+			return
+		}
+		token, err := issueSessionToken(session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+		response["questions"] = session.batchQuestions()
+		response["sessionToken"] = token
+	}
+
+	quizSessionsMu.Lock()
+	quizSessions[session.ID] = session
+	quizSessionsMu.Unlock()
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// handleGetQuizSession は、セッションの現在の状態を返します。
+func handleGetQuizSession(c *gin.Context) {
+	session, ok := findQuizSession(c)
+	if !ok {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if now := time.Now(); session.isFinished(now) {
+		session.finalize(now)
+	}
+	c.JSON(http.StatusOK, session.state())
+}
+
+// handleFinishQuizSession は、プレイヤーが途中でセッションを終了し、その時点の成績を確定させます。
+func handleFinishQuizSession(c *gin.Context) {
+	session, ok := findQuizSession(c)
+	if !ok {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	now := time.Now()
+	if !session.isFinished(now) {
+		session.ended = true
+		session.current = nil
+		session.updatedAt = now
+	}
+	session.finalize(now)
+	c.JSON(http.StatusOK, session.state())
+}
+
+// handleNextSessionQuestion は、セッションの次の問題を出題します。
+// 回答前に再度呼ばれた場合は、同じ問題を返します（引き直しによる問題選びを防ぐ）。
+func handleNextSessionQuestion(c *gin.Context) {
+	session, ok := findQuizSession(c)
+	if !ok {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Type == sessionTypeBatch {
+		c.JSON(http.StatusConflict, gin.H{"error": "Batch sessions issue all questions at creation; submit answers instead"})
+		return
+	}
+	if now := time.Now(); session.isFinished(now) {
+		session.finalize(now)
+		c.JSON(http.StatusGone, sessionOverError(session))
+		return
+	}
+	if session.current == nil {
+		// プレイリストは順に出題し、不正解の選択肢も同じプレイリストから選ぶ
+		pool, idx := session.playlist, session.Answered
+		candidates := pool
+		qr := session.nextQuestionRand()
+		if session.Type != sessionTypePlaylist {
+			pool = session.regionPool()
+			candidates = session.unskipped(pool)
+			// 出題から外したため地方にポケモンがいなくなったら、セッションを終了する
+			if len(candidates) == 0 {
+				now := time.Now()
+				session.ended = true
+				session.updatedAt = now
+				session.finalize(now)
+				response := sessionOverError(session)
+				response["error"] = "No Pokemon are available in this region; the session has ended"
+				response["code"] = "region_unavailable"
+				c.JSON(http.StatusConflict, response)
+				return
+			}
+			var err error
+			idx, err = qr.index(len(candidates))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select a random pokemon"})
+				return
+			}
+		}
+		pokemon := candidates[idx]
+		question, err := newQuizQuestion(qr, pokemon, pool, session.Mode, defaultOptionCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quiz"})
+			return
+		}
+		if session.Accessible {
+			addAccessibleHints(question, pokemon)
+		}
+		recordQuestionServed(session.UserID, pokemon.ID, session.Mode, "", "session", session.Accessible)
+		delete(question, "id") // 正解が分からないようにIDは返さない
+		session.current = &sessionQuestion{
+			pokemon:  pokemon,
+			question: question,
+			issuedAt: time.Now(),
+		}
+	}
+	session.updatedAt = time.Now()
+
+	question := session.current.question
+	question["questionNumber"] = session.Answered + 1
+	question["balance"] = session.Balance
+	question["questionLimit"] = session.QuestionLimit
+	if deadline, ok := session.deadline(); ok {
+		question["remainingMs"] = time.Until(deadline).Milliseconds()
+	}
+	c.JSON(http.StatusOK, question)
+}
+
+// handleSessionAnswer は、出題中の問題への回答を採点し、賭けたポイントを精算します。
+// 正解すると基本ポイントに加えて「賭け金×(倍率-1)」を獲得し、不正解なら賭け金を失います。
+func handleSessionAnswer(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name" binding:"required"`
+		Stake      int    `json:"stake"`
+		Multiplier int    `json:"multiplier"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	session, ok := findQuizSession(c)
+	if !ok {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Type == sessionTypeBatch {
+		c.JSON(http.StatusConflict, gin.H{"error": "Batch sessions issue all questions at creation; submit answers instead"})
+		return
+	}
+	// 制限時間を過ぎてから届いた回答や、問題数の上限を超える回答は受け付けない
+	if now := time.Now(); session.isFinished(now) {
+		session.current = nil
+		session.finalize(now)
+		c.JSON(http.StatusGone, sessionOverError(session))
+		return
+	}
+	if session.current == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "No question has been issued"})
+		return
+	}
+	if req.Stake != 0 {
+		if !session.Wager {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wagers are not enabled for this session"})
+			return
+		}
+		if req.Stake < 0 || req.Stake > session.Balance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Stake must be between 0 and your current balance"})
+			return
+		}
+		if !wagerMultipliers[req.Multiplier] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Multiplier must be 2, 3 or 5"})
+			return
+		}
+	}
+
+	if !isOfferedOption(session.current.question, req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be one of the options from the question"})
+		return
+	}
+	correctPokemon := session.current.pokemon
+	isCorrect := quiz.IsSameAnswer(req.Name, answerName(correctPokemon, session.Mode))
+	answer := statsAnswer{PokemonID: correctPokemon.ID, Mode: session.Mode, IsCorrect: isCorrect, Elapsed: time.Since(session.current.issuedAt), AnsweredAt: time.Now()}
+	delta := 0
+	if isCorrect {
+		delta = sessionBasePoint
+		if req.Stake > 0 {
+			delta += req.Stake * (req.Multiplier - 1)
+		}
+		session.Correct++
+	} else {
+		delta = -req.Stake
+		if session.Type == sessionTypeSurvival {
+			session.Lives--
+		}
+	}
+	session.Balance += delta
+	session.Answered++
+	session.answerLog = append(session.answerLog, answer)
+	session.current = nil
+	session.updatedAt = time.Now()
+	if session.isFinished(session.updatedAt) {
+		session.finalize(session.updatedAt)
+	}
+
+	response := session.state()
+	if xp, ok := recordAnswerSubmitted(c, session.UserID, correctPokemon.ID, session.Mode, "", "session", isCorrect); ok {
+		response["xp"] = xp
+	}
+	if session.UserID != 0 {
+		res, ok, pending := updateUserStats(session.UserID, answer)
+		if ok {
+			response["streak"] = res.Streak
+			response["stats"] = res.Stats
+			response["score"] = res.Score
+		}
+		if pending {
+			response["statsPending"] = true
+		}
+	}
+	response["isCorrect"] = isCorrect
+	response["correctPokemon"] = correctPokemon
+	response["explanation"] = buildExplanation(correctPokemon)
+	response["pointsDelta"] = delta
+	c.JSON(http.StatusOK, response)
+}
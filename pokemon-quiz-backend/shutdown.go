@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// --- 終了処理 ---
+
+// SIGINT・SIGTERM を受け取ったら、新しいリクエストの受け付けをやめ、処理中のリクエストが終わるのを待ってから、
+// キューやバッファに積んである書き込み（成績・行動記録・APIの利用状況）を書き出して終了します。
+
+// 処理中のリクエストを待つ時間
+const shutdownTimeout = 30 * time.Second
+
+// serve は、handler でリクエストを受け付け、終了のシグナルを受け取るまで戻りません。
+func serve(addr string, handler http.Handler) {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	select {
+	case err := <-errc:
+		log.Fatalf("Server stopped: %v", err)
+	case sig := <-stop:
+		log.Printf("Received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Failed to finish in-flight requests: %v", err)
+	}
+	flushPendingWrites()
+	log.Println("Server stopped")
+}
+
+// flushPendingWrites は、キューやバッファに積んである書き込みを書き出します。
+func flushPendingWrites() {
+	if statsQueue != nil {
+		statsQueue.close()
+	}
+	if activity != nil {
+		activity.close()
+	}
+	flushUsage()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 問題のスキップ ---
+
+// 分からない問題を当てずっぽうで答えて先に進むと、間違えたリストや正答率が実力と関係なく悪くなるので、
+// POST /quiz/:questionID/skip で問題を飛ばせるようにします（questionID は /quiz の問題の questionId）。
+// スキップは回答数・正答率・間違えたリストには含めず、TotalSkipped として別に数えます。
+// スキップした問題は /answer と同じ nonce を使用済みにするので、正解を見てから答えることはできません
+// （既に答えた問題のスキップも 409 で断る）。
+// 答えずに連続正解を伸ばせないよう、連続正解はスキップで途切れます。
+// ログインユーザーがスキップできるのは1日に SKIP_DAILY_LIMIT 回（既定は5回）までで、回数はライフラインと同じく
+// データベースで数えます。セッションでは POST /quiz/session/:id/skip でスキップでき、
+// スキップしたポケモンはそのセッションの間は出題しません。
+
+// applySkip は、1問分のスキップを成績に反映し、更新後の連続正解の状況を返します（保存はしない）。
+func applySkip(stat *UserStat) answerStreak {
+	stat.TotalSkipped++
+	stat.CurrentStreak = 0
+	return answerStreak{Current: 0, Best: stat.BestStreak}
+}
+
+// handleSkipQuestion は、問題をスキップして正解を返します。ログインしていれば成績にも反映します。
+func handleSkipQuestion(c *gin.Context) {
+	questionID := c.Param("questionID")
+	// ライフラインを使う前に、既に答えた（スキップした）問題でないかを確かめる
+	if answerNonceUsed(questionAnswerNonce(questionID)) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This question has already been answered"})
+		return
+	}
+	userID, exists := optionalUserID(c)
+	servedQuestionsMu.Lock()
+	var q servedQuestion
+	served, ok := lookupServedQuestion(questionID, userID)
+	if ok {
+		q = *served // ヒントの利用などで書き換えられるので、ロックしている間に写す
+	}
+	servedQuestionsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	correctPokemon := q.pokemon
+	pack, ok := lookupPack(q.Pack)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown content pack specified"})
+		return
+	}
+
+	// コンテンツパックの問題は成績に含めないので、回数も数えない
+	countsForStats := exists && pack.isDefaultPack()
+	// 回数を数えてから nonce を使用済みにする（回数が残っていなければ、その問題にはまだ答えられる）。
+	// 同時に答えられて nonce を使えなかったときは、数えた回数を取り消す
+	remaining := -1
+	now := time.Now()
+	if countsForStats {
+		var err error
+		if remaining, err = useLifeline(userID, lifelineSkip, skipDailyLimit, now); err != nil {
+			respondLifelineError(c, err, "skip")
+			return
+		}
+	}
+	if !consumeAnswerNonce(questionAnswerNonce(questionID), q.servedAt.Add(questionTokenTTL)) {
+		if countsForStats {
+			if err := refundLifeline(userID, lifelineSkip, now); err != nil {
+				log.Printf("Failed to refund skip for user %d: %v", userID, err)
+			}
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "This question has already been answered"})
+		return
+	}
+	takeServedQuestion(questionID, userID)
+
+	response := gin.H{
+		"skipped":        true,
+		"correctPokemon": correctPokemon,
+		"explanation":    buildExplanation(correctPokemon),
+		"hintsUsed":      q.HintsUsed,
+	}
+	recordQuestionSkipped(userID, correctPokemon.ID, q.Mode, q.Pack, "quiz")
+	if countsForStats {
+		streak, pending, err := writeUserSkip(userID, answerStatsWait)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record skip"})
+			return
+		}
+		if pending {
+			response["statsPending"] = true
+		} else {
+			response["streak"] = streak
+		}
+		response["skipsRemaining"] = remaining
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleSessionSkip は、セッションで出題中の問題をスキップします。
+// スキップは回答数に含めず、スキップしたポケモンはそのセッションでは出題しません。
+func handleSessionSkip(c *gin.Context) {
+	session, ok := findQuizSession(c)
+	if !ok {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Type == sessionTypeBatch || session.Type == sessionTypePlaylist {
+		c.JSON(http.StatusConflict, gin.H{"error": "Questions cannot be skipped in this session type"})
+		return
+	}
+	if now := time.Now(); session.isFinished(now) {
+		session.current = nil
+		session.finalize(now)
+		c.JSON(http.StatusGone, sessionOverError(session))
+		return
+	}
+	if session.current == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "No question has been issued"})
+		return
+	}
+
+	remaining := -1
+	if session.UserID != 0 {
+		var err error
+		if remaining, err = useLifeline(session.UserID, lifelineSkip, skipDailyLimit, time.Now()); err != nil {
+			respondLifelineError(c, err, "skip")
+			return
+		}
+	}
+
+	correctPokemon := session.current.pokemon
+	if session.skippedPokemon == nil {
+		session.skippedPokemon = make(map[int]bool)
+	}
+	session.skippedPokemon[correctPokemon.ID] = true
+	session.Skipped++
+	session.current = nil
+	session.updatedAt = time.Now()
+
+	response := session.state()
+	recordQuestionSkipped(session.UserID, correctPokemon.ID, session.Mode, "", "session")
+	if session.UserID != 0 {
+		// 失敗したときは writeUserSkip がログに出す
+		streak, pending, err := writeUserSkip(session.UserID, answerStatsWait)
+		if pending {
+			response["statsPending"] = true
+		} else if err == nil {
+			response["streak"] = streak
+		}
+		response["skipsRemaining"] = remaining
+	}
+	response["skipped"] = true
+	response["correctPokemon"] = correctPokemon
+	response["explanation"] = buildExplanation(correctPokemon)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- レスポンス時間のSLO ---
+
+// ルートごとにレスポンス時間を記録し、直近のリクエストのパーセンタイルを /metrics に公開します。
+// しきい値を超えたリクエストはログに出して数えるので、問題の生成が遅くなったことにすぐ気付けます。
+// しきい値は SLO_THRESHOLD_MS（全ルート共通）と SLO_ROUTE_THRESHOLDS（"GET /quiz=200,POST /answer=300" の形式）で設定します。
+
+const (
+	defaultSLOThreshold = 500 * time.Millisecond
+	sloSampleSize       = 1024 // パーセンタイルの計算に使う直近のリクエスト数
+)
+
+// 公開するパーセンタイル
+var sloQuantiles = []float64{0.5, 0.9, 0.99}
+
+// 1つのルートのレスポンス時間の記録
+type routeLatency struct {
+	samples    []time.Duration // 直近のレスポンス時間（リングバッファ）
+	next       int
+	count      uint64
+	sum        time.Duration
+	violations uint64
+}
+
+// ルートごとのレスポンス時間の記録
+type sloTracker struct {
+	mu               sync.Mutex
+	routes           map[string]*routeLatency
+	defaultThreshold time.Duration
+	thresholds       map[string]time.Duration // ルートごとのしきい値
+}
+
+// .env を読み込んだ後に main で環境変数のしきい値を反映する
+var routeSLO = newSLOTracker("", "")
+
+// newSLOTracker は、環境変数の値からしきい値を読み取って記録を初期化します。不正な値は無視します。
+func newSLOTracker(defaultMS, routeThresholds string) *sloTracker {
+	t := &sloTracker{
+		routes:           make(map[string]*routeLatency),
+		defaultThreshold: defaultSLOThreshold,
+		thresholds:       make(map[string]time.Duration),
+	}
+	if ms, err := strconv.Atoi(defaultMS); err == nil && ms > 0 {
+		t.defaultThreshold = time.Duration(ms) * time.Millisecond
+	}
+	for _, entry := range strings.Split(routeThresholds, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		ms, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || ms <= 0 {
+			log.Printf("Ignoring invalid SLO threshold %q", entry)
+			continue
+		}
+		t.thresholds[strings.TrimSpace(route)] = time.Duration(ms) * time.Millisecond
+	}
+	return t
+}
+
+// threshold は、ルートのしきい値を返します。
+func (t *sloTracker) threshold(route string) time.Duration {
+	if d, ok := t.thresholds[route]; ok {
+		return d
+	}
+	return t.defaultThreshold
+}
+
+// observe は、1回分のレスポンス時間を記録し、しきい値を超えたかどうかを返します。
+func (t *sloTracker) observe(route string, d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.routes[route]
+	if !ok {
+		r = &routeLatency{samples: make([]time.Duration, 0, sloSampleSize)}
+		t.routes[route] = r
+	}
+	if len(r.samples) < sloSampleSize {
+		r.samples = append(r.samples, d)
+	} else {
+		r.samples[r.next] = d
+	}
+	r.next = (r.next + 1) % sloSampleSize
+	r.count++
+	r.sum += d
+
+	exceeded := d > t.threshold(route)
+	if exceeded {
+		r.violations++
+	}
+	return exceeded
+}
+
+// percentiles は、直近のレスポンス時間のパーセンタイルを返します。
+func (r *routeLatency) percentiles() []time.Duration {
+	sorted := make([]time.Duration, len(r.samples))
+	copy(sorted, r.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	result := make([]time.Duration, len(sloQuantiles))
+	if len(sorted) == 0 {
+		return result
+	}
+	for i, q := range sloQuantiles {
+		// 最近傍順位法: 全体の q 以上が収まる最小の値
+		idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		result[i] = sorted[idx]
+	}
+	return result
+}
+
+// sloMiddleware は、ルートごとのレスポンス時間を記録し、しきい値を超えたリクエストをログに出します。
+// 存在しないパスへのリクエストと、接続を保ち続けるSSEのストリームは記録しません。
+func sloMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if c.FullPath() == "" || strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		route := c.Request.Method + " " + c.FullPath()
+		elapsed := time.Since(start)
+		if routeSLO.observe(route, elapsed) {
+			log.Printf("SLO exceeded: %s took %s (threshold %s, status %d)", route, elapsed.Round(time.Millisecond), routeSLO.threshold(route), c.Writer.Status())
+		}
+	}
+}
+
+// writeRouteMetrics は、ルートごとのレスポンス時間をPrometheusのテキスト形式で書き出します。
+func writeRouteMetrics(b *strings.Builder) {
+	t := routeSLO
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	routes := make([]string, 0, len(t.routes))
+	for route := range t.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	b.WriteString("# HELP pokequiz_http_request_duration_seconds Response time of recent requests by route.\n")
+	b.WriteString("# TYPE pokequiz_http_request_duration_seconds summary\n")
+	for _, route := range routes {
+		r := t.routes[route]
+		for i, p := range r.percentiles() {
+			fmt.Fprintf(b, "pokequiz_http_request_duration_seconds{route=%q,quantile=\"%g\"} %g\n", route, sloQuantiles[i], p.Seconds())
+		}
+		fmt.Fprintf(b, "pokequiz_http_request_duration_seconds_sum{route=%q} %g\n", route, r.sum.Seconds())
+		fmt.Fprintf(b, "pokequiz_http_request_duration_seconds_count{route=%q} %d\n", route, r.count)
+	}
+	b.WriteString("# HELP pokequiz_http_slo_threshold_seconds Response time threshold by route.\n")
+	b.WriteString("# TYPE pokequiz_http_slo_threshold_seconds gauge\n")
+	for _, route := range routes {
+		fmt.Fprintf(b, "pokequiz_http_slo_threshold_seconds{route=%q} %g\n", route, t.threshold(route).Seconds())
+	}
+	b.WriteString("# HELP pokequiz_http_slo_violations_total Requests slower than the route threshold.\n")
+	b.WriteString("# TYPE pokequiz_http_slo_violations_total counter\n")
+	for _, route := range routes {
+		fmt.Fprintf(b, "pokequiz_http_slo_violations_total{route=%q} %d\n", route, t.routes[route].violations)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 起動処理 ---
+
+// ポケモンデータの読み込みをバックグラウンドで行い、サーバーはプロセスの起動直後からリクエストを受け付けます。
+// データの準備ができるまでは、ポケモンデータを使うエンドポイントは 503 を返します（/healthz などは常に応答する）。
+// 種族値の近傍の索引のような重い処理は、出題を受け付け始めてから構築します。
+//
+// Render の無料プランなどでは、しばらくアクセスがないとサーバーが止まり、次の最初のユーザーが起動を待つことになります。
+// cron などから /warmup を呼ぶと、データの準備ができるまで（最大 warmupWaitTimeout）待ち、
+// データベースへの接続を開いて、今日のデイリーチャレンジを作っておくので、実際のユーザーは待たずに済みます。
+
+const (
+	warmupWaitTimeout  = 25 * time.Second // Render の cron などのタイムアウトより短くする
+	warmupPollInterval = 100 * time.Millisecond
+)
+
+// ポケモンデータの準備ができたかどうか
+var dataReady atomic.Bool
+
+// データの準備ができていなくても応答するパス
+var pathsWithoutData = map[string]bool{
+	"/healthz":      true,
+	"/warmup":       true,
+	"/readyz":       true,
+	"/metrics":      true,
+	"/capabilities": true,
+	"/register":     true,
+	"/login":        true,
+	"/refresh":      true,
+}
+
+// loadPokemonDataInBackground は、ポケモンデータの読み込みをバックグラウンドで開始します。
+func loadPokemonDataInBackground() {
+	go func() {
+		start := time.Now()
+		if err := loadOrFetchPokemonData(); err != nil {
+			log.Fatalf("Failed to initialize Pokemon data: %v", err)
+		}
+		dataReady.Store(true)
+		log.Printf("Pokemon data is ready after %s.", time.Since(start).Round(time.Millisecond))
+
+		// 難易度「hard」で使う種族値の近傍を計算（できるまでは出題のたびに計算する）
+		buildStatNeighborIndex()
+		log.Printf("Stat neighbor index is ready after %s.", time.Since(start).Round(time.Millisecond))
+	}()
+}
+
+// dataReadyMiddleware は、ポケモンデータの準備ができるまでリクエストを 503 で断ります。
+func dataReadyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if dataReady.Load() || pathsWithoutData[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "5")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Pokemon data is still loading, please try again shortly",
+			"code":  "not_ready",
+		})
+	}
+}
+
+// --- 起動状態のハンドラ ---
+
+// handleHealthz は、プロセスが動いていれば常に 200 を返します（死活監視用）。
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "ready": dataReady.Load()})
+}
+
+// handleWarmup は、データの準備ができるまで待ってから、データベースの接続とキャッシュを準備します。
+// 準備ができれば 200、待ちきれなかったりデータベースにつながらなければ 503 を返します。
+func handleWarmup(c *gin.Context) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), warmupWaitTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(warmupPollInterval)
+	defer ticker.Stop()
+	for !dataReady.Load() {
+		select {
+		case <-ctx.Done():
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "elapsedMs": time.Since(start).Milliseconds()})
+			return
+		case <-ticker.C:
+		}
+	}
+
+	// データベースの接続を開いておく
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		log.Printf("Warmup failed to reach the database: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": true, "database": false, "elapsedMs": time.Since(start).Milliseconds()})
+		return
+	}
+
+	// 今日のデイリーチャレンジは最初に開いたユーザーのリクエストで作るので、先に作っておく
+	_, dailyErr := getDailyChallenge(dateKey(time.Now()))
+	if dailyErr != nil {
+		log.Printf("Warmup failed to prepare the daily challenge: %v", dailyErr)
+	}
+
+	statNeighborIndexMu.RLock()
+	neighborIndexReady := len(statNeighborIndex) > 0
+	statNeighborIndexMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"ready":              true,
+		"database":           true,
+		"pokemon":            len(pokemonMapByID),
+		"daily":              dailyErr == nil,
+		"neighborIndexReady": neighborIndexReady,
+		"elapsedMs":          time.Since(start).Milliseconds(),
+	})
+}
+
+// handleReadyz は、ポケモンデータの準備ができていれば 200、まだなら 503 を返します。
+func handleReadyz(c *gin.Context) {
+	if !dataReady.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ready": true, "pokemon": len(pokemonMapByID)})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// --- 成績の非同期書き込み ---
+
+// 回答の応答をデータベースへの書き込みから切り離すため、成績の更新はキューに積んでワーカーが順に処理します。
+// 同じユーザーの更新は必ず同じワーカーに割り当てるので、回答した順に反映されます。
+// /answer だけでなく、セッション・デイリーチャレンジ・まとめて出題するセッションの回答も writeUserStats で、
+// 問題のスキップも writeUserSkip で同じキューを通すので、どこで答えても同じユーザーの書き込みの順番は崩れません。
+// 応答に更新後の成績を含めるため、書き込みが終わるまで少しだけ待ちます（待ち切れなければ pending を返し、書き込みは後で行われる）。
+// キューがいっぱいのときはリクエストを待たせず、その場で同期的に書き込みます。
+// その場合だけは、キューに残っている同じユーザーの回答より先に反映されることがあります（合計は変わらず、連続正解の数え方だけが前後する）。
+// ワーカー数は STATS_WORKERS、ワーカーごとのキューの長さは STATS_QUEUE_SIZE で設定します。
+// 終了するときは、キューに残っている更新をすべて書き込んでから止めます（shutdown.go）。
+
+const (
+	defaultStatsWorkers   = 4
+	defaultStatsQueueSize = 256
+	answerStatsWait       = 250 * time.Millisecond // 1問の回答の応答に含める成績の書き込みを待つ時間
+	batchStatsWait        = 5 * time.Second        // まとめて答えた回答の書き込みを待つ時間
+)
+
+// キューに積む回答結果（skip なら問題のスキップ）
+type statsUpdate struct {
+	userID  uint
+	answers []statsAnswer
+	skip    bool
+	done    chan statsWriteResult // 書き込みが終わったら結果を送る
+}
+
+// 成績の書き込みの結果
+type statsWriteResult struct {
+	res    answerStatsResult
+	streak answerStreak // スキップを反映した後の連続正解の状況（skip のときだけ）
+	err    error
+}
+
+// apply は、更新を成績に反映します。失敗したらログに出します。バックアップの復元の間は待ちます。
+func (u statsUpdate) apply() statsWriteResult {
+	restoreGate.RLock()
+	defer restoreGate.RUnlock()
+	if u.skip {
+		streak, err := users.ApplySkip(u.userID)
+		if err != nil {
+			log.Printf("Failed to record skip for user %d: %v", u.userID, err)
+		}
+		return statsWriteResult{streak: streak, err: err}
+	}
+	res, err := applyUserAnswers(u.userID, u.answers)
+	return statsWriteResult{res: res, err: err}
+}
+
+// ユーザーごとに順序を保って成績を書き込むキュー
+type statsWriteQueue struct {
+	queues  []chan statsUpdate
+	workers sync.WaitGroup
+	mu      sync.RWMutex // closed とキューへの送信を守る
+	closed  bool
+}
+
+// main でワーカーを起動するまでは nil（その間は同期的に書き込む）
+var statsQueue *statsWriteQueue
+
+// startStatsWorkers は、成績を書き込むワーカーを起動します。
+func startStatsWorkers(workers, queueSize int) *statsWriteQueue {
+	if workers <= 0 {
+		workers = defaultStatsWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultStatsQueueSize
+	}
+	q := &statsWriteQueue{queues: make([]chan statsUpdate, workers)}
+	for i := range q.queues {
+		ch := make(chan statsUpdate, queueSize)
+		q.queues[i] = ch
+		q.workers.Add(1)
+		go func() {
+			defer q.workers.Done()
+			for u := range ch {
+				u.done <- u.apply()
+			}
+		}()
+	}
+	log.Printf("Started %d stats workers (queue size %d).", workers, queueSize)
+	return q
+}
+
+// tryEnqueue は、回答結果をユーザーの担当のワーカーのキューに積みます。
+// キューがいっぱいか、止めた後なら積まずに false を返します。
+func (q *statsWriteQueue) tryEnqueue(u statsUpdate) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.queues[u.userID%uint(len(q.queues))] <- u:
+		return true
+	default:
+		return false
+	}
+}
+
+// close は、新しい更新の受け付けをやめ、キューに残っている更新をワーカーがすべて書き込むまで待ちます。
+// close の後の更新は、その場で同期的に書き込まれます。
+func (q *statsWriteQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, ch := range q.queues {
+			close(ch)
+		}
+	}
+	q.mu.Unlock()
+	q.workers.Wait()
+}
+
+// pending は、まだ書き込まれていない更新の数を返します。
+func (q *statsWriteQueue) pending() int {
+	n := 0
+	for _, ch := range q.queues {
+		n += len(ch)
+	}
+	return n
+}
+
+// writeUserStats は、回答結果をユーザーの成績に反映し、書き込みが wait 以内に終わればその結果を返します。
+// 待ち切れなかった場合は pending が true になり、書き込みはそのまま後で行われます（失敗してもログに出すだけ）。
+func writeUserStats(userID uint, answers []statsAnswer, wait time.Duration) (res answerStatsResult, pending bool, err error) {
+	r, pending := submitStatsUpdate(statsUpdate{userID: userID, answers: answers}, wait)
+	return r.res, pending, r.err
+}
+
+// writeUserSkip は、問題のスキップをユーザーの成績に反映し、書き込みが wait 以内に終われば連続正解の状況を返します。
+// 待ち切れなかった場合は writeUserStats と同じく pending が true になります。
+func writeUserSkip(userID uint, wait time.Duration) (streak answerStreak, pending bool, err error) {
+	r, pending := submitStatsUpdate(statsUpdate{userID: userID, skip: true}, wait)
+	return r.streak, pending, r.err
+}
+
+// submitStatsUpdate は、更新をキューに積んで wait だけ結果を待ちます。
+func submitStatsUpdate(u statsUpdate, wait time.Duration) (statsWriteResult, bool) {
+	if statsQueue == nil {
+		return u.apply(), false
+	}
+	u.done = make(chan statsWriteResult, 1)
+	if !statsQueue.tryEnqueue(u) {
+		log.Printf("Stats queue is full or stopped, writing stats for user %d synchronously", u.userID)
+		return u.apply(), false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case r := <-u.done:
+		return r, false
+	case <-timer.C:
+		return statsWriteResult{}, true
+	}
+}
+
+// applyUserAnswers は、回答結果をユーザーの成績に1つのトランザクションで反映します。失敗したらログに出します。
+func applyUserAnswers(userID uint, answers []statsAnswer) (answerStatsResult, error) {
+	res, err := users.ApplyAnswers(userID, answers)
+	if err != nil {
+		log.Printf("Failed to update user stats for user %d: %v", userID, err)
+	}
+	return res, err
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- ユーザーと成績の保存先 ---
+
+// ユーザーと成績の読み書きは userStore を通して行い、保存先を差し替えられるようにします。
+// 既定はGORM（PostgreSQL・SQLite）で、STORAGE=memory ならメモリ上に保存します（デモ用。再起動で消える）。
+// ハンドラはこのインターフェースだけを使うので、実際のデータベースがなくても動かせます。
+
+var (
+	errUserNotFound  = errors.New("user not found")
+	errUsernameTaken = errors.New("username already exists")
+)
+
+// 成績に反映する1問分の回答結果
+type statsAnswer struct {
+	PokemonID int
+	Mode      string // 出題形式（分からなければ空）
+	IsCorrect bool
+	HintsUsed int           // 使ったヒントの数（得点の計算に使う）
+	Elapsed   time.Duration // 答えるまでにかかった時間（分からなければ0）
+	// 回答した時刻（XPの倍率を掛けるかの判断に使う。空なら成績に反映した時刻）
+	AnsweredAt time.Time
+	// 連続正解シールドを使ったので、間違えても連続正解を途切れさせない（items.go が成績の更新の中で設定する）
+	StreakShielded bool
+}
+
+// 全ユーザーの成績の合計
+type statTotals struct {
+	Players   int64
+	Questions int64
+	Correct   int64
+}
+
+// ユーザーと成績の保存先
+type userStore interface {
+	// CreateUser は、ユーザーと空の成績を作成します。ユーザー名が使われていれば errUsernameTaken を返します。
+	CreateUser(user *User) error
+	// UserByID と UserByUsername は、ユーザーがいなければ errUserNotFound を返します。
+	UserByID(id uint) (*User, error)
+	UserByUsername(username string) (*User, error)
+	// PromoteAdmin は、ユーザーを管理者にします（ユーザーがいなければ何もしない）。
+	PromoteAdmin(username string) error
+	// UpdatePassword は、ユーザーのパスワードのハッシュと、パスワードを変えた時刻を置き換え、トークンの版を上げます。
+	UpdatePassword(userID uint, passwordHash string, changedAt time.Time) error
+	// Stats は、ユーザーの成績を返します。まだなければ nil を返します。
+	Stats(userID uint) (*UserStat, error)
+	// ApplyAnswers は、回答結果を順に成績に反映し、最後の回答を反映した後の状況を返します。
+	// 成績と一緒に、回答ごとの得点・デイリー目標の進捗・連続正解シールドの獲得と消費も保存します。
+	// 途中で失敗した場合は1問も反映しません。自己ベストを途中で更新していれば IsNewBest は true になります。
+	ApplyAnswers(userID uint, answers []statsAnswer) (answerStatsResult, error)
+	// ApplySkip は、問題をスキップしたことを成績に反映し、反映した後の連続正解の状況を返します。
+	ApplySkip(userID uint) (answerStreak, error)
+	// PokemonAttempts は、ユーザーのポケモンごとの回答記録をポケモンのIDをキーにして返します。
+	PokemonAttempts(userID uint) (map[int]PokemonAttempt, error)
+	// PokemonAttemptTotals は、全ユーザーの回答記録をポケモンごとに合計して返します。
+	PokemonAttemptTotals() ([]pokemonAttemptTotal, error)
+	// GlobalTotals は、全ユーザーの成績の合計を返します。
+	GlobalTotals() (statTotals, error)
+	// WrongAnswerLists は、全ユーザーの間違えたリスト（JSON配列の文字列）のうち空でないものを返します。
+	WrongAnswerLists() ([]string, error)
+	// StatUserIDs は、成績があるユーザーのIDを返します。
+	StatUserIDs() ([]uint, error)
+	// SetRegionalStats は、ユーザーの地方ごとの成績を置き換えます。成績がなければ何もしません。
+	SetRegionalStats(userID uint, regionalStats map[string]RegionalStatDetail) error
+	// Items は、ユーザーの持ち物を返します。
+	Items(userID uint) ([]InventoryItem, error)
+	// UseItem は、持っているアイテムを1つ使って構え、使った後の持ち物を返します。
+	// 構えている間は errItemAlreadyActive、持っていなければ errItemNotOwned を返します。
+	UseItem(userID uint, item string) (InventoryItem, error)
+	// DailyGoal は、ユーザーのデイリー目標（未設定ならデフォルト値）と、now の日の進捗を返します。
+	DailyGoal(userID uint, now time.Time) (UserGoal, DailyProgress, error)
+	// UpdateDailyGoal は、ユーザーのデイリー目標を変更します。nil の項目は変更しません。
+	UpdateDailyGoal(userID uint, dailyQuestions, dailyAccuracy *int) error
+}
+
+// main で STORAGE に応じて設定する
+var users userStore
+
+// newUserStore は、STORAGE の値に応じた保存先を作成します。
+func newUserStore(kind string, db *gorm.DB) userStore {
+	if kind == "memory" {
+		log.Println("Using in-memory storage for users and stats (data is lost on restart).")
+		return newMemoryUserStore()
+	}
+	return gormUserStore{db: db}
+}
+
+// --- GORMによる実装 ---
+
+type gormUserStore struct {
+	db *gorm.DB
+}
+
+func (s gormUserStore) CreateUser(user *User) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUsernameTaken
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return errUsernameTaken // 同時に登録された場合は一意制約で失敗する
+		}
+		return tx.Create(&UserStat{UserID: user.ID, WrongAnswers: "[]"}).Error
+	})
+}
+
+func (s gormUserStore) UserByID(id uint) (*User, error) {
+	var user User
+	result := s.db.Where("id = ?", id).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errUserNotFound
+	}
+	return &user, nil
+}
+
+func (s gormUserStore) UserByUsername(username string) (*User, error) {
+	var user User
+	result := s.db.Where("username = ?", username).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errUserNotFound
+	}
+	return &user, nil
+}
+
+func (s gormUserStore) PromoteAdmin(username string) error {
+	return s.db.Model(&User{}).Where("username = ?", username).Update("is_admin", true).Error
+}
+
+func (s gormUserStore) UpdatePassword(userID uint, passwordHash string, changedAt time.Time) error {
+	result := s.db.Model(&User{}).Where("id = ?", userID).
+		Updates(map[string]any{"password_hash": passwordHash, "password_changed_at": changedAt, "token_version": gorm.Expr("token_version + 1")})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func (s gormUserStore) Stats(userID uint) (*UserStat, error) {
+	var stat UserStat
+	result := s.db.Where("user_id = ?", userID).Limit(1).Find(&stat)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &stat, nil
+}
+
+func (s gormUserStore) ApplyAnswers(userID uint, answers []statsAnswer) (answerStatsResult, error) {
+	var result answerStatsResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, a := range answers {
+			res, err := applyAnswerToStats(tx, userID, a)
+			if err != nil {
+				return err
+			}
+			res.Streak.IsNewBest = res.Streak.IsNewBest || result.Streak.IsNewBest
+			result = res
+		}
+		return nil
+	})
+	if err != nil {
+		return answerStatsResult{}, err
+	}
+	return result, nil
+}
+
+func (s gormUserStore) ApplySkip(userID uint) (answerStreak, error) {
+	var streak answerStreak
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		stat, err := lockUserStat(tx, userID)
+		if err != nil {
+			return err
+		}
+		streak = applySkip(&stat)
+		return tx.Save(&stat).Error
+	})
+	return streak, err
+}
+
+func (s gormUserStore) PokemonAttempts(userID uint) (map[int]PokemonAttempt, error) {
+	var list []PokemonAttempt
+	if err := s.db.Where("user_id = ?", userID).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	attempts := make(map[int]PokemonAttempt, len(list))
+	for _, a := range list {
+		attempts[a.PokemonID] = a
+	}
+	return attempts, nil
+}
+
+func (s gormUserStore) PokemonAttemptTotals() ([]pokemonAttemptTotal, error) {
+	var totals []pokemonAttemptTotal
+	err := s.db.Model(&PokemonAttempt{}).
+		Select("pokemon_id, COUNT(DISTINCT user_id) AS players, SUM(attempts) AS attempts, SUM(correct) AS correct").
+		Group("pokemon_id").
+		Scan(&totals).Error
+	return totals, err
+}
+
+func (s gormUserStore) GlobalTotals() (statTotals, error) {
+	var totals statTotals
+	err := s.db.Model(&UserStat{}).
+		Select("COUNT(*) AS players, COALESCE(SUM(total_questions), 0) AS questions, COALESCE(SUM(total_correct), 0) AS correct").
+		Scan(&totals).Error
+	return totals, err
+}
+
+func (s gormUserStore) WrongAnswerLists() ([]string, error) {
+	var lists []string
+	err := s.db.Model(&UserStat{}).Where("wrong_answers <> '' AND wrong_answers <> '[]'").Pluck("wrong_answers", &lists).Error
+	return lists, err
+}
+
+func (s gormUserStore) StatUserIDs() ([]uint, error) {
+	var ids []uint
+	err := s.db.Model(&UserStat{}).Order("user_id").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (s gormUserStore) SetRegionalStats(userID uint, regionalStats map[string]RegionalStatDetail) error {
+	data, err := json.Marshal(regionalStats)
+	if err != nil {
+		return err
+	}
+	return s.db.Model(&UserStat{}).Where("user_id = ?", userID).Update("regional_stats", string(data)).Error
+}
+
+func (s gormUserStore) Items(userID uint) ([]InventoryItem, error) {
+	var owned []InventoryItem
+	err := s.db.Where("user_id = ?", userID).Find(&owned).Error
+	return owned, err
+}
+
+func (s gormUserStore) UseItem(userID uint, item string) (InventoryItem, error) {
+	var inv InventoryItem
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if inv, err = lockInventoryItem(tx, userID, item); err != nil {
+			return err
+		}
+		if err := useInventoryItem(&inv); err != nil {
+			return err
+		}
+		return tx.Save(&inv).Error
+	})
+	return inv, err
+}
+
+func (s gormUserStore) DailyGoal(userID uint, now time.Time) (UserGoal, DailyProgress, error) {
+	goal := UserGoal{UserID: userID, DailyQuestions: defaultDailyQuestions}
+	if err := s.db.First(&goal, "user_id = ?", userID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return UserGoal{}, DailyProgress{}, err
+	}
+	progress := DailyProgress{UserID: userID, Date: dateKey(now)}
+	if err := s.db.First(&progress, "user_id = ? AND date = ?", userID, progress.Date).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return UserGoal{}, DailyProgress{}, err
+	}
+	return goal, progress, nil
+}
+
+func (s gormUserStore) UpdateDailyGoal(userID uint, dailyQuestions, dailyAccuracy *int) error {
+	var goal UserGoal
+	if err := s.db.Attrs(UserGoal{DailyQuestions: defaultDailyQuestions}).FirstOrCreate(&goal, UserGoal{UserID: userID}).Error; err != nil {
+		return err
+	}
+	setDailyGoal(&goal, dailyQuestions, dailyAccuracy)
+	return s.db.Save(&goal).Error
+}
+
+// --- メモリ上の実装 ---
+
+// データベースを使わないので、--offline-dev などデータベースなしでもすべての機能が動きます。
+type memoryUserStore struct {
+	mu       sync.Mutex
+	users    map[uint]*User
+	byName   map[string]uint
+	stats    map[uint]*UserStat
+	attempts map[uint]map[int]PokemonAttempt
+	scores   map[uint][]AnswerScore
+	items    map[uint]map[string]InventoryItem
+	goals    map[uint]UserGoal
+	progress map[uint]map[string]DailyProgress // ユーザーごとの日付をキーにした進捗
+	nextID   uint
+}
+
+func newMemoryUserStore() *memoryUserStore {
+	return &memoryUserStore{
+		users:    make(map[uint]*User),
+		byName:   make(map[string]uint),
+		stats:    make(map[uint]*UserStat),
+		attempts: make(map[uint]map[int]PokemonAttempt),
+		scores:   make(map[uint][]AnswerScore),
+		items:    make(map[uint]map[string]InventoryItem),
+		goals:    make(map[uint]UserGoal),
+		progress: make(map[uint]map[string]DailyProgress),
+		nextID:   1,
+	}
+}
+
+func (s *memoryUserStore) CreateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byName[user.Username]; ok {
+		return errUsernameTaken
+	}
+	now := time.Now()
+	user.ID = s.nextID
+	user.CreatedAt, user.UpdatedAt = now, now
+	s.nextID++
+	stored := *user
+	s.users[user.ID] = &stored
+	s.byName[user.Username] = user.ID
+	s.stats[user.ID] = &UserStat{Model: gorm.Model{ID: user.ID, CreatedAt: now, UpdatedAt: now}, UserID: user.ID, WrongAnswers: "[]", RegionalStats: "{}", ModeStats: "{}"}
+	return nil
+}
+
+func (s *memoryUserStore) UserByID(id uint) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *memoryUserStore) UserByUsername(username string) (*User, error) {
+	s.mu.Lock()
+	id, ok := s.byName[username]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return s.UserByID(id)
+}
+
+func (s *memoryUserStore) PromoteAdmin(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.byName[username]; ok {
+		s.users[id].IsAdmin = true
+	}
+	return nil
+}
+
+func (s *memoryUserStore) UpdatePassword(userID uint, passwordHash string, changedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return errUserNotFound
+	}
+	user.PasswordHash = passwordHash
+	user.PasswordChangedAt = &changedAt
+	user.TokenVersion++
+	return nil
+}
+
+func (s *memoryUserStore) Stats(userID uint) (*UserStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, ok := s.stats[userID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *stat
+	return &copied, nil
+}
+
+func (s *memoryUserStore) ApplyAnswers(userID uint, answers []statsAnswer) (answerStatsResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := UserStat{UserID: userID, WrongAnswers: "[]", RegionalStats: "{}", ModeStats: "{}"}
+	if existing, ok := s.stats[userID]; ok {
+		stat = *existing
+	}
+	if s.attempts[userID] == nil {
+		s.attempts[userID] = make(map[int]PokemonAttempt)
+	}
+	if s.items[userID] == nil {
+		s.items[userID] = make(map[string]InventoryItem)
+	}
+	if s.progress[userID] == nil {
+		s.progress[userID] = make(map[string]DailyProgress)
+	}
+	var result answerStatsResult
+	for _, a := range answers {
+		if needsStreakShield(&stat, a) {
+			a.StreakShielded = s.consumeStreakShield(userID)
+		}
+		res := applyAnswer(&stat, a)
+		if earnsStreakShield(a, res.Streak) && s.grantStreakShield(userID) {
+			res.Streak.ShieldEarned = true
+		}
+		res.Streak.IsNewBest = res.Streak.IsNewBest || result.Streak.IsNewBest
+		result = res
+
+		attempt := s.attempts[userID][a.PokemonID]
+		attempt.UserID, attempt.PokemonID = userID, a.PokemonID
+		attempt.Attempts++
+		if a.IsCorrect {
+			attempt.Correct++
+		}
+		s.attempts[userID][a.PokemonID] = attempt
+
+		s.scores[userID] = append(s.scores[userID], newAnswerScore(userID, a, res.Score))
+		s.addDailyProgress(userID, a.IsCorrect, time.Now())
+	}
+	stat.UpdatedAt = time.Now()
+	s.stats[userID] = &stat
+	return result, nil
+}
+
+// consumeStreakShield は、構えているシールドがあれば使い切って true を返します。s.mu をロックして呼び出します。
+func (s *memoryUserStore) consumeStreakShield(userID uint) bool {
+	inv := s.items[userID][itemStreakShield]
+	if !inv.Active {
+		return false
+	}
+	inv.Active = false
+	s.items[userID][itemStreakShield] = inv
+	return true
+}
+
+// grantStreakShield は、シールドを1つ獲得させます。上限に達していれば false を返します。s.mu をロックして呼び出します。
+func (s *memoryUserStore) grantStreakShield(userID uint) bool {
+	inv := s.items[userID][itemStreakShield]
+	if inv.Quantity >= maxStreakShieldsInHand {
+		return false
+	}
+	inv.UserID, inv.Item = userID, itemStreakShield
+	inv.Quantity++
+	s.items[userID][itemStreakShield] = inv
+	return true
+}
+
+// addDailyProgress は、回答結果をその日の進捗に加算します。s.mu をロックして呼び出します。
+func (s *memoryUserStore) addDailyProgress(userID uint, isCorrect bool, now time.Time) {
+	today := dateKey(now)
+	progress, ok := s.progress[userID][today]
+	if !ok {
+		progress = DailyProgress{UserID: userID, Date: today}
+	}
+	goal, hasGoal := s.goals[userID]
+	if addDailyProgress(&goal, hasGoal, &progress, isCorrect, now) {
+		s.goals[userID] = goal
+	}
+	s.progress[userID][today] = progress
+}
+
+func (s *memoryUserStore) ApplySkip(userID uint) (answerStreak, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat := UserStat{UserID: userID, WrongAnswers: "[]", RegionalStats: "{}", ModeStats: "{}"}
+	if existing, ok := s.stats[userID]; ok {
+		stat = *existing
+	}
+	streak := applySkip(&stat)
+	stat.UpdatedAt = time.Now()
+	s.stats[userID] = &stat
+	return streak, nil
+}
+
+func (s *memoryUserStore) PokemonAttempts(userID uint) (map[int]PokemonAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts := make(map[int]PokemonAttempt, len(s.attempts[userID]))
+	for id, a := range s.attempts[userID] {
+		attempts[id] = a
+	}
+	return attempts, nil
+}
+
+func (s *memoryUserStore) PokemonAttemptTotals() ([]pokemonAttemptTotal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byID := make(map[int]*pokemonAttemptTotal)
+	for _, attempts := range s.attempts {
+		for id, a := range attempts {
+			t, ok := byID[id]
+			if !ok {
+				t = &pokemonAttemptTotal{PokemonID: id}
+				byID[id] = t
+			}
+			t.Players++
+			t.Attempts += a.Attempts
+			t.Correct += a.Correct
+		}
+	}
+	totals := make([]pokemonAttemptTotal, 0, len(byID))
+	for _, t := range byID {
+		totals = append(totals, *t)
+	}
+	return totals, nil
+}
+
+func (s *memoryUserStore) GlobalTotals() (statTotals, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var totals statTotals
+	for _, stat := range s.stats {
+		totals.Players++
+		totals.Questions += int64(stat.TotalQuestions)
+		totals.Correct += int64(stat.TotalCorrect)
+	}
+	return totals, nil
+}
+
+func (s *memoryUserStore) WrongAnswerLists() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lists := make([]string, 0)
+	for _, stat := range s.stats {
+		if w := strings.TrimSpace(stat.WrongAnswers); w != "" && w != "[]" {
+			lists = append(lists, w)
+		}
+	}
+	return lists, nil
+}
+
+func (s *memoryUserStore) StatUserIDs() ([]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]uint, 0, len(s.stats))
+	for id := range s.stats {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *memoryUserStore) SetRegionalStats(userID uint, regionalStats map[string]RegionalStatDetail) error {
+	data, err := json.Marshal(regionalStats)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stat, ok := s.stats[userID]; ok {
+		stat.RegionalStats = string(data)
+	}
+	return nil
+}
+
+func (s *memoryUserStore) Items(userID uint) ([]InventoryItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owned := make([]InventoryItem, 0, len(s.items[userID]))
+	for _, inv := range s.items[userID] {
+		owned = append(owned, inv)
+	}
+	return owned, nil
+}
+
+func (s *memoryUserStore) UseItem(userID uint, item string) (InventoryItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.items[userID][item]
+	if !ok {
+		inv = InventoryItem{UserID: userID, Item: item}
+	}
+	if err := useInventoryItem(&inv); err != nil {
+		return inv, err
+	}
+	if s.items[userID] == nil {
+		s.items[userID] = make(map[string]InventoryItem)
+	}
+	s.items[userID][item] = inv
+	return inv, nil
+}
+
+func (s *memoryUserStore) DailyGoal(userID uint, now time.Time) (UserGoal, DailyProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	goal, ok := s.goals[userID]
+	if !ok {
+		goal = UserGoal{UserID: userID, DailyQuestions: defaultDailyQuestions}
+	}
+	date := dateKey(now)
+	progress, ok := s.progress[userID][date]
+	if !ok {
+		progress = DailyProgress{UserID: userID, Date: date}
+	}
+	return goal, progress, nil
+}
+
+func (s *memoryUserStore) UpdateDailyGoal(userID uint, dailyQuestions, dailyAccuracy *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	goal, ok := s.goals[userID]
+	if !ok {
+		goal = UserGoal{UserID: userID, DailyQuestions: defaultDailyQuestions}
+	}
+	setDailyGoal(&goal, dailyQuestions, dailyAccuracy)
+	s.goals[userID] = goal
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- サバイバルモード ---
+
+// ライフが尽きるまで問題を解き続けるセッションです。残りライフはサーバーが管理し、
+// ライフがなくなった時点でセッションを終了して、何問続いたかを記録に残します。
+
+const (
+	sessionTypeStandard = "standard"
+	sessionTypeSurvival = "survival"
+
+	defaultSurvivalLives = 3
+	maxSurvivalLives     = 10
+)
+
+// --- データベースモデル ---
+
+// サバイバルモードの1回分の記録
+type SurvivalRun struct {
+	gorm.Model
+	SessionID string    `gorm:"uniqueIndex;not null" json:"sessionId"`
+	UserID    uint      `gorm:"index" json:"userId"` // ログインしていない場合は0
+	Region    string    `json:"region"`
+	Mode      string    `json:"mode"`
+	Lives     int       `json:"lives"`    // 開始時のライフ
+	Length    int       `json:"length"`   // 正解した問題数
+	Answered  int       `json:"answered"` // 回答した問題数
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+}
+
+// recordSurvivalRun は、終了したサバイバルセッションの記録を保存します。既に保存していれば何もしません。
+// 呼び出し側で session.mu をロックしておく必要があります。
+func recordSurvivalRun(s *quizSession) {
+	if s.Type != sessionTypeSurvival || s.runRecorded {
+		return
+	}
+	run := SurvivalRun{
+		SessionID: s.ID,
+		UserID:    s.UserID,
+		Region:    s.Region,
+		Mode:      s.Mode,
+		Lives:     s.MaxLives,
+		Length:    s.Correct,
+		Answered:  s.Answered,
+		StartedAt: s.CreatedAt,
+		EndedAt:   time.Now(),
+	}
+	if err := db.Create(&run).Error; err != nil {
+		log.Printf("Failed to record survival run for session %s: %v", s.ID, err)
+		return
+	}
+	s.runRecorded = true
+}
+
+// --- サバイバルモードのハンドラ ---
+
+// handleGetSessionResult は、終了したサバイバルセッションの記録を返します。
+func handleGetSessionResult(c *gin.Context) {
+	var run SurvivalRun
+	err := db.First(&run, "session_id = ?", c.Param("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No result has been recorded for this session"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load result"})
+		return
+	}
+
+	// 自分の過去の記録と比べて自己ベストかどうかを返す
+	best := false
+	if run.UserID != 0 {
+		var longer int64
+		db.Model(&SurvivalRun{}).Where("user_id = ? AND length > ?", run.UserID, run.Length).Count(&longer)
+		best = longer == 0
+	}
+	c.JSON(http.StatusOK, gin.H{"run": run, "personalBest": best})
+}
+
+// handleGetMySurvivalRuns は、ログインユーザーのサバイバルモードの記録を新しい順に返します。
+func handleGetMySurvivalRuns(c *gin.Context) {
+	var runs []SurvivalRun
+	if err := db.Where("user_id = ?", c.MustGet("userID").(uint)).Order("ended_at desc").Limit(50).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load survival runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
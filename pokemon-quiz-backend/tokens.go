@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"pokemon-quiz-backend/auth"
+)
+
+// --- ログイントークンの有効期限 ---
+
+// ログイントークンの有効期限は TOKEN_DURATION（"30m" や "720h" の形式、既定は15分）で変えられます。
+// 切れたらリフレッシュトークンで取り直すので（refresh_tokens.go）、盗まれたときに使われてしまう期間を短くできます。
+// TOKEN_SLIDING=true にすると、有効期限の半分を過ぎたトークンで認証したときに新しいトークンを
+// X-Refreshed-Token ヘッダーで返し、使い続けている間はログインが切れないようにします（スライディング有効期限）。
+// ただし、最初にログインしてから TOKEN_MAX_LIFETIME（既定は30日）を過ぎると延長しません。
+
+const (
+	defaultTokenDuration    = 15 * time.Minute
+	defaultTokenMaxLifetime = 30 * 24 * time.Hour
+	refreshedTokenHeader    = "X-Refreshed-Token"
+)
+
+var (
+	tokenDuration    = defaultTokenDuration
+	tokenMaxLifetime = defaultTokenMaxLifetime
+	tokenSliding     = false
+)
+
+// envDuration は、環境変数を時間（"30m" など）として読み取ります。未設定や不正な値の場合は fallback を返します。
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// loadTokenSettings は、ログイントークンの有効期限の設定を環境変数から読み込みます。
+func loadTokenSettings() {
+	tokenDuration = envDuration("TOKEN_DURATION", defaultTokenDuration)
+	tokenMaxLifetime = envDuration("TOKEN_MAX_LIFETIME", defaultTokenMaxLifetime)
+	tokenSliding = os.Getenv("TOKEN_SLIDING") == "true"
+	refreshTokenDuration = envDuration("REFRESH_TOKEN_DURATION", defaultRefreshTokenDuration)
+}
+
+// ログイントークンの発行と検証（main で JWT_SECRET_KEY と TOKEN_DURATION から作り直す）
+var loginTokens = auth.NewTokens(jwtKey, defaultTokenDuration)
+
+// issueLoginToken は、ログイントークンを発行します。version にはユーザーの今のトークンの版（User.TokenVersion）を、
+// loggedInAt には最初にログインした時刻を渡します。
+func issueLoginToken(userID uint, version int, loggedInAt, now time.Time) (string, time.Time, error) {
+	return loginTokens.Issue(userID, version, loggedInAt, now)
+}
+
+// refreshLoginToken は、スライディング有効期限が有効で、トークンの有効期限が半分を過ぎていれば、
+// 延長したトークンを X-Refreshed-Token ヘッダーで返します。
+func refreshLoginToken(c *gin.Context, userID uint, claims *auth.Claims) {
+	if !tokenSliding || claims.ExpiresAt == nil {
+		return
+	}
+	now := time.Now()
+	if claims.ExpiresAt.Sub(now) > loginTokens.Duration()/2 {
+		return
+	}
+	// IssuedAt がない（この仕組みより前に発行された）トークンは、今ログインしたものとして扱う
+	loggedInAt := now
+	if claims.IssuedAt != nil {
+		loggedInAt = claims.IssuedAt.Time
+	}
+	if now.Sub(loggedInAt) > tokenMaxLifetime {
+		return
+	}
+	tokenString, _, err := issueLoginToken(userID, claims.Version, loggedInAt, now)
+	if err != nil {
+		log.Printf("Failed to refresh token for user %d: %v", userID, err)
+		return
+	}
+	c.Header(refreshedTokenHeader, tokenString)
+}
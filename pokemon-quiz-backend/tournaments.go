@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- トーナメント ---
+
+// トーナメントの状態
+const (
+	tournamentStatusOpen     = "open"     // 参加受付中（対戦も可能）
+	tournamentStatusFinished = "finished" // 終了（順位確定）
+)
+
+// 勝敗ごとの勝ち点
+const (
+	tournamentWinPoints  = 3
+	tournamentDrawPoints = 1
+)
+
+// --- データベースモデル ---
+
+// コミュニティイベントなどで開催するトーナメント
+type Tournament struct {
+	gorm.Model
+	Name       string `gorm:"not null"`
+	HostUserID uint   `gorm:"index;not null"`
+	Mode       string `gorm:"not null"` // 対戦の種類
+	Region     string `gorm:"not null"`
+	Rounds     int    `gorm:"not null"`
+	Status     string `gorm:"not null;default:'open'"`
+}
+
+// トーナメントの参加者と成績
+type TournamentEntry struct {
+	gorm.Model
+	TournamentID uint   `gorm:"uniqueIndex:idx_tournament_user;not null" json:"-"`
+	UserID       uint   `gorm:"uniqueIndex:idx_tournament_user;not null" json:"userId"`
+	Username     string `json:"username"`
+	Points       int    `json:"points"` // 勝ち点
+	Played       int    `json:"played"`
+	Wins         int    `json:"wins"`
+	Draws        int    `json:"draws"`
+	Losses       int    `json:"losses"`
+	ScoreFor     int    `json:"scoreFor"` // 対戦で獲得した得点の合計
+}
+
+// tournamentTopic は、トーナメントの更新を配信するイベントバスのトピック名を返します。
+func tournamentTopic(id uint) string {
+	return fmt.Sprintf("tournament:%d", id)
+}
+
+// loadTournamentStandings は、トーナメントの順位表を勝ち点・勝利数・得点の順で返します。
+func loadTournamentStandings(tx *gorm.DB, tournamentID uint) ([]TournamentEntry, error) {
+	var entries []TournamentEntry
+	err := tx.Where("tournament_id = ?", tournamentID).
+		Order("points desc, wins desc, score_for desc, id asc").
+		Find(&entries).Error
+	return entries, err
+}
+
+// tournamentState は、観戦画面に送るトーナメントの状態を組み立てます。
+func tournamentState(t *Tournament, standings []TournamentEntry) gin.H {
+	return gin.H{
+		"id":        t.ID,
+		"name":      t.Name,
+		"mode":      t.Mode,
+		"region":    t.Region,
+		"rounds":    t.Rounds,
+		"status":    t.Status,
+		"standings": standings,
+	}
+}
+
+// recordTournamentResult は、トーナメントの対戦結果を順位表に反映し、観戦者へ配信します。
+func recordTournamentResult(r *matchRoom) {
+	topScore, winners := -1, 0
+	for _, p := range r.Players {
+		if p.Score > topScore {
+			topScore, winners = p.Score, 1
+		} else if p.Score == topScore {
+			winners++
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range r.Players {
+			var entry TournamentEntry
+			if err := tx.First(&entry, "tournament_id = ? AND user_id = ?", r.TournamentID, p.UserID).Error; err != nil {
+				return err
+			}
+			entry.Played++
+			entry.ScoreFor += p.Score
+			switch {
+			case p.Score == topScore && winners == 1:
+				entry.Wins++
+				entry.Points += tournamentWinPoints
+			case p.Score == topScore:
+				entry.Draws++
+				entry.Points += tournamentDrawPoints
+			default:
+				entry.Losses++
+			}
+			if err := tx.Save(&entry).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to record tournament result for match %s: %v", r.ID, err)
+		return
+	}
+
+	publishTournamentStandings(r.TournamentID)
+	events.Publish(tournamentTopic(r.TournamentID), "match", gin.H{
+		"matchId": r.ID,
+		"players": r.Players,
+	})
+}
+
+// publishTournamentStandings は、最新の順位表をトーナメントの購読者に配信します。
+func publishTournamentStandings(tournamentID uint) {
+	var tournament Tournament
+	if err := db.First(&tournament, tournamentID).Error; err != nil {
+		return
+	}
+	standings, err := loadTournamentStandings(db, tournamentID)
+	if err != nil {
+		log.Printf("Failed to load standings for tournament %d: %v", tournamentID, err)
+		return
+	}
+	events.Publish(tournamentTopic(tournamentID), "standings", tournamentState(&tournament, standings))
+}
+
+// isTournamentEntrant は、ユーザーがトーナメントの参加者かどうかを返します。
+func isTournamentEntrant(tournamentID, userID uint) bool {
+	var count int64
+	db.Model(&TournamentEntry{}).Where("tournament_id = ? AND user_id = ?", tournamentID, userID).Count(&count)
+	return count > 0
+}
+
+// findTournament は、URLパラメータのIDからトーナメントを取得します。見つからなければエラーレスポンスを返します。
+func findTournament(c *gin.Context) (*Tournament, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tournament ID"})
+		return nil, false
+	}
+	var tournament Tournament
+	if err := db.First(&tournament, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tournament not found"})
+		return nil, false
+	}
+	return &tournament, true
+}
+
+// --- トーナメントのハンドラ ---
+
+// handleCreateTournament は、ログインユーザーを主催者として新しいトーナメントを作成します。
+func handleCreateTournament(c *gin.Context) {
+	var req struct {
+		Name   string `json:"name" binding:"required"`
+		Mode   string `json:"mode"`
+		Region string `json:"region"`
+		Rounds int    `json:"rounds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tournament name is required"})
+		return
+	}
+	if rejectBlockedName(c, "tournament name", req.Name) {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = matchModeQuiz
+	}
+	if req.Mode != matchModeTopTrumps && req.Mode != matchModeQuiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid match mode specified"})
+		return
+	}
+	if req.Region == "" {
+		req.Region = "all"
+	}
+	if len(regionRotation(req.Region)) < 4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or empty region specified"})
+		return
+	}
+	if req.Rounds == 0 {
+		req.Rounds = defaultMatchRounds
+	}
+	if req.Rounds < 1 || req.Rounds > maxMatchRounds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rounds must be between 1 and 20"})
+		return
+	}
+
+	tournament := Tournament{
+		Name:       req.Name,
+		HostUserID: c.MustGet("userID").(uint),
+		Mode:       req.Mode,
+		Region:     req.Region,
+		Rounds:     req.Rounds,
+		Status:     tournamentStatusOpen,
+	}
+	if err := db.Create(&tournament).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tournament"})
+		return
+	}
+	c.JSON(http.StatusCreated, tournamentState(&tournament, []TournamentEntry{}))
+}
+
+// handleJoinTournament は、ログインユーザーをトーナメントの参加者に登録します。
+func handleJoinTournament(c *gin.Context) {
+	tournament, ok := findTournament(c)
+	if !ok {
+		return
+	}
+	if tournament.Status != tournamentStatusOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tournament has already finished"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	user, err := users.UserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	entry := TournamentEntry{TournamentID: tournament.ID, UserID: user.ID, Username: user.Username}
+	if err := db.FirstOrCreate(&entry, TournamentEntry{TournamentID: tournament.ID, UserID: user.ID}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join tournament"})
+		return
+	}
+
+	publishTournamentStandings(tournament.ID)
+	c.JSON(http.StatusOK, entry)
+}
+
+// handleGetTournament は、トーナメントの現在の順位表を返します。
+func handleGetTournament(c *gin.Context) {
+	tournament, ok := findTournament(c)
+	if !ok {
+		return
+	}
+	standings, err := loadTournamentStandings(db, tournament.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load standings"})
+		return
+	}
+	c.JSON(http.StatusOK, tournamentState(tournament, standings))
+}
+
+// handleTournamentStream は、トーナメントの順位表の更新をServer-Sent Eventsで配信します。
+// 大型スクリーンでの観戦用のため、認証は不要です。
+func handleTournamentStream(c *gin.Context) {
+	tournament, ok := findTournament(c)
+	if !ok {
+		return
+	}
+	standings, err := loadTournamentStandings(db, tournament.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load standings"})
+		return
+	}
+	streamEvents(c, tournamentTopic(tournament.ID), &busEvent{Type: "standings", Data: tournamentState(tournament, standings)})
+}
+
+// handleFinishTournament は、主催者がトーナメントを終了して順位を確定します。
+func handleFinishTournament(c *gin.Context) {
+	tournament, ok := findTournament(c)
+	if !ok {
+		return
+	}
+	if tournament.HostUserID != c.MustGet("userID").(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the host can finish the tournament"})
+		return
+	}
+
+	tournament.Status = tournamentStatusFinished
+	if err := db.Save(tournament).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finish tournament"})
+		return
+	}
+
+	publishTournamentStandings(tournament.ID)
+	standings, _ := loadTournamentStandings(db, tournament.ID)
+	c.JSON(http.StatusOK, tournamentState(tournament, standings))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- タイプの色とアイコン ---
+
+// Webのフロントエンド・Discordのボット・共有画像など複数のクライアントでタイプを同じ見た目で表示できるよう、
+// タイプごとの色（16進数のカラーコード）とアイコン画像のURLをサーバーから配信します。
+// 問題やポケモンのデータのタイプは日本語名なので、GET /types/:name には日本語名でも英語名でも指定できます。
+// アイコンは PokeAPI のスプライトを使います。自前で配信する場合は TYPE_ICON_BASE_URL に
+// "<ベースURL>/<タイプのID>.png" で取得できる場所を指定してください。
+
+const defaultTypeIconBaseURL = "https://raw.githubusercontent.com/PokeAPI/sprites/master/sprites/types/generation-viii/sword-shield"
+
+// タイプの表示用の情報
+type typeInfo struct {
+	ID      int    `json:"id"`      // PokeAPI のタイプのID
+	Name    string `json:"name"`    // 日本語名（問題やポケモンのデータと同じ表記）
+	English string `json:"english"` // 英語名（小文字）
+	Color   string `json:"color"`   // "#RRGGBB"
+	IconURL string `json:"iconUrl"`
+}
+
+// タイプの一覧（PokeAPI のIDの順）
+var typeInfos = []typeInfo{
+	{ID: 1, Name: "ノーマル", English: "normal", Color: "#A8A77A"},
+	{ID: 2, Name: "かくとう", English: "fighting", Color: "#C22E28"},
+	{ID: 3, Name: "ひこう", English: "flying", Color: "#A98FF3"},
+	{ID: 4, Name: "どく", English: "poison", Color: "#A33EA1"},
+	{ID: 5, Name: "じめん", English: "ground", Color: "#E2BF65"},
+	{ID: 6, Name: "いわ", English: "rock", Color: "#B6A136"},
+	{ID: 7, Name: "むし", English: "bug", Color: "#A6B91A"},
+	{ID: 8, Name: "ゴースト", English: "ghost", Color: "#735797"},
+	{ID: 9, Name: "はがね", English: "steel", Color: "#B7B7CE"},
+	{ID: 10, Name: "ほのお", English: "fire", Color: "#EE8130"},
+	{ID: 11, Name: "みず", English: "water", Color: "#6390F0"},
+	{ID: 12, Name: "くさ", English: "grass", Color: "#7AC74C"},
+	{ID: 13, Name: "でんき", English: "electric", Color: "#F7D02C"},
+	{ID: 14, Name: "エスパー", English: "psychic", Color: "#F95587"},
+	{ID: 15, Name: "こおり", English: "ice", Color: "#96D9D6"},
+	{ID: 16, Name: "ドラゴン", English: "dragon", Color: "#6F35FC"},
+	{ID: 17, Name: "あく", English: "dark", Color: "#705746"},
+	{ID: 18, Name: "フェアリー", English: "fairy", Color: "#D685AD"},
+}
+
+// typeIconBaseURL は、タイプのアイコン画像のベースURLを返します。
+func typeIconBaseURL() string {
+	if base := os.Getenv("TYPE_ICON_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return defaultTypeIconBaseURL
+}
+
+// typeInfoWithIcon は、アイコン画像のURLを埋めたタイプの情報を返します。
+func typeInfoWithIcon(t typeInfo) typeInfo {
+	t.IconURL = typeIconBaseURL() + "/" + strconv.Itoa(t.ID) + ".png"
+	return t
+}
+
+// lookupTypeInfo は、日本語名・英語名（大文字小文字は区別しない）からタイプの情報を返します。
+func lookupTypeInfo(name string) (typeInfo, bool) {
+	for _, t := range typeInfos {
+		if t.Name == name || strings.EqualFold(t.English, name) {
+			return typeInfoWithIcon(t), true
+		}
+	}
+	return typeInfo{}, false
+}
+
+// --- タイプのハンドラ ---
+
+// handleListTypes は、全てのタイプの色とアイコンを返します。
+func handleListTypes(c *gin.Context) {
+	types := make([]typeInfo, len(typeInfos))
+	for i, t := range typeInfos {
+		types[i] = typeInfoWithIcon(t)
+	}
+	// 色やアイコンはめったに変わらないので、クライアントにキャッシュしてもらう
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, gin.H{"types": types})
+}
+
+// handleGetType は、1つのタイプの色とアイコンを返します。
+func handleGetType(c *gin.Context) {
+	t, ok := lookupTypeInfo(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Type not found"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, t)
+}
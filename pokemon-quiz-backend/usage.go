@@ -0,0 +1,173 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- APIの利用状況 ---
+
+// ユーザーごとに日別・エンドポイント別のリクエスト数を記録します。
+// 外部連携の利用量の確認や、暴走しているクライアントの発見に使います。
+// リクエストのたびにデータベースへ書き込まないよう、件数はメモリで数えて usageFlushInterval ごとにまとめて書き込みます。
+// 終了するときは、まだ書き込んでいない件数を書き込んでから止めます（shutdown.go）。
+
+const (
+	defaultUsageDays   = 7
+	maxUsageDays       = 90
+	usageFlushInterval = 10 * time.Second
+)
+
+// まだ書き込んでいないリクエスト数のキー
+type usageKey struct {
+	userID   uint
+	date     string
+	endpoint string
+}
+
+var (
+	pendingUsage   = make(map[usageKey]int)
+	pendingUsageMu sync.Mutex
+)
+
+// --- データベースモデル ---
+
+// ユーザーの1日・1エンドポイントあたりのリクエスト数
+type APIUsage struct {
+	gorm.Model
+	UserID   uint   `gorm:"uniqueIndex:idx_api_usage;not null"`
+	Date     string `gorm:"uniqueIndex:idx_api_usage;not null"` // YYYY-MM-DD（日本時間）
+	Endpoint string `gorm:"uniqueIndex:idx_api_usage;not null"` // "GET /quiz" の形式
+	Count    int    `gorm:"default:0"`
+}
+
+// usageMiddleware は、ログインユーザーのリクエストを利用状況として記録します。
+// 存在しないパスへのリクエストは記録しません。
+func usageMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.FullPath() == "" {
+			return
+		}
+		userID, ok := optionalUserID(c)
+		if !ok {
+			return
+		}
+		countUsage(userID, c.Request.Method+" "+c.FullPath(), time.Now())
+	}
+}
+
+// countUsage は、その日のエンドポイントのリクエスト数を1件数えます（書き込みは flushUsage で行う）。
+func countUsage(userID uint, endpoint string, now time.Time) {
+	pendingUsageMu.Lock()
+	pendingUsage[usageKey{userID: userID, date: dateKey(now), endpoint: endpoint}]++
+	pendingUsageMu.Unlock()
+}
+
+// startUsageFlusher は、数えたリクエスト数を定期的に書き込むジョブを開始します。
+func startUsageFlusher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushUsage()
+		}
+	}()
+}
+
+// flushUsage は、数えたリクエスト数をまとめて書き込みます。書き込めなかった分は次回に持ち越します。
+func flushUsage() {
+	pendingUsageMu.Lock()
+	counts := pendingUsage
+	pendingUsage = make(map[usageKey]int)
+	pendingUsageMu.Unlock()
+
+	for k, n := range counts {
+		if err := recordUsage(db, k, n); err != nil {
+			log.Printf("Failed to record API usage for user %d: %v", k.userID, err)
+			pendingUsageMu.Lock()
+			pendingUsage[k] += n
+			pendingUsageMu.Unlock()
+		}
+	}
+}
+
+// recordUsage は、その日のエンドポイントのリクエスト数に n 件加算します。
+func recordUsage(tx *gorm.DB, k usageKey, n int) error {
+	usage := APIUsage{UserID: k.userID, Date: k.date, Endpoint: k.endpoint}
+	if err := tx.FirstOrCreate(&usage, usage).Error; err != nil {
+		return err
+	}
+	return tx.Model(&usage).UpdateColumn("count", gorm.Expr("count + ?", n)).Error
+}
+
+// handleGetMyUsage は、ログインユーザーの直近の日別リクエスト数を返します。
+func handleGetMyUsage(c *gin.Context) {
+	days := defaultUsageDays
+	if q := c.Query("days"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n < 1 || n > maxUsageDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 90"})
+			return
+		}
+		days = n
+	}
+
+	userID := c.MustGet("userID").(uint)
+	now := time.Now()
+	since := dateKey(now.AddDate(0, 0, -(days - 1)))
+	var rows []APIUsage
+	if err := db.Where("user_id = ? AND date >= ?", userID, since).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load usage"})
+		return
+	}
+
+	// 日付ごとに集計する（リクエストのなかった日も0件として返す）
+	type dayUsage struct {
+		Date      string         `json:"date"`
+		Total     int            `json:"total"`
+		Endpoints map[string]int `json:"endpoints"`
+	}
+	byDate := make(map[string]*dayUsage)
+	for i := 0; i < days; i++ {
+		date := dateKey(now.AddDate(0, 0, -i))
+		byDate[date] = &dayUsage{Date: date, Endpoints: map[string]int{}}
+	}
+	// まだ書き込んでいない分も含める
+	pendingUsageMu.Lock()
+	for k, n := range pendingUsage {
+		if k.userID == userID && k.date >= since {
+			rows = append(rows, APIUsage{Date: k.date, Endpoint: k.endpoint, Count: n})
+		}
+	}
+	pendingUsageMu.Unlock()
+	total := 0
+	for _, row := range rows {
+		day, ok := byDate[row.Date]
+		if !ok {
+			continue
+		}
+		day.Total += row.Count
+		day.Endpoints[row.Endpoint] += row.Count
+		total += row.Count
+	}
+	result := make([]*dayUsage, 0, len(byDate))
+	for _, day := range byDate {
+		result = append(result, day)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date > result[j].Date })
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":  result,
+		"total": total,
+		"today": byDate[dateKey(now)].Total,
+	})
+}
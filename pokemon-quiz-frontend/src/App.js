@@ -34,9 +34,71 @@ ChartJS.register(
 // バックエンドAPIのURL
 const API_URL = process.env.REACT_APP_API_URL;
 
+// 公式クライアントの証明（バックエンドの attestation.go を参照）
+// ビルド時に REACT_APP_ATTESTATION_CLIENT と REACT_APP_ATTESTATION_KEY を設定すると、
+// リクエストに X-Client-Attestation ヘッダーを付けます。鍵はバックエンドの CLIENT_ATTESTATION_KEYS と同じものにします。
+// 未設定のビルドから回答すると、公式でないクライアントからの回答として記録されます。
+const ATTESTATION_CLIENT = process.env.REACT_APP_ATTESTATION_CLIENT;
+const ATTESTATION_KEY = process.env.REACT_APP_ATTESTATION_KEY;
+
+let attestationKey = null;
+const importAttestationKey = () => {
+  if (!attestationKey) {
+    attestationKey = window.crypto.subtle.importKey(
+      'raw',
+      new TextEncoder().encode(ATTESTATION_KEY),
+      { name: 'HMAC', hash: 'SHA-256' },
+      false,
+      ['sign'],
+    );
+  }
+  return attestationKey;
+};
+
+// "<クライアント名>:<UNIX時刻(秒)>:<メソッド> <パス>" の HMAC-SHA256 を付けたヘッダーの値を作る
+// （パスにクエリは含めない。WebCrypto が使えない環境では null を返し、ヘッダーを付けない）
+const attestationHeader = async (method, path) => {
+  if (!ATTESTATION_CLIENT || !ATTESTATION_KEY || !window.crypto?.subtle) {
+    return null;
+  }
+  const timestamp = Math.floor(Date.now() / 1000).toString();
+  const message = `${ATTESTATION_CLIENT}:${timestamp}:${method.toUpperCase()} ${path}`;
+  const signature = await window.crypto.subtle.sign('HMAC', await importAttestationKey(), new TextEncoder().encode(message));
+  const hex = Array.from(new Uint8Array(signature), b => b.toString(16).padStart(2, '0')).join('');
+  return `${ATTESTATION_CLIENT}:${timestamp}:${hex}`;
+};
+
 // 認証コンテキスト
 const AuthContext = createContext(null);
 
+// ログインやリフレッシュで受け取ったトークンを保存する
+const saveTokens = (data) => {
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('tokenExpiresAt', data.expiresAt);
+  localStorage.setItem('refreshToken', data.refreshToken);
+};
+
+const clearTokens = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('tokenExpiresAt');
+  localStorage.removeItem('refreshToken');
+};
+
+// 同時に複数のリクエストでトークンが切れても、リフレッシュトークンの交換は1回だけにする
+// （交換したリフレッシュトークンはもう使えないため）
+let refreshing = null;
+const refreshLoginToken = (refreshToken) => {
+  if (!refreshing) {
+    refreshing = axios.post(`${API_URL}/refresh`, { refreshToken })
+      .then(res => {
+        saveTokens(res.data);
+        return res.data.token;
+      })
+      .finally(() => { refreshing = null; });
+  }
+  return refreshing;
+};
+
 function App() {
   const [auth, setAuth] = useState({ token: localStorage.getItem('token'), user: null, isLoading: true });
 
@@ -44,12 +106,48 @@ function App() {
     const instance = axios.create({
       baseURL: API_URL,
     });
-    instance.interceptors.request.use(config => {
-      if (auth.token) {
-        config.headers.Authorization = `Bearer ${auth.token}`;
+    instance.interceptors.request.use(async config => {
+      let token = auth.token;
+      // /answer などログインしていなくても使えるAPIは、トークンが切れていると成績に反映されないので、切れる前に取り直す
+      const refreshToken = localStorage.getItem('refreshToken');
+      const expiresAt = Date.parse(localStorage.getItem('tokenExpiresAt'));
+      if (token && refreshToken && expiresAt - Date.now() < 30 * 1000) {
+        try {
+          token = await refreshLoginToken(refreshToken);
+          setAuth(prev => ({ ...prev, token }));
+        } catch {
+          // 取り直せなければそのまま送り、401 なら下でログアウトする
+        }
+      }
+      if (token) {
+        config.headers.Authorization = `Bearer ${token}`;
+      }
+      const path = new URL(instance.getUri(config), window.location.href).pathname;
+      const attestation = await attestationHeader(config.method || 'get', path);
+      if (attestation) {
+        config.headers['X-Client-Attestation'] = attestation;
       }
       return config;
     });
+    // ログイントークンが切れていたら、リフレッシュトークンで取り直してから1回だけ送り直す
+    instance.interceptors.response.use(undefined, async (error) => {
+      const config = error.config;
+      const refreshToken = localStorage.getItem('refreshToken');
+      if (error.response?.status !== 401 || !config || config._retried || !refreshToken) {
+        return Promise.reject(error);
+      }
+      config._retried = true;
+      try {
+        const token = await refreshLoginToken(refreshToken);
+        config.headers.Authorization = `Bearer ${token}`;
+        setAuth(prev => ({ ...prev, token }));
+        return instance(config);
+      } catch {
+        clearTokens();
+        setAuth({ token: null, user: null, isLoading: false });
+        return Promise.reject(error);
+      }
+    });
     return instance;
   }, [auth.token]);
 
@@ -61,7 +159,7 @@ function App() {
           setAuth(prev => ({ ...prev, user: res.data, isLoading: false }));
         } catch {
           // トークンが無効な場合
-          localStorage.removeItem('token');
+          clearTokens();
           setAuth({ token: null, user: null, isLoading: false });
         }
       } else {
@@ -73,7 +171,7 @@ function App() {
 
   const login = async (username, password) => {
     const res = await axios.post(`${API_URL}/login`, { username, password });
-    localStorage.setItem('token', res.data.token);
+    saveTokens(res.data);
     setAuth(prev => ({ ...prev, token: res.data.token }));
   };
 
@@ -82,7 +180,7 @@ function App() {
   };
 
   const logout = () => {
-    localStorage.removeItem('token');
+    clearTokens();
     setAuth({ token: null, user: null, isLoading: false });
   };
 
@@ -160,8 +258,11 @@ function QuizPage() {
 
     try {
       const response = await api.post(`/answer`, {
-        id: quiz.id,
+        questionToken: quiz.questionToken,
         name: selectedName,
+      }, {
+        // 送り直しても成績が2回数えられないよう、問題ごとに同じキーを送る
+        headers: { 'Idempotency-Key': quiz.questionId },
       });
       setResult(response.data); // 結果をStateに保存
 
@@ -268,7 +369,7 @@ function QuizPage() {
                 <p className="result-correct">🎉 正解！ 🎉</p>
               ) : (
                 <p className="result-incorrect">
-                  残念！ 正解は...
+                  {result.timedOut ? '時間切れ！ 正解は...' : '残念！ 正解は...'}
                 </p>
               )}
               <h3>{result.correctPokemon.name}</h3>
@@ -322,8 +423,9 @@ function HintDisplay({ quiz, difficulty }) {
       return hints; // かんたんモードでは全てのヒントを表示
     }
     // ふつうモードではランダムに1つ
-    return [hints[quiz.id % hints.length]]; // ポケモンIDに基づいて決定的に選択
-  }, [quiz.id, quiz.height, quiz.weight, difficulty]);
+    // 問題にはポケモンIDが含まれないので、questionId に基づいて決定的に選択
+    return [hints[parseInt(quiz.questionId.slice(0, 8), 16) % hints.length]];
+  }, [quiz.questionId, quiz.height, quiz.weight, difficulty]);
 
   if (difficulty === 'hard') {
     return null; // むずかしいモードではヒントなし